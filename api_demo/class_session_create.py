@@ -0,0 +1,31 @@
+#!/usr/bin/python3
+
+from http_request import HTTPRequest
+from http_request import HTTPMethod
+import sys
+import time
+from host_url import host_url_maker
+        
+# get host url
+host = host_url_maker(sys.argv)
+
+# url + method (course records of all enrolled students are created with the session)
+api_url = "{}/api/0/workflow/teacher/session/create".format(host)
+method = HTTPMethod.POST
+params = {
+    "course_pid": "102030405060708090000001",
+    "target_tag": "c1",
+    "start_ts": int(time.time()) - 3600,
+    "end_ts": int(time.time()),
+    "attendances": [
+        {
+            "student_pid": "102030405060708090000001",
+            "attendance": "present"
+        }
+    ]
+}
+
+print("[create class session: course ({})]".format(params["course_pid"]))
+http_req = HTTPRequest(api_url, method, params)
+http_req.send()
+http_req.print_resp()
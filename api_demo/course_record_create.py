@@ -23,6 +23,10 @@ course_record_params = [
         "target_tag": "c1",
         "record_ts": int(time.time()),
         "is_makeup": False,
+        "targets": [
+            {"tag": "c1", "score": 3, "note": "steady progress"},
+            {"tag": "c2", "score": 2, "note": ""}
+        ],
     },
     {
         "pid": "102030405060708090000002",
@@ -39,6 +43,10 @@ course_record_params = [
         "target_tag": "c1",
         "record_ts": int(time.time()),
         "is_makeup": False,
+        "targets": [
+            {"tag": "c1", "score": 3, "note": "steady progress"},
+            {"tag": "c2", "score": 2, "note": ""}
+        ],
     },
     {
         "pid": "102030405060708090000004",
@@ -0,0 +1,47 @@
+#!/usr/bin/python3
+
+from http_request import HTTPRequest
+from http_request import HTTPMethod
+import sys
+from host_url import host_url_maker
+        
+# get host url
+host = host_url_maker(sys.argv)
+
+# url + method
+api_url = "{}/api/0/config/course_schedule".format(host)
+method = HTTPMethod.POST
+course_schedule_params = [
+    {
+        "course_pid": "102030405060708090000001",
+        "weekdays": [1, 3],
+        "interval_weeks": 1,
+        "start_time": "16:00",
+        "duration_minutes": 60,
+        "time_zone": "Asia/Shanghai",
+        "term_start": "2026-09-01",
+        "term_end": "2027-01-15",
+        "holidays": ["2026-10-01", "2026-10-02"],
+        "cancellations": [],
+        "location": "Room 101"
+    },
+    {
+        "course_pid": "102030405060708090000002",
+        "weekdays": [2],
+        "interval_weeks": 2,
+        "start_time": "10:00",
+        "duration_minutes": 90,
+        "time_zone": "Asia/Shanghai",
+        "term_start": "2026-09-01",
+        "term_end": "2027-01-15",
+        "holidays": [],
+        "cancellations": [],
+        "location": "Room 202"
+    }
+]
+
+for params in course_schedule_params:
+    print("[create course schedule: course ({})]".format(params["course_pid"]))
+    http_req = HTTPRequest(api_url, method, params)
+    http_req.send()
+    http_req.print_resp()
@@ -3,6 +3,7 @@
 from enum import Enum
 import requests 
 import json
+import os
 
 class HTTPMethod(Enum):
     GET = 1
@@ -30,6 +31,14 @@ class HTTPRequest:
         self.method = method
         self.params = {key:val for key, val in params.items()}
         self.resp = None
+        # caller's institute (config api) or admin token (super-admin across institutes)
+        self.headers = {}
+        if os.environ.get("KLOG_TEACHER_TOKEN"):
+            self.headers["Authorization"] = "Bearer " + os.environ["KLOG_TEACHER_TOKEN"]
+        if os.environ.get("KLOG_INSTITUTE_PID"):
+            self.headers["X-Institute-PID"] = os.environ["KLOG_INSTITUTE_PID"]
+        if os.environ.get("KLOG_ADMIN_TOKEN"):
+            self.headers["X-Admin-Token"] = os.environ["KLOG_ADMIN_TOKEN"]
         
     def send(self):
         req_handler = HTTPMethodMap[self.method]
@@ -37,7 +46,7 @@ class HTTPRequest:
         print("Send <Request>")
         print("HTTP Method:", HTTPMethodStringMap[self.method])
         if self.method == HTTPMethod.GET or self.method == HTTPMethod.DELETE:
-            self.resp = req_handler(url=self.api_url, params=self.params, timeout=3)
+            self.resp = req_handler(url=self.api_url, params=self.params, headers=self.headers, timeout=3)
             api_url_full = self.api_url
             delimiter = "?"
             for key, val in self.params.items():
@@ -48,7 +57,7 @@ class HTTPRequest:
             print("URL:", self.api_url)
             print("Params:")
             print(json.dumps(self.params, indent=4, ensure_ascii=False))
-            self.resp = req_handler(url=self.api_url, json=self.params, timeout=3)
+            self.resp = req_handler(url=self.api_url, json=self.params, headers=self.headers, timeout=3)
         else:
             print("Unsupported HTTP method: {}".format(self.method))
   
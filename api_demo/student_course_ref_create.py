@@ -19,21 +19,25 @@ reference_params = [
         "pid": "102030405060708090000001",
         "student_pid": "102030405060708090000001",
         "course_pid": "102030405060708090000001",
+        "credits": 20,
     },
     {
         "pid": "102030405060708090000002",
         "student_pid": "102030405060708090000001",
         "course_pid": "102030405060708090000002",
+        "credits": 20,
     },
     {
         "pid": "102030405060708090000003",
         "student_pid": "102030405060708090000002",
         "course_pid": "102030405060708090000001",
+        "credits": 20,
     },
     {
         "pid": "102030405060708090000004",
         "student_pid": "102030405060708090000002",
         "course_pid": "102030405060708090000002",
+        "credits": 20,
     }
 ]
 
@@ -20,32 +20,48 @@ student_params = [
         "student_name": "Thomas Hu",
         "student_image_name": "",
         "student_image_url": "",
-        "binding_code": "",
-        "binding_expire": 0
+        "institute_pid": "102030405060708090000001",
+        "birthdate": "2015-06-01",
+        "gender": "",
+        "allergies": "",
+        "notes": "",
+        "emergency_contacts": []
     },
     {
         "pid": "102030405060708090000002",
         "student_name": "Bruce Wang",
         "student_image_name": "",
         "student_image_url": "",
-        "binding_code": "",
-        "binding_expire": 0
+        "institute_pid": "102030405060708090000001",
+        "birthdate": "2015-06-01",
+        "gender": "",
+        "allergies": "",
+        "notes": "",
+        "emergency_contacts": []
     },
     {
         "pid": "102030405060708090000003",
         "student_name": "Tiffiny Shawn",
         "student_image_name": "",
         "student_image_url": "",
-        "binding_code": "",
-        "binding_expire": 0
+        "institute_pid": "102030405060708090000001",
+        "birthdate": "2015-06-01",
+        "gender": "",
+        "allergies": "",
+        "notes": "",
+        "emergency_contacts": []
     },
     {
         "pid": "102030405060708090000004",
         "student_name": "Gintama Y.",
         "student_image_name": "",
         "student_image_url": "",
-        "binding_code": "",
-        "binding_expire": 0
+        "institute_pid": "102030405060708090000001",
+        "birthdate": "2015-06-01",
+        "gender": "",
+        "allergies": "",
+        "notes": "",
+        "emergency_contacts": []
     }
 ]
 
@@ -10,11 +10,8 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"sync"
 )
 
-var restapi_ctrl sync.Mutex
-
 // MapClaims type that uses the map[string]interface{} for JSON decoding
 // This is the default claims type if you don't supply one
 type MapClaims map[string]interface{}
@@ -366,8 +363,6 @@ func (mw *GinJWTMiddleware) middlewareImpl(c *gin.Context) {
 		mw.unauthorized(c, http.StatusForbidden, mw.HTTPStatusMessageFunc(ErrForbidden, c))
 		return
 	}
-	restapi_ctrl.Lock()
-	defer restapi_ctrl.Unlock()
 
 	c.Next()
 }
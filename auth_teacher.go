@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ginHeaderAuthorization = "Authorization"
+	teacherTokenPrefix     = "Bearer "
+)
+
+// teacherTokenClaims teacher auth token content (subject is teacher PID)
+type teacherTokenClaims struct {
+	InstitutePID string `json:"institute_pid"`
+	jwt.StandardClaims
+}
+
+// teacherTokenIssue signs auth token of a logged in teacher, returns token and expiry (unix seconds)
+func teacherTokenIssue(teacher *Teacher) (string, int64, error) {
+	if serverConfig.TeacherTokenSecret == "" {
+		return "", 0, fmt.Errorf("[%s] - Teacher token secret is not configured", serverErrorMessages[seAPINotSupport])
+	}
+	if teacher.InstitutePID.IsZero() {
+		return "", 0, fmt.Errorf("[%s] - Teacher (PID %s) does not belong to an institute", serverErrorMessages[seResourceNotMatched], teacher.PID.Hex())
+	}
+
+	expireAt := time.Now().Add(time.Duration(serverConfig.TeacherTokenLifeTime) * time.Hour).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, teacherTokenClaims{
+		InstitutePID: teacher.InstitutePID.Hex(),
+		StandardClaims: jwt.StandardClaims{
+			Subject:   teacher.PID.Hex(),
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: expireAt,
+		},
+	})
+	tokenString, err := token.SignedString([]byte(serverConfig.TeacherTokenSecret))
+	if err != nil {
+		return "", 0, err
+	}
+	return tokenString, expireAt, nil
+}
+
+// teacherTokenParse verifies teacher auth token (Authorization header value), returns teacher and institute PID
+func teacherTokenParse(authorization string) (primitive.ObjectID, primitive.ObjectID, error) {
+	if serverConfig.TeacherTokenSecret == "" {
+		return primitive.NilObjectID, primitive.NilObjectID, fmt.Errorf("teacher token secret is not configured")
+	}
+	if !strings.HasPrefix(authorization, teacherTokenPrefix) {
+		return primitive.NilObjectID, primitive.NilObjectID, fmt.Errorf("bearer token is expected")
+	}
+
+	var claims teacherTokenClaims
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(authorization, teacherTokenPrefix), &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(serverConfig.TeacherTokenSecret), nil
+	})
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, err
+	}
+
+	teacherPID, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return primitive.NilObjectID, primitive.NilObjectID, err
+	}
+	institutePID, err := primitive.ObjectIDFromHex(claims.InstitutePID)
+	if err != nil || institutePID.IsZero() {
+		return primitive.NilObjectID, primitive.NilObjectID, fmt.Errorf("token has no institute")
+	}
+	return teacherPID, institutePID, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -15,6 +16,24 @@ import (
 
 var azMediaContainerURL *azblob.ContainerURL
 
+// azure storage operation classes (each class has its own configurable timeout)
+const (
+	azureOpMeta = iota
+	azureOpTransfer
+)
+
+// azureContextWithTimeout derives a storage operation context from request context
+func azureContextWithTimeout(ctx context.Context, opClass int) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := serverConfig.StorageTimeout
+	if opClass == azureOpTransfer {
+		timeout = serverConfig.StorageTransferTimeout
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+}
+
 func azureErrorCode(err error) (string, error) {
 	if err != nil {
 		if serr, ok := err.(azblob.StorageError); ok { // This error is an Azure Service-specific
@@ -46,9 +65,11 @@ func azureStorageInit(sc *ServerConfig) (*azblob.ContainerURL, error) {
 	containerURL := azblob.NewContainerURL(*URL, pipeline)
 
 	// check if container exists. If not, try to create
-	if _, containerPropErr := containerURL.GetProperties(context.TODO(), azblob.LeaseAccessConditions{}); containerPropErr != nil {
+	azCtx, azCancel := azureContextWithTimeout(context.Background(), azureOpMeta)
+	defer azCancel()
+	if _, containerPropErr := containerURL.GetProperties(azCtx, azblob.LeaseAccessConditions{}); containerPropErr != nil {
 		if serr, ok := containerPropErr.(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeContainerNotFound {
-			if containerCreateErr := azureStorageCreateContainer(&containerURL); containerCreateErr != nil {
+			if containerCreateErr := azureStorageCreateContainer(context.Background(), &containerURL); containerCreateErr != nil {
 				return nil, containerCreateErr
 			}
 		} else {
@@ -59,31 +80,39 @@ func azureStorageInit(sc *ServerConfig) (*azblob.ContainerURL, error) {
 	return &containerURL, nil
 }
 
-func azureStorageCreateContainer(azureContainerURL *azblob.ContainerURL) error {
+func azureStorageCreateContainer(ctx context.Context, azureContainerURL *azblob.ContainerURL) error {
 	if azureContainerURL == nil {
 		return fmt.Errorf("Empty azure container URL object")
 	}
 
 	// create azure storage container
-	if _, containerCreateErr := azureContainerURL.Create(context.TODO(), azblob.Metadata{}, azblob.PublicAccessBlob); containerCreateErr != nil {
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpMeta)
+	defer azCancel()
+	_, containerCreateErr := azureContainerURL.Create(azCtx, azblob.Metadata{}, azblob.PublicAccessBlob)
+	metricsStorageOperation("create_container", containerCreateErr)
+	if containerCreateErr != nil {
 		return containerCreateErr
 	}
 	return nil
 }
 
-func azureStorageDeleteContainer(azureContainerURL *azblob.ContainerURL) error {
+func azureStorageDeleteContainer(ctx context.Context, azureContainerURL *azblob.ContainerURL) error {
 	if azureContainerURL == nil {
 		return fmt.Errorf("Empty azure container URL object")
 	}
 
 	// delete azure storage container
-	if _, containerDeleteErr := azureContainerURL.Delete(context.TODO(), azblob.ContainerAccessConditions{}); containerDeleteErr != nil {
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpMeta)
+	defer azCancel()
+	_, containerDeleteErr := azureContainerURL.Delete(azCtx, azblob.ContainerAccessConditions{})
+	metricsStorageOperation("delete_container", containerDeleteErr)
+	if containerDeleteErr != nil {
 		return containerDeleteErr
 	}
 	return nil
 }
 
-func azureStorageListBlobs(azureContainerURL *azblob.ContainerURL, prefix string) ([]*azblob.BlobItem, error) {
+func azureStorageListBlobs(ctx context.Context, azureContainerURL *azblob.ContainerURL, prefix string) ([]*azblob.BlobItem, error) {
 	if azureContainerURL == nil {
 		return []*azblob.BlobItem{}, fmt.Errorf("Empty azure container URL object")
 	}
@@ -91,9 +120,12 @@ func azureStorageListBlobs(azureContainerURL *azblob.ContainerURL, prefix string
 	var blobItems = []*azblob.BlobItem{}
 	for marker := (azblob.Marker{}); marker.NotDone(); {
 		// get a result segment starting with the blob indicated by the current Marker.
-		listBlob, listBlobErr := azureContainerURL.ListBlobsFlatSegment(context.TODO(), marker, azblob.ListBlobsSegmentOptions{
+		azCtx, azCancel := azureContextWithTimeout(ctx, azureOpMeta)
+		listBlob, listBlobErr := azureContainerURL.ListBlobsFlatSegment(azCtx, marker, azblob.ListBlobsSegmentOptions{
 			Prefix: prefix,
 		})
+		azCancel()
+		metricsStorageOperation("list", listBlobErr)
 		if listBlobErr != nil {
 			return []*azblob.BlobItem{}, listBlobErr
 		}
@@ -109,21 +141,29 @@ func azureStorageListBlobs(azureContainerURL *azblob.ContainerURL, prefix string
 	return blobItems, nil
 }
 
-func azureStorageBlobExist(azureContainerURL *azblob.ContainerURL, blobname string) (bool, error) {
+func azureStorageBlobExist(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string) (bool, error) {
 	blobURL := azureContainerURL.NewBlobURL(blobname)
-	_, err := blobURL.GetProperties(context.TODO(), azblob.BlobAccessConditions{})
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpMeta)
+	defer azCancel()
+	_, err := blobURL.GetProperties(azCtx, azblob.BlobAccessConditions{})
 	if err != nil {
 		if serr, ok := err.(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+			metricsStorageOperation("get_properties", nil)
 			return false, nil
 		}
+		metricsStorageOperation("get_properties", err)
 		return false, err
 	}
+	metricsStorageOperation("get_properties", nil)
 	return true, nil
 }
 
-func azureStorageGetBlobProperties(azureContainerURL *azblob.ContainerURL, blobname string) (*AzureBlobProp, error) {
+func azureStorageGetBlobProperties(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string) (*AzureBlobProp, error) {
 	blobURL := azureContainerURL.NewBlobURL(blobname)
-	blobPropResp, err := blobURL.GetProperties(context.TODO(), azblob.BlobAccessConditions{})
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpMeta)
+	defer azCancel()
+	blobPropResp, err := blobURL.GetProperties(azCtx, azblob.BlobAccessConditions{})
+	metricsStorageOperation("get_properties", err)
 	if err != nil {
 		return nil, err
 	}
@@ -140,11 +180,12 @@ func azureStorageGetBlobProperties(azureContainerURL *azblob.ContainerURL, blobn
 		}
 	}
 	azureBlobProp.ContentLength = blobPropResp.Response().ContentLength
+	azureBlobProp.ContentType = blobPropResp.ContentType()
 
 	return &azureBlobProp, nil
 }
 
-func azureStorageUploadBlob(azureContainerURL *azblob.ContainerURL, blobname string) error {
+func azureStorageUploadBlob(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string) error {
 	if azureContainerURL == nil {
 		return fmt.Errorf("Empty azure container URL object")
 	}
@@ -155,39 +196,113 @@ func azureStorageUploadBlob(azureContainerURL *azblob.ContainerURL, blobname str
 		return fmt.Errorf("Failed to open file %s for blob upload", blobname)
 	}
 	defer blobFile.Close()
+	blobFileInfo, fileErr := blobFile.Stat()
+	if fileErr != nil {
+		return fmt.Errorf("Failed to stat file %s for blob upload", blobname)
+	}
 
 	// upload blob file
 	blobURL := azureContainerURL.NewBlockBlobURL(blobname)
-	_, blobUploadErr := azblob.UploadFileToBlockBlob(context.TODO(), blobFile, blobURL, azblob.UploadToBlockBlobOptions{
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpTransfer)
+	defer azCancel()
+	_, blobUploadErr := azblob.UploadFileToBlockBlob(azCtx, blobFile, blobURL, azblob.UploadToBlockBlobOptions{
 		BlockSize:   4 * 1024 * 1024,
 		Parallelism: 16})
+	metricsStorageOperation("upload", blobUploadErr)
 	if blobUploadErr != nil {
 		return blobUploadErr
 	}
+	metricsStorageUploadBytes.Add(float64(blobFileInfo.Size()))
 
 	return nil
 }
 
-func azureStorageDownloadBlob(azureContainerURL *azblob.ContainerURL, blobname string) error {
+func azureStorageUploadBuffer(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string, data []byte, contentType string, cacheControl string) error {
 	if azureContainerURL == nil {
 		return fmt.Errorf("Empty azure container URL object")
 	}
 
-	// download blob file
+	// upload blob data
 	blobURL := azureContainerURL.NewBlockBlobURL(blobname)
-	downloadResp, downloadErr := blobURL.Download(context.TODO(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpTransfer)
+	defer azCancel()
+	_, blobUploadErr := azblob.UploadBufferToBlockBlob(azCtx, data, blobURL, azblob.UploadToBlockBlobOptions{
+		BlockSize:   4 * 1024 * 1024,
+		Parallelism: 16,
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{
+			ContentType:  contentType,
+			CacheControl: cacheControl,
+		}})
+	metricsStorageOperation("upload", blobUploadErr)
+	if blobUploadErr != nil {
+		return blobUploadErr
+	}
+	metricsStorageUploadBytes.Add(float64(len(data)))
+
+	return nil
+}
+
+func azureStorageDownloadBuffer(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string) ([]byte, error) {
+	return azureStorageDownloadRange(ctx, azureContainerURL, blobname, 0, azblob.CountToEnd)
+}
+
+func azureStorageDownloadRange(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string, offset int64, count int64) ([]byte, error) {
+	if azureContainerURL == nil {
+		return nil, fmt.Errorf("Empty azure container URL object")
+	}
+
+	// download blob data (count bytes from offset, azblob.CountToEnd for rest of blob)
+	blobURL := azureContainerURL.NewBlockBlobURL(blobname)
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpTransfer)
+	defer azCancel()
+	downloadResp, downloadErr := blobURL.Download(azCtx, offset, count, azblob.BlobAccessConditions{}, false)
+	metricsStorageOperation("download", downloadErr)
 	if downloadErr != nil {
-		return downloadErr
+		return nil, downloadErr
 	}
 	bodyStream := downloadResp.Body(azblob.RetryReaderOptions{MaxRetryRequests: 5})
 	downloadedData := bytes.Buffer{}
 	_, dataErr := downloadedData.ReadFrom(bodyStream)
 	if dataErr != nil {
-		return fmt.Errorf("Failed to read downloaded blob data: %s", dataErr.Error())
+		return nil, fmt.Errorf("Failed to read downloaded blob data: %s", dataErr.Error())
+	}
+
+	return downloadedData.Bytes(), nil
+}
+
+func azureStorageDownloadStream(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string, writer io.Writer) (int64, error) {
+	if azureContainerURL == nil {
+		return 0, fmt.Errorf("Empty azure container URL object")
+	}
+
+	// download blob data into writer without buffering the whole blob
+	blobURL := azureContainerURL.NewBlockBlobURL(blobname)
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpTransfer)
+	defer azCancel()
+	downloadResp, downloadErr := blobURL.Download(azCtx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
+	metricsStorageOperation("download", downloadErr)
+	if downloadErr != nil {
+		return 0, downloadErr
+	}
+	bodyStream := downloadResp.Body(azblob.RetryReaderOptions{MaxRetryRequests: 5})
+	defer bodyStream.Close()
+	written, dataErr := io.Copy(writer, bodyStream)
+	if dataErr != nil {
+		return written, fmt.Errorf("Failed to read downloaded blob data: %s", dataErr.Error())
+	}
+
+	return written, nil
+}
+
+func azureStorageDownloadBlob(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string) error {
+	// download blob file
+	downloadedData, downloadErr := azureStorageDownloadBuffer(ctx, azureContainerURL, blobname)
+	if downloadErr != nil {
+		return downloadErr
 	}
 
 	// save blob file
-	fileErr := ioutil.WriteFile(blobname, downloadedData.Bytes(), 0755)
+	fileErr := ioutil.WriteFile(blobname, downloadedData, 0755)
 	if fileErr != nil {
 		return fmt.Errorf("Failed to save blob file %s: %s", blobname, fileErr.Error())
 	}
@@ -195,17 +310,64 @@ func azureStorageDownloadBlob(azureContainerURL *azblob.ContainerURL, blobname s
 	return nil
 }
 
-func azureStorageDeleteBlob(azureContainerURL *azblob.ContainerURL, blobname string) error {
+func azureStorageDeleteBlob(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string) error {
 	if azureContainerURL == nil {
 		return fmt.Errorf("Empty azure container URL object")
 	}
 
 	// delete blob
 	blobURL := azureContainerURL.NewBlockBlobURL(blobname)
-	_, deleteErr := blobURL.Delete(context.TODO(), azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpMeta)
+	defer azCancel()
+	_, deleteErr := blobURL.Delete(azCtx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{})
+	metricsStorageOperation("delete", deleteErr)
 	if deleteErr != nil {
 		return deleteErr
 	}
 
 	return nil
 }
+
+func azureStorageSetBlobContentHeaders(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string, contentType string, contentDisposition string) error {
+	if azureContainerURL == nil {
+		return fmt.Errorf("Empty azure container URL object")
+	}
+
+	// set blob content type/disposition (headers not given are cleared, so keep the other current headers)
+	blobURL := azureContainerURL.NewBlobURL(blobname)
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpMeta)
+	defer azCancel()
+	blobPropResp, err := blobURL.GetProperties(azCtx, azblob.BlobAccessConditions{})
+	metricsStorageOperation("get_properties", err)
+	if err != nil {
+		return err
+	}
+	headers := blobPropResp.NewHTTPHeaders()
+	headers.ContentType = contentType
+	headers.ContentDisposition = contentDisposition
+	_, setHeadersErr := blobURL.SetHTTPHeaders(azCtx, headers, azblob.BlobAccessConditions{})
+	metricsStorageOperation("set_headers", setHeadersErr)
+	if setHeadersErr != nil {
+		return setHeadersErr
+	}
+
+	return nil
+}
+
+func azureStorageSetBlobTier(ctx context.Context, azureContainerURL *azblob.ContainerURL, blobname string, tier azblob.AccessTierType) error {
+	if azureContainerURL == nil {
+		return fmt.Errorf("Empty azure container URL object")
+	}
+
+	// set blob access tier (hot/cool blobs stay readable)
+	blobURL := azureContainerURL.NewBlobURL(blobname)
+	azCtx, azCancel := azureContextWithTimeout(ctx, azureOpMeta)
+	defer azCancel()
+	_, setTierErr := blobURL.SetTier(azCtx, tier, azblob.LeaseAccessConditions{})
+	metricsStorageOperation("set_tier", setTierErr)
+	if setTierErr != nil {
+		return setTierErr
+	}
+
+	return nil
+}
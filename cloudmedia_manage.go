@@ -1,43 +1,83 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
 	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func cloudMediaRecycle() error {
+const (
+	cloudMediaTieringInterval       = time.Hour        // interval of moving media of archived students to cool tier
+	cloudMediaVariantInterval       = 10 * time.Minute // interval of generating missing image variants
+	cloudMediaVariantBatchSize      = 50               // image media per variant backfill run
+	cloudMediaVariantMaxSize        = 50 * 1024 * 1024 // byte, larger images get no variants
+	cloudMediaStripBatchSize        = 100              // image media per metadata stripping query
+	cloudMediaHashBatchSize         = 100              // media per content hash backfill query
+	cloudMediaNearDuplicateDistance = 10               // max differing bits of perceptual hashes of near-duplicate images
+	cloudMediaVariantCacheControl   = "public, max-age=604800"
+)
+
+// metadata stripping migration is running (admin api)
+var cloudMediaStripRunning int32
+
+// variants of image cloud media (longest side in pixel, thumbnails are center-cropped squares for grids)
+var cloudMediaVariantSpecs = []struct {
+	Name    string
+	MaxSide int
+	Square  bool
+}{
+	{CloudMediaVariantThumbnail, 320, true},
+	{CloudMediaVariantMedium, 1280, false},
+}
+
+func cloudMediaRecycle(ctx context.Context) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCloudMediaMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
 		}
 	}()
 
 	// DB student images
 	var students []*Student
-	students, err = findStudent(primitive.NilObjectID)
+	students, err = findStudent(ctx, primitive.NilObjectID)
 	if err != nil {
 		return err
 	}
 	var studentImageMap = map[string]bool{}
 	for i := range students {
-		studentImageMap[students[i].StudentImageName] = true
+		for _, imageName := range studentImageBlobNames(students[i]) {
+			studentImageMap[imageName] = true
+		}
 	}
 
 	// DB cloud media
 	var cloudMediaSlice []*CloudMedia
-	cloudMediaSlice, err = findCloudMedia(primitive.NilObjectID)
+	cloudMediaSlice, err = findCloudMedia(ctx, primitive.NilObjectID)
 	if err != nil {
 		return err
 	}
 	var cloudMediaMap = map[string]bool{}
 	for i := range cloudMediaSlice {
-		cloudMediaMap[cloudMediaSlice[i].MediaName] = true
+		for _, blobName := range cloudMediaBlobNames(cloudMediaSlice[i]) {
+			cloudMediaMap[blobName] = true
+		}
 	}
 
 	// azure blobs
 	var azMediaBlobs []*azblob.BlobItem
-	azMediaBlobs, err = azureStorageListBlobs(azMediaContainerURL, "")
+	azMediaBlobs, err = azureStorageListBlobs(ctx, azMediaContainerURL, "")
 	if err != nil {
 		return err
 	}
@@ -47,13 +87,733 @@ func cloudMediaRecycle() error {
 		_, imageOK := studentImageMap[azMediaBlobs[i].Name]
 		_, mediaOK := cloudMediaMap[azMediaBlobs[i].Name]
 		if !imageOK && !mediaOK {
-			err = azureStorageDeleteBlob(azMediaContainerURL, azMediaBlobs[i].Name)
+			err = azureStorageDeleteBlob(ctx, azMediaContainerURL, azMediaBlobs[i].Name)
+			if err != nil {
+				return err
+			}
+			loggingWithContext(ctx).Infomf(logModCloudMediaMgmt, "[%s] is neither student image or cloud media ==> delete it", azMediaBlobs[i].Name)
+		}
+	}
+
+	return nil
+}
+
+// access tier of cloud media (media without tier is in default hot tier)
+func cloudMediaTier(cloudMedia *CloudMedia) azblob.AccessTierType {
+	if cloudMedia.StorageTier == "" {
+		return azblob.AccessTierHot
+	}
+	return azblob.AccessTierType(cloudMedia.StorageTier)
+}
+
+// move media of a student (not shared session media, group media to cool tier only if all its students are archived)
+// to access tier, return #moved media, error
+func cloudMediaStudentTier(ctx context.Context, studentPID primitive.ObjectID, tier azblob.AccessTierType) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+		}
+	}()
+
+	var cloudMediaSlice []*CloudMedia
+	cloudMediaSlice, err = findCloudMediaByStudentPID(ctx, studentPID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var moved = 0
+	for _, cloudMedia := range cloudMediaSlice {
+		if cloudMediaTier(cloudMedia) == tier {
+			continue
+		}
+		if tier != azblob.AccessTierHot {
+			var archived bool
+			archived, err = cloudMediaStudentsArchived(ctx, cloudMedia, studentPID)
 			if err != nil {
+				return moved, err
+			}
+			if !archived {
+				continue
+			}
+		}
+		for _, blobName := range cloudMediaBlobNames(cloudMedia) {
+			err = azureStorageSetBlobTier(ctx, azMediaContainerURL, blobName, tier)
+			if err != nil {
+				break
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("[%s] - could not move cloud media (PID %s) to %s tier: %s", serverErrorMessages[seCloudOpsError],
+				cloudMedia.PID.Hex(), tier, err.Error())
+			return moved, err
+		}
+
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		_, err = dbPool.Collection(DBCollectionCloudMedia).UpdateOne(dbCtx, bson.D{{"_id", cloudMedia.PID}},
+			bson.D{{"$set", bson.D{{"storage_tier", string(tier)}, {"tier_ts", time.Now().Unix()}}}})
+		dbCancel()
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return moved, err
+		}
+		moved++
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Moved %d cloud media of student (PID %s) to %s tier", moved, studentPID.Hex(), tier)
+	return moved, nil
+}
+
+// other students linked to group media are archived too, return archived, error
+func cloudMediaStudentsArchived(ctx context.Context, cloudMedia *CloudMedia, studentPID primitive.ObjectID) (bool, error) {
+	for _, link := range cloudMediaStudentLinks(cloudMedia) {
+		if link.StudentPID == studentPID {
+			continue
+		}
+		students, err := findStudent(ctx, link.StudentPID)
+		if err != nil {
+			return false, err
+		}
+		if len(students) > 0 && students[0].Status != StudentStatusGraduated && students[0].Status != StudentStatusWithdrawn {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// move media of students archived longer than configured days to cool tier, return error
+func cloudMediaTiering(ctx context.Context) error {
+	var archiveDays = serverConfig.MediaArchiveTierDays
+	if archiveDays < 0 {
+		return nil
+	}
+
+	students, err := findStudentByStatus(ctx, primitive.NilObjectID, []string{StudentStatusGraduated, StudentStatusWithdrawn}, nil)
+	if err != nil {
+		return err
+	}
+	var archivedBefore = time.Now().AddDate(0, 0, -archiveDays).Unix()
+	for i := range students {
+		if students[i].StatusTS > archivedBefore {
+			continue
+		}
+		moved, err := cloudMediaStudentTier(ctx, students[i].PID, azblob.AccessTierCool)
+		if err != nil {
+			return err
+		}
+		if moved > 0 {
+			loggingWithContext(ctx).Infomf(logModCloudMediaMgmt, "Moved %d cloud media of archived student (PID %s) to cool tier", moved, students[i].PID.Hex())
+		}
+	}
+	return nil
+}
+
+// run cloud media tiering in background
+func cloudMediaTieringStart() {
+	go func() {
+		ticker := time.NewTicker(cloudMediaTieringInterval)
+		defer ticker.Stop()
+		for {
+			cloudMediaTiering(context.Background())
+			<-ticker.C
+		}
+	}()
+}
+
+// blob name of an image cloud media variant (next to original blob)
+func cloudMediaVariantName(mediaName string, variant string) string {
+	return mediaName + "." + variant + ".jpg"
+}
+
+// blob names of cloud media (original and resized variants)
+func cloudMediaBlobNames(cloudMedia *CloudMedia) []string {
+	var blobNames = []string{cloudMedia.MediaName}
+	for _, variant := range cloudMedia.MediaVariants {
+		blobNames = append(blobNames, variant.MediaName)
+	}
+	return blobNames
+}
+
+// delete blobs of cloud media, return first error (except blob not found)
+func cloudMediaDeleteBlobs(ctx context.Context, cloudMedia *CloudMedia) error {
+	for _, blobName := range cloudMediaBlobNames(cloudMedia) {
+		if err := azureStorageDeleteBlob(ctx, azMediaContainerURL, blobName); err != nil {
+			if serr, ok := err.(azblob.StorageError); !ok || serr.ServiceCode() != azblob.ServiceCodeBlobNotFound {
 				return err
 			}
-			logging.Infomf(logModCloudMediaMgmt, "[%s] is neither student image or cloud media ==> delete it", azMediaBlobs[i].Name)
 		}
 	}
+	return nil
+}
+
+// maximum blob size of cloud media type (byte)
+func cloudMediaMaxSize(mediaType string) int64 {
+	switch mediaType {
+	case CloudMediaTypeImage:
+		// larger images could not be stripped of location/device metadata
+		if maxSize := int64(serverConfig.MediaImageMaxSize) * 1024 * 1024; maxSize < cloudMediaVariantMaxSize {
+			return maxSize
+		}
+		return cloudMediaVariantMaxSize
+	case CloudMediaTypeVideo:
+		return int64(serverConfig.MediaVideoMaxSize) * 1024 * 1024
+	}
+	return int64(serverConfig.MediaOthersMaxSize) * 1024 * 1024
+}
+
+// check uploaded blob against cloud media type (size limit, format sniffed from content, declared content type), return format, error
+func cloudMediaCheckContent(ctx context.Context, cloudMedia *CloudMedia, azProp *AzureBlobProp) (mediaFormat, error) {
+	if azProp.ContentLength <= 0 {
+		return mediaFormat{}, fmt.Errorf("[%s] - Cloud media (name %s) is empty", serverErrorMessages[seInputParamNotValid], cloudMedia.MediaName)
+	}
+	if maxSize := cloudMediaMaxSize(cloudMedia.MediaType); azProp.ContentLength > maxSize {
+		return mediaFormat{}, fmt.Errorf("[%s] - Cloud media (name %s) has %d bytes, %s media is limited to %d bytes", serverErrorMessages[seInputParamNotValid],
+			cloudMedia.MediaName, azProp.ContentLength, cloudMedia.MediaType, maxSize)
+	}
+	data, err := azureStorageDownloadRange(ctx, azMediaContainerURL, cloudMedia.MediaName, 0, mediaSniffSize)
+	if err != nil {
+		return mediaFormat{}, fmt.Errorf("[%s] - could not read cloud media (name %s): %s", serverErrorMessages[seCloudOpsError], cloudMedia.MediaName, err.Error())
+	}
+	format, ok := mediaSniffFormat(data)
+	if !ok {
+		return mediaFormat{}, fmt.Errorf("[%s] - Cloud media (name %s) format is unknown or not allowed", serverErrorMessages[seInputParamNotValid], cloudMedia.MediaName)
+	}
+	if format.MediaType != cloudMedia.MediaType {
+		return mediaFormat{}, fmt.Errorf("[%s] - Cloud media (name %s) content is %s, not %s media", serverErrorMessages[seInputParamNotValid],
+			cloudMedia.MediaName, format.ContentType, cloudMedia.MediaType)
+	}
+	if !mediaContentTypeMatches(azProp.ContentType, format.ContentType) {
+		return mediaFormat{}, fmt.Errorf("[%s] - Cloud media (name %s) content is %s, but was uploaded as %s", serverErrorMessages[seInputParamNotValid],
+			cloudMedia.MediaName, format.ContentType, azProp.ContentType)
+	}
+	return format, nil
+}
 
+// errCloudMediaNotStripped image could not be read or stripped of its metadata (blob still holds location/device data)
+var errCloudMediaNotStripped = errors.New("image metadata is not stripped")
+
+// capture metadata (images and mp4/mov videos), resized variants (images) and content hashes of cloud media,
+// return error (errCloudMediaNotStripped if image metadata is kept, variants/hashes to be retried later otherwise)
+func cloudMediaProcess(ctx context.Context, cloudMedia *CloudMedia) error {
+	switch cloudMedia.MediaType {
+	case CloudMediaTypeImage:
+		data, err := cloudMediaImageData(ctx, cloudMedia)
+		if err != nil {
+			return fmt.Errorf("%s -> %w", err.Error(), errCloudMediaNotStripped)
+		}
+		cloudMediaSetMetadata(cloudMedia, mediaImageMetadata(data))
+		data, err = cloudMediaStripMetadata(ctx, cloudMedia, data)
+		if err != nil {
+			return fmt.Errorf("%s -> %w", err.Error(), errCloudMediaNotStripped)
+		}
+		err = cloudMediaContentHash(ctx, cloudMedia, data)
+		if err != nil {
+			return err
+		}
+		cloudMedia.MediaVariants, err = cloudMediaGenerateVariants(ctx, cloudMedia, data)
+		return err
+	case CloudMediaTypeVideo:
+		moov, err := cloudMediaVideoMoov(ctx, cloudMedia)
+		if err != nil {
+			loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (name %s) has no video metadata: %s", cloudMedia.MediaName, err.Error())
+		} else {
+			cloudMediaSetMetadata(cloudMedia, mediaVideoMetadata(moov))
+		}
+	}
+	return cloudMediaContentHash(ctx, cloudMedia, nil)
+}
+
+// set SHA-256 content hash of cloud media (from image data as stored after metadata stripping, streamed from blob if
+// data is nil; left empty if blob is missing), return error
+func cloudMediaContentHash(ctx context.Context, cloudMedia *CloudMedia, data []byte) error {
+	if data != nil {
+		if format, ok := mediaSniffFormat(data); ok && format.ImageFormat != "" {
+			data, _ = imageStripMetadata(data, format.ImageFormat)
+		}
+		hash := sha256.Sum256(data)
+		cloudMedia.ContentHash = hex.EncodeToString(hash[:])
+		return nil
+	}
+	hash := sha256.New()
+	if _, err := azureStorageDownloadStream(ctx, azMediaContainerURL, cloudMedia.MediaName, hash); err != nil {
+		if serr, ok := err.(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+			loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (name %s) blob not found for hashing", cloudMedia.MediaName)
+			return nil
+		}
+		return fmt.Errorf("[%s] - could not hash cloud media (name %s): %s", serverErrorMessages[seCloudOpsError], cloudMedia.MediaName, err.Error())
+	}
+	cloudMedia.ContentHash = hex.EncodeToString(hash.Sum(nil))
 	return nil
 }
+
+// earlier image media of the same course record/class session most similar to cloud media (by perceptual hash),
+// return PID (nil if none is similar enough), error
+func cloudMediaFindNearDuplicate(ctx context.Context, cloudMedia *CloudMedia) (primitive.ObjectID, error) {
+	var candidates []*CloudMedia
+	var err error
+	switch {
+	case cloudMedia.PerceptualHash == "":
+		return primitive.NilObjectID, nil
+	case !cloudMedia.CourseRecordPID.IsZero():
+		candidates, err = findCloudMediaByRecordPID(ctx, cloudMedia.CourseRecordPID)
+	case !cloudMedia.SessionPID.IsZero():
+		candidates, err = findCloudMediaBySessionPID(ctx, []primitive.ObjectID{cloudMedia.SessionPID})
+	default:
+		return primitive.NilObjectID, nil
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	var nearestPID = primitive.NilObjectID
+	var nearestDistance = cloudMediaNearDuplicateDistance + 1
+	for _, candidate := range candidates {
+		// media being created has no PID yet (all others are earlier)
+		if candidate.PID == cloudMedia.PID || (!cloudMedia.PID.IsZero() && candidate.PID.Hex() > cloudMedia.PID.Hex()) {
+			continue
+		}
+		if distance := imagePerceptualDistance(cloudMedia.PerceptualHash, candidate.PerceptualHash); distance >= 0 && distance < nearestDistance {
+			nearestPID, nearestDistance = candidate.PID, distance
+		}
+	}
+	return nearestPID, nil
+}
+
+// groups of near-duplicate cloud media (same content or similar images, collapsed media left out), earliest media first
+func cloudMediaDuplicateGroups(cloudMediaSlice []*CloudMedia) []*CloudMediaDuplicateGroup {
+	var media = []*CloudMedia{}
+	for _, cloudMedia := range cloudMediaSlice {
+		if !cloudMedia.Collapsed {
+			media = append(media, cloudMedia)
+		}
+	}
+	sort.Slice(media, func(i, j int) bool {
+		return media[i].PID.Hex() < media[j].PID.Hex()
+	})
+
+	// union similar media, root is the earliest media of a group
+	var root = make([]int, len(media))
+	var find func(i int) int
+	find = func(i int) int {
+		for root[i] != i {
+			root[i] = root[root[i]]
+			i = root[i]
+		}
+		return i
+	}
+	for i := range media {
+		root[i] = i
+		for j := 0; j < i; j++ {
+			sameContent := media[i].ContentHash != "" && media[i].ContentHash == media[j].ContentHash
+			distance := imagePerceptualDistance(media[i].PerceptualHash, media[j].PerceptualHash)
+			if sameContent || (distance >= 0 && distance <= cloudMediaNearDuplicateDistance) {
+				if ri, rj := find(i), find(j); ri != rj {
+					if ri < rj {
+						root[rj] = ri
+					} else {
+						root[ri] = rj
+					}
+				}
+			}
+		}
+	}
+
+	var groups = []*CloudMediaDuplicateGroup{}
+	var groupIndex = map[int]int{}
+	for i := range media {
+		r := find(i)
+		if index, ok := groupIndex[r]; ok {
+			groups[index].Media = append(groups[index].Media, media[i])
+			continue
+		}
+		groupIndex[r] = len(groups)
+		groups = append(groups, &CloudMediaDuplicateGroup{Media: []*CloudMedia{media[i]}})
+	}
+	var duplicateGroups = []*CloudMediaDuplicateGroup{}
+	for _, group := range groups {
+		if len(group.Media) > 1 {
+			duplicateGroups = append(duplicateGroups, group)
+		}
+	}
+	return duplicateGroups
+}
+
+// rewrite image blob without location/device metadata (after capture metadata is read), return stripped data, error;
+// images of formats that cannot be stripped (stored before format checks) are marked as skipped
+func cloudMediaStripMetadata(ctx context.Context, cloudMedia *CloudMedia, data []byte) ([]byte, error) {
+	if data == nil {
+		return data, nil
+	}
+	format, ok := mediaSniffFormat(data)
+	if !ok || format.ImageFormat == "" {
+		loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (name %s) format cannot be stripped of metadata", cloudMedia.MediaName)
+		cloudMedia.MetadataStripSkipped = true
+		return data, nil
+	}
+	stripped, changed := imageStripMetadata(data, format.ImageFormat)
+	if changed {
+		err := azureStorageUploadBuffer(ctx, azMediaContainerURL, cloudMedia.MediaName, stripped, format.ContentType, "")
+		if err != nil {
+			return nil, fmt.Errorf("[%s] - could not strip metadata of cloud media (name %s): %s", serverErrorMessages[seCloudOpsError], cloudMedia.MediaName, err.Error())
+		}
+		// uploaded blob starts in default tier
+		if tier := cloudMediaTier(cloudMedia); tier != azblob.AccessTierHot {
+			azureStorageSetBlobTier(ctx, azMediaContainerURL, cloudMedia.MediaName, tier)
+		}
+		cloudMedia.ContentLength = int64(len(stripped))
+		loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Stripped metadata of cloud media (name %s)", cloudMedia.MediaName)
+	}
+	cloudMedia.MetadataStripped = true
+	return stripped, nil
+}
+
+// set capture metadata of cloud media
+func cloudMediaSetMetadata(cloudMedia *CloudMedia, metadata mediaMetadata) {
+	cloudMedia.CaptureTS = metadata.CaptureTS
+	cloudMedia.Width = metadata.Width
+	cloudMedia.Height = metadata.Height
+	cloudMedia.Duration = metadata.Duration
+	cloudMedia.Orientation = metadata.Orientation
+}
+
+// time of cloud media for time range queries (capture time, upload time if unknown)
+func cloudMediaTS(cloudMedia *CloudMedia) int64 {
+	if cloudMedia.CaptureTS > 0 {
+		return cloudMedia.CaptureTS
+	}
+	return cloudMedia.CreateTS
+}
+
+// download image cloud media, return data (nil if image is too large or missing), error (retry later)
+func cloudMediaImageData(ctx context.Context, cloudMedia *CloudMedia) ([]byte, error) {
+	if cloudMedia.ContentLength > cloudMediaVariantMaxSize {
+		loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (name %s) is too large (%d bytes) for processing", cloudMedia.MediaName, cloudMedia.ContentLength)
+		return nil, nil
+	}
+	data, err := azureStorageDownloadBuffer(ctx, azMediaContainerURL, cloudMedia.MediaName)
+	if err != nil {
+		if serr, ok := err.(azblob.StorageError); ok && serr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+			loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (name %s) blob not found for processing", cloudMedia.MediaName)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("[%s] - could not download cloud media (name %s): %s", serverErrorMessages[seCloudOpsError], cloudMedia.MediaName, err.Error())
+	}
+	return data, nil
+}
+
+// moov box payload of mp4/mov video cloud media (top-level boxes are read by ranges, moov may follow media data)
+func cloudMediaVideoMoov(ctx context.Context, cloudMedia *CloudMedia) ([]byte, error) {
+	var offset int64
+	for i := 0; i < mp4HeaderMaxCount && offset+8 <= cloudMedia.ContentLength; i++ {
+		data, err := azureStorageDownloadRange(ctx, azMediaContainerURL, cloudMedia.MediaName, offset, 16)
+		if err != nil {
+			return nil, err
+		}
+		boxType, size, header, ok := mp4BoxHeader(data)
+		if !ok {
+			return nil, fmt.Errorf("no mp4/mov box at offset %d", offset)
+		}
+		if size == 0 {
+			size = cloudMedia.ContentLength - offset
+		}
+		if boxType == "moov" {
+			if size > mp4MoovMaxSize {
+				return nil, fmt.Errorf("moov box is too large (%d bytes)", size)
+			}
+			return azureStorageDownloadRange(ctx, azMediaContainerURL, cloudMedia.MediaName, offset+header, size-header)
+		}
+		offset += size
+	}
+	return nil, fmt.Errorf("no moov box found")
+}
+
+// generate resized variants (and perceptual hash) from image cloud media data, return variants (empty if image cannot be resized),
+// error (retry later)
+func cloudMediaGenerateVariants(ctx context.Context, cloudMedia *CloudMedia, data []byte) (map[string]CloudMediaVariant, error) {
+	var variants = map[string]CloudMediaVariant{}
+	if data == nil {
+		return variants, nil
+	}
+	img, format, err := imageDecodeUpload(data)
+	if err != nil {
+		loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (name %s) has no variants: %s", cloudMedia.MediaName, err.Error())
+		return variants, nil
+	}
+	var orientation = imageExifOrientation(data, format)
+	cloudMedia.PerceptualHash = imagePerceptualHash(img, orientation)
+
+	var uploadedNames = []string{}
+	for _, spec := range cloudMediaVariantSpecs {
+		var source = img.Bounds()
+		if spec.Square {
+			source = imageCenterSquare(source)
+		}
+		width, height := imageFitSize(source, spec.MaxSide)
+		resized := imageOrient(imageResize(img, source, width, height), orientation)
+		encoded, err := imageEncodeJPEG(resized)
+		if err != nil {
+			return nil, err
+		}
+
+		var variant = CloudMediaVariant{
+			MediaName:     cloudMediaVariantName(cloudMedia.MediaName, spec.Name),
+			Width:         resized.Bounds().Dx(),
+			Height:        resized.Bounds().Dy(),
+			ContentLength: int64(len(encoded)),
+		}
+		variant.MediaURL = azMediaContainerURL.String() + "/" + variant.MediaName
+		err = azureStorageUploadBuffer(ctx, azMediaContainerURL, variant.MediaName, encoded, imageContentTypeJPEG, cloudMediaVariantCacheControl)
+		if err != nil {
+			for _, uploadedName := range uploadedNames {
+				azureStorageDeleteBlob(ctx, azMediaContainerURL, uploadedName)
+			}
+			return nil, fmt.Errorf("[%s] - could not upload cloud media variant (name %s): %s", serverErrorMessages[seCloudOpsError], variant.MediaName, err.Error())
+		}
+		uploadedNames = append(uploadedNames, variant.MediaName)
+		variants[spec.Name] = variant
+	}
+	return variants, nil
+}
+
+// generate variants and metadata of image cloud media created before variants (or whose generation failed), return #processed media, error
+func cloudMediaVariantBackfill(ctx context.Context) (int, error) {
+	cloudMediaSlice, err := findCloudMediaWithoutVariants(ctx, cloudMediaVariantBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var processed = 0
+	for _, cloudMedia := range cloudMediaSlice {
+		err = cloudMediaProcess(ctx, cloudMedia)
+		if err != nil {
+			loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (PID %s) variants are retried later: %s", cloudMedia.PID.Hex(), err.Error())
+			continue
+		}
+		if !cloudMedia.Collapsed {
+			cloudMedia.NearDuplicateOf, err = cloudMediaFindNearDuplicate(ctx, cloudMedia)
+			if err != nil {
+				return processed, err
+			}
+		}
+
+		// media may be deleted meanwhile (its leftover variants are removed by blob recycling)
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		_, err = dbPool.Collection(DBCollectionCloudMedia).UpdateOne(dbCtx, bson.D{{"_id", cloudMedia.PID}, {"media_variants", nil}},
+			bson.D{{"$set", bson.D{
+				{"media_variants", cloudMedia.MediaVariants},
+				{"capture_ts", cloudMedia.CaptureTS},
+				{"width", cloudMedia.Width},
+				{"height", cloudMedia.Height},
+				{"duration", cloudMedia.Duration},
+				{"orientation", cloudMedia.Orientation},
+				{"content_length", cloudMedia.ContentLength},
+				{"metadata_stripped", cloudMedia.MetadataStripped},
+				{"metadata_strip_skipped", cloudMedia.MetadataStripSkipped},
+				{"content_hash", cloudMedia.ContentHash},
+				{"perceptual_hash", cloudMedia.PerceptualHash},
+				{"near_duplicate_of", cloudMedia.NearDuplicateOf},
+			}}})
+		dbCancel()
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+			return processed, err
+		}
+		processed++
+	}
+
+	if processed > 0 {
+		loggingWithContext(ctx).Infomf(logModCloudMediaMgmt, "Generated variants of %d image cloud media", processed)
+	}
+	return processed, nil
+}
+
+// compute content hashes of cloud media created before hashing (or whose hashing failed) and flag near-duplicates,
+// return #hashed media, error (failed media are logged and left for the next run)
+func cloudMediaHashBackfill(ctx context.Context) (int, error) {
+	var hashed = 0
+	var afterPID = primitive.NilObjectID
+	for {
+		cloudMediaSlice, err := findCloudMediaWithoutHash(ctx, afterPID, cloudMediaHashBatchSize)
+		if err != nil {
+			return hashed, err
+		}
+		if len(cloudMediaSlice) == 0 {
+			break
+		}
+		for _, cloudMedia := range cloudMediaSlice {
+			afterPID = cloudMedia.PID
+			var data []byte
+			if cloudMedia.MediaType == CloudMediaTypeImage {
+				data, err = cloudMediaImageData(ctx, cloudMedia)
+				if err == nil && data != nil {
+					if img, format, decodeErr := imageDecodeUpload(data); decodeErr == nil {
+						cloudMedia.PerceptualHash = imagePerceptualHash(img, imageExifOrientation(data, format))
+					}
+				}
+			}
+			if err == nil {
+				err = cloudMediaContentHash(ctx, cloudMedia, data)
+			}
+			if err != nil {
+				loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (PID %s) content hash is retried later: %s", cloudMedia.PID.Hex(), err.Error())
+				continue
+			}
+			if cloudMedia.ContentHash == "" {
+				continue // blob missing
+			}
+			if !cloudMedia.Collapsed {
+				cloudMedia.NearDuplicateOf, err = cloudMediaFindNearDuplicate(ctx, cloudMedia)
+				if err != nil {
+					return hashed, err
+				}
+			}
+
+			dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+			_, err = dbPool.Collection(DBCollectionCloudMedia).UpdateOne(dbCtx, bson.D{{"_id", cloudMedia.PID}},
+				bson.D{{"$set", bson.D{
+					{"content_hash", cloudMedia.ContentHash},
+					{"perceptual_hash", cloudMedia.PerceptualHash},
+					{"near_duplicate_of", cloudMedia.NearDuplicateOf},
+				}}})
+			dbCancel()
+			if err != nil {
+				err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+				loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+				return hashed, err
+			}
+			hashed++
+		}
+	}
+
+	if hashed > 0 {
+		loggingWithContext(ctx).Infomf(logModCloudMediaMgmt, "Computed content hashes of %d cloud media", hashed)
+	}
+	return hashed, nil
+}
+
+// run image cloud media variant and content hash backfill in background
+func cloudMediaVariantBackfillStart() {
+	go func() {
+		ticker := time.NewTicker(cloudMediaVariantInterval)
+		defer ticker.Stop()
+		for {
+			cloudMediaVariantBackfill(context.Background())
+			cloudMediaHashBackfill(context.Background())
+			<-ticker.C
+		}
+	}()
+}
+
+// strip location/device metadata of image blobs stored before ingestion stripping (image cloud media and manually uploaded
+// student images), return #rewritten blobs, error (failed blobs are logged and left for the next run)
+func cloudMediaStripMigration(ctx context.Context) (int, error) {
+	var rewritten, failed = 0, 0
+	var afterPID = primitive.NilObjectID
+	for {
+		cloudMediaSlice, err := findCloudMediaUnstripped(ctx, afterPID, cloudMediaStripBatchSize)
+		if err != nil {
+			return rewritten, err
+		}
+		if len(cloudMediaSlice) == 0 {
+			break
+		}
+		for _, cloudMedia := range cloudMediaSlice {
+			afterPID = cloudMedia.PID
+			var contentLength = cloudMedia.ContentLength
+			data, err := cloudMediaImageData(ctx, cloudMedia)
+			if err == nil {
+				_, err = cloudMediaStripMetadata(ctx, cloudMedia, data)
+			}
+			if err != nil {
+				loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (PID %s) metadata not stripped: %s", cloudMedia.PID.Hex(), err.Error())
+				failed++
+				continue
+			}
+			if data == nil {
+				cloudMedia.MetadataStripSkipped = true // too large or missing, not to be found again
+			}
+
+			dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+			_, err = dbPool.Collection(DBCollectionCloudMedia).UpdateOne(dbCtx, bson.D{{"_id", cloudMedia.PID}},
+				bson.D{{"$set", bson.D{
+					{"metadata_stripped", cloudMedia.MetadataStripped},
+					{"metadata_strip_skipped", cloudMedia.MetadataStripSkipped},
+					{"content_length", cloudMedia.ContentLength},
+				}}})
+			dbCancel()
+			if err != nil {
+				err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+				loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+				return rewritten, err
+			}
+			if cloudMedia.ContentLength != contentLength {
+				rewritten++
+			}
+		}
+	}
+
+	// student images uploaded by hand (uploaded student images are re-encoded without metadata)
+	students, err := findStudent(ctx, primitive.NilObjectID)
+	if err != nil {
+		return rewritten, err
+	}
+	for _, student := range students {
+		if student.StudentImageName == "" || len(student.StudentImageVariants) > 0 {
+			continue
+		}
+		data, err := azureStorageDownloadBuffer(ctx, azMediaContainerURL, student.StudentImageName)
+		if err != nil {
+			if serr, ok := err.(azblob.StorageError); !ok || serr.ServiceCode() != azblob.ServiceCodeBlobNotFound {
+				loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Student (PID %s) image metadata not stripped: %s", student.PID.Hex(), err.Error())
+				failed++
+			}
+			continue
+		}
+		format, ok := mediaSniffFormat(data)
+		if !ok || format.ImageFormat == "" {
+			loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Student (PID %s) image format cannot be stripped of metadata", student.PID.Hex())
+			continue
+		}
+		if stripped, changed := imageStripMetadata(data, format.ImageFormat); changed {
+			err = azureStorageUploadBuffer(ctx, azMediaContainerURL, student.StudentImageName, stripped, format.ContentType, "")
+			if err != nil {
+				loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Student (PID %s) image metadata not stripped: %s", student.PID.Hex(), err.Error())
+				failed++
+				continue
+			}
+			rewritten++
+		}
+	}
+
+	loggingWithContext(ctx).Infomf(logModCloudMediaMgmt, "Metadata stripping rewrote %d image blobs (%d failed)", rewritten, failed)
+	return rewritten, nil
+}
+
+// start metadata stripping migration in background (admin api), one run at a time
+func cloudMediaStripMetadataHandler(ctx *gin.Context) {
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	if !ginContextIsAdmin(ctx) {
+		response.Status = http.StatusForbidden
+		response.Message = fmt.Sprintf("[%s] - Admin token is missing or not valid", serverErrorMessages[seInputParamNotValid])
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&cloudMediaStripRunning, 0, 1) {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - Metadata stripping is already running", serverErrorMessages[seResourceConflict])
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&cloudMediaStripRunning, 0)
+		cloudMediaStripMigration(context.Background())
+	}()
+	loggingWithContext(ctx.Request.Context()).Infomln(logModCloudMediaMgmt, "Metadata stripping started (admin api)")
+	response.Payload = "Metadata stripping started"
+	return
+}
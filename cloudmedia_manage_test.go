@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// without reachable storage image creation must fail (blob keeps its metadata), other media only lack hashes
+func TestCloudMediaProcessStripFailure(t *testing.T) {
+	jpegData := testJPEG(t, testExifWithGPS())
+
+	image := CloudMedia{MediaName: "test.jpg", MediaType: CloudMediaTypeImage, ContentLength: int64(len(jpegData))}
+	if err := cloudMediaProcess(context.Background(), &image); !errors.Is(err, errCloudMediaNotStripped) {
+		t.Errorf("image not downloaded: got error %v, want %v", err, errCloudMediaNotStripped)
+	}
+
+	stripped, err := cloudMediaStripMetadata(context.Background(), &image, jpegData)
+	if err == nil || stripped != nil {
+		t.Errorf("stripped image not uploaded: got no error")
+	}
+	if image.MetadataStripped {
+		t.Errorf("stripped image not uploaded: marked as stripped")
+	}
+
+	others := CloudMedia{MediaName: "test.pdf", MediaType: CloudMediaTypeOthers}
+	if err := cloudMediaProcess(context.Background(), &others); err == nil || errors.Is(err, errCloudMediaNotStripped) {
+		t.Errorf("other media not hashed: got error %v, want hash error", err)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	bindingCodeDigits          = 6
+	bindingCodeCreateRetry     = 5
+	bindingCodeQRPrefix        = "klog:bind:" // QR payload = prefix + binding code
+	bindingCodeActiveIndex     = "binding_code_active_unique"
+	bindingCodeStudentIndex    = "student_pid_active_unique"
+	bindingAttemptFieldWXID    = "relative_wxid"
+	bindingAttemptFieldCode    = "binding_code"
+	bindingAttemptFieldIP      = "client_ip"
+	bindingCodeQRImageSize     = 256 // pixel
+	bindingCodeQRContentType   = "image/png"
+	bindingCodeQRQueryStudent  = "student_pid"
+	bindingCodeHistoryMaxCount = 100
+)
+
+var bindingCodeConfigHandlerTable = map[string]gin.HandlerFunc{
+	"get": bindingCodeGetHandler,
+}
+
+// get binding code history of a student
+func bindingCodeGetHandler(ctx *gin.Context) {
+	// params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var bindingCodes []*BindingCode
+	var err error
+	var studentPID primitive.ObjectID
+
+	sPID := ctx.Request.URL.Query().Get("student_pid")
+	if sPID == "all" {
+		studentPID = primitive.NilObjectID
+	} else {
+		studentPID, err = primitive.ObjectIDFromHex(sPID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid student PID (student_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
+	// pid: nil objectid for all, others for specified one
+	bindingCodes, err = findBindingCode(ctx.Request.Context(), studentPID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = bindingCodes
+	return
+}
+
+// bindingCodeGenerate returns a random numeric code with fixed digits
+func bindingCodeGenerate() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < bindingCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", bindingCodeDigits, n.Int64()), nil
+}
+
+// bindingCodeFromInput accepts raw binding code or scanned QR payload
+func bindingCodeFromInput(input string) string {
+	return strings.TrimPrefix(strings.TrimSpace(input), bindingCodeQRPrefix)
+}
+
+// find binding codes of a student (latest first), return binding code slice, error
+func findBindingCode(ctx context.Context, studentPID primitive.ObjectID) ([]*BindingCode, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetSort(bson.D{{"create_ts", -1}}).SetLimit(bindingCodeHistoryMaxCount)
+	var findFilter bson.D = bson.D{}
+	if !studentPID.IsZero() {
+		findFilter = append(findFilter, bson.E{"student_pid", studentPID})
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionBindingCode).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	bindingCodes := []*BindingCode{}
+	for findCursor.Next(dbCtx) {
+		var bindingCode BindingCode
+		err = findCursor.Decode(&bindingCode)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		bindingCodes = append(bindingCodes, &bindingCode)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Found %d binding code results from DB (studentPID=%v)", len(bindingCodes), studentPID.Hex())
+	return bindingCodes, nil
+}
+
+// find active binding code by code or by student (one of them), return binding code (nil if none), error
+func findActiveBindingCode(ctx context.Context, code string, studentPID primitive.ObjectID) (*BindingCode, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	var findFilter = bson.D{{"status", BindingCodeStatusActive}}
+	if code != "" {
+		findFilter = append(findFilter, bson.E{"binding_code", code})
+	}
+	if !studentPID.IsZero() {
+		findFilter = append(findFilter, bson.E{"student_pid", studentPID})
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	var bindingCode BindingCode
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findErr := dbPool.Collection(DBCollectionBindingCode).FindOne(dbCtx, findFilter).Decode(&bindingCode)
+	if errors.Is(findErr, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if findErr != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(findErr)], findErr.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Found active binding code from DB (PID=%s, studentPID=%s)", bindingCode.PID.Hex(), bindingCode.StudentPID.Hex())
+	return &bindingCode, nil
+}
+
+// create active binding code for student, return binding code, error (conflict if student already has an active code)
+func createBindingCode(ctx context.Context, student *Student) (*BindingCode, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	var bindingCode BindingCode
+	bindingCode.StudentPID = student.PID
+	bindingCode.InstitutePID = student.InstitutePID
+	bindingCode.Status = BindingCodeStatusActive
+	bindingCode.CreateTS = time.Now().Unix()
+	bindingCode.ExpireTS = bindingCode.CreateTS + int64(3600*serverConfigBindingCodeLifeTime())
+	bindingCode.ExpireAt = time.Unix(bindingCode.ExpireTS, 0)
+
+	// retry on code collision with another active code
+	for retry := 0; retry < bindingCodeCreateRetry; retry++ {
+		bindingCode.Code, err = bindingCodeGenerate()
+		if err != nil {
+			err = fmt.Errorf("[%s] - could not generate binding code: %s", serverErrorMessages[seUnresolvedError], err.Error())
+			return nil, err
+		}
+
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		insertResult, insertErr := dbPool.Collection(DBCollectionBindingCode).InsertOne(dbCtx, &bindingCode)
+		dbCancel()
+		if insertErr == nil {
+			bindingCode.PID = insertResult.InsertedID.(primitive.ObjectID)
+			loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Created binding code in DB (LastInsertID,PID=%s)", bindingCode.PID.Hex())
+			return &bindingCode, nil
+		}
+		if !dbIsDuplicateKeyError(insertErr) {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(insertErr)], insertErr.Error())
+			return nil, err
+		}
+		if dbDuplicateKeyIndex(insertErr) == bindingCodeStudentIndex {
+			err = fmt.Errorf("[%s] - Student (PID %s) already has an active binding code", serverErrorMessages[seResourceConflict], student.PID.Hex())
+			return nil, err
+		}
+	}
+
+	err = fmt.Errorf("[%s] - could not allocate a free binding code after %d retries", serverErrorMessages[seResourceConflict], bindingCodeCreateRetry)
+	return nil, err
+}
+
+// claim active binding code atomically for a relative, return error (conflict if already redeemed/revoked)
+func claimBindingCode(ctx context.Context, bindingCode *BindingCode, relativePID primitive.ObjectID) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	var updateFilter = bson.D{{"_id", bindingCode.PID}, {"status", BindingCodeStatusActive}}
+	var updateOptions = bson.D{{"$set", bson.D{{"status", BindingCodeStatusRedeemed}, {"relative_pid", relativePID}, {"update_ts", time.Now().Unix()}}}}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	updateResult, err := dbPool.Collection(DBCollectionBindingCode).UpdateOne(dbCtx, updateFilter, updateOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return err
+	}
+	if updateResult.MatchedCount == 0 {
+		err = fmt.Errorf("[%s] - binding code of student (PID %s) has been redeemed or revoked by another request", serverErrorMessages[seResourceConflict],
+			bindingCode.StudentPID.Hex())
+		return err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Claimed binding code (PID %s) for relative (PID %s)", bindingCode.PID.Hex(), relativePID.Hex())
+	return nil
+}
+
+// restore a claimed binding code to active (binding failed after claim), return error
+func restoreBindingCode(ctx context.Context, bindingCode *BindingCode, relativePID primitive.ObjectID) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	var updateFilter = bson.D{{"_id", bindingCode.PID}, {"status", BindingCodeStatusRedeemed}, {"relative_pid", relativePID}}
+	var updateOptions = bson.D{{"$set", bson.D{{"status", BindingCodeStatusActive}, {"relative_pid", primitive.NilObjectID}, {"update_ts", int64(0)}}}}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	_, err = dbPool.Collection(DBCollectionBindingCode).UpdateOne(dbCtx, updateFilter, updateOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return err
+	}
+	return nil
+}
+
+// revoke active binding codes of a student, return #revoked codes, error
+func revokeBindingCode(ctx context.Context, studentPID primitive.ObjectID) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	var updateFilter = bson.D{{"student_pid", studentPID}, {"status", BindingCodeStatusActive}}
+	var updateOptions = bson.D{{"$set", bson.D{{"status", BindingCodeStatusRevoked}, {"update_ts", time.Now().Unix()}}}}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	updateResult, err := dbPool.Collection(DBCollectionBindingCode).UpdateMany(dbCtx, updateFilter, updateOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Revoked %d binding codes of student (PID %s)", updateResult.ModifiedCount, studentPID.Hex())
+	return int(updateResult.ModifiedCount), nil
+}
+
+// delete binding codes (history included) of a student, return #delete entries, error
+func deleteBindingCodeByStudentPID(ctx context.Context, studentPID primitive.ObjectID) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	deleteFilter := bson.D{{"student_pid", studentPID}}
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionBindingCode).DeleteMany(dbCtx, deleteFilter)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Deleted %d binding codes from DB (studentPID %s)", deleteResult.DeletedCount, studentPID.Hex())
+	return int(deleteResult.DeletedCount), nil
+}
+
+// record a binding attempt (counted as failed until deleted), return attempt PID, error
+func createBindingAttempt(ctx context.Context, relativeWXID string, code string, clientIP string) (primitive.ObjectID, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	attempt := BindingAttempt{
+		RelativeWXID: relativeWXID,
+		Code:         code,
+		ClientIP:     clientIP,
+		AttemptAt:    time.Now(),
+	}
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionBindingAttempt).InsertOne(dbCtx, &attempt)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return primitive.NilObjectID, err
+	}
+	return insertResult.InsertedID.(primitive.ObjectID), nil
+}
+
+// delete binding attempt of a successful binding, return error
+func deleteBindingAttempt(ctx context.Context, pid primitive.ObjectID) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	_, err = dbPool.Collection(DBCollectionBindingAttempt).DeleteOne(dbCtx, bson.D{{"_id", pid}})
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return err
+	}
+	return nil
+}
+
+// count failed binding attempts within attempt window (field: relative_wxid, binding_code, client_ip or "" for all), return count, error
+func countBindingAttempt(ctx context.Context, field string, value string) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	windowStart := time.Now().Add(-time.Duration(serverConfig.BindingAttemptWindow) * time.Minute)
+	countFilter := bson.D{{"attempt_at", bson.D{{"$gte", windowStart}}}}
+	if field != "" {
+		countFilter = append(countFilter, bson.E{field, value})
+	}
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	count, err := dbPool.Collection(DBCollectionBindingAttempt).CountDocuments(dbCtx, countFilter)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// bindingAttemptLimited checks failed binding attempts (current one included) per wechat id, code, client IP and of all clients,
+// true if any limit is exceeded or attempts could not be counted
+func bindingAttemptLimited(ctx context.Context, relativeWXID string, code string, clientIP string) bool {
+	var limits = []struct {
+		field       string
+		value       string
+		maxAttempts int
+	}{
+		{bindingAttemptFieldWXID, relativeWXID, serverConfig.BindingMaxAttemptsPerWXID},
+		{bindingAttemptFieldCode, code, serverConfig.BindingMaxAttemptsPerCode},
+		{bindingAttemptFieldIP, clientIP, serverConfig.BindingMaxAttemptsPerIP},
+		{"", "", serverConfig.BindingMaxAttemptsTotal},
+	}
+	for _, limit := range limits {
+		count, err := countBindingAttempt(ctx, limit.field, limit.value)
+		if err != nil || count > limit.maxAttempts {
+			return true
+		}
+	}
+	return false
+}
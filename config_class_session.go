@@ -0,0 +1,574 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var classSessionConfigHandlerTable = map[string]gin.HandlerFunc{
+	"get":    classSessionGetHandler,
+	"delete": classSessionDeleteHandler,
+}
+
+func classSessionGetHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var sessions []*ClassSession
+	var err error
+	var pid, coursePID primitive.ObjectID
+	if params.PID == "all" {
+		pid = primitive.NilObjectID
+	} else {
+		pid, err = primitive.ObjectIDFromHex(params.PID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid PID (mongoDB ObjectID)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
+	// optional course filter (course_pid=?)
+	if cPID := ctx.Request.URL.Query().Get("course_pid"); cPID != "" && cPID != "all" {
+		coursePID, err = primitive.ObjectIDFromHex(cPID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid course PID (course_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
+	// pid: nil objectid for all, others for specified one
+	sessions, err = findClassSession(ctx.Request.Context(), pid, coursePID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = sessions
+	return
+}
+
+func classSessionDeleteHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var err error
+	var deletedRows int
+	var pid primitive.ObjectID
+	pid, err = primitive.ObjectIDFromHex(params.PID)
+	if err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specifiy a valid PID (mongoDB ObjectID)", serverErrorMessages[seInputParamNotValid])
+		return
+	}
+
+	deletedRows, err = deleteClassSession(ctx.Request.Context(), pid)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = deletedRows
+	return
+}
+
+// find class session, return class session slice (latest first), error
+func findClassSession(ctx context.Context, pid primitive.ObjectID, coursePID primitive.ObjectID) ([]*ClassSession, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModClassSessionMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetSort(bson.D{{"start_ts", -1}})
+	var findFilter bson.D = bson.D{}
+	if !pid.IsZero() {
+		findOptions.SetLimit(1)
+		findFilter = append(findFilter, bson.E{"_id", pid})
+	}
+	if !coursePID.IsZero() {
+		findFilter = append(findFilter, bson.E{"course_pid", coursePID})
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionClassSession).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	sessions := []*ClassSession{}
+	for findCursor.Next(dbCtx) {
+		var session ClassSession
+		err = findCursor.Decode(&session)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModClassSessionMgmt, "Found %d class sessions from DB (PID=%v, coursePID=%v)", len(sessions), pid.Hex(), coursePID.Hex())
+	return sessions, nil
+}
+
+// find class sessions of courses starting within [from, to), return class session slice, error
+func findClassSessionInRange(ctx context.Context, coursePIDs []primitive.ObjectID, from int64, to int64) ([]*ClassSession, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModClassSessionMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetSort(bson.D{{"start_ts", 1}})
+	var findFilter = bson.D{
+		{"course_pid", bson.D{{"$in", coursePIDs}}},
+		{"start_ts", bson.D{{"$gte", from}, {"$lt", to}}},
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionClassSession).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	sessions := []*ClassSession{}
+	for findCursor.Next(dbCtx) {
+		var session ClassSession
+		err = findCursor.Decode(&session)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModClassSessionMgmt, "Found %d class sessions from DB (%d courses, %d-%d)", len(sessions), len(coursePIDs), from, to)
+	return sessions, nil
+}
+
+// create class session and course records of all enrolled students, return session detail, error
+func createClassSession(ctx context.Context, sessionReq *ClassSessionCreateReq) (*ClassSessionDetail, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModClassSessionMgmt, err.Error())
+		}
+	}()
+
+	var session = sessionReq.ClassSession
+	session.PID = primitive.NilObjectID
+
+	// course PID and session time check
+	if session.CoursePID.IsZero() {
+		err = fmt.Errorf("[%s] - No course PID specified", serverErrorMessages[seResourceNotFound])
+		return nil, err
+	}
+	if session.StartTS <= 0 || session.EndTS < session.StartTS {
+		err = fmt.Errorf("[%s] - Invalid session time (start_ts %d, end_ts %d)", serverErrorMessages[seInputSchemaNotValid], session.StartTS, session.EndTS)
+		return nil, err
+	}
+
+	// course target tag and teacher check (teacher defaults to course teacher)
+	courses, err := findCourse(ctx, session.CoursePID)
+	if err != nil || len(courses) == 0 {
+		err = fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], session.CoursePID.Hex())
+		return nil, err
+	}
+	var course = courses[0]
+	if !curriculumActiveTarget(course.CourseTargets, session.TargetTag) {
+		err = fmt.Errorf("[%s] - No valid course target tag (\"%v\") specified", serverErrorMessages[seResourceNotFound], session.TargetTag)
+		return nil, err
+	}
+	// staff in charge at session start (substitute replaces lead)
+	if session.TeacherPID.IsZero() {
+		session.TeacherPID = courseStaffLeadAt(course, session.StartTS)
+	}
+	if session.TeacherPID.IsZero() || courseStaffRoleAt(course, session.TeacherPID, session.StartTS) == "" {
+		err = fmt.Errorf("[%s] - Teacher (PID %s) does not teach course (PID %s) at session start", serverErrorMessages[seResourceNotMatched],
+			session.TeacherPID.Hex(), course.PID.Hex())
+		return nil, err
+	}
+
+	// enrolled students (one query for the whole class), listed attendance must refer to enrolled students
+	studentCourseReferences, err := findStudentCourseRef(ctx, primitive.NilObjectID, session.CoursePID)
+	if err != nil {
+		return nil, err
+	}
+	// only active students take part (paused and archived students stay enrolled without records)
+	var enrolledStudentPIDs = []primitive.ObjectID{}
+	for i := range studentCourseReferences {
+		enrolledStudentPIDs = append(enrolledStudentPIDs, studentCourseReferences[i].StudentPID)
+	}
+	activeStudents, err := findStudentByStatus(ctx, primitive.NilObjectID, []string{StudentStatusActive}, enrolledStudentPIDs)
+	if err != nil {
+		return nil, err
+	}
+	var attendanceMapByStudent = map[primitive.ObjectID]string{}
+	for i := range activeStudents {
+		attendanceMapByStudent[activeStudents[i].PID] = AttendancePresent
+	}
+	for _, attendance := range sessionReq.Attendances {
+		if _, ok := attendanceMapByStudent[attendance.StudentPID]; !ok {
+			err = fmt.Errorf("[%s] - No active student enrolled with student PID %s and course PID %s -> cannot generate record",
+				serverErrorMessages[seResourceNotFound], attendance.StudentPID.Hex(), session.CoursePID.Hex())
+			return nil, err
+		}
+		if !attendanceMap[attendance.Attendance] {
+			err = fmt.Errorf("[%s] - Attendance can only be %s/%s/%s", serverErrorMessages[seInputSchemaNotValid],
+				AttendancePresent, AttendanceAbsent, AttendanceMakeUp)
+			return nil, err
+		}
+		attendanceMapByStudent[attendance.StudentPID] = attendance.Attendance
+	}
+	if len(attendanceMapByStudent) == 0 {
+		err = fmt.Errorf("[%s] - No active student enrolled in course (PID %s)", serverErrorMessages[seDependencyIssue], session.CoursePID.Hex())
+		return nil, err
+	}
+
+	// students on approved leave already have an absence record, which is attached to the session instead
+	leaveRequests, err := findLeaveRequestInRange(ctx, []primitive.ObjectID{session.CoursePID}, LeaveStatusApproved, session.StartTS, session.EndTS+1)
+	if err != nil {
+		return nil, err
+	}
+	var leaveRecordPIDs = bson.A{}
+	for _, leaveRequest := range leaveRequests {
+		if _, exist := attendanceMapByStudent[leaveRequest.StudentPID]; exist && !leaveRequest.CourseRecordPID.IsZero() {
+			delete(attendanceMapByStudent, leaveRequest.StudentPID)
+			leaveRecordPIDs = append(leaveRecordPIDs, leaveRequest.CourseRecordPID)
+		}
+	}
+
+	// makeup attendance redeems a makeup entitlement
+	for studentPID, attendance := range attendanceMapByStudent {
+		if attendance == AttendanceMakeUp {
+			err = lessonCreditCheckMakeUp(ctx, studentPID, session.CoursePID, primitive.NilObjectID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// insert session
+	session.CreateTS = time.Now().Unix()
+	session.InstitutePID = course.InstitutePID
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionClassSession).InsertOne(dbCtx, &session)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+	session.PID = insertResult.InsertedID.(primitive.ObjectID)
+
+	// insert course records of the session at once
+	var courseRecords = []*CourseRecord{}
+	var courseRecordDocuments = []interface{}{}
+	for i := range studentCourseReferences {
+		var studentPID = studentCourseReferences[i].StudentPID
+		if _, exist := attendanceMapByStudent[studentPID]; !exist {
+			continue
+		}
+		var courseRecord = CourseRecord{
+			StudentPID:        studentPID,
+			CoursePID:         session.CoursePID,
+			TargetTag:         session.TargetTag,
+			RecordTS:          session.StartTS,
+			IsMakeUp:          attendanceMapByStudent[studentPID] == AttendanceMakeUp,
+			SessionPID:        session.PID,
+			Attendance:        attendanceMapByStudent[studentPID],
+			Targets:           []CourseRecordTarget{},
+			CurriculumVersion: course.CurriculumVersion,
+			InstitutePID:      course.InstitutePID,
+		}
+		courseRecords = append(courseRecords, &courseRecord)
+		courseRecordDocuments = append(courseRecordDocuments, &courseRecord)
+	}
+
+	recordCtx, recordCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer recordCancel()
+	if len(courseRecordDocuments) > 0 {
+		insertManyResult, insertErr := dbPool.Collection(DBCollectionCourseRecord).InsertMany(recordCtx, courseRecordDocuments)
+		if insertErr != nil {
+			err = fmt.Errorf("[%s] - %s -> class session (PID %s) is rolled back", serverErrorMessages[dbErrorCode(insertErr)], insertErr.Error(), session.PID.Hex())
+			classSessionRollback(ctx, session.PID)
+			return nil, err
+		}
+		for i := range insertManyResult.InsertedIDs {
+			courseRecords[i].PID = insertManyResult.InsertedIDs[i].(primitive.ObjectID)
+		}
+	}
+
+	// lesson credit ledger of the whole class at once
+	err = applyLessonCreditRecords(ctx, courseRecords)
+	if err != nil {
+		err = fmt.Errorf("%s -> class session (PID %s) is rolled back", err.Error(), session.PID.Hex())
+		classSessionRollback(ctx, session.PID)
+		return nil, err
+	}
+
+	// attach absence records of approved leave requests
+	if len(leaveRecordPIDs) > 0 {
+		_, err = dbPool.Collection(DBCollectionCourseRecord).UpdateMany(recordCtx, bson.D{{"_id", bson.D{{"$in", leaveRecordPIDs}}}},
+			bson.D{{"$set", bson.D{{"session_pid", session.PID}}}})
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s -> class session (PID %s) is rolled back", serverErrorMessages[dbErrorCode(err)], err.Error(), session.PID.Hex())
+			classSessionRollback(ctx, session.PID)
+			return nil, err
+		}
+	}
+
+	loggingWithContext(ctx).Debugmf(logModClassSessionMgmt, "Created class session in DB (LastInsertID,PID=%s) with %d course records",
+		session.PID.Hex(), len(courseRecords))
+	return &ClassSessionDetail{Session: &session, Records: courseRecords, Media: []*CloudMedia{}}, nil
+}
+
+// remove partially created class session and its course records (no comment/media attached yet)
+func classSessionRollback(ctx context.Context, sessionPID primitive.ObjectID) {
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	var creditErr error
+	courseRecords, recordErr := findCourseRecordBySessionPID(ctx, sessionPID)
+	leaveRecordPIDs, leaveErr := classSessionLeaveRecordPIDs(ctx, courseRecords)
+	if recordErr == nil {
+		recordErr = leaveErr
+	}
+	for i := range courseRecords {
+		if leaveRecordPIDs[courseRecords[i].PID] {
+			continue
+		}
+		if _, deleteErr := deleteLessonCreditByRecordPID(ctx, courseRecords[i].PID); deleteErr != nil {
+			creditErr = deleteErr
+		}
+	}
+	if recordErr == nil {
+		recordErr = classSessionDetachLeaveRecords(ctx, leaveRecordPIDs)
+	}
+	if recordErr == nil {
+		_, recordErr = dbPool.Collection(DBCollectionCourseRecord).DeleteMany(dbCtx, bson.D{{"session_pid", sessionPID}})
+	}
+	_, sessionErr := dbPool.Collection(DBCollectionClassSession).DeleteOne(dbCtx, bson.D{{"_id", sessionPID}})
+	if recordErr != nil || sessionErr != nil || creditErr != nil {
+		loggingWithContext(ctx).Errormf(logModClassSessionMgmt, "Could not roll back class session (PID %s): %v %v %v", sessionPID.Hex(),
+			recordErr, sessionErr, creditErr)
+	}
+}
+
+// update attendance of students in a class session, return #updated records, error
+func updateClassSessionAttendance(ctx context.Context, attendanceReq *ClassSessionAttendanceReq) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModClassSessionMgmt, err.Error())
+		}
+	}()
+
+	if attendanceReq.SessionPID.IsZero() {
+		err = fmt.Errorf("[%s] - No class session PID specified", serverErrorMessages[seInputJSONNotValid])
+		return 0, err
+	}
+	for _, attendance := range attendanceReq.Attendances {
+		if !attendanceMap[attendance.Attendance] {
+			err = fmt.Errorf("[%s] - Attendance can only be %s/%s/%s", serverErrorMessages[seInputSchemaNotValid],
+				AttendancePresent, AttendanceAbsent, AttendanceMakeUp)
+			return 0, err
+		}
+	}
+
+	// course records of the session by student, makeup attendance redeems a makeup entitlement
+	courseRecords, err := findCourseRecordBySessionPID(ctx, attendanceReq.SessionPID)
+	if err != nil {
+		return 0, err
+	}
+	var courseRecordMap = map[primitive.ObjectID]*CourseRecord{}
+	for i := range courseRecords {
+		courseRecordMap[courseRecords[i].StudentPID] = courseRecords[i]
+	}
+	for _, attendance := range attendanceReq.Attendances {
+		courseRecord, exist := courseRecordMap[attendance.StudentPID]
+		if !exist {
+			err = fmt.Errorf("[%s] - No course record found for student (PID %s) in class session (PID %s)", serverErrorMessages[seResourceNotFound],
+				attendance.StudentPID.Hex(), attendanceReq.SessionPID.Hex())
+			return 0, err
+		}
+		if attendance.Attendance == AttendanceMakeUp {
+			err = lessonCreditCheckMakeUp(ctx, attendance.StudentPID, courseRecord.CoursePID, courseRecord.PID)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	var updateCnt int64
+	var updatedRecords = []*CourseRecord{}
+	for _, attendance := range attendanceReq.Attendances {
+		var updateFilter = bson.D{{"session_pid", attendanceReq.SessionPID}, {"student_pid", attendance.StudentPID}}
+		var updateOptions = bson.D{{"$set", bson.D{
+			{"attendance", attendance.Attendance},
+			{"is_makeup", attendance.Attendance == AttendanceMakeUp},
+		}}}
+
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		updateResult, updateErr := dbPool.Collection(DBCollectionCourseRecord).UpdateOne(dbCtx, updateFilter, updateOptions)
+		dbCancel()
+		if updateErr != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(updateErr)], updateErr.Error())
+			return int(updateCnt), err
+		}
+		if updateResult.MatchedCount == 0 {
+			err = fmt.Errorf("[%s] - No course record found for student (PID %s) in class session (PID %s)", serverErrorMessages[seResourceNotFound],
+				attendance.StudentPID.Hex(), attendanceReq.SessionPID.Hex())
+			return int(updateCnt), err
+		}
+		updateCnt += updateResult.ModifiedCount
+		if updateResult.ModifiedCount > 0 {
+			var courseRecord = courseRecordMap[attendance.StudentPID]
+			courseRecord.Attendance = attendance.Attendance
+			courseRecord.IsMakeUp = attendance.Attendance == AttendanceMakeUp
+			updatedRecords = append(updatedRecords, courseRecord)
+		}
+	}
+
+	// lesson credit ledger follows attendance
+	err = applyLessonCreditRecords(ctx, updatedRecords)
+	if err != nil {
+		return int(updateCnt), err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModClassSessionMgmt, "Updated attendance of %d course records (sessionPID %s)", updateCnt, attendanceReq.SessionPID.Hex())
+	return int(updateCnt), nil
+}
+
+// delete class session with its course records (comments/media included) and session media, return #delete entries, error
+func deleteClassSession(ctx context.Context, pid primitive.ObjectID) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModClassSessionMgmt, err.Error())
+		}
+	}()
+
+	courseRecords, err := findCourseRecordBySessionPID(ctx, pid)
+	if err != nil {
+		return 0, err
+	}
+
+	// absence records of approved leave requests outlive the session
+	leaveRecordPIDs, err := classSessionLeaveRecordPIDs(ctx, courseRecords)
+	if err == nil {
+		err = classSessionDetachLeaveRecords(ctx, leaveRecordPIDs)
+	}
+	if err != nil {
+		return 0, err
+	}
+	for i := range courseRecords {
+		if leaveRecordPIDs[courseRecords[i].PID] {
+			continue
+		}
+		_, err = deleteCourseRecord(ctx, courseRecords[i].PID)
+		if err != nil {
+			err = fmt.Errorf("[%s] - stop deleting class session (PID %s) since course record could not be deleted: %s",
+				serverErrorMessages[seDependencyIssue], pid.Hex(), err.Error())
+			return 0, err
+		}
+	}
+
+	_, err = deleteCloudMediaBySessionPID(ctx, pid)
+	if err != nil {
+		err = fmt.Errorf("[%s] - stop deleting class session (PID %s) since session media could not be deleted: %s",
+			serverErrorMessages[seCloudOpsError], pid.Hex(), err.Error())
+		return 0, err
+	}
+
+	deleteFilter := bson.D{{"_id", pid}}
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionClassSession).DeleteOne(dbCtx, deleteFilter)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModClassSessionMgmt, "Deleted %d class sessions (PID %s) with %d course records", deleteResult.DeletedCount,
+		pid.Hex(), len(courseRecords))
+	return int(deleteResult.DeletedCount), nil
+}
+
+// course records of a class session created by approved leave requests, return record PID set, error
+func classSessionLeaveRecordPIDs(ctx context.Context, courseRecords []*CourseRecord) (map[primitive.ObjectID]bool, error) {
+	var leaveRecordPIDs = map[primitive.ObjectID]bool{}
+	var recordPIDs = []primitive.ObjectID{}
+	for i := range courseRecords {
+		recordPIDs = append(recordPIDs, courseRecords[i].PID)
+	}
+	if len(recordPIDs) == 0 {
+		return leaveRecordPIDs, nil
+	}
+
+	leaveRequests, err := findLeaveRequestByFilter(ctx, bson.D{{"course_record_pid", bson.D{{"$in", recordPIDs}}}})
+	if err != nil {
+		return nil, err
+	}
+	for _, leaveRequest := range leaveRequests {
+		leaveRecordPIDs[leaveRequest.CourseRecordPID] = true
+	}
+	return leaveRecordPIDs, nil
+}
+
+// detach leave absence records from their class session, return error
+func classSessionDetachLeaveRecords(ctx context.Context, leaveRecordPIDs map[primitive.ObjectID]bool) error {
+	if len(leaveRecordPIDs) == 0 {
+		return nil
+	}
+	var recordPIDs = bson.A{}
+	for recordPID := range leaveRecordPIDs {
+		recordPIDs = append(recordPIDs, recordPID)
+	}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	_, err := dbPool.Collection(DBCollectionCourseRecord).UpdateMany(dbCtx, bson.D{{"_id", bson.D{{"$in", recordPIDs}}}},
+		bson.D{{"$unset", bson.D{{"session_pid", ""}}}})
+	if err != nil {
+		return fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -45,7 +46,7 @@ func cloudMediaGetHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	cloudMediaSlice, err = findCloudMedia(pid)
+	cloudMediaSlice, err = findCloudMedia(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -74,7 +75,7 @@ func cloudMediaPostHandler(ctx *gin.Context) {
 		return
 	}
 
-	cloudMediaPID, err = createCloudMedia(&cloudMedia)
+	cloudMediaPID, err = createCloudMedia(ctx.Request.Context(), &cloudMedia)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -102,7 +103,7 @@ func cloudMediaPutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateCloudMedia(&cloudMedia)
+	err = updateCloudMedia(ctx.Request.Context(), &cloudMedia)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -136,7 +137,7 @@ func cloudMediaDeleteHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteCloudMedia(pid)
+	deletedRows, err = deleteCloudMedia(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -147,11 +148,11 @@ func cloudMediaDeleteHandler(ctx *gin.Context) {
 }
 
 // find cloud media, return cloud media slice, error
-func findCloudMedia(pid primitive.ObjectID) ([]*CloudMedia, error) {
+func findCloudMedia(ctx context.Context, pid primitive.ObjectID) ([]*CloudMedia, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCloudMediaMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
 		}
 	}()
 
@@ -163,19 +164,22 @@ func findCloudMedia(pid primitive.ObjectID) ([]*CloudMedia, error) {
 		findOptions.SetLimit(1)
 		findFilter = bson.D{{"_id", pid}}
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	cloudMediaSlice := []*CloudMedia{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var cloudMedia CloudMedia
 		err = findCursor.Decode(&cloudMedia)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		cloudMediaSlice = append(cloudMediaSlice, &cloudMedia)
@@ -183,41 +187,44 @@ func findCloudMedia(pid primitive.ObjectID) ([]*CloudMedia, error) {
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModCloudMediaMgmt, "Found %d cloud media results from DB (PID=%v)", len(cloudMediaSlice), pid.Hex())
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Found %d cloud media results from DB (PID=%v)", len(cloudMediaSlice), pid.Hex())
 	return cloudMediaSlice, nil
 }
 
-// find cloud media by student pid, return cloud media slice, error
-func findCloudMediaByStudentPID(studentPID primitive.ObjectID, onlyNilCourseRecord bool) ([]*CloudMedia, error) {
+// find cloud media linked to student, return cloud media slice, error
+func findCloudMediaByStudentPID(ctx context.Context, studentPID primitive.ObjectID, onlyNilCourseRecord bool) ([]*CloudMedia, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCloudMediaMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
 		}
 	}()
 
 	var findOptions = options.Find()
-	var findFilter = bson.D{{"student_pid", studentPID}}
+	var findFilter = bson.D{cloudMediaStudentFilter([]primitive.ObjectID{studentPID})}
 	if onlyNilCourseRecord {
 		findFilter = append(findFilter, bson.E{"course_record_pid", primitive.NilObjectID})
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	cloudMediaSlice := []*CloudMedia{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var cloudMedia CloudMedia
 		err = findCursor.Decode(&cloudMedia)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		cloudMediaSlice = append(cloudMediaSlice, &cloudMedia)
@@ -225,38 +232,222 @@ func findCloudMediaByStudentPID(studentPID primitive.ObjectID, onlyNilCourseReco
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModCloudMediaMgmt, "Found %d cloud media results from DB (studentPID=%v)", len(cloudMediaSlice), studentPID.Hex())
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Found %d cloud media results from DB (studentPID=%v)", len(cloudMediaSlice), studentPID.Hex())
+	return cloudMediaSlice, nil
+}
+
+// find image cloud media whose variants are not generated yet (at most limit), return cloud media slice, error
+func findCloudMediaWithoutVariants(ctx context.Context, limit int64) ([]*CloudMedia, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetLimit(limit)
+	var findFilter = dbTenantFilter(ctx, bson.D{{"media_type", CloudMediaTypeImage}, {"media_variants", nil}})
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	cloudMediaSlice := []*CloudMedia{}
+	for findCursor.Next(dbCtx) {
+		var cloudMedia CloudMedia
+		err = findCursor.Decode(&cloudMedia)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		cloudMediaSlice = append(cloudMediaSlice, &cloudMedia)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Found %d image cloud media without variants from DB", len(cloudMediaSlice))
+	return cloudMediaSlice, nil
+}
+
+// find image cloud media whose metadata is not stripped yet (PID after afterPID, at most limit, PID order), return cloud media slice, error
+func findCloudMediaUnstripped(ctx context.Context, afterPID primitive.ObjectID, limit int64) ([]*CloudMedia, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetLimit(limit).SetSort(bson.D{{"_id", 1}})
+	var findFilter = dbTenantFilter(ctx, bson.D{
+		{"_id", bson.D{{"$gt", afterPID}}},
+		{"media_type", CloudMediaTypeImage},
+		{"metadata_stripped", bson.D{{"$ne", true}}},
+		{"metadata_strip_skipped", bson.D{{"$ne", true}}},
+	})
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	cloudMediaSlice := []*CloudMedia{}
+	for findCursor.Next(dbCtx) {
+		var cloudMedia CloudMedia
+		err = findCursor.Decode(&cloudMedia)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		cloudMediaSlice = append(cloudMediaSlice, &cloudMedia)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Found %d image cloud media with unstripped metadata from DB", len(cloudMediaSlice))
+	return cloudMediaSlice, nil
+}
+
+// find cloud media linked to any of the students (or of the class session) by content hash, return cloud media slice, error
+func findCloudMediaByContentHash(ctx context.Context, contentHash string, studentPIDs []primitive.ObjectID, sessionPID primitive.ObjectID) ([]*CloudMedia, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find()
+	var findFilter = bson.D{{"content_hash", contentHash}, {"session_pid", sessionPID}}
+	if sessionPID.IsZero() {
+		findFilter = append(findFilter, cloudMediaStudentFilter(studentPIDs))
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	cloudMediaSlice := []*CloudMedia{}
+	for findCursor.Next(dbCtx) {
+		var cloudMedia CloudMedia
+		err = findCursor.Decode(&cloudMedia)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		cloudMediaSlice = append(cloudMediaSlice, &cloudMedia)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Found %d cloud media results from DB (contentHash=%s)", len(cloudMediaSlice), contentHash)
+	return cloudMediaSlice, nil
+}
+
+// find cloud media without content hash (PID after afterPID, at most limit, PID order; images once their variants are
+// generated), return cloud media slice, error
+func findCloudMediaWithoutHash(ctx context.Context, afterPID primitive.ObjectID, limit int64) ([]*CloudMedia, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetLimit(limit).SetSort(bson.D{{"_id", 1}})
+	var findFilter = dbTenantFilter(ctx, bson.D{
+		{"_id", bson.D{{"$gt", afterPID}}},
+		{"content_hash", bson.D{{"$in", bson.A{nil, ""}}}},
+		{"$or", bson.A{
+			bson.D{{"media_type", bson.D{{"$ne", CloudMediaTypeImage}}}},
+			bson.D{{"media_variants", bson.D{{"$ne", nil}}}},
+		}},
+	})
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	cloudMediaSlice := []*CloudMedia{}
+	for findCursor.Next(dbCtx) {
+		var cloudMedia CloudMedia
+		err = findCursor.Decode(&cloudMedia)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		cloudMediaSlice = append(cloudMediaSlice, &cloudMedia)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Found %d cloud media without content hash from DB", len(cloudMediaSlice))
 	return cloudMediaSlice, nil
 }
 
 // find cloud media by course record pid, return cloud media slice, error
-func findCloudMediaByRecordPID(courseRecordPID primitive.ObjectID) ([]*CloudMedia, error) {
+func findCloudMediaByRecordPID(ctx context.Context, courseRecordPID primitive.ObjectID) ([]*CloudMedia, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCloudMediaMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
 		}
 	}()
 
 	var findOptions = options.Find()
 	var findFilter = bson.D{{"course_record_pid", courseRecordPID}}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	cloudMediaSlice := []*CloudMedia{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var cloudMedia CloudMedia
 		err = findCursor.Decode(&cloudMedia)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		cloudMediaSlice = append(cloudMediaSlice, &cloudMedia)
@@ -264,51 +455,225 @@ func findCloudMediaByRecordPID(courseRecordPID primitive.ObjectID) ([]*CloudMedi
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModCloudMediaMgmt, "Found %d cloud media results from DB (courseRecordPID=%v)", len(cloudMediaSlice), courseRecordPID.Hex())
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Found %d cloud media results from DB (courseRecordPID=%v)", len(cloudMediaSlice), courseRecordPID.Hex())
 	return cloudMediaSlice, nil
 }
 
-// create cloud media, return PID, error
-func createCloudMedia(cloudMedia *CloudMedia) (primitive.ObjectID, error) {
+// find cloud media attached to class sessions, return cloud media slice, error
+func findCloudMediaBySessionPID(ctx context.Context, sessionPIDs []primitive.ObjectID) ([]*CloudMedia, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCloudMediaMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
 		}
 	}()
 
-	// student PID check
-	if cloudMedia.StudentPID.IsZero() {
-		err = fmt.Errorf("[%s] - No student PID specified", serverErrorMessages[seResourceNotFound])
-		return primitive.NilObjectID, err
+	cloudMediaSlice := []*CloudMedia{}
+	if len(sessionPIDs) == 0 {
+		return cloudMediaSlice, nil
 	}
-	students, err := findStudent(cloudMedia.StudentPID)
-	if err != nil || len(students) == 0 {
-		err = fmt.Errorf("[%s] - No associate student found with PID %s", serverErrorMessages[seResourceNotFound], cloudMedia.StudentPID.Hex())
-		return primitive.NilObjectID, err
+
+	var findOptions = options.Find()
+	var findFilter = bson.D{{"session_pid", bson.D{{"$in", sessionPIDs}}}}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCloudMedia).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	for findCursor.Next(dbCtx) {
+		var cloudMedia CloudMedia
+		err = findCursor.Decode(&cloudMedia)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		cloudMediaSlice = append(cloudMediaSlice, &cloudMedia)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Found %d cloud media results from DB (%d sessions)", len(cloudMediaSlice), len(sessionPIDs))
+	return cloudMediaSlice, nil
+}
+
+// check session media: class session exists and media is not bound to students/record
+func cloudMediaSessionCheck(ctx context.Context, cloudMedia *CloudMedia) error {
+	if !cloudMedia.StudentPID.IsZero() || len(cloudMedia.StudentLinks) > 0 || !cloudMedia.CourseRecordPID.IsZero() {
+		return fmt.Errorf("[%s] - Session media (session PID %s) cannot be bound to student or course record", serverErrorMessages[seInputSchemaNotValid],
+			cloudMedia.SessionPID.Hex())
+	}
+	sessions, err := findClassSession(ctx, cloudMedia.SessionPID, primitive.NilObjectID)
+	if err != nil || len(sessions) == 0 {
+		return fmt.Errorf("[%s] - No class session found with PID %s", serverErrorMessages[seResourceNotFound], cloudMedia.SessionPID.Hex())
+	}
+	courses, err := findCourse(ctx, sessions[0].CoursePID)
+	if err != nil || len(courses) == 0 {
+		return fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], sessions[0].CoursePID.Hex())
+	}
+	cloudMedia.InstitutePID = courses[0].InstitutePID
+	return nil
+}
+
+// linked students of cloud media (media created before group media has student_pid only)
+func cloudMediaStudentLinks(cloudMedia *CloudMedia) []CloudMediaStudentLink {
+	if cloudMedia.StudentLinks != nil || cloudMedia.StudentPID.IsZero() {
+		return cloudMedia.StudentLinks
+	}
+	return []CloudMediaStudentLink{{StudentPID: cloudMedia.StudentPID}}
+}
+
+// link of student to cloud media, nil if media is not linked to student
+func cloudMediaStudentLink(cloudMedia *CloudMedia, studentPID primitive.ObjectID) *CloudMediaStudentLink {
+	links := cloudMediaStudentLinks(cloudMedia)
+	for i := range links {
+		if links[i].StudentPID == studentPID {
+			return &links[i]
+		}
+	}
+	return nil
+}
+
+// relative-visible fields of a cloud media (other linked students are not disclosed)
+func cloudMediaStudentView(cloudMedia *CloudMedia) *CloudMediaStudentView {
+	return &CloudMediaStudentView{
+		PID:             cloudMedia.PID,
+		CourseRecordPID: cloudMedia.CourseRecordPID,
+		SessionPID:      cloudMedia.SessionPID,
+		MediaType:       cloudMedia.MediaType,
+		MediaName:       cloudMedia.MediaName,
+		MediaURL:        cloudMedia.MediaURL,
+		RankScore:       cloudMedia.RankScore,
+		MediaTags:       cloudMedia.MediaTags,
+		CreateTS:        cloudMedia.CreateTS,
+		ContentLength:   cloudMedia.ContentLength,
+		ContentType:     cloudMedia.ContentType,
+		InstitutePID:    cloudMedia.InstitutePID,
+		MediaVariants:   cloudMedia.MediaVariants,
+		CaptureTS:       cloudMedia.CaptureTS,
+		Width:           cloudMedia.Width,
+		Height:          cloudMedia.Height,
+		Duration:        cloudMedia.Duration,
+		Orientation:     cloudMedia.Orientation,
+	}
+}
+
+// DB filter element of cloud media linked to any of the students
+func cloudMediaStudentFilter(studentPIDs []primitive.ObjectID) bson.E {
+	return bson.E{"$or", bson.A{
+		bson.D{{"student_links.student_pid", bson.D{{"$in", studentPIDs}}}},
+		bson.D{{"student_pid", bson.D{{"$in", studentPIDs}}}, {"student_links", nil}},
+	}}
+}
+
+// check student media: linked students (student_links, or student_pid only for a single student) exist in one institute
+// and course record belongs to a linked student
+func cloudMediaStudentCheck(ctx context.Context, cloudMedia *CloudMedia) error {
+	links := cloudMediaStudentLinks(cloudMedia)
+	if len(links) == 0 {
+		return fmt.Errorf("[%s] - No student PID specified", serverErrorMessages[seResourceNotFound])
+	}
+	var linked = map[primitive.ObjectID]bool{}
+	for i := range links {
+		if linked[links[i].StudentPID] {
+			return fmt.Errorf("[%s] - Student PID %s is linked twice", serverErrorMessages[seInputSchemaNotValid], links[i].StudentPID.Hex())
+		}
+		linked[links[i].StudentPID] = true
+		students, err := findStudent(ctx, links[i].StudentPID)
+		if err != nil || len(students) == 0 {
+			return fmt.Errorf("[%s] - No associated student found with PID %s", serverErrorMessages[seResourceNotFound], links[i].StudentPID.Hex())
+		}
+		if i == 0 {
+			cloudMedia.InstitutePID = students[0].InstitutePID
+		} else if students[0].InstitutePID != cloudMedia.InstitutePID {
+			return fmt.Errorf("[%s] - Student (PID %s) is not in the institute of student (PID %s)", serverErrorMessages[seResourceNotMatched],
+				links[i].StudentPID.Hex(), links[0].StudentPID.Hex())
+		}
 	}
+	cloudMedia.StudentLinks = links
+	cloudMedia.StudentPID = links[0].StudentPID
 
 	// course record PID check (pid = nil -> not related to any course record)
 	if !cloudMedia.CourseRecordPID.IsZero() {
-		var courseRecords []*CourseRecord
-		courseRecords, err = findCourseRecord(cloudMedia.CourseRecordPID)
+		courseRecords, err := findCourseRecord(ctx, cloudMedia.CourseRecordPID)
 		if err != nil || len(courseRecords) == 0 {
-			err = fmt.Errorf("[%s] - No course record found with PID %s", serverErrorMessages[seResourceNotFound], cloudMedia.CourseRecordPID.Hex())
+			return fmt.Errorf("[%s] - No course record found with PID %s", serverErrorMessages[seResourceNotFound], cloudMedia.CourseRecordPID.Hex())
+		}
+		if !linked[courseRecords[0].StudentPID] {
+			return fmt.Errorf("[%s] - Course record (PID %s) student PID %s is not linked to media", serverErrorMessages[seResourceNotMatched],
+				cloudMedia.CourseRecordPID.Hex(), courseRecords[0].StudentPID.Hex())
+		}
+	}
+	return nil
+}
+
+// blob name is used by any cloud media (original or variant) or student image of any institute, return in use, error
+func cloudMediaBlobNameInUse(ctx context.Context, blobName string) (bool, error) {
+	var mediaFilter = bson.A{bson.D{{"media_name", blobName}}}
+	for _, spec := range cloudMediaVariantSpecs {
+		mediaFilter = append(mediaFilter, bson.D{{"media_variants." + spec.Name + ".media_name", blobName}})
+	}
+	var imageFilter = bson.A{bson.D{{"student_image_name", blobName}}, bson.D{{"student_image_variants.image_name", blobName}}}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	count, err := dbPool.Collection(DBCollectionCloudMedia).CountDocuments(dbCtx, bson.D{{"$or", mediaFilter}})
+	if err == nil && count == 0 {
+		count, err = dbPool.Collection(DBCollectionStudent).CountDocuments(dbCtx, bson.D{{"$or", imageFilter}})
+	}
+	if err != nil {
+		return false, fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+	}
+	return count > 0, nil
+}
+
+// create cloud media, return PID, error
+func createCloudMedia(ctx context.Context, cloudMedia *CloudMedia) (primitive.ObjectID, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+		}
+	}()
+
+	// session media is attached once to class session (no student PID, no course record PID)
+	if !cloudMedia.SessionPID.IsZero() {
+		err = cloudMediaSessionCheck(ctx, cloudMedia)
+		if err != nil {
 			return primitive.NilObjectID, err
 		}
-		if courseRecords[0].StudentPID != cloudMedia.StudentPID {
-			err = fmt.Errorf("[%s] - Student PID %s does not match course record (PID %s) student PID %s", serverErrorMessages[seResourceNotMatched],
-				cloudMedia.StudentPID, cloudMedia.CourseRecordPID.Hex(), courseRecords[0].StudentPID)
+	} else {
+		err = cloudMediaStudentCheck(ctx, cloudMedia)
+		if err != nil {
 			return primitive.NilObjectID, err
 		}
 	}
 
+	// blob of an existing record (e.g. client retry) is neither processed nor deleted again
+	var nameInUse bool
+	nameInUse, err = cloudMediaBlobNameInUse(ctx, cloudMedia.MediaName)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	if nameInUse {
+		err = fmt.Errorf("[%s] - Cloud media name %s is already in use", serverErrorMessages[seResourceDuplicated], cloudMedia.MediaName)
+		return primitive.NilObjectID, err
+	}
+
 	// check if media exists at cloud and fill media information
-	azProp, azPropErr := azureStorageGetBlobProperties(azMediaContainerURL, cloudMedia.MediaName)
+	azProp, azPropErr := azureStorageGetBlobProperties(ctx, azMediaContainerURL, cloudMedia.MediaName)
 	if azPropErr != nil {
 		err = fmt.Errorf("[%s] - No media properties (URL: %s/%s) found at cloud (please check cloud connection and blob contents)",
 			serverErrorMessages[seResourceNotFound], azMediaContainerURL.String(), cloudMedia.MediaName)
@@ -324,23 +689,92 @@ func createCloudMedia(cloudMedia *CloudMedia) (primitive.ObjectID, error) {
 		return primitive.NilObjectID, err
 	}
 
-	insertResult, err := dbPool.Collection(DBCollectionCloudMedia).InsertOne(context.TODO(), cloudMedia)
+	// content check (rejected blobs are left to cloud media recycle)
+	var format mediaFormat
+	format, err = cloudMediaCheckContent(ctx, cloudMedia, azProp)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	cloudMedia.ContentType = format.ContentType
+
+	// capture metadata and resized variants of images (left to variant backfill if cloud is not reachable now), images are
+	// not created while their blob keeps private metadata
+	cloudMedia.MediaVariants = nil
+	cloudMedia.MetadataStripped = false
+	cloudMedia.MetadataStripSkipped = false
+	cloudMedia.ContentHash = ""
+	cloudMedia.PerceptualHash = ""
+	cloudMedia.Collapsed = false
+	cloudMediaSetMetadata(cloudMedia, mediaMetadata{})
+	if processErr := cloudMediaProcess(ctx, cloudMedia); errors.Is(processErr, errCloudMediaNotStripped) {
+		err = fmt.Errorf("[%s] - could not create cloud media (name %s): %s", serverErrorMessages[seCloudOpsError], cloudMedia.MediaName, processErr.Error())
+		return primitive.NilObjectID, err
+	} else if processErr != nil {
+		cloudMedia.MediaVariants = nil
+		cloudMedia.ContentHash = ""
+		loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Cloud media (name %s) variants/hashes are left to backfill: %s", cloudMedia.MediaName, processErr.Error())
+	}
+
+	// exact duplicates of media of the same students/class session are rejected, near-duplicates are flagged
+	if cloudMedia.ContentHash != "" {
+		var studentPIDs = []primitive.ObjectID{}
+		for _, link := range cloudMedia.StudentLinks {
+			studentPIDs = append(studentPIDs, link.StudentPID)
+		}
+		var duplicates []*CloudMedia
+		duplicates, err = findCloudMediaByContentHash(ctx, cloudMedia.ContentHash, studentPIDs, cloudMedia.SessionPID)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+		if len(duplicates) > 0 {
+			// blobs are only deleted if no record points to them (same name created concurrently)
+			var ownBlobs = true
+			for _, duplicate := range duplicates {
+				if duplicate.MediaName == cloudMedia.MediaName {
+					ownBlobs = false
+				}
+			}
+			if ownBlobs {
+				if deleteErr := cloudMediaDeleteBlobs(ctx, cloudMedia); deleteErr != nil {
+					loggingWithContext(ctx).Warnmf(logModCloudMediaMgmt, "Duplicate cloud media (name %s) blobs are left to recycle: %s", cloudMedia.MediaName, deleteErr.Error())
+				}
+			}
+			err = fmt.Errorf("[%s] - Cloud media (name %s) has the same content as cloud media (PID %s)", serverErrorMessages[seResourceDuplicated],
+				cloudMedia.MediaName, duplicates[0].PID.Hex())
+			return primitive.NilObjectID, err
+		}
+	}
+	cloudMedia.NearDuplicateOf, err = cloudMediaFindNearDuplicate(ctx, cloudMedia)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	// content headers after processing (metadata stripping re-uploads the blob)
+	err = azureStorageSetBlobContentHeaders(ctx, azMediaContainerURL, cloudMedia.MediaName, format.ContentType, mediaContentDisposition(cloudMedia.MediaName, format))
+	if err != nil {
+		err = fmt.Errorf("[%s] - could not set content headers of cloud media (name %s): %s", serverErrorMessages[seCloudOpsError], cloudMedia.MediaName, err.Error())
+		return primitive.NilObjectID, err
+	}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionCloudMedia).InsertOne(dbCtx, cloudMedia)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return primitive.NilObjectID, err
 	}
 
 	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModCloudMediaMgmt, "Created cloud media in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Created cloud media in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
 	return lastInsertID, nil
 }
 
 // update cloud media (only rank score and student pid), return error
-func updateCloudMedia(cloudMedia *CloudMedia) error {
+func updateCloudMedia(ctx context.Context, cloudMedia *CloudMedia) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCloudMediaMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
 		}
 	}()
 
@@ -349,47 +783,43 @@ func updateCloudMedia(cloudMedia *CloudMedia) error {
 		err = fmt.Errorf("[%s] - Cloud media PID is empty", serverErrorMessages[seInputJSONNotValid])
 		return err
 	}
-	cloudMediaSlice, err := findCloudMedia(cloudMedia.PID)
+	cloudMediaSlice, err := findCloudMedia(ctx, cloudMedia.PID)
 	if err != nil || len(cloudMediaSlice) == 0 {
 		err = fmt.Errorf("[%s] - No cloud media found with PID %s", serverErrorMessages[seResourceNotFound], cloudMedia.PID.Hex())
 		return err
 	}
 	cloudMediaFound := cloudMediaSlice[0]
 
-	// student PID check
-	if cloudMedia.StudentPID.IsZero() {
-		err = fmt.Errorf("[%s] - No student PID associated", serverErrorMessages[seResourceNotFound])
-		return err
-	}
-	students, err := findStudent(cloudMedia.StudentPID)
-	if err != nil || len(students) == 0 {
-		err = fmt.Errorf("[%s] - No associated student found with PID %s", serverErrorMessages[seResourceNotFound], cloudMedia.StudentPID.Hex())
-		return err
-	}
-
-	// course record PID check (pid = nil -> not related to any course record)
-	if !cloudMedia.CourseRecordPID.IsZero() {
-		var courseRecords []*CourseRecord
-		courseRecords, err = findCourseRecord(cloudMedia.CourseRecordPID)
-		if err != nil || len(courseRecords) == 0 {
-			err = fmt.Errorf("[%s] - No course record found with PID %s", serverErrorMessages[seResourceNotFound], cloudMedia.CourseRecordPID.Hex())
+	// session media keeps its session (only rank score and tags can be updated)
+	if !cloudMediaFound.SessionPID.IsZero() {
+		cloudMedia.SessionPID = cloudMediaFound.SessionPID
+		err = cloudMediaSessionCheck(ctx, cloudMedia)
+		if err != nil {
 			return err
 		}
-		if courseRecords[0].StudentPID != cloudMedia.StudentPID {
-			err = fmt.Errorf("[%s] - Student PID %s does not match course record (PID %s) student PID %s", serverErrorMessages[seResourceNotMatched],
-				cloudMedia.StudentPID, cloudMedia.CourseRecordPID.Hex(), courseRecords[0].StudentPID)
+	} else {
+		err = cloudMediaStudentCheck(ctx, cloudMedia)
+		if err != nil {
 			return err
 		}
 	}
 
+	// near-duplicate flags only hold within a course record
+	if cloudMediaFound.CourseRecordPID != cloudMedia.CourseRecordPID {
+		cloudMediaFound.NearDuplicateOf = primitive.NilObjectID
+		cloudMediaFound.Collapsed = false
+	}
+
 	// NOTE: only update partial attributes
 	cloudMediaFound.StudentPID = cloudMedia.StudentPID
+	cloudMediaFound.StudentLinks = cloudMedia.StudentLinks
 	cloudMediaFound.CourseRecordPID = cloudMedia.CourseRecordPID
 	cloudMediaFound.RankScore = cloudMedia.RankScore
+	cloudMediaFound.InstitutePID = cloudMedia.InstitutePID
 	cloudMediaFound.MediaTags = []string{}
 	cloudMediaFound.MediaTags = append(cloudMediaFound.MediaTags, cloudMedia.MediaTags...)
 
-	var updateFilter = bson.D{{"_id", cloudMediaFound.PID}}
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", cloudMediaFound.PID}})
 	var updateBSONDocument = bson.D{}
 	cloudMediaBSONData, err := bson.Marshal(cloudMediaFound)
 	if err != nil {
@@ -403,13 +833,15 @@ func updateCloudMedia(cloudMedia *CloudMedia) error {
 	}
 	var updateOptions = bson.D{{"$set", updateBSONDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionCloudMedia).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionCloudMedia).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModCloudMediaMgmt, "Update cloud media (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Update cloud media (PID %s): matched %d modified %d",
 		cloudMediaFound.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
 		err = fmt.Errorf("[%s] - could not find cloud media (PID %s)", serverErrorMessages[seResourceNotFound], cloudMediaFound.PID.Hex())
@@ -421,17 +853,76 @@ func updateCloudMedia(cloudMedia *CloudMedia) error {
 	return nil
 }
 
+// collapse near-duplicate cloud media into kept media of the same course record/class session, return #collapsed media, error
+func collapseCloudMedia(ctx context.Context, keepPID primitive.ObjectID, collapsePIDs []primitive.ObjectID) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+		}
+	}()
+
+	cloudMediaSlice, err := findCloudMedia(ctx, keepPID)
+	if err != nil || len(cloudMediaSlice) == 0 {
+		err = fmt.Errorf("[%s] - No cloud media found with PID %s", serverErrorMessages[seResourceNotFound], keepPID.Hex())
+		return 0, err
+	}
+	keepMedia := cloudMediaSlice[0]
+	if keepMedia.CourseRecordPID.IsZero() && keepMedia.SessionPID.IsZero() {
+		err = fmt.Errorf("[%s] - Cloud media (PID %s) belongs to no course record or class session", serverErrorMessages[seInputParamNotValid], keepPID.Hex())
+		return 0, err
+	}
+	for _, collapsePID := range collapsePIDs {
+		if collapsePID == keepPID {
+			err = fmt.Errorf("[%s] - Cloud media (PID %s) cannot be kept and collapsed", serverErrorMessages[seInputParamNotValid], keepPID.Hex())
+			return 0, err
+		}
+		cloudMediaSlice, err = findCloudMedia(ctx, collapsePID)
+		if err != nil || len(cloudMediaSlice) == 0 {
+			err = fmt.Errorf("[%s] - No cloud media found with PID %s", serverErrorMessages[seResourceNotFound], collapsePID.Hex())
+			return 0, err
+		}
+		if cloudMediaSlice[0].CourseRecordPID != keepMedia.CourseRecordPID || cloudMediaSlice[0].SessionPID != keepMedia.SessionPID {
+			err = fmt.Errorf("[%s] - Cloud media (PID %s) is not in the course record/class session of cloud media (PID %s)", serverErrorMessages[seResourceNotMatched],
+				collapsePID.Hex(), keepPID.Hex())
+			return 0, err
+		}
+	}
+
+	// kept media is shown again if it was collapsed before
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	_, err = dbPool.Collection(DBCollectionCloudMedia).UpdateOne(dbCtx, dbTenantFilter(ctx, bson.D{{"_id", keepPID}}),
+		bson.D{{"$set", bson.D{{"collapsed", false}, {"near_duplicate_of", primitive.NilObjectID}}}})
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+	if len(collapsePIDs) == 0 {
+		return 0, nil
+	}
+	updateResult, err := dbPool.Collection(DBCollectionCloudMedia).UpdateMany(dbCtx, dbTenantFilter(ctx, bson.D{{"_id", bson.D{{"$in", collapsePIDs}}}}),
+		bson.D{{"$set", bson.D{{"collapsed", true}, {"near_duplicate_of", keepPID}}}})
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Collapsed %d cloud media into cloud media (PID %s)", updateResult.MatchedCount, keepPID.Hex())
+	return int(updateResult.MatchedCount), nil
+}
+
 // delete cloud media, return #delete entries, error
-func deleteCloudMedia(pid primitive.ObjectID) (int, error) {
+func deleteCloudMedia(ctx context.Context, pid primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCloudMediaMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
 		}
 	}()
 
 	// try to delete media files at cloud side
-	cloudMediaSlice, findErr := findCloudMedia(pid)
+	cloudMediaSlice, findErr := findCloudMedia(ctx, pid)
 	if findErr != nil {
 		err = fmt.Errorf("[%s] - could not delete cloud media DB entries due to query error", serverErrorMessages[seResourceNotFound])
 		return 0, err
@@ -440,7 +931,7 @@ func deleteCloudMedia(pid primitive.ObjectID) (int, error) {
 	var deleteCount int64
 	for i := range cloudMediaSlice {
 		cloudMedia := cloudMediaSlice[i]
-		var azBlobDeleteErr error = azureStorageDeleteBlob(azMediaContainerURL, cloudMedia.MediaName)
+		var azBlobDeleteErr error = cloudMediaDeleteBlobs(ctx, cloudMedia)
 		// return if error occurs (except blob not found)
 		if azBlobDeleteErr != nil {
 			if serr, ok := azBlobDeleteErr.(azblob.StorageError); !ok || serr.ServiceCode() != azblob.ServiceCodeBlobNotFound {
@@ -451,30 +942,65 @@ func deleteCloudMedia(pid primitive.ObjectID) (int, error) {
 		}
 
 		deleteFilter := bson.D{{"_id", cloudMedia.PID}}
-		deleteResult, err := dbPool.Collection(DBCollectionCloudMedia).DeleteMany(context.TODO(), deleteFilter)
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		deleteResult, err := dbPool.Collection(DBCollectionCloudMedia).DeleteMany(dbCtx, deleteFilter)
+		dbCancel()
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return int(deleteCount), err
 		}
 
 		deleteCount += deleteResult.DeletedCount
 	}
 
-	logging.Debugmf(logModCloudMediaMgmt, "Deleted %d cloud media results from DB (cloud media PID %s)", deleteCount, pid.Hex())
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Deleted %d cloud media results from DB (cloud media PID %s)", deleteCount, pid.Hex())
 	return int(deleteCount), nil
 }
 
-// delete cloud media by student pid, return #delete entries, error
-func deleteCloudMediaByStudentPID(studentPID primitive.ObjectID, onlyNilCourseRecord bool) (int, error) {
+// remove student link of group media (media stays with the other linked students), return error
+func unlinkCloudMediaStudent(ctx context.Context, cloudMedia *CloudMedia, studentPID primitive.ObjectID) error {
+	var links = []CloudMediaStudentLink{}
+	for _, link := range cloudMediaStudentLinks(cloudMedia) {
+		if link.StudentPID != studentPID {
+			links = append(links, link)
+		}
+	}
+	if len(links) == 0 {
+		return fmt.Errorf("[%s] - Cloud media (PID %s) has no other linked student", serverErrorMessages[seResourceConflict], cloudMedia.PID.Hex())
+	}
+	var updateSet = bson.D{{"student_links", links}, {"student_pid", links[0].StudentPID}}
+
+	// course record of unlinked student is left
+	if !cloudMedia.CourseRecordPID.IsZero() {
+		courseRecords, err := findCourseRecord(ctx, cloudMedia.CourseRecordPID)
+		if err != nil || len(courseRecords) == 0 || courseRecords[0].StudentPID == studentPID {
+			updateSet = append(updateSet, bson.E{"course_record_pid", primitive.NilObjectID})
+		}
+	}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	_, err := dbPool.Collection(DBCollectionCloudMedia).UpdateOne(dbCtx, bson.D{{"_id", cloudMedia.PID}}, bson.D{{"$set", updateSet}})
+	if err != nil {
+		return fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Unlinked student (PID %s) from cloud media (PID %s)", studentPID.Hex(), cloudMedia.PID.Hex())
+	return nil
+}
+
+// delete cloud media linked to student (group media linked to other students only loses the student link),
+// return #delete entries, error
+func deleteCloudMediaByStudentPID(ctx context.Context, studentPID primitive.ObjectID, onlyNilCourseRecord bool) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCloudMediaMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
 		}
 	}()
 
 	// try to delete media files at cloud side
-	cloudMediaSlice, findErr := findCloudMediaByStudentPID(studentPID, onlyNilCourseRecord)
+	cloudMediaSlice, findErr := findCloudMediaByStudentPID(ctx, studentPID, onlyNilCourseRecord)
 	if findErr != nil {
 		err = fmt.Errorf("[%s] - could not delete cloud media DB entries due to query error", serverErrorMessages[seResourceNotFound])
 		return 0, err
@@ -483,7 +1009,72 @@ func deleteCloudMediaByStudentPID(studentPID primitive.ObjectID, onlyNilCourseRe
 	var deleteCount int64
 	for i := range cloudMediaSlice {
 		cloudMedia := cloudMediaSlice[i]
-		var azBlobDeleteErr error = azureStorageDeleteBlob(azMediaContainerURL, cloudMedia.MediaName)
+		if len(cloudMediaStudentLinks(cloudMedia)) > 1 {
+			err = unlinkCloudMediaStudent(ctx, cloudMedia, studentPID)
+			if err != nil {
+				return int(deleteCount), err
+			}
+			continue
+		}
+
+		var azBlobDeleteErr error = cloudMediaDeleteBlobs(ctx, cloudMedia)
+		// return if error occurs (except blob not found)
+		if azBlobDeleteErr != nil {
+			if serr, ok := azBlobDeleteErr.(azblob.StorageError); !ok || serr.ServiceCode() != azblob.ServiceCodeBlobNotFound {
+				err = fmt.Errorf("[%s] - could not delete cloud media blob at cloud (PID: %s name:%s type:%s) due to error: [%s]",
+					serverErrorMessages[seCloudOpsError], cloudMedia.PID.Hex(), cloudMedia.MediaName, cloudMedia.MediaType, azBlobDeleteErr.Error())
+				return int(deleteCount), err
+			}
+		}
+
+		deleteFilter := bson.D{{"_id", cloudMedia.PID}}
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		deleteResult, err := dbPool.Collection(DBCollectionCloudMedia).DeleteMany(dbCtx, deleteFilter)
+		dbCancel()
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return int(deleteCount), err
+		}
+
+		deleteCount += deleteResult.DeletedCount
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Deleted %d cloud media results from DB (studentPID %s)", deleteCount, studentPID.Hex())
+	return int(deleteCount), nil
+}
+
+// delete cloud media by course record pid (group media only loses the course record), return #delete entries, error
+func deleteCloudMediaByRecordPID(ctx context.Context, courseRecordPID primitive.ObjectID) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
+		}
+	}()
+
+	// try to delete media files at cloud side
+	cloudMediaSlice, findErr := findCloudMediaByRecordPID(ctx, courseRecordPID)
+	if findErr != nil {
+		err = fmt.Errorf("[%s] - could not delete cloud media DB entries due to query error", serverErrorMessages[seResourceNotFound])
+		return 0, err
+	}
+
+	var deleteCount int64
+	for i := range cloudMediaSlice {
+		cloudMedia := cloudMediaSlice[i]
+		if len(cloudMediaStudentLinks(cloudMedia)) > 1 {
+			dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+			_, err = dbPool.Collection(DBCollectionCloudMedia).UpdateOne(dbCtx, bson.D{{"_id", cloudMedia.PID}},
+				bson.D{{"$set", bson.D{{"course_record_pid", primitive.NilObjectID}}}})
+			dbCancel()
+			if err != nil {
+				err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+				return int(deleteCount), err
+			}
+			continue
+		}
+
+		var azBlobDeleteErr error = cloudMediaDeleteBlobs(ctx, cloudMedia)
 		// return if error occurs (except blob not found)
 		if azBlobDeleteErr != nil {
 			if serr, ok := azBlobDeleteErr.(azblob.StorageError); !ok || serr.ServiceCode() != azblob.ServiceCodeBlobNotFound {
@@ -494,30 +1085,32 @@ func deleteCloudMediaByStudentPID(studentPID primitive.ObjectID, onlyNilCourseRe
 		}
 
 		deleteFilter := bson.D{{"_id", cloudMedia.PID}}
-		deleteResult, err := dbPool.Collection(DBCollectionCloudMedia).DeleteMany(context.TODO(), deleteFilter)
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		deleteResult, err := dbPool.Collection(DBCollectionCloudMedia).DeleteMany(dbCtx, deleteFilter)
+		dbCancel()
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return int(deleteCount), err
 		}
 
 		deleteCount += deleteResult.DeletedCount
 	}
 
-	logging.Debugmf(logModCloudMediaMgmt, "Deleted %d cloud media results from DB (studentPID %s)", deleteCount, studentPID.Hex())
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Deleted %d cloud media results from DB (courseRecordPID %s)", deleteCount, courseRecordPID.Hex())
 	return int(deleteCount), nil
 }
 
-// delete cloud media by course record pid, return #delete entries, error
-func deleteCloudMediaByRecordPID(courseRecordPID primitive.ObjectID) (int, error) {
+// delete cloud media attached to class session, return #delete entries, error
+func deleteCloudMediaBySessionPID(ctx context.Context, sessionPID primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCloudMediaMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCloudMediaMgmt, err.Error())
 		}
 	}()
 
 	// try to delete media files at cloud side
-	cloudMediaSlice, findErr := findCloudMediaByRecordPID(courseRecordPID)
+	cloudMediaSlice, findErr := findCloudMediaBySessionPID(ctx, []primitive.ObjectID{sessionPID})
 	if findErr != nil {
 		err = fmt.Errorf("[%s] - could not delete cloud media DB entries due to query error", serverErrorMessages[seResourceNotFound])
 		return 0, err
@@ -526,7 +1119,7 @@ func deleteCloudMediaByRecordPID(courseRecordPID primitive.ObjectID) (int, error
 	var deleteCount int64
 	for i := range cloudMediaSlice {
 		cloudMedia := cloudMediaSlice[i]
-		var azBlobDeleteErr error = azureStorageDeleteBlob(azMediaContainerURL, cloudMedia.MediaName)
+		var azBlobDeleteErr error = cloudMediaDeleteBlobs(ctx, cloudMedia)
 		// return if error occurs (except blob not found)
 		if azBlobDeleteErr != nil {
 			if serr, ok := azBlobDeleteErr.(azblob.StorageError); !ok || serr.ServiceCode() != azblob.ServiceCodeBlobNotFound {
@@ -537,15 +1130,17 @@ func deleteCloudMediaByRecordPID(courseRecordPID primitive.ObjectID) (int, error
 		}
 
 		deleteFilter := bson.D{{"_id", cloudMedia.PID}}
-		deleteResult, err := dbPool.Collection(DBCollectionCloudMedia).DeleteMany(context.TODO(), deleteFilter)
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		deleteResult, err := dbPool.Collection(DBCollectionCloudMedia).DeleteMany(dbCtx, deleteFilter)
+		dbCancel()
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return int(deleteCount), err
 		}
 
 		deleteCount += deleteResult.DeletedCount
 	}
 
-	logging.Debugmf(logModCloudMediaMgmt, "Deleted %d cloud media results from DB (courseRecordPID %s)", deleteCount, courseRecordPID.Hex())
+	loggingWithContext(ctx).Debugmf(logModCloudMediaMgmt, "Deleted %d cloud media results from DB (sessionPID %s)", deleteCount, sessionPID.Hex())
 	return int(deleteCount), nil
 }
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -44,7 +46,7 @@ func courseGetHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	courses, err = findCourse(pid)
+	courses, err = findCourse(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -73,7 +75,7 @@ func coursePostHandler(ctx *gin.Context) {
 		return
 	}
 
-	coursePID, err = createCourse(&course)
+	coursePID, err = createCourse(ctx.Request.Context(), &course)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -101,7 +103,7 @@ func coursePutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateCourse(&course)
+	err = updateCourse(ctx.Request.Context(), &course)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -135,7 +137,7 @@ func courseDeleteHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteCourse(pid)
+	deletedRows, err = deleteCourse(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -146,11 +148,11 @@ func courseDeleteHandler(ctx *gin.Context) {
 }
 
 // find course, return course slice, error
-func findCourse(pid primitive.ObjectID) ([]*Course, error) {
+func findCourse(ctx context.Context, pid primitive.ObjectID) ([]*Course, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
 		}
 	}()
 
@@ -162,19 +164,22 @@ func findCourse(pid primitive.ObjectID) ([]*Course, error) {
 		findOptions.SetLimit(1)
 		findFilter = bson.D{{"_id", pid}}
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionCourse).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCourse).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	courses := []*Course{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var course Course
 		err = findCursor.Decode(&course)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		courses = append(courses, &course)
@@ -182,41 +187,130 @@ func findCourse(pid primitive.ObjectID) ([]*Course, error) {
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModCourseMgmt, "Found %d course results from DB (PID=%v)", len(courses), pid.Hex())
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Found %d course results from DB (PID=%v)", len(courses), pid.Hex())
+	return courses, nil
+}
+
+// find courses taught or assisted by a teacher (also on staff history), return course slice, error
+func findCourseByStaffPID(ctx context.Context, staffPID primitive.ObjectID) ([]*Course, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find()
+	var findFilter = bson.D{{"$or", bson.A{bson.D{{"teacher_pid", staffPID}}, bson.D{{"assistant_pid", staffPID}}, bson.D{{"staff.teacher_pid", staffPID}}}}}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCourse).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	courses := []*Course{}
+	for findCursor.Next(dbCtx) {
+		var course Course
+		err = findCursor.Decode(&course)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		courses = append(courses, &course)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Found %d course results from DB (staffPID=%v)", len(courses), staffPID.Hex())
+	return courses, nil
+}
+
+// find courses by PID list, return course slice, error
+func findCourseByPIDs(ctx context.Context, pids []primitive.ObjectID) ([]*Course, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		}
+	}()
+
+	if len(pids) == 0 {
+		return []*Course{}, nil
+	}
+
+	var findOptions = options.Find()
+	var findFilter = dbTenantFilter(ctx, bson.D{{"_id", bson.D{{"$in", pids}}}})
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCourse).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	courses := []*Course{}
+	for findCursor.Next(dbCtx) {
+		var course Course
+		err = findCursor.Decode(&course)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		courses = append(courses, &course)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Found %d course results from DB (%d PIDs)", len(courses), len(pids))
 	return courses, nil
 }
 
 // find course by courseUID
-func findCourseByUID(courseUID string) (*Course, error) {
+func findCourseByUID(ctx context.Context, courseUID string) (*Course, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
 		}
 	}()
 
 	var course Course
-	findFilter := bson.D{{"course_uid", courseUID}}
-	err = dbPool.Collection(DBCollectionCourse).FindOne(context.TODO(), findFilter).Decode(&course)
+	findFilter := dbTenantFilter(ctx, bson.D{{"course_uid", courseUID}})
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	err = dbPool.Collection(DBCollectionCourse).FindOne(dbCtx, findFilter).Decode(&course)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModCourseMgmt, "Found course from DB (courseUID=%s)", courseUID)
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Found course from DB (courseUID=%s)", courseUID)
 	return &course, nil
 }
 
 // create course, return PID, error
-func createCourse(course *Course) (primitive.ObjectID, error) {
+func createCourse(ctx context.Context, course *Course) (primitive.ObjectID, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
 		}
 	}()
 
@@ -225,7 +319,11 @@ func createCourse(course *Course) (primitive.ObjectID, error) {
 		err = fmt.Errorf("[%s] - No institute PID specified", serverErrorMessages[seResourceNotFound])
 		return primitive.NilObjectID, err
 	}
-	institutes, err := findInstitute(course.InstitutePID)
+	err = tenantCheck(ctx, course.InstitutePID)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	institutes, err := findInstitute(ctx, course.InstitutePID)
 	if err != nil || len(institutes) == 0 {
 		err = fmt.Errorf("[%s] - No institutes found with PID %s", serverErrorMessages[seResourceNotFound], course.InstitutePID.Hex())
 		return primitive.NilObjectID, err
@@ -236,7 +334,7 @@ func createCourse(course *Course) (primitive.ObjectID, error) {
 		err = fmt.Errorf("[%s] - No teacher PID specified", serverErrorMessages[seResourceNotFound])
 		return primitive.NilObjectID, err
 	}
-	teachers, err := findTeacher(course.TeacherPID)
+	teachers, err := findTeacher(ctx, course.TeacherPID)
 	if err != nil || len(teachers) == 0 {
 		err = fmt.Errorf("[%s] - No teachers found with PID %s", serverErrorMessages[seResourceNotFound], course.TeacherPID.Hex())
 		return primitive.NilObjectID, err
@@ -249,30 +347,59 @@ func createCourse(course *Course) (primitive.ObjectID, error) {
 			return primitive.NilObjectID, err
 		}
 
-		assistants, err := findTeacher(course.AssistantPID)
+		assistants, err := findTeacher(ctx, course.AssistantPID)
 		if err != nil || len(assistants) == 0 {
 			err = fmt.Errorf("[%s] - No assistants found with PID %s", serverErrorMessages[seResourceNotFound], course.AssistantPID.Hex())
 			return primitive.NilObjectID, err
 		}
 	}
 
-	insertResult, err := dbPool.Collection(DBCollectionCourse).InsertOne(context.TODO(), course)
+	// staff check (teacher/assistant are kept on staff list)
+	courseStaffMerge(course, nil, time.Now().Unix())
+	err = courseStaffCheck(ctx, course)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		return primitive.NilObjectID, err
+	}
+
+	// rubric and curriculum check (first curriculum version)
+	err = courseRubricCheck(course)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	course.CourseTargets, err = curriculumTargetCheck(course.CourseTargets)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	course.CurriculumVersion = 1
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionCourse).InsertOne(dbCtx, course)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return primitive.NilObjectID, err
 	}
 
 	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModCourseMgmt, "Created course in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Created course in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+
+	// course is removed again if curriculum version could not be kept
+	course.PID = lastInsertID
+	err = createCurriculumVersion(ctx, course)
+	if err != nil {
+		_, _ = dbPool.Collection(DBCollectionCourse).DeleteOne(dbCtx, bson.D{{"_id", lastInsertID}})
+		err = fmt.Errorf("%s -> course (PID %s) is rolled back", err.Error(), lastInsertID.Hex())
+		return primitive.NilObjectID, err
+	}
 	return lastInsertID, nil
 }
 
 // update course, return error
-func updateCourse(course *Course) error {
+func updateCourse(ctx context.Context, course *Course) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
 		}
 	}()
 
@@ -287,7 +414,11 @@ func updateCourse(course *Course) error {
 		err = fmt.Errorf("[%s] - No institute PID specified", serverErrorMessages[seResourceNotFound])
 		return err
 	}
-	institutes, err := findInstitute(course.InstitutePID)
+	err = tenantCheck(ctx, course.InstitutePID)
+	if err != nil {
+		return err
+	}
+	institutes, err := findInstitute(ctx, course.InstitutePID)
 	if err != nil || len(institutes) == 0 {
 		err = fmt.Errorf("[%s] - No institutes found with PID %s", serverErrorMessages[seResourceNotFound], course.InstitutePID.Hex())
 		return err
@@ -298,7 +429,7 @@ func updateCourse(course *Course) error {
 		err = fmt.Errorf("[%s] - No teacher PID specified", serverErrorMessages[seResourceNotFound])
 		return err
 	}
-	teachers, err := findTeacher(course.TeacherPID)
+	teachers, err := findTeacher(ctx, course.TeacherPID)
 	if err != nil || len(teachers) == 0 {
 		err = fmt.Errorf("[%s] - No teachers found with PID %s", serverErrorMessages[seResourceNotFound], course.TeacherPID.Hex())
 		return err
@@ -311,14 +442,49 @@ func updateCourse(course *Course) error {
 			return err
 		}
 
-		assistants, err := findTeacher(course.AssistantPID)
+		assistants, err := findTeacher(ctx, course.AssistantPID)
 		if err != nil || len(assistants) == 0 {
 			err = fmt.Errorf("[%s] - No assistants found with PID %s", serverErrorMessages[seResourceNotFound], course.AssistantPID.Hex())
 			return err
 		}
 	}
 
-	var updateFilter = bson.D{{"_id", course.PID}}
+	// rubric check
+	err = courseRubricCheck(course)
+	if err != nil {
+		return err
+	}
+	courses, err := findCourse(ctx, course.PID)
+	if err != nil || len(courses) == 0 {
+		err = fmt.Errorf("[%s] - could not find course (PID %s)", serverErrorMessages[seResourceNotFound], course.PID.Hex())
+		return err
+	}
+	var previous = courses[0]
+
+	// staff check (changed teacher/assistant ends staff entries of previous one)
+	courseStaffMerge(course, previous, time.Now().Unix())
+	err = courseStaffCheck(ctx, course)
+	if err != nil {
+		return err
+	}
+
+	// curriculum check: removed targets are retired, changed targets make a new curriculum version
+	course.CourseTargets, err = curriculumTargetCheck(curriculumMergeTargets(previous.CourseTargets, course.CourseTargets))
+	if err != nil {
+		return err
+	}
+	course.CurriculumVersion = previous.CurriculumVersion
+	var curriculumChanged = previous.CurriculumVersion == 0 || !curriculumTargetsEqual(previous.CourseTargets, course.CourseTargets)
+	if curriculumChanged {
+		course.CurriculumVersion++
+	}
+
+	// only if curriculum was not changed concurrently (courses older than versioning have no version)
+	var previousVersions = bson.A{previous.CurriculumVersion}
+	if previous.CurriculumVersion == 0 {
+		previousVersions = append(previousVersions, nil)
+	}
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", course.PID}, {"curriculum_version", bson.D{{"$in", previousVersions}}}})
 	var updateBSONDocument = bson.D{}
 	courseBSONData, err := bson.Marshal(course)
 	if err != nil {
@@ -332,52 +498,119 @@ func updateCourse(course *Course) error {
 	}
 	var updateOptions = bson.D{{"$set", updateBSONDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionCourse).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionCourse).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModCourseMgmt, "Update course (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Update course (PID %s): matched %d modified %d",
 		course.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
-		err = fmt.Errorf("[%s] - could not find course (PID %s)", serverErrorMessages[seResourceNotFound], course.PID.Hex())
+		err = fmt.Errorf("[%s] - course (PID %s) curriculum was changed concurrently, please retry", serverErrorMessages[seResourceConflict], course.PID.Hex())
 		return err
 	} else if insertResult.ModifiedCount == 0 {
 		err = fmt.Errorf("[%s] - course (PID %s) not changed", serverErrorMessages[seResourceNotChange], course.PID.Hex())
 		return err
 	}
+	if curriculumChanged {
+		err = createCurriculumVersion(ctx, course)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // delete course, return #delete entries, error
-func deleteCourse(pid primitive.ObjectID) (int, error) {
+func deleteCourse(ctx context.Context, pid primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
 		}
 	}()
 
 	// check course-student dependency
-	studentCourseReferences, err := findStudentCourseRef(primitive.NilObjectID, pid)
+	studentCourseReferences, err := findStudentCourseRef(ctx, primitive.NilObjectID, pid)
 	if err == nil && len(studentCourseReferences) > 0 {
 		err = fmt.Errorf("[%s] - student-course dependency unresolved (e.g. student PID %s course PID %s)",
 			serverErrorMessages[seDependencyIssue], studentCourseReferences[0].StudentPID.Hex(), studentCourseReferences[0].CoursePID.Hex())
 		return 0, err
 	}
 
+	// check course-session dependency
+	sessions, err := findClassSession(ctx, primitive.NilObjectID, pid)
+	if err == nil && len(sessions) > 0 {
+		err = fmt.Errorf("[%s] - class session dependency unresolved (e.g. session PID %s course PID %s)",
+			serverErrorMessages[seDependencyIssue], sessions[0].PID.Hex(), sessions[0].CoursePID.Hex())
+		return 0, err
+	}
+
 	var deleteFilter bson.D = bson.D{}
 	if !pid.IsZero() {
 		deleteFilter = append(deleteFilter, bson.E{"_id", pid})
 	}
+	deleteFilter = dbTenantFilter(ctx, deleteFilter)
 
-	deleteResult, err := dbPool.Collection(DBCollectionCourse).DeleteMany(context.TODO(), deleteFilter)
+	// schedules and curriculum versions belong to course only
+	_, err = deleteCourseSchedule(ctx, primitive.NilObjectID, pid)
+	if err != nil {
+		return 0, err
+	}
+	_, err = deleteCurriculumVersion(ctx, pid)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
 		return 0, err
 	}
 
-	logging.Debugmf(logModCourseMgmt, "Deleted %d course results from DB", deleteResult.DeletedCount)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionCourse).DeleteMany(dbCtx, deleteFilter)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Deleted %d course results from DB", deleteResult.DeletedCount)
 	return int(deleteResult.DeletedCount), nil
 }
+
+// default rubric of courses without own rubric
+var defaultCourseRubric = []RubricLevel{
+	{Score: 1, Label: "beginning"},
+	{Score: 2, Label: "developing"},
+	{Score: 3, Label: "meets target"},
+	{Score: 4, Label: "exceeds target"},
+	{Score: 5, Label: "mastered"},
+}
+
+// check course rubric (labelled levels with distinct scores), sort levels by score
+func courseRubricCheck(course *Course) error {
+	if course.Rubric == nil {
+		course.Rubric = []RubricLevel{}
+	}
+	var scoreMap = map[int]bool{}
+	for _, level := range course.Rubric {
+		if level.Label == "" {
+			return fmt.Errorf("[%s] - Rubric level (score %d) has no label", serverErrorMessages[seInputSchemaNotValid], level.Score)
+		}
+		if scoreMap[level.Score] {
+			return fmt.Errorf("[%s] - Rubric score %d is defined more than once", serverErrorMessages[seInputSchemaNotValid], level.Score)
+		}
+		scoreMap[level.Score] = true
+	}
+	sort.Slice(course.Rubric, func(i, j int) bool {
+		return course.Rubric[i].Score < course.Rubric[j].Score
+	})
+	return nil
+}
+
+// rubric of a course (default rubric if not configured)
+func courseRubric(course *Course) []RubricLevel {
+	if len(course.Rubric) == 0 {
+		return defaultCourseRubric
+	}
+	return course.Rubric
+}
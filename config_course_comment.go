@@ -44,7 +44,7 @@ func courseCommentGetHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	courseComments, err = findCourseComment(pid)
+	courseComments, err = findCourseComment(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -73,7 +73,7 @@ func courseCommentPostHandler(ctx *gin.Context) {
 		return
 	}
 
-	courseCommentPID, err = createCourseComment(&courseComment)
+	courseCommentPID, err = createCourseComment(ctx.Request.Context(), &courseComment)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -101,7 +101,7 @@ func courseCommentPutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateCourseComment(&courseComment)
+	err = updateCourseComment(ctx.Request.Context(), &courseComment)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -135,7 +135,7 @@ func courseCommentDeleteHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteCourseComment(pid)
+	deletedRows, err = deleteCourseComment(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -146,11 +146,11 @@ func courseCommentDeleteHandler(ctx *gin.Context) {
 }
 
 // find course comment, return course comment slice, error
-func findCourseComment(pid primitive.ObjectID) ([]*CourseComment, error) {
+func findCourseComment(ctx context.Context, pid primitive.ObjectID) ([]*CourseComment, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseCommentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseCommentMgmt, err.Error())
 		}
 	}()
 
@@ -162,19 +162,22 @@ func findCourseComment(pid primitive.ObjectID) ([]*CourseComment, error) {
 		findOptions.SetLimit(1)
 		findFilter = bson.D{{"_id", pid}}
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionCourseComment).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCourseComment).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	courseComments := []*CourseComment{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var courseComment CourseComment
 		err = findCursor.Decode(&courseComment)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		courseComments = append(courseComments, &courseComment)
@@ -182,38 +185,41 @@ func findCourseComment(pid primitive.ObjectID) ([]*CourseComment, error) {
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModCourseCommentMgmt, "Found %d course comments from DB (PID=%v)", len(courseComments), pid.Hex())
+	loggingWithContext(ctx).Debugmf(logModCourseCommentMgmt, "Found %d course comments from DB (PID=%v)", len(courseComments), pid.Hex())
 	return courseComments, nil
 }
 
 // find course comment by course record pid, return course comment slice, error
-func findCourseCommentByRecordPID(courseRecordPID primitive.ObjectID) ([]*CourseComment, error) {
+func findCourseCommentByRecordPID(ctx context.Context, courseRecordPID primitive.ObjectID) ([]*CourseComment, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseCommentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseCommentMgmt, err.Error())
 		}
 	}()
 
 	var findOptions = options.Find()
 	var findFilter = bson.D{{"course_record_pid", courseRecordPID}}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionCourseComment).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCourseComment).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	courseComments := []*CourseComment{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var courseComment CourseComment
 		err = findCursor.Decode(&courseComment)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		courseComments = append(courseComments, &courseComment)
@@ -221,20 +227,20 @@ func findCourseCommentByRecordPID(courseRecordPID primitive.ObjectID) ([]*Course
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModCourseCommentMgmt, "Found %d course comments from DB (course record PID=%v)", len(courseComments), courseRecordPID.Hex())
+	loggingWithContext(ctx).Debugmf(logModCourseCommentMgmt, "Found %d course comments from DB (course record PID=%v)", len(courseComments), courseRecordPID.Hex())
 	return courseComments, nil
 }
 
 // create course comment, return PID, error
-func createCourseComment(courseComment *CourseComment) (primitive.ObjectID, error) {
+func createCourseComment(ctx context.Context, courseComment *CourseComment) (primitive.ObjectID, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseCommentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseCommentMgmt, err.Error())
 		}
 	}()
 
@@ -243,52 +249,68 @@ func createCourseComment(courseComment *CourseComment) (primitive.ObjectID, erro
 		err = fmt.Errorf("[%s] - No course record PID specified", serverErrorMessages[seResourceNotFound])
 		return primitive.NilObjectID, err
 	}
-	courseRecords, err := findCourseRecord(courseComment.CourseRecordPID)
+	courseRecords, err := findCourseRecord(ctx, courseComment.CourseRecordPID)
 	if err != nil || len(courseRecords) == 0 {
 		err = fmt.Errorf("[%s] - No associate course records found with PID %s", serverErrorMessages[seResourceNotFound], courseComment.CourseRecordPID.Hex())
 		return primitive.NilObjectID, err
 	}
+	courseComment.InstitutePID = courseRecords[0].InstitutePID
 
 	// person type check
 	if courseComment.CommentPersonType == CommentPersonTypeTeacher {
 		var teachers []*Teacher
-		teachers, err = findTeacher(courseComment.CommentPersonPID)
+		teachers, err = findTeacher(ctx, courseComment.CommentPersonPID)
 		if err != nil || len(teachers) == 0 {
 			err = fmt.Errorf("[%s] - No comment person (%s) found with PID %s", serverErrorMessages[seResourceNotFound],
 				courseComment.CommentPersonType, courseComment.CourseRecordPID.Hex())
 			return primitive.NilObjectID, err
 		}
+		err = courseCommentStaffRole(ctx, courseComment, courseRecords[0])
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
 	} else if courseComment.CommentPersonType == CommentPersonTypeRelative {
 		var relatives []*Relative
-		relatives, err = findRelative(courseComment.CommentPersonPID)
+		relatives, err = findRelative(ctx, courseComment.CommentPersonPID)
 		if err != nil || len(relatives) == 0 {
 			err = fmt.Errorf("[%s] - No comment person (%s) found with PID %s", serverErrorMessages[seResourceNotFound],
 				courseComment.CommentPersonType, courseComment.CourseRecordPID.Hex())
 			return primitive.NilObjectID, err
 		}
+		courseComment.StaffRole = ""
+		// relative must be bound to the student with comment permission
+		var references []*StudentRelativeRef
+		references, err = findStudentRelativeRef(ctx, courseRecords[0].StudentPID, courseComment.CommentPersonPID)
+		if err != nil || len(references) == 0 || !studentRelativeRefCanComment(references[0]) {
+			err = fmt.Errorf("[%s] - Relative (PID %s) is not allowed to comment on course records of student (PID %s)", serverErrorMessages[seResourceConflict],
+				courseComment.CommentPersonPID.Hex(), courseRecords[0].StudentPID.Hex())
+			return primitive.NilObjectID, err
+		}
 	} else {
 		err = fmt.Errorf("[%s] - Comment person type must be %s or %s", serverErrorMessages[seResourceNotFound],
 			CommentPersonTypeTeacher, CommentPersonTypeRelative)
 		return primitive.NilObjectID, err
 	}
 
-	insertResult, err := dbPool.Collection(DBCollectionCourseComment).InsertOne(context.TODO(), courseComment)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionCourseComment).InsertOne(dbCtx, courseComment)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return primitive.NilObjectID, err
 	}
 
 	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModCourseCommentMgmt, "Created course comment in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	loggingWithContext(ctx).Debugmf(logModCourseCommentMgmt, "Created course comment in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
 	return lastInsertID, nil
 }
 
 // update course comment, return error
-func updateCourseComment(courseComment *CourseComment) error {
+func updateCourseComment(ctx context.Context, courseComment *CourseComment) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseCommentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseCommentMgmt, err.Error())
 		}
 	}()
 
@@ -303,36 +325,50 @@ func updateCourseComment(courseComment *CourseComment) error {
 		err = fmt.Errorf("[%s] - No course record PID specified", serverErrorMessages[seResourceNotFound])
 		return err
 	}
-	courseRecords, err := findCourseRecord(courseComment.CourseRecordPID)
+	courseRecords, err := findCourseRecord(ctx, courseComment.CourseRecordPID)
 	if err != nil || len(courseRecords) == 0 {
 		err = fmt.Errorf("[%s] - No associate course records found with PID %s", serverErrorMessages[seResourceNotFound], courseComment.CourseRecordPID.Hex())
 		return err
 	}
+	courseComment.InstitutePID = courseRecords[0].InstitutePID
 
 	// person type check
 	if courseComment.CommentPersonType == CommentPersonTypeTeacher {
 		var teachers []*Teacher
-		teachers, err = findTeacher(courseComment.CommentPersonPID)
+		teachers, err = findTeacher(ctx, courseComment.CommentPersonPID)
 		if err != nil || len(teachers) == 0 {
 			err = fmt.Errorf("[%s] - No comment person (%s) found with PID %s", serverErrorMessages[seResourceNotFound],
 				courseComment.CommentPersonType, courseComment.CourseRecordPID.Hex())
 			return err
 		}
+		err = courseCommentStaffRole(ctx, courseComment, courseRecords[0])
+		if err != nil {
+			return err
+		}
 	} else if courseComment.CommentPersonType == CommentPersonTypeRelative {
 		var relatives []*Relative
-		relatives, err = findRelative(courseComment.CommentPersonPID)
+		relatives, err = findRelative(ctx, courseComment.CommentPersonPID)
 		if err != nil || len(relatives) == 0 {
 			err = fmt.Errorf("[%s] - No comment person (%s) found with PID %s", serverErrorMessages[seResourceNotFound],
 				courseComment.CommentPersonType, courseComment.CourseRecordPID.Hex())
 			return err
 		}
+		courseComment.StaffRole = ""
+		// relative must be bound to the student with comment permission
+		var references []*StudentRelativeRef
+		references, err = findStudentRelativeRef(ctx, courseRecords[0].StudentPID, courseComment.CommentPersonPID)
+		if err != nil || len(references) == 0 || !studentRelativeRefCanComment(references[0]) {
+			err = fmt.Errorf("[%s] - Relative (PID %s) is not allowed to comment on course records of student (PID %s)", serverErrorMessages[seResourceConflict],
+				courseComment.CommentPersonPID.Hex(), courseRecords[0].StudentPID.Hex())
+			return err
+		}
 	} else {
 		err = fmt.Errorf("[%s] - Comment person type must be %s or %s", serverErrorMessages[seResourceNotFound],
 			CommentPersonTypeTeacher, CommentPersonTypeRelative)
 		return err
 	}
 
-	var updateFilter = bson.D{{"_id", courseComment.PID}}
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", courseComment.PID}})
 	var updateBSONDocument = bson.D{}
 	courseCommentBSONData, err := bson.Marshal(courseComment)
 	if err != nil {
@@ -346,13 +382,15 @@ func updateCourseComment(courseComment *CourseComment) error {
 	}
 	var updateOptions = bson.D{{"$set", updateBSONDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionCourseComment).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionCourseComment).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModCourseCommentMgmt, "Update course comment (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModCourseCommentMgmt, "Update course comment (PID %s): matched %d modified %d",
 		courseComment.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
 		err = fmt.Errorf("[%s] - could not find course comment (PID %s)", serverErrorMessages[seResourceNotFound], courseComment.PID.Hex())
@@ -365,11 +403,11 @@ func updateCourseComment(courseComment *CourseComment) error {
 }
 
 // delete course comment, return #delete entries, error
-func deleteCourseComment(pid primitive.ObjectID) (int, error) {
+func deleteCourseComment(ctx context.Context, pid primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseCommentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseCommentMgmt, err.Error())
 		}
 	}()
 
@@ -379,33 +417,52 @@ func deleteCourseComment(pid primitive.ObjectID) (int, error) {
 	} else {
 		deleteFilter = bson.D{{"_id", pid}}
 	}
+	deleteFilter = dbTenantFilter(ctx, deleteFilter)
 
-	deleteResult, err := dbPool.Collection(DBCollectionCourseComment).DeleteMany(context.TODO(), deleteFilter)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionCourseComment).DeleteMany(dbCtx, deleteFilter)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return 0, err
 	}
 
-	logging.Debugmf(logModInstituteMgmt, "Deleted %d course comments from DB", deleteResult.DeletedCount)
+	loggingWithContext(ctx).Debugmf(logModInstituteMgmt, "Deleted %d course comments from DB", deleteResult.DeletedCount)
 	return int(deleteResult.DeletedCount), nil
 }
 
 // delete course comment by record pid, return #delete entries, error
-func deleteCourseCommentByRecordPID(courseRecordPID primitive.ObjectID) (int, error) {
+func deleteCourseCommentByRecordPID(ctx context.Context, courseRecordPID primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseCommentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseCommentMgmt, err.Error())
 		}
 	}()
 
 	deleteFilter := bson.D{{"course_record_pid", courseRecordPID}}
-	deleteResult, err := dbPool.Collection(DBCollectionCourseComment).DeleteMany(context.TODO(), deleteFilter)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionCourseComment).DeleteMany(dbCtx, deleteFilter)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return 0, err
 	}
 
-	logging.Debugmf(logModInstituteMgmt, "Deleted %d course comments from DB (course record PID %s)", deleteResult.DeletedCount, courseRecordPID.Hex())
+	loggingWithContext(ctx).Debugmf(logModInstituteMgmt, "Deleted %d course comments from DB (course record PID %s)", deleteResult.DeletedCount, courseRecordPID.Hex())
 	return int(deleteResult.DeletedCount), nil
 }
+
+// teacher comments are attributed to the course staff role at record time (teacher not on staff then cannot comment), return error
+func courseCommentStaffRole(ctx context.Context, courseComment *CourseComment, courseRecord *CourseRecord) error {
+	courses, err := findCourse(ctx, courseRecord.CoursePID)
+	if err != nil || len(courses) == 0 {
+		return fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], courseRecord.CoursePID.Hex())
+	}
+	courseComment.StaffRole = courseStaffRoleAt(courses[0], courseComment.CommentPersonPID, courseRecord.RecordTS)
+	if courseComment.StaffRole == "" {
+		return fmt.Errorf("[%s] - Teacher (PID %s) was not on staff of course (PID %s) at course record time", serverErrorMessages[seResourceConflict],
+			courseComment.CommentPersonPID.Hex(), courseRecord.CoursePID.Hex())
+	}
+	return nil
+}
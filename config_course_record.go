@@ -44,7 +44,7 @@ func courseRecordGetHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	courseRecords, err = findCourseRecord(pid)
+	courseRecords, err = findCourseRecord(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -73,7 +73,7 @@ func courseRecordPostHandler(ctx *gin.Context) {
 		return
 	}
 
-	courseRecordPID, err = createCourseRecord(&courseRecord)
+	courseRecordPID, err = createCourseRecord(ctx.Request.Context(), &courseRecord)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -101,7 +101,7 @@ func courseRecordPutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateCourseRecord(&courseRecord)
+	err = updateCourseRecord(ctx.Request.Context(), &courseRecord)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -135,7 +135,7 @@ func courseRecordDeleteHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteCourseRecord(pid)
+	deletedRows, err = deleteCourseRecord(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -146,11 +146,11 @@ func courseRecordDeleteHandler(ctx *gin.Context) {
 }
 
 // find course record, return course record slice, error
-func findCourseRecord(pid primitive.ObjectID) ([]*CourseRecord, error) {
+func findCourseRecord(ctx context.Context, pid primitive.ObjectID) ([]*CourseRecord, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseRecordMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseRecordMgmt, err.Error())
 		}
 	}()
 
@@ -162,19 +162,22 @@ func findCourseRecord(pid primitive.ObjectID) ([]*CourseRecord, error) {
 		findOptions.SetLimit(1)
 		findFilter = bson.D{{"_id", pid}}
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionCourseRecord).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCourseRecord).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	courseRecords := []*CourseRecord{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var courseRecord CourseRecord
 		err = findCursor.Decode(&courseRecord)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		courseRecords = append(courseRecords, &courseRecord)
@@ -182,20 +185,20 @@ func findCourseRecord(pid primitive.ObjectID) ([]*CourseRecord, error) {
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModCourseRecordMgmt, "Found %d course records from DB (PID=%v)", len(courseRecords), pid.Hex())
+	loggingWithContext(ctx).Debugmf(logModCourseRecordMgmt, "Found %d course records from DB (PID=%v)", len(courseRecords), pid.Hex())
 	return courseRecords, nil
 }
 
 // find course record by student pid and course pid, return course record slice, error
-func findCourseRecordByStudentPIDAndCoursePID(studentPID primitive.ObjectID, coursePID primitive.ObjectID) ([]*CourseRecord, error) {
+func findCourseRecordByStudentPIDAndCoursePID(ctx context.Context, studentPID primitive.ObjectID, coursePID primitive.ObjectID) ([]*CourseRecord, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseRecordMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseRecordMgmt, err.Error())
 		}
 	}()
 
@@ -207,19 +210,22 @@ func findCourseRecordByStudentPIDAndCoursePID(studentPID primitive.ObjectID, cou
 	if !coursePID.IsZero() {
 		findFilter = append(findFilter, bson.E{"course_pid", coursePID})
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionCourseRecord).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCourseRecord).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	courseRecords := []*CourseRecord{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var courseRecord CourseRecord
 		err = findCursor.Decode(&courseRecord)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		courseRecords = append(courseRecords, &courseRecord)
@@ -227,21 +233,62 @@ func findCourseRecordByStudentPIDAndCoursePID(studentPID primitive.ObjectID, cou
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModCourseRecordMgmt, "Found %d course records from DB (studentPID=%v, coursePID=%v)",
+	loggingWithContext(ctx).Debugmf(logModCourseRecordMgmt, "Found %d course records from DB (studentPID=%v, coursePID=%v)",
 		len(courseRecords), studentPID.Hex(), coursePID.Hex())
 	return courseRecords, nil
 }
 
+// find course records of a class session, return course record slice, error
+func findCourseRecordBySessionPID(ctx context.Context, sessionPID primitive.ObjectID) ([]*CourseRecord, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCourseRecordMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find()
+	var findFilter = dbTenantFilter(ctx, bson.D{{"session_pid", sessionPID}})
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCourseRecord).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	courseRecords := []*CourseRecord{}
+	for findCursor.Next(dbCtx) {
+		var courseRecord CourseRecord
+		err = findCursor.Decode(&courseRecord)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		courseRecords = append(courseRecords, &courseRecord)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseRecordMgmt, "Found %d course records from DB (sessionPID=%v)", len(courseRecords), sessionPID.Hex())
+	return courseRecords, nil
+}
+
 // create course record, return PID, error
-func createCourseRecord(courseRecord *CourseRecord) (primitive.ObjectID, error) {
+func createCourseRecord(ctx context.Context, courseRecord *CourseRecord) (primitive.ObjectID, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseRecordMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseRecordMgmt, err.Error())
 		}
 	}()
 
@@ -257,51 +304,78 @@ func createCourseRecord(courseRecord *CourseRecord) (primitive.ObjectID, error)
 		return primitive.NilObjectID, err
 	}
 
+	// attendance check (single records are present or makeup, absent for approved leave requests)
+	if courseRecord.Attendance == "" {
+		courseRecord.Attendance = AttendancePresent
+		if courseRecord.IsMakeUp {
+			courseRecord.Attendance = AttendanceMakeUp
+		}
+	}
+	if !attendanceMap[courseRecord.Attendance] {
+		err = fmt.Errorf("[%s] - Attendance can only be %s/%s/%s", serverErrorMessages[seInputSchemaNotValid], AttendancePresent, AttendanceAbsent, AttendanceMakeUp)
+		return primitive.NilObjectID, err
+	}
+	courseRecord.IsMakeUp = courseRecord.Attendance == AttendanceMakeUp
+
 	// student-course reference check
-	studentCourseReferences, err := findStudentCourseRef(courseRecord.StudentPID, courseRecord.CoursePID)
+	studentCourseReferences, err := findStudentCourseRef(ctx, courseRecord.StudentPID, courseRecord.CoursePID)
 	if err != nil || len(studentCourseReferences) == 0 {
 		err = fmt.Errorf("[%s] - No student-course reference found with student PID %s and course PID %s -> cannot generate record",
 			serverErrorMessages[seResourceNotFound], courseRecord.StudentPID.Hex(), courseRecord.CoursePID.Hex())
 		return primitive.NilObjectID, err
 	}
 
+	// makeup records redeem a makeup entitlement
+	if courseRecord.IsMakeUp {
+		err = lessonCreditCheckMakeUp(ctx, courseRecord.StudentPID, courseRecord.CoursePID, primitive.NilObjectID)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+	}
+
 	// course target tags check
-	courses, err := findCourse(courseRecord.CoursePID)
+	courses, err := findCourse(ctx, courseRecord.CoursePID)
 	if err != nil || len(courses) == 0 {
 		err = fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], courseRecord.CoursePID.Hex())
 		return primitive.NilObjectID, err
 	}
-	courseTargets := courses[0].CourseTargets
-	courseTargetTagValid := false
-	for i := 0; i < len(courseTargets); i++ {
-		if courseRecord.TargetTag == courseTargets[i].Tag {
-			courseTargetTagValid = true
-			break
-		}
-	}
-	if courseTargetTagValid == false || courseRecord.TargetTag == "" {
-		err = fmt.Errorf("[%s] - No valid course target tag (\"%v\") specified", serverErrorMessages[seResourceNotFound], courseRecord.TargetTag)
+	// new records follow the curriculum version in force (retired targets are not assessed anymore)
+	courseRecord.CurriculumVersion = courses[0].CurriculumVersion
+	courseRecord.InstitutePID = courses[0].InstitutePID
+	err = courseRecordTargetCheck(courseRecord, courses[0], courses[0].CourseTargets, false)
+	if err != nil {
 		return primitive.NilObjectID, err
 	}
 
-	insertResult, err := dbPool.Collection(DBCollectionCourseRecord).InsertOne(context.TODO(), courseRecord)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionCourseRecord).InsertOne(dbCtx, courseRecord)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return primitive.NilObjectID, err
 	}
 
 	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModCourseRecordMgmt, "Created course record in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	loggingWithContext(ctx).Debugmf(logModCourseRecordMgmt, "Created course record in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+
+	// lesson credit ledger (record is removed again if credits could not be booked)
+	courseRecord.PID = lastInsertID
+	err = applyLessonCreditRecords(ctx, []*CourseRecord{courseRecord})
+	if err != nil {
+		_, _ = dbPool.Collection(DBCollectionCourseRecord).DeleteOne(dbCtx, bson.D{{"_id", lastInsertID}})
+		err = fmt.Errorf("%s -> course record (PID %s) is rolled back", err.Error(), lastInsertID.Hex())
+		return primitive.NilObjectID, err
+	}
 
 	return lastInsertID, nil
 }
 
 // update course record, return error
-func updateCourseRecord(courseRecord *CourseRecord) error {
+func updateCourseRecord(ctx context.Context, courseRecord *CourseRecord) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseRecordMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseRecordMgmt, err.Error())
 		}
 	}()
 
@@ -323,35 +397,71 @@ func updateCourseRecord(courseRecord *CourseRecord) error {
 		return err
 	}
 
+	// attendance check
+	if courseRecord.Attendance == "" {
+		courseRecord.Attendance = AttendancePresent
+		if courseRecord.IsMakeUp {
+			courseRecord.Attendance = AttendanceMakeUp
+		}
+	}
+	if !attendanceMap[courseRecord.Attendance] {
+		err = fmt.Errorf("[%s] - Attendance can only be %s/%s/%s", serverErrorMessages[seInputSchemaNotValid], AttendancePresent, AttendanceAbsent, AttendanceMakeUp)
+		return err
+	}
+	courseRecord.IsMakeUp = courseRecord.Attendance == AttendanceMakeUp
+
 	// student-course reference check
-	studentCourseReferences, err := findStudentCourseRef(courseRecord.StudentPID, courseRecord.CoursePID)
+	studentCourseReferences, err := findStudentCourseRef(ctx, courseRecord.StudentPID, courseRecord.CoursePID)
 	if err != nil || len(studentCourseReferences) == 0 {
 		err = fmt.Errorf("[%s] - No student-course reference found with student PID %s and course PID %s -> cannot generate record",
 			serverErrorMessages[seResourceNotFound], courseRecord.StudentPID.Hex(), courseRecord.CoursePID.Hex())
 		return err
 	}
 
+	// makeup records redeem a makeup entitlement
+	if courseRecord.IsMakeUp {
+		err = lessonCreditCheckMakeUp(ctx, courseRecord.StudentPID, courseRecord.CoursePID, courseRecord.PID)
+		if err != nil {
+			return err
+		}
+	}
+
 	// course target tags check
-	courses, err := findCourse(courseRecord.CoursePID)
+	courses, err := findCourse(ctx, courseRecord.CoursePID)
 	if err != nil || len(courses) == 0 {
 		err = fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], courseRecord.CoursePID.Hex())
 		return err
 	}
-	courseTargets := courses[0].CourseTargets
-	courseTargetTagValid := false
-	for i := 0; i < len(courseTargets); i++ {
-		if courseRecord.TargetTag == courseTargets[i].Tag {
-			courseTargetTagValid = true
-			break
+
+	// records stay valid against the curriculum version in force when they were created
+	storedRecords, err := findCourseRecord(ctx, courseRecord.PID)
+	if err != nil || len(storedRecords) == 0 {
+		err = fmt.Errorf("[%s] - could not find course record (PID %s)", serverErrorMessages[seResourceNotFound], courseRecord.PID.Hex())
+		return err
+	}
+	courseRecord.CurriculumVersion = storedRecords[0].CurriculumVersion
+	courseRecord.InstitutePID = courses[0].InstitutePID
+	curriculumTargets, err := curriculumTargetsOf(ctx, courses[0], courseRecord.CurriculumVersion)
+	if err != nil {
+		return err
+	}
+	// records older than versioning may refer to targets removed before retiring was kept
+	if courseRecord.TargetTag != "" && courseRecord.TargetTag == storedRecords[0].TargetTag {
+		var knownTag = false
+		for _, target := range curriculumTargets {
+			knownTag = knownTag || target.Tag == courseRecord.TargetTag
+		}
+		if !knownTag {
+			curriculumTargets = append(append([]CourseTarget{}, curriculumTargets...), CourseTarget{Tag: courseRecord.TargetTag, Retired: true})
 		}
 	}
-	if courseTargetTagValid == false || courseRecord.TargetTag == "" {
-		err = fmt.Errorf("[%s] - No valid course target tag (\"%v\") specified", serverErrorMessages[seResourceNotFound], courseRecord.TargetTag)
+	err = courseRecordTargetCheck(courseRecord, courses[0], curriculumTargets, true)
+	if err != nil {
 		return err
 	}
 
 	// update course record
-	var updateFilter = bson.D{{"_id", courseRecord.PID}}
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", courseRecord.PID}})
 	var updateBSONDocument = bson.D{}
 	courseRecordBSONData, err := bson.Marshal(courseRecord)
 	if err != nil {
@@ -365,13 +475,15 @@ func updateCourseRecord(courseRecord *CourseRecord) error {
 	}
 	var updateOptions = bson.D{{"$set", updateBSONDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionCourseRecord).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionCourseRecord).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModCourseRecordMgmt, "Update course record (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModCourseRecordMgmt, "Update course record (PID %s): matched %d modified %d",
 		courseRecord.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
 		err = fmt.Errorf("[%s] - could not find course record (PID %s)", serverErrorMessages[seResourceNotFound], courseRecord.PID.Hex())
@@ -380,19 +492,25 @@ func updateCourseRecord(courseRecord *CourseRecord) error {
 		err = fmt.Errorf("[%s] - course record (PID %s) not changed", serverErrorMessages[seResourceNotChange], courseRecord.PID.Hex())
 		return err
 	}
+
+	// lesson credit ledger follows attendance
+	err = applyLessonCreditRecords(ctx, []*CourseRecord{courseRecord})
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
 // delete course record, return #delete entries, error
-func deleteCourseRecord(pid primitive.ObjectID) (int, error) {
+func deleteCourseRecord(ctx context.Context, pid primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseRecordMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseRecordMgmt, err.Error())
 		}
 	}()
 
-	courseRecords, findErr := findCourseRecord(pid)
+	courseRecords, findErr := findCourseRecord(ctx, pid)
 	if findErr != nil {
 		err = fmt.Errorf("[%s] - could not delete course records (PID %s) due to DB query/find error occurs", serverErrorMessages[seDBResourceQuery], pid.Hex())
 		return 0, err
@@ -400,43 +518,51 @@ func deleteCourseRecord(pid primitive.ObjectID) (int, error) {
 
 	var deleteCnt int64
 	for i := range courseRecords {
-		_, deleteCommentErr := deleteCourseCommentByRecordPID(courseRecords[i].PID)
+		_, deleteCommentErr := deleteCourseCommentByRecordPID(ctx, courseRecords[i].PID)
 		if deleteCommentErr != nil {
 			err = fmt.Errorf("[%s] - stop deleting course record (PID %s) since course comment could not be deleted: %s",
 				serverErrorMessages[seCloudOpsError], courseRecords[i].PID, deleteCommentErr.Error())
 			return int(deleteCnt), err
 		}
-		_, deleteMediaErr := deleteCloudMediaByRecordPID(courseRecords[i].PID)
+		_, deleteMediaErr := deleteCloudMediaByRecordPID(ctx, courseRecords[i].PID)
 		if deleteMediaErr != nil {
 			err = fmt.Errorf("[%s] - stop deleting course record (PID %s) since cloud media could not be deleted: %s",
 				serverErrorMessages[seCloudOpsError], courseRecords[i].PID, deleteMediaErr.Error())
 			return int(deleteCnt), err
 		}
+		_, deleteCreditErr := deleteLessonCreditByRecordPID(ctx, courseRecords[i].PID)
+		if deleteCreditErr != nil {
+			err = fmt.Errorf("[%s] - stop deleting course record (PID %s) since lesson credit entries could not be deleted: %s",
+				serverErrorMessages[seDependencyIssue], courseRecords[i].PID, deleteCreditErr.Error())
+			return int(deleteCnt), err
+		}
 
 		deleteFilter := bson.D{{"_id", courseRecords[i].PID}}
-		deleteResult, err := dbPool.Collection(DBCollectionCourseRecord).DeleteMany(context.TODO(), deleteFilter)
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		deleteResult, err := dbPool.Collection(DBCollectionCourseRecord).DeleteMany(dbCtx, deleteFilter)
+		dbCancel()
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return 0, err
 		}
 
 		deleteCnt += deleteResult.DeletedCount
 	}
 
-	logging.Debugmf(logModCourseRecordMgmt, "Deleted %d course records from DB", deleteCnt)
+	loggingWithContext(ctx).Debugmf(logModCourseRecordMgmt, "Deleted %d course records from DB", deleteCnt)
 	return int(deleteCnt), nil
 }
 
 // delete course record by student/course pid, return #delete entries, error
-func deleteCourseRecordByStudentPIDAndCoursePID(studentPID primitive.ObjectID, coursePID primitive.ObjectID) (int, error) {
+func deleteCourseRecordByStudentPIDAndCoursePID(ctx context.Context, studentPID primitive.ObjectID, coursePID primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModCourseRecordMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModCourseRecordMgmt, err.Error())
 		}
 	}()
 
-	courseRecords, findErr := findCourseRecordByStudentPIDAndCoursePID(studentPID, coursePID)
+	courseRecords, findErr := findCourseRecordByStudentPIDAndCoursePID(ctx, studentPID, coursePID)
 	if findErr != nil {
 		err = fmt.Errorf("[%s] - could not delete cloud media DB entries due to query error", serverErrorMessages[seResourceNotFound])
 		return 0, err
@@ -444,29 +570,75 @@ func deleteCourseRecordByStudentPIDAndCoursePID(studentPID primitive.ObjectID, c
 
 	var deleteCnt int64
 	for i := range courseRecords {
-		_, deleteCommentErr := deleteCourseCommentByRecordPID(courseRecords[i].PID)
+		_, deleteCommentErr := deleteCourseCommentByRecordPID(ctx, courseRecords[i].PID)
 		if deleteCommentErr != nil {
 			err = fmt.Errorf("[%s] - stop deleting course record (student PID %s course PID %s) since course comment could not be deleted: %s",
 				serverErrorMessages[seCloudOpsError], courseRecords[i].StudentPID, courseRecords[i].CoursePID, deleteCommentErr.Error())
 			return int(deleteCnt), err
 		}
-		_, deleteMediaErr := deleteCloudMediaByRecordPID(courseRecords[i].PID)
+		_, deleteMediaErr := deleteCloudMediaByRecordPID(ctx, courseRecords[i].PID)
 		if deleteMediaErr != nil {
 			err = fmt.Errorf("[%s] - stop deleting course record (student PID %s course PID %s) since cloud media could not be deleted: %s",
 				serverErrorMessages[seCloudOpsError], courseRecords[i].StudentPID, courseRecords[i].CoursePID, deleteMediaErr.Error())
 			return int(deleteCnt), err
 		}
+		_, deleteCreditErr := deleteLessonCreditByRecordPID(ctx, courseRecords[i].PID)
+		if deleteCreditErr != nil {
+			err = fmt.Errorf("[%s] - stop deleting course record (student PID %s course PID %s) since lesson credit entries could not be deleted: %s",
+				serverErrorMessages[seDependencyIssue], courseRecords[i].StudentPID, courseRecords[i].CoursePID, deleteCreditErr.Error())
+			return int(deleteCnt), err
+		}
 
 		deleteFilter := bson.D{{"_id", courseRecords[i].PID}}
-		deleteResult, err := dbPool.Collection(DBCollectionCourseRecord).DeleteMany(context.TODO(), deleteFilter)
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		deleteResult, err := dbPool.Collection(DBCollectionCourseRecord).DeleteMany(dbCtx, deleteFilter)
+		dbCancel()
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return 0, err
 		}
 
 		deleteCnt += deleteResult.DeletedCount
 	}
 
-	logging.Debugmf(logModCourseRecordMgmt, "Deleted %d course records from DB", deleteCnt)
+	loggingWithContext(ctx).Debugmf(logModCourseRecordMgmt, "Deleted %d course records from DB", deleteCnt)
 	return int(deleteCnt), nil
 }
+
+// check target tag and assessed targets (known tags of curriculum, once each, scores of course rubric) of a course record
+func courseRecordTargetCheck(courseRecord *CourseRecord, course *Course, targets []CourseTarget, allowRetired bool) error {
+	var courseTargetMap = map[string]bool{}
+	for i := range targets {
+		courseTargetMap[targets[i].Tag] = allowRetired || !targets[i].Retired
+	}
+	var rubricMap = map[int]bool{}
+	for _, level := range courseRubric(course) {
+		rubricMap[level.Score] = true
+	}
+
+	if courseRecord.Targets == nil {
+		courseRecord.Targets = []CourseRecordTarget{}
+	}
+	if courseRecord.TargetTag == "" && len(courseRecord.Targets) > 0 {
+		courseRecord.TargetTag = courseRecord.Targets[0].Tag
+	}
+	if !courseTargetMap[courseRecord.TargetTag] || courseRecord.TargetTag == "" {
+		return fmt.Errorf("[%s] - No valid course target tag (\"%v\") specified", serverErrorMessages[seResourceNotFound], courseRecord.TargetTag)
+	}
+
+	var assessedMap = map[string]bool{}
+	for _, target := range courseRecord.Targets {
+		if !courseTargetMap[target.Tag] {
+			return fmt.Errorf("[%s] - No valid course target tag (\"%v\") specified", serverErrorMessages[seResourceNotFound], target.Tag)
+		}
+		if assessedMap[target.Tag] {
+			return fmt.Errorf("[%s] - Course target \"%s\" is assessed more than once", serverErrorMessages[seInputSchemaNotValid], target.Tag)
+		}
+		if !rubricMap[target.Score] {
+			return fmt.Errorf("[%s] - Score %d of course target \"%s\" is not in course rubric", serverErrorMessages[seInputSchemaNotValid],
+				target.Score, target.Tag)
+		}
+		assessedMap[target.Tag] = true
+	}
+	return nil
+}
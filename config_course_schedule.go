@@ -0,0 +1,626 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	scheduleDateLayout  = "2006-01-02"
+	scheduleTimeLayout  = "15:04"
+	scheduleMaxTermDays = 366
+)
+
+var courseScheduleConfigHandlerTable = map[string]gin.HandlerFunc{
+	"get":    courseScheduleGetHandler,
+	"post":   courseSchedulePostHandler,
+	"put":    courseSchedulePutHandler,
+	"delete": courseScheduleDeleteHandler,
+}
+
+func courseScheduleGetHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var schedules []*CourseSchedule
+	var err error
+	var pid, coursePID primitive.ObjectID
+	if params.PID == "all" {
+		pid = primitive.NilObjectID
+	} else {
+		pid, err = primitive.ObjectIDFromHex(params.PID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid PID (mongoDB ObjectID)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
+	// optional course filter (course_pid=?)
+	var coursePIDs []primitive.ObjectID
+	if cPID := ctx.Request.URL.Query().Get("course_pid"); cPID != "" && cPID != "all" {
+		coursePID, err = primitive.ObjectIDFromHex(cPID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid course PID (course_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+		coursePIDs = []primitive.ObjectID{coursePID}
+	}
+
+	// pid: nil objectid for all, others for specified one
+	schedules, err = findCourseSchedule(ctx.Request.Context(), pid, coursePIDs)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = schedules
+	return
+}
+
+func courseSchedulePostHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var schedule CourseSchedule
+	var schedulePID primitive.ObjectID
+	var err error
+
+	if err = json.Unmarshal(params.Data, &schedule); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	schedulePID, err = createCourseSchedule(ctx.Request.Context(), &schedule)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+	} else {
+		response.Payload = schedulePID
+	}
+	return
+}
+
+func courseSchedulePutHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var schedule CourseSchedule
+	var err error
+
+	if err = json.Unmarshal(params.Data, &schedule); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	err = updateCourseSchedule(ctx.Request.Context(), &schedule)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+	} else {
+		response.Payload = schedule.PID
+	}
+	return
+}
+
+func courseScheduleDeleteHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var err error
+	var deletedRows int
+	var pid primitive.ObjectID
+	pid, err = primitive.ObjectIDFromHex(params.PID)
+	if err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specifiy a valid PID (mongoDB ObjectID)", serverErrorMessages[seInputParamNotValid])
+		return
+	}
+
+	deletedRows, err = deleteCourseSchedule(ctx.Request.Context(), pid, primitive.NilObjectID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = deletedRows
+	return
+}
+
+// find course schedules (pid nil for all, course PIDs nil for all courses), return schedule slice, error
+func findCourseSchedule(ctx context.Context, pid primitive.ObjectID, coursePIDs []primitive.ObjectID) ([]*CourseSchedule, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find()
+	var findFilter bson.D = bson.D{}
+	if !pid.IsZero() {
+		findOptions.SetLimit(1)
+		findFilter = append(findFilter, bson.E{"_id", pid})
+	}
+	if coursePIDs != nil {
+		findFilter = append(findFilter, bson.E{"course_pid", bson.D{{"$in", coursePIDs}}})
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCourseSchedule).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	schedules := []*CourseSchedule{}
+	for findCursor.Next(dbCtx) {
+		var schedule CourseSchedule
+		err = findCursor.Decode(&schedule)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		schedules = append(schedules, &schedule)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Found %d course schedules from DB (PID=%v, %d courses)", len(schedules), pid.Hex(), len(coursePIDs))
+	return schedules, nil
+}
+
+// create course schedule (rejected if course teacher/assistant is double-booked), return PID, error
+func createCourseSchedule(ctx context.Context, schedule *CourseSchedule) (primitive.ObjectID, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		}
+	}()
+
+	schedule.PID = primitive.NilObjectID
+	err = courseScheduleCheck(ctx, schedule)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	schedule.UpdateTS = time.Now().Unix()
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionCourseSchedule).InsertOne(dbCtx, schedule)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return primitive.NilObjectID, err
+	}
+
+	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Created course schedule in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	return lastInsertID, nil
+}
+
+// update course schedule (rejected if course teacher/assistant is double-booked), return error
+func updateCourseSchedule(ctx context.Context, schedule *CourseSchedule) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		}
+	}()
+
+	// course schedule PID check
+	if schedule.PID.IsZero() {
+		err = fmt.Errorf("[%s] - course schedule PID is empty", serverErrorMessages[seInputJSONNotValid])
+		return err
+	}
+	err = courseScheduleCheck(ctx, schedule)
+	if err != nil {
+		return err
+	}
+
+	// update course schedule
+	schedule.UpdateTS = time.Now().Unix()
+	updateFilter := dbTenantFilter(ctx, bson.D{{"_id", schedule.PID}})
+	var updateBSONDocument = bson.D{}
+	scheduleBSONData, err := bson.Marshal(schedule)
+	if err != nil {
+		err = fmt.Errorf("[%s] - could not convert course schedule (PID %s) to bson data", serverErrorMessages[seInputBSONNotValid], schedule.PID.Hex())
+		return err
+	}
+	err = bson.Unmarshal(scheduleBSONData, &updateBSONDocument)
+	if err != nil {
+		err = fmt.Errorf("[%s] - could not convert course schedule (PID %s) to bson document", serverErrorMessages[seInputBSONNotValid], schedule.PID.Hex())
+		return err
+	}
+	var updateOptions = bson.D{{"$set", updateBSONDocument}}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	updateResult, err := dbPool.Collection(DBCollectionCourseSchedule).UpdateOne(dbCtx, updateFilter, updateOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Update course schedule (PID %s): matched %d modified %d",
+		schedule.PID.Hex(), updateResult.MatchedCount, updateResult.ModifiedCount)
+	if updateResult.MatchedCount == 0 {
+		err = fmt.Errorf("[%s] - could not find course schedule (PID %s)", serverErrorMessages[seResourceNotFound], schedule.PID.Hex())
+		return err
+	}
+	return nil
+}
+
+// cancel (or restore) one occurrence of a course schedule, return error
+func cancelCourseScheduleOccurrence(ctx context.Context, cancelReq *ScheduleCancelReq) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		}
+	}()
+
+	if _, parseErr := time.Parse(scheduleDateLayout, cancelReq.Date); parseErr != nil {
+		err = fmt.Errorf("[%s] - Occurrence date must be YYYY-MM-DD (\"%s\")", serverErrorMessages[seInputSchemaNotValid], cancelReq.Date)
+		return err
+	}
+
+	var operator = "$addToSet"
+	if cancelReq.Restore {
+		operator = "$pull"
+	}
+	updateFilter := dbTenantFilter(ctx, bson.D{{"_id", cancelReq.SchedulePID}})
+	var updateOptions = bson.D{
+		{operator, bson.D{{"cancellations", cancelReq.Date}}},
+		{"$set", bson.D{{"update_ts", time.Now().Unix()}}},
+	}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	updateResult, err := dbPool.Collection(DBCollectionCourseSchedule).UpdateOne(dbCtx, updateFilter, updateOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return err
+	}
+	if updateResult.MatchedCount == 0 {
+		err = fmt.Errorf("[%s] - could not find course schedule (PID %s)", serverErrorMessages[seResourceNotFound], cancelReq.SchedulePID.Hex())
+		return err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Course schedule (PID %s) occurrence %s cancelled=%v", cancelReq.SchedulePID.Hex(),
+		cancelReq.Date, !cancelReq.Restore)
+	return nil
+}
+
+// delete course schedule by PID or by course PID, return #delete entries, error
+func deleteCourseSchedule(ctx context.Context, pid primitive.ObjectID, coursePID primitive.ObjectID) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		}
+	}()
+
+	var deleteFilter bson.D = bson.D{}
+	if !pid.IsZero() {
+		deleteFilter = append(deleteFilter, bson.E{"_id", pid})
+	}
+	if !coursePID.IsZero() {
+		deleteFilter = append(deleteFilter, bson.E{"course_pid", coursePID})
+	}
+	deleteFilter = dbTenantFilter(ctx, deleteFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionCourseSchedule).DeleteMany(dbCtx, deleteFilter)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Deleted %d course schedules from DB (PID %s, coursePID %s)", deleteResult.DeletedCount,
+		pid.Hex(), coursePID.Hex())
+	return int(deleteResult.DeletedCount), nil
+}
+
+// check course schedule fields, course existence and teacher double-booking, return error
+func courseScheduleCheck(ctx context.Context, schedule *CourseSchedule) error {
+	if schedule.IntervalWeeks == 0 {
+		schedule.IntervalWeeks = 1
+	}
+	if schedule.Holidays == nil {
+		schedule.Holidays = []string{}
+	}
+	if schedule.Cancellations == nil {
+		schedule.Cancellations = []string{}
+	}
+	err := courseScheduleValidate(schedule)
+	if err != nil {
+		return err
+	}
+
+	courses, err := findCourse(ctx, schedule.CoursePID)
+	if err != nil || len(courses) == 0 {
+		return fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], schedule.CoursePID.Hex())
+	}
+	schedule.InstitutePID = courses[0].InstitutePID
+	return courseScheduleConflictCheck(ctx, schedule, courses[0])
+}
+
+// validate course schedule fields, return error
+func courseScheduleValidate(schedule *CourseSchedule) error {
+	if schedule.CoursePID.IsZero() {
+		return fmt.Errorf("[%s] - No course PID specified", serverErrorMessages[seResourceNotFound])
+	}
+	if len(schedule.Weekdays) == 0 || schedule.IntervalWeeks < 1 || schedule.DurationMinutes <= 0 {
+		return fmt.Errorf("[%s] - Course schedule needs weekdays, positive interval_weeks and duration_minutes", serverErrorMessages[seInputSchemaNotValid])
+	}
+	for _, weekday := range schedule.Weekdays {
+		if weekday < int(time.Sunday) || weekday > int(time.Saturday) {
+			return fmt.Errorf("[%s] - Weekday must be 0 (sunday) - 6 (saturday), got %d", serverErrorMessages[seInputSchemaNotValid], weekday)
+		}
+	}
+	if _, err := time.Parse(scheduleTimeLayout, schedule.StartTime); err != nil {
+		return fmt.Errorf("[%s] - Start time must be HH:MM (\"%s\")", serverErrorMessages[seInputSchemaNotValid], schedule.StartTime)
+	}
+	if _, err := scheduleLocation(schedule.TimeZone); err != nil {
+		return fmt.Errorf("[%s] - Unknown time zone \"%s\"", serverErrorMessages[seInputSchemaNotValid], schedule.TimeZone)
+	}
+	termStart, startErr := time.Parse(scheduleDateLayout, schedule.TermStart)
+	termEnd, endErr := time.Parse(scheduleDateLayout, schedule.TermEnd)
+	if startErr != nil || endErr != nil || termEnd.Before(termStart) || termEnd.Sub(termStart).Hours() > 24*scheduleMaxTermDays {
+		return fmt.Errorf("[%s] - Term start/end must be YYYY-MM-DD within %d days (\"%s\" - \"%s\")", serverErrorMessages[seInputSchemaNotValid],
+			scheduleMaxTermDays, schedule.TermStart, schedule.TermEnd)
+	}
+	for _, date := range append(append([]string{}, schedule.Holidays...), schedule.Cancellations...) {
+		if _, err := time.Parse(scheduleDateLayout, date); err != nil {
+			return fmt.Errorf("[%s] - Holiday/cancellation date must be YYYY-MM-DD (\"%s\")", serverErrorMessages[seInputSchemaNotValid], date)
+		}
+	}
+	return nil
+}
+
+// detect overlapping occurrences with other schedules of the same teacher/assistant, return error (conflict)
+func courseScheduleConflictCheck(ctx context.Context, schedule *CourseSchedule, course *Course) error {
+	var staffPIDs = []primitive.ObjectID{}
+	var staffPIDMap = map[primitive.ObjectID]bool{}
+	for _, staffPID := range []primitive.ObjectID{course.TeacherPID, course.AssistantPID} {
+		staffPIDMap[staffPID] = true
+	}
+	for _, staff := range course.Staff {
+		staffPIDMap[staff.TeacherPID] = true
+	}
+	for staffPID := range staffPIDMap {
+		if !staffPID.IsZero() {
+			staffPIDs = append(staffPIDs, staffPID)
+		}
+	}
+
+	// courses sharing staff with this course
+	var staffCourses = map[primitive.ObjectID]*Course{course.PID: course}
+	for _, staffPID := range staffPIDs {
+		courses, err := findCourseByStaffPID(ctx, staffPID)
+		if err != nil {
+			return err
+		}
+		for i := range courses {
+			staffCourses[courses[i].PID] = courses[i]
+		}
+	}
+	var coursePIDs = []primitive.ObjectID{}
+	for coursePID := range staffCourses {
+		coursePIDs = append(coursePIDs, coursePID)
+	}
+	otherSchedules, err := findCourseSchedule(ctx, primitive.NilObjectID, coursePIDs)
+	if err != nil {
+		return err
+	}
+
+	// compare occurrences within the term of this schedule
+	from, to := courseScheduleTermRange(schedule)
+	occurrences := courseScheduleOccurrences(schedule, course, from, to)
+	for _, other := range otherSchedules {
+		if other.PID == schedule.PID {
+			continue
+		}
+		otherCourse := staffCourses[other.CoursePID]
+		otherOccurrences := courseScheduleOccurrences(other, otherCourse, from, to)
+		for _, occurrence := range occurrences {
+			for _, otherOccurrence := range otherOccurrences {
+				if occurrence.Cancelled || otherOccurrence.Cancelled {
+					continue
+				}
+				if occurrence.StartTS < otherOccurrence.EndTS && otherOccurrence.StartTS < occurrence.EndTS &&
+					scheduleOccurrenceStaffShared(occurrence, otherOccurrence) {
+					return fmt.Errorf("[%s] - Teacher double-booked: course %s overlaps course %s (schedule PID %s) at %s",
+						serverErrorMessages[seResourceConflict], course.CourseName, otherCourse.CourseName, other.PID.Hex(),
+						time.Unix(occurrence.StartTS, 0).Format(time.RFC3339))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// term range of a course schedule as time range (term end day included)
+func courseScheduleTermRange(schedule *CourseSchedule) (time.Time, time.Time) {
+	loc, _ := scheduleLocation(schedule.TimeZone)
+	termStart, _ := time.ParseInLocation(scheduleDateLayout, schedule.TermStart, loc)
+	termEnd, _ := time.ParseInLocation(scheduleDateLayout, schedule.TermEnd, loc)
+	return termStart, termEnd.AddDate(0, 0, 1)
+}
+
+// expand course schedule into occurrences overlapping [from, to) (holidays skipped, cancelled occurrences flagged)
+func courseScheduleOccurrences(schedule *CourseSchedule, course *Course, from time.Time, to time.Time) []*ScheduleOccurrence {
+	occurrences := []*ScheduleOccurrence{}
+	loc, locErr := scheduleLocation(schedule.TimeZone)
+	startTime, timeErr := time.Parse(scheduleTimeLayout, schedule.StartTime)
+	termStart, startErr := time.ParseInLocation(scheduleDateLayout, schedule.TermStart, loc)
+	termEnd, endErr := time.ParseInLocation(scheduleDateLayout, schedule.TermEnd, loc)
+	if locErr != nil || timeErr != nil || startErr != nil || endErr != nil || schedule.IntervalWeeks < 1 {
+		logging.Warnmf(logModCourseMgmt, "Skip invalid course schedule (PID %s)", schedule.PID.Hex())
+		return occurrences
+	}
+
+	var weekdays = map[int]bool{}
+	for _, weekday := range schedule.Weekdays {
+		weekdays[weekday] = true
+	}
+	var skipDates = map[string]bool{}
+	for _, holiday := range schedule.Holidays {
+		skipDates[holiday] = true
+	}
+	var cancelDates = map[string]bool{}
+	for _, cancellation := range schedule.Cancellations {
+		cancelDates[cancellation] = true
+	}
+
+	// iterate days of the term overlapping requested range (one day margin for time zone offsets)
+	var firstDay = termStart
+	if dayBefore := from.In(loc).AddDate(0, 0, -1); dayBefore.After(firstDay) {
+		firstDay = time.Date(dayBefore.Year(), dayBefore.Month(), dayBefore.Day(), 0, 0, 0, 0, loc)
+	}
+	var lastDay = termEnd
+	if dayAfter := to.In(loc).AddDate(0, 0, 1); dayAfter.Before(lastDay) {
+		lastDay = dayAfter
+	}
+	var termWeek = scheduleDayNumber(termStart) - (int64(termStart.Weekday())+6)%7 // monday of first term week
+	var duration = time.Duration(schedule.DurationMinutes) * time.Minute
+	for day := firstDay; !day.After(lastDay); day = day.AddDate(0, 0, 1) {
+		if !weekdays[int(day.Weekday())] {
+			continue
+		}
+		week := (scheduleDayNumber(day) - (int64(day.Weekday())+6)%7 - termWeek) / 7
+		if week%int64(schedule.IntervalWeeks) != 0 {
+			continue
+		}
+		date := day.Format(scheduleDateLayout)
+		if skipDates[date] {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), startTime.Hour(), startTime.Minute(), 0, 0, loc)
+		end := start.Add(duration)
+		if !start.Before(to) || !end.After(from) {
+			continue
+		}
+		occurrences = append(occurrences, &ScheduleOccurrence{
+			SchedulePID:  schedule.PID,
+			CoursePID:    schedule.CoursePID,
+			CourseName:   course.CourseName,
+			TeacherPID:   courseStaffLeadAt(course, start.Unix()),
+			AssistantPID: courseStaffAssistantAt(course, start.Unix()),
+			Staff:        courseStaffAt(course, start.Unix()),
+			Date:         date,
+			StartTS:      start.Unix(),
+			EndTS:        end.Unix(),
+			Location:     schedule.Location,
+			Cancelled:    cancelDates[date],
+		})
+	}
+	return occurrences
+}
+
+// time zone of a course schedule (empty for server local time)
+func scheduleLocation(timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(timeZone)
+}
+
+// calendar day number (days since unix epoch) of a date, independent of DST
+func scheduleDayNumber(day time.Time) int64 {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+}
+
+// expand schedules of courses into occurrences within [from, to) sorted by start time
+func courseScheduleUpcoming(ctx context.Context, courses []*Course, from time.Time, to time.Time) ([]*ScheduleOccurrence, error) {
+	occurrences := []*ScheduleOccurrence{}
+	if len(courses) == 0 {
+		return occurrences, nil
+	}
+
+	var courseMap = map[primitive.ObjectID]*Course{}
+	var coursePIDs = []primitive.ObjectID{}
+	for i := range courses {
+		courseMap[courses[i].PID] = courses[i]
+		coursePIDs = append(coursePIDs, courses[i].PID)
+	}
+	schedules, err := findCourseSchedule(ctx, primitive.NilObjectID, coursePIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range schedules {
+		occurrences = append(occurrences, courseScheduleOccurrences(schedule, courseMap[schedule.CoursePID], from, to)...)
+	}
+
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].StartTS < occurrences[j].StartTS
+	})
+	return occurrences, nil
+}
+
+// check if two occurrences have a teacher on staff of both
+func scheduleOccurrenceStaffShared(occurrence *ScheduleOccurrence, other *ScheduleOccurrence) bool {
+	for _, staff := range occurrence.Staff {
+		for _, otherStaff := range other.Staff {
+			if staff.TeacherPID == otherStaff.TeacherPID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// occurrences a teacher is on staff of (all occurrences for student/relative owners)
+func scheduleOwnerOccurrences(occurrences []*ScheduleOccurrence, ownerType string, ownerPID primitive.ObjectID) []*ScheduleOccurrence {
+	if ownerType != ScheduleOwnerTeacher {
+		return occurrences
+	}
+	var ownerOccurrences = []*ScheduleOccurrence{}
+	for _, occurrence := range occurrences {
+		if scheduleOccurrenceStaffShared(occurrence, &ScheduleOccurrence{Staff: []CourseStaff{{TeacherPID: ownerPID}}}) {
+			ownerOccurrences = append(ownerOccurrences, occurrence)
+		}
+	}
+	return ownerOccurrences
+}
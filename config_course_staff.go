@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// check if staff entry is effective at ts (start inclusive, end exclusive, end 0 for open-ended)
+func courseStaffEffective(staff *CourseStaff, ts int64) bool {
+	return staff.StartTS <= ts && (staff.EndTS == 0 || ts < staff.EndTS)
+}
+
+// staff of a course effective at ts
+func courseStaffAt(course *Course, ts int64) []CourseStaff {
+	var staffAt = []CourseStaff{}
+	for i := range course.Staff {
+		if courseStaffEffective(&course.Staff[i], ts) {
+			staffAt = append(staffAt, course.Staff[i])
+		}
+	}
+	// courses older than staff lists
+	if len(course.Staff) == 0 {
+		staffAt = append(staffAt, CourseStaff{TeacherPID: course.TeacherPID, Role: CourseStaffLead})
+		if !course.AssistantPID.IsZero() {
+			staffAt = append(staffAt, CourseStaff{TeacherPID: course.AssistantPID, Role: CourseStaffAssistant})
+		}
+	}
+	return staffAt
+}
+
+// role of a teacher on course staff at ts ("" if not on staff at that time)
+func courseStaffRoleAt(course *Course, teacherPID primitive.ObjectID, ts int64) string {
+	var role = ""
+	for _, staff := range courseStaffAt(course, ts) {
+		// a teacher with several entries acts with the strongest role
+		if staff.TeacherPID == teacherPID && (role == "" || role == CourseStaffAssistant) {
+			role = staff.Role
+		}
+	}
+	return role
+}
+
+// teacher in charge of a course at ts: substitute while effective, lead otherwise
+func courseStaffLeadAt(course *Course, ts int64) primitive.ObjectID {
+	var leadPID = primitive.NilObjectID
+	for _, staff := range courseStaffAt(course, ts) {
+		if staff.Role == CourseStaffSubstitute {
+			return staff.TeacherPID
+		}
+		if staff.Role == CourseStaffLead && leadPID.IsZero() {
+			leadPID = staff.TeacherPID
+		}
+	}
+	return leadPID
+}
+
+// first assistant of a course at ts
+func courseStaffAssistantAt(course *Course, ts int64) primitive.ObjectID {
+	for _, staff := range courseStaffAt(course, ts) {
+		if staff.Role == CourseStaffAssistant {
+			return staff.TeacherPID
+		}
+	}
+	return primitive.NilObjectID
+}
+
+// keep course teacher/assistant on staff list: a changed teacher/assistant ends the previous one's entries now
+func courseStaffMerge(course *Course, previous *Course, now int64) {
+	if course.Staff == nil {
+		course.Staff = []CourseStaff{}
+		if previous != nil {
+			course.Staff = append(course.Staff, previous.Staff...)
+		}
+	}
+	var appendStaff = func(teacherPID primitive.ObjectID, role string) {
+		if teacherPID.IsZero() {
+			return
+		}
+		var startTS int64 = 0
+		for i := range course.Staff {
+			if course.Staff[i].Role != role {
+				continue
+			}
+			if course.Staff[i].TeacherPID == teacherPID && courseStaffEffective(&course.Staff[i], now) {
+				return
+			}
+			// first teacher/assistant of a course is effective since ever, later ones from now
+			startTS = now
+		}
+		for i := range course.Staff {
+			if role == CourseStaffLead && course.Staff[i].Role == CourseStaffLead && courseStaffEffective(&course.Staff[i], now) {
+				course.Staff[i].EndTS = now
+			}
+		}
+		course.Staff = append(course.Staff, CourseStaff{TeacherPID: teacherPID, Role: role, StartTS: startTS})
+	}
+	appendStaff(course.TeacherPID, CourseStaffLead)
+	if previous != nil && !previous.AssistantPID.IsZero() && previous.AssistantPID != course.AssistantPID {
+		for i := range course.Staff {
+			var staff = &course.Staff[i]
+			if staff.TeacherPID == previous.AssistantPID && staff.Role == CourseStaffAssistant && courseStaffEffective(staff, now) {
+				staff.EndTS = now
+			}
+		}
+	}
+	appendStaff(course.AssistantPID, CourseStaffAssistant)
+	sort.SliceStable(course.Staff, func(i, j int) bool { return course.Staff[i].StartTS < course.Staff[j].StartTS })
+}
+
+// check course staff list (known teachers of course institute and roles, valid date ranges, one lead at a time), return error
+func courseStaffCheck(ctx context.Context, course *Course) error {
+	var knownTeachers = map[primitive.ObjectID]bool{}
+	for i, staff := range course.Staff {
+		if !courseStaffRoleMap[staff.Role] {
+			return fmt.Errorf("[%s] - Course staff role can only be %s/%s/%s (\"%s\")", serverErrorMessages[seInputSchemaNotValid],
+				CourseStaffLead, CourseStaffAssistant, CourseStaffSubstitute, staff.Role)
+		}
+		if staff.StartTS < 0 || (staff.EndTS != 0 && staff.EndTS <= staff.StartTS) {
+			return fmt.Errorf("[%s] - Invalid course staff date range (teacher PID %s, start_ts %d, end_ts %d)", serverErrorMessages[seInputSchemaNotValid],
+				staff.TeacherPID.Hex(), staff.StartTS, staff.EndTS)
+		}
+		if !knownTeachers[staff.TeacherPID] {
+			teachers, err := findTeacher(ctx, staff.TeacherPID)
+			if err != nil || len(teachers) == 0 || staff.TeacherPID.IsZero() {
+				return fmt.Errorf("[%s] - No teachers found with PID %s", serverErrorMessages[seResourceNotFound], staff.TeacherPID.Hex())
+			}
+			if teachers[0].InstitutePID != course.InstitutePID {
+				return fmt.Errorf("[%s] - Teacher (PID %s) belongs to another institute than course (PID %s)", serverErrorMessages[seResourceNotMatched],
+					staff.TeacherPID.Hex(), course.PID.Hex())
+			}
+			knownTeachers[staff.TeacherPID] = true
+		}
+		if staff.Role != CourseStaffLead {
+			continue
+		}
+		for _, other := range course.Staff[i+1:] {
+			if other.Role == CourseStaffLead && (other.EndTS == 0 || staff.StartTS < other.EndTS) && (staff.EndTS == 0 || other.StartTS < staff.EndTS) {
+				return fmt.Errorf("[%s] - Course lead teachers (PID %s, PID %s) overlap, use substitute for temporary replacement",
+					serverErrorMessages[seInputSchemaNotValid], staff.TeacherPID.Hex(), other.TeacherPID.Hex())
+			}
+		}
+	}
+	return nil
+}
+
+// check if a teacher is on course staff now or later
+func courseStaffActive(course *Course, teacherPID primitive.ObjectID, now int64) bool {
+	if course.TeacherPID == teacherPID || course.AssistantPID == teacherPID {
+		return true
+	}
+	for _, staff := range course.Staff {
+		if staff.TeacherPID == teacherPID && (staff.EndTS == 0 || staff.EndTS > now) {
+			return true
+		}
+	}
+	return false
+}
+
+// hand over active course staff entries of a teacher to another teacher from now, return #courses, error
+func reassignCourseStaff(ctx context.Context, fromPID primitive.ObjectID, toPID primitive.ObjectID) (int, error) {
+	if fromPID.IsZero() || toPID.IsZero() || fromPID == toPID {
+		return 0, fmt.Errorf("[%s] - Please specify a different teacher to reassign courses to", serverErrorMessages[seInputParamNotValid])
+	}
+	courses, err := findCourseByStaffPID(ctx, fromPID)
+	if err != nil {
+		return 0, err
+	}
+
+	var now = time.Now().Unix()
+	var reassigned = 0
+	for _, course := range courses {
+		if !courseStaffActive(course, fromPID, now) {
+			continue
+		}
+		var staffList = []CourseStaff{}
+		for _, staff := range course.Staff {
+			if staff.TeacherPID == fromPID && (staff.EndTS == 0 || staff.EndTS > now) {
+				// entries not started yet are handed over completely
+				var handover = staff
+				handover.TeacherPID = toPID
+				if staff.StartTS < now {
+					handover.StartTS = now
+					staff.EndTS = now
+					staffList = append(staffList, staff)
+				}
+				staffList = append(staffList, handover)
+				continue
+			}
+			staffList = append(staffList, staff)
+		}
+		course.Staff = staffList
+		if course.TeacherPID == fromPID {
+			course.TeacherPID = toPID
+		}
+		if course.AssistantPID == fromPID {
+			course.AssistantPID = primitive.NilObjectID
+			if course.TeacherPID != toPID {
+				course.AssistantPID = toPID
+			}
+		}
+		err = updateCourse(ctx, course)
+		if err != nil {
+			return reassigned, fmt.Errorf("%s -> %d courses reassigned before course (PID %s)", err.Error(), reassigned, course.PID.Hex())
+		}
+		reassigned++
+	}
+
+	loggingWithContext(ctx).Infomf(logModCourseMgmt, "Reassigned %d courses from teacher (PID %s) to teacher (PID %s)", reassigned, fromPID.Hex(), toPID.Hex())
+	return reassigned, nil
+}
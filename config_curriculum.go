@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var curriculumVersionConfigHandlerTable = map[string]gin.HandlerFunc{
+	"get": curriculumVersionGetHandler,
+}
+
+func curriculumVersionGetHandler(ctx *gin.Context) {
+	// params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var versions []*CurriculumVersion
+	var err error
+	var coursePID primitive.ObjectID
+	var version int
+
+	coursePID, err = primitive.ObjectIDFromHex(ctx.Request.URL.Query().Get("course_pid"))
+	if err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specifiy a valid course PID (course_pid=?)", serverErrorMessages[seInputParamNotValid])
+		return
+	}
+	// optional version filter (version=?), all versions if not given
+	if v := ctx.Request.URL.Query().Get("version"); v != "" && v != "all" {
+		version, err = strconv.Atoi(v)
+		if err != nil || version <= 0 {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid curriculum version (version=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
+	versions, err = findCurriculumVersion(ctx.Request.Context(), coursePID, version)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = versions
+	return
+}
+
+// find curriculum versions of a course (0 for all versions), newest first, return version slice, error
+func findCurriculumVersion(ctx context.Context, coursePID primitive.ObjectID, version int) ([]*CurriculumVersion, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetSort(bson.D{{"version", -1}})
+	var findFilter = bson.D{{"course_pid", coursePID}}
+	if version > 0 {
+		findOptions.SetLimit(1)
+		findFilter = append(findFilter, bson.E{"version", version})
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionCurriculumVersion).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	versions := []*CurriculumVersion{}
+	for findCursor.Next(dbCtx) {
+		var curriculumVersion CurriculumVersion
+		err = findCursor.Decode(&curriculumVersion)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		versions = append(versions, &curriculumVersion)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Found %d curriculum versions from DB (coursePID=%v, version=%d)", len(versions), coursePID.Hex(), version)
+	return versions, nil
+}
+
+// keep snapshot of current course targets as course curriculum version, return error
+func createCurriculumVersion(ctx context.Context, course *Course) error {
+	var curriculumVersion = CurriculumVersion{
+		CoursePID:    course.PID,
+		Version:      course.CurriculumVersion,
+		Targets:      course.CourseTargets,
+		CreateTS:     time.Now().Unix(),
+		InstitutePID: course.InstitutePID,
+	}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	_, err := dbPool.Collection(DBCollectionCurriculumVersion).InsertOne(dbCtx, &curriculumVersion)
+	if err != nil {
+		err = fmt.Errorf("[%s] - could not keep curriculum version %d of course (PID %s): %s", serverErrorMessages[dbErrorCode(err)],
+			course.CurriculumVersion, course.PID.Hex(), err.Error())
+		loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		return err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Created curriculum version %d of course (PID %s) with %d targets",
+		course.CurriculumVersion, course.PID.Hex(), len(course.CourseTargets))
+	return nil
+}
+
+// delete curriculum versions of a course (nil objectid for all), return #delete entries, error
+func deleteCurriculumVersion(ctx context.Context, coursePID primitive.ObjectID) (int, error) {
+	var deleteFilter = bson.D{}
+	if !coursePID.IsZero() {
+		deleteFilter = bson.D{{"course_pid", coursePID}}
+	}
+	deleteFilter = dbTenantFilter(ctx, deleteFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionCurriculumVersion).DeleteMany(dbCtx, deleteFilter)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		loggingWithContext(ctx).Errormf(logModCourseMgmt, err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModCourseMgmt, "Deleted %d curriculum versions (course PID %s)", deleteResult.DeletedCount, coursePID.Hex())
+	return int(deleteResult.DeletedCount), nil
+}
+
+// check course targets (tags given once each), return targets sorted by level and order, error
+func curriculumTargetCheck(targets []CourseTarget) ([]CourseTarget, error) {
+	var tagMap = map[string]bool{}
+	var checked = []CourseTarget{}
+	for _, target := range targets {
+		if target.Tag == "" {
+			return nil, fmt.Errorf("[%s] - Course target (\"%s\") has no tag", serverErrorMessages[seInputSchemaNotValid], target.Desc)
+		}
+		if tagMap[target.Tag] {
+			return nil, fmt.Errorf("[%s] - Course target tag \"%s\" is defined more than once", serverErrorMessages[seInputSchemaNotValid], target.Tag)
+		}
+		tagMap[target.Tag] = true
+		checked = append(checked, target)
+	}
+	sort.SliceStable(checked, func(i, j int) bool {
+		if checked[i].Level != checked[j].Level {
+			return checked[i].Level < checked[j].Level
+		}
+		return checked[i].Order < checked[j].Order
+	})
+	return checked, nil
+}
+
+// targets of the previous curriculum missing in the next one are kept as retired (records may still refer to them)
+func curriculumMergeTargets(previous []CourseTarget, next []CourseTarget) []CourseTarget {
+	var nextTagMap = map[string]bool{}
+	for _, target := range next {
+		nextTagMap[target.Tag] = true
+	}
+	var merged = append([]CourseTarget{}, next...)
+	for _, target := range previous {
+		if !nextTagMap[target.Tag] {
+			target.Retired = true
+			merged = append(merged, target)
+		}
+	}
+	return merged
+}
+
+// check if two curricula have identical targets
+func curriculumTargetsEqual(a []CourseTarget, b []CourseTarget) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// check if tag is an active (not retired) target of a curriculum
+func curriculumActiveTarget(targets []CourseTarget, tag string) bool {
+	for _, target := range targets {
+		if target.Tag == tag && !target.Retired {
+			return true
+		}
+	}
+	return false
+}
+
+// targets of a curriculum version of a course (current course targets for current version and records older than versioning)
+func curriculumTargetsOf(ctx context.Context, course *Course, version int) ([]CourseTarget, error) {
+	if version == 0 || version == course.CurriculumVersion {
+		return course.CourseTargets, nil
+	}
+	versions, err := findCurriculumVersion(ctx, course.PID, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("[%s] - No curriculum version %d found for course (PID %s)", serverErrorMessages[seResourceNotFound],
+			version, course.PID.Hex())
+	}
+	return versions[0].Targets, nil
+}
+
+// clone curriculum (targets, optionally rubric) of a course into another course as its new curriculum version, return course, error
+func cloneCurriculum(ctx context.Context, cloneReq *CurriculumCloneReq) (*Course, error) {
+	if cloneReq.SourceCoursePID.IsZero() || cloneReq.TargetCoursePID.IsZero() || cloneReq.SourceCoursePID == cloneReq.TargetCoursePID {
+		return nil, fmt.Errorf("[%s] - Please specify different source_course_pid and target_course_pid", serverErrorMessages[seInputJSONNotValid])
+	}
+	sourceCourses, err := findCourse(ctx, cloneReq.SourceCoursePID)
+	if err != nil || len(sourceCourses) == 0 {
+		return nil, fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], cloneReq.SourceCoursePID.Hex())
+	}
+	targetCourses, err := findCourse(ctx, cloneReq.TargetCoursePID)
+	if err != nil || len(targetCourses) == 0 {
+		return nil, fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], cloneReq.TargetCoursePID.Hex())
+	}
+	sourceTargets, err := curriculumTargetsOf(ctx, sourceCourses[0], cloneReq.SourceVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var course = *targetCourses[0]
+	course.CourseTargets = []CourseTarget{}
+	for _, target := range sourceTargets {
+		if target.Retired && !cloneReq.IncludeRetired {
+			continue
+		}
+		course.CourseTargets = append(course.CourseTargets, target)
+	}
+	if cloneReq.CloneRubric {
+		course.Rubric = sourceCourses[0].Rubric
+	}
+
+	// existing targets of the course missing in the clone are retired by update
+	err = updateCourse(ctx, &course)
+	if err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
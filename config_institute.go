@@ -43,7 +43,7 @@ func instituteGetHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	institutes, err = findInstitute(pid)
+	institutes, err = findInstitute(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -72,7 +72,7 @@ func institutePostHandler(ctx *gin.Context) {
 		return
 	}
 
-	institutePID, err = createInstitute(&institute)
+	institutePID, err = createInstitute(ctx.Request.Context(), &institute)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -100,7 +100,7 @@ func institutePutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateInstitute(&institute)
+	err = updateInstitute(ctx.Request.Context(), &institute)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -134,7 +134,7 @@ func instituteDeleteHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteInstitute(pid)
+	deletedRows, err = deleteInstitute(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -145,11 +145,11 @@ func instituteDeleteHandler(ctx *gin.Context) {
 }
 
 // find institute, return institute slice, error
-func findInstitute(pid primitive.ObjectID) ([]*Institute, error) {
+func findInstitute(ctx context.Context, pid primitive.ObjectID) ([]*Institute, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModInstituteMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModInstituteMgmt, err.Error())
 		}
 	}()
 
@@ -161,19 +161,25 @@ func findInstitute(pid primitive.ObjectID) ([]*Institute, error) {
 		findOptions.SetLimit(1)
 		findFilter = bson.D{{"_id", pid}}
 	}
+	// tenants only see their own institute
+	if tenantPID := tenantFromContext(ctx); !tenantPID.IsZero() {
+		findFilter = bson.D{{"$and", bson.A{findFilter, bson.D{{"_id", tenantPID}}}}}
+	}
 
-	findCursor, err := dbPool.Collection(DBCollectionInstitute).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionInstitute).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	institutes := []*Institute{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var institute Institute
 		err = findCursor.Decode(&institute)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		institutes = append(institutes, &institute)
@@ -181,40 +187,48 @@ func findInstitute(pid primitive.ObjectID) ([]*Institute, error) {
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModInstituteMgmt, "Found %d institute results from DB (PID=%v)", len(institutes), pid.Hex())
+	loggingWithContext(ctx).Debugmf(logModInstituteMgmt, "Found %d institute results from DB (PID=%v)", len(institutes), pid.Hex())
 	return institutes, nil
 }
 
 // create institute, return PID, error
-func createInstitute(institute *Institute) (primitive.ObjectID, error) {
+func createInstitute(ctx context.Context, institute *Institute) (primitive.ObjectID, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModInstituteMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModInstituteMgmt, err.Error())
 		}
 	}()
 
-	insertResult, err := dbPool.Collection(DBCollectionInstitute).InsertOne(context.TODO(), institute)
+	// institutes are created by super-admin across tenants only
+	if !tenantFromContext(ctx).IsZero() {
+		err = fmt.Errorf("[%s] - Institutes can only be created with admin token and without institute PID", serverErrorMessages[seInputParamNotValid])
+		return primitive.NilObjectID, err
+	}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionInstitute).InsertOne(dbCtx, institute)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return primitive.NilObjectID, err
 	}
 
 	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModInstituteMgmt, "Created institute in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	loggingWithContext(ctx).Debugmf(logModInstituteMgmt, "Created institute in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
 	return lastInsertID, nil
 }
 
 // update institute, return error
-func updateInstitute(institute *Institute) error {
+func updateInstitute(ctx context.Context, institute *Institute) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModInstituteMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModInstituteMgmt, err.Error())
 		}
 	}()
 
@@ -223,6 +237,10 @@ func updateInstitute(institute *Institute) error {
 		err = fmt.Errorf("[%s] - institute PID is empty", serverErrorMessages[seInputJSONNotValid])
 		return err
 	}
+	err = tenantCheck(ctx, institute.PID)
+	if err != nil {
+		return err
+	}
 
 	var updateFilter = bson.D{{"_id", institute.PID}}
 	var updateBSONDocument = bson.D{}
@@ -238,13 +256,15 @@ func updateInstitute(institute *Institute) error {
 	}
 	var updateOptions = bson.D{{"$set", updateBSONDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionInstitute).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionInstitute).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModInstituteMgmt, "Update institute (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModInstituteMgmt, "Update institute (PID %s): matched %d modified %d",
 		institute.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
 		err = fmt.Errorf("[%s] - could not find institute (PID %s)", serverErrorMessages[seResourceNotFound], institute.PID.Hex())
@@ -257,14 +277,20 @@ func updateInstitute(institute *Institute) error {
 }
 
 // delete institute, return #delete entries, error
-func deleteInstitute(pid primitive.ObjectID) (int, error) {
+func deleteInstitute(ctx context.Context, pid primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModInstituteMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModInstituteMgmt, err.Error())
 		}
 	}()
 
+	// institutes are deleted by super-admin across tenants only
+	if !tenantFromContext(ctx).IsZero() {
+		err = fmt.Errorf("[%s] - Institutes can only be deleted with admin token and without institute PID", serverErrorMessages[seInputParamNotValid])
+		return 0, err
+	}
+
 	var deleteFilter bson.D = bson.D{}
 	var dependencyFindFilter bson.D = bson.D{}
 	if !pid.IsZero() {
@@ -274,7 +300,9 @@ func deleteInstitute(pid primitive.ObjectID) (int, error) {
 
 	// check teacher dependency
 	var teacher Teacher
-	if dbPool.Collection(DBCollectionTeacher).FindOne(context.TODO(), dependencyFindFilter).Decode(&teacher) == nil {
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	if dbPool.Collection(DBCollectionTeacher).FindOne(dbCtx, dependencyFindFilter).Decode(&teacher) == nil {
 		err = fmt.Errorf("[%s] - teacher-institute dependency unresolved (e.g. teacher PID %s institute PID %s)",
 			serverErrorMessages[seDependencyIssue], teacher.PID.Hex(), teacher.InstitutePID.Hex())
 		return 0, err
@@ -282,18 +310,26 @@ func deleteInstitute(pid primitive.ObjectID) (int, error) {
 
 	// check course dependency
 	var course Course
-	if dbPool.Collection(DBCollectionCourse).FindOne(context.TODO(), dependencyFindFilter).Decode(&course) == nil {
+	if dbPool.Collection(DBCollectionCourse).FindOne(dbCtx, dependencyFindFilter).Decode(&course) == nil {
 		err = fmt.Errorf("[%s] - course-institute dependency unresolved (e.g. course PID %s institute PID %s)",
 			serverErrorMessages[seDependencyIssue], course.PID.Hex(), course.InstitutePID.Hex())
 		return 0, err
 	}
 
-	deleteResult, err := dbPool.Collection(DBCollectionInstitute).DeleteMany(context.TODO(), deleteFilter)
+	// check student dependency
+	var student Student
+	if dbPool.Collection(DBCollectionStudent).FindOne(dbCtx, dependencyFindFilter).Decode(&student) == nil {
+		err = fmt.Errorf("[%s] - student-institute dependency unresolved (e.g. student PID %s institute PID %s)",
+			serverErrorMessages[seDependencyIssue], student.PID.Hex(), student.InstitutePID.Hex())
+		return 0, err
+	}
+
+	deleteResult, err := dbPool.Collection(DBCollectionInstitute).DeleteMany(dbCtx, deleteFilter)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return 0, err
 	}
 
-	logging.Debugmf(logModInstituteMgmt, "Deleted %d institute results from DB", deleteResult.DeletedCount)
+	loggingWithContext(ctx).Debugmf(logModInstituteMgmt, "Deleted %d institute results from DB", deleteResult.DeletedCount)
 	return int(deleteResult.DeletedCount), nil
 }
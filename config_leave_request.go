@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var leaveRequestConfigHandlerTable = map[string]gin.HandlerFunc{
+	"get": leaveRequestGetHandler,
+}
+
+func leaveRequestGetHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var leaveRequests []*LeaveRequest
+	var err error
+	var pid primitive.ObjectID
+	var studentPIDs, coursePIDs []primitive.ObjectID
+	if params.PID == "all" {
+		pid = primitive.NilObjectID
+	} else {
+		pid, err = primitive.ObjectIDFromHex(params.PID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid PID (mongoDB ObjectID)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
+	// optional student/course filters (student_pid=?, course_pid=?)
+	if sPID := ctx.Request.URL.Query().Get("student_pid"); sPID != "" && sPID != "all" {
+		studentPID, parseErr := primitive.ObjectIDFromHex(sPID)
+		if parseErr != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid student PID (student_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+		studentPIDs = []primitive.ObjectID{studentPID}
+	}
+	if cPID := ctx.Request.URL.Query().Get("course_pid"); cPID != "" && cPID != "all" {
+		coursePID, parseErr := primitive.ObjectIDFromHex(cPID)
+		if parseErr != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid course PID (course_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+		coursePIDs = []primitive.ObjectID{coursePID}
+	}
+
+	// pid: nil objectid for all, others for specified one
+	leaveRequests, err = findLeaveRequest(ctx.Request.Context(), pid, studentPIDs, coursePIDs)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = leaveRequests
+	return
+}
+
+// find leave requests (nil student/course PIDs for all), newest occurrence first, return leave request slice, error
+func findLeaveRequest(ctx context.Context, pid primitive.ObjectID, studentPIDs []primitive.ObjectID, coursePIDs []primitive.ObjectID) ([]*LeaveRequest, error) {
+	var findFilter bson.D = bson.D{}
+	if !pid.IsZero() {
+		findFilter = append(findFilter, bson.E{"_id", pid})
+	}
+	if studentPIDs != nil {
+		findFilter = append(findFilter, bson.E{"student_pid", bson.D{{"$in", studentPIDs}}})
+	}
+	if coursePIDs != nil {
+		findFilter = append(findFilter, bson.E{"course_pid", bson.D{{"$in", coursePIDs}}})
+	}
+	return findLeaveRequestByFilter(ctx, findFilter)
+}
+
+// find leave requests of courses whose occurrence overlaps [from, to) (empty status for all), return leave request slice, error
+func findLeaveRequestInRange(ctx context.Context, coursePIDs []primitive.ObjectID, status string, from int64, to int64) ([]*LeaveRequest, error) {
+	var findFilter = bson.D{
+		{"course_pid", bson.D{{"$in", coursePIDs}}},
+		{"start_ts", bson.D{{"$lt", to}}},
+		{"end_ts", bson.D{{"$gt", from}}},
+	}
+	if status != "" {
+		findFilter = append(findFilter, bson.E{"status", status})
+	}
+	return findLeaveRequestByFilter(ctx, findFilter)
+}
+
+func findLeaveRequestByFilter(ctx context.Context, findFilter bson.D) ([]*LeaveRequest, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModLeaveRequestMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetSort(bson.D{{"start_ts", -1}})
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionLeaveRequest).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	leaveRequests := []*LeaveRequest{}
+	for findCursor.Next(dbCtx) {
+		var leaveRequest LeaveRequest
+		err = findCursor.Decode(&leaveRequest)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		leaveRequests = append(leaveRequests, &leaveRequest)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModLeaveRequestMgmt, "Found %d leave requests from DB", len(leaveRequests))
+	return leaveRequests, nil
+}
+
+// create leave request of a bound relative for an upcoming schedule occurrence, return leave request, error
+func createLeaveRequest(ctx context.Context, relative *Relative, leaveReq *LeaveRequestReq) (*LeaveRequest, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModLeaveRequestMgmt, err.Error())
+		}
+	}()
+
+	// relative must be main relative or allowed to comment (view-only relatives cannot act for the student)
+	references, err := findStudentRelativeRef(ctx, leaveReq.StudentPID, relative.PID)
+	if err != nil || len(references) == 0 || leaveReq.StudentPID.IsZero() {
+		err = fmt.Errorf("[%s] - Relative (PID %s) is not bound to student (PID %s)", serverErrorMessages[seResourceNotFound],
+			relative.PID.Hex(), leaveReq.StudentPID.Hex())
+		return nil, err
+	}
+	if !references[0].IsMain && references[0].Permission != RelativePermissionComment {
+		err = fmt.Errorf("[%s] - Relative (PID %s) has view permission only", serverErrorMessages[seResourceConflict], relative.PID.Hex())
+		return nil, err
+	}
+
+	// occurrence of the schedule on the given date (not cancelled, not started yet)
+	schedules, err := findCourseSchedule(ctx, leaveReq.SchedulePID, nil)
+	if err != nil || len(schedules) == 0 || leaveReq.SchedulePID.IsZero() {
+		err = fmt.Errorf("[%s] - No course schedule found with PID %s", serverErrorMessages[seResourceNotFound], leaveReq.SchedulePID.Hex())
+		return nil, err
+	}
+	var schedule = schedules[0]
+	courses, err := findCourse(ctx, schedule.CoursePID)
+	if err != nil || len(courses) == 0 {
+		err = fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], schedule.CoursePID.Hex())
+		return nil, err
+	}
+	loc, _ := scheduleLocation(schedule.TimeZone)
+	day, err := time.ParseInLocation(scheduleDateLayout, leaveReq.Date, loc)
+	if err != nil {
+		err = fmt.Errorf("[%s] - Occurrence date must be YYYY-MM-DD (\"%s\")", serverErrorMessages[seInputSchemaNotValid], leaveReq.Date)
+		return nil, err
+	}
+	var occurrence *ScheduleOccurrence
+	for _, dayOccurrence := range courseScheduleOccurrences(schedule, courses[0], day, day.AddDate(0, 0, 1)) {
+		if dayOccurrence.Date == leaveReq.Date {
+			occurrence = dayOccurrence
+		}
+	}
+	if occurrence == nil || occurrence.Cancelled {
+		err = fmt.Errorf("[%s] - Course schedule (PID %s) has no class on %s", serverErrorMessages[seResourceNotFound], schedule.PID.Hex(), leaveReq.Date)
+		return nil, err
+	}
+	if occurrence.StartTS <= time.Now().Unix() {
+		err = fmt.Errorf("[%s] - Class on %s has already started", serverErrorMessages[seResourceExpired], leaveReq.Date)
+		return nil, err
+	}
+
+	// student-course reference check
+	studentCourseReferences, err := findStudentCourseRef(ctx, leaveReq.StudentPID, schedule.CoursePID)
+	if err != nil || len(studentCourseReferences) == 0 {
+		err = fmt.Errorf("[%s] - Student (PID %s) is not enrolled in course (PID %s)", serverErrorMessages[seResourceNotFound],
+			leaveReq.StudentPID.Hex(), schedule.CoursePID.Hex())
+		return nil, err
+	}
+
+	// one open (pending/approved) request per student and occurrence
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	openCount, err := dbPool.Collection(DBCollectionLeaveRequest).CountDocuments(dbCtx, bson.D{
+		{"student_pid", leaveReq.StudentPID},
+		{"schedule_pid", schedule.PID},
+		{"date", leaveReq.Date},
+		{"status", bson.D{{"$in", bson.A{LeaveStatusPending, LeaveStatusApproved}}}},
+	})
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+	if openCount > 0 {
+		err = fmt.Errorf("[%s] - Student (PID %s) already has a leave request for class on %s", serverErrorMessages[seResourceDuplicated],
+			leaveReq.StudentPID.Hex(), leaveReq.Date)
+		return nil, err
+	}
+
+	var leaveRequest = LeaveRequest{
+		StudentPID:   leaveReq.StudentPID,
+		RelativePID:  relative.PID,
+		CoursePID:    schedule.CoursePID,
+		SchedulePID:  schedule.PID,
+		Date:         leaveReq.Date,
+		StartTS:      occurrence.StartTS,
+		EndTS:        occurrence.EndTS,
+		Reason:       leaveReq.Reason,
+		Status:       LeaveStatusPending,
+		CreateTS:     time.Now().Unix(),
+		InstitutePID: courses[0].InstitutePID,
+	}
+	insertResult, err := dbPool.Collection(DBCollectionLeaveRequest).InsertOne(dbCtx, &leaveRequest)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	leaveRequest.PID = insertResult.InsertedID.(primitive.ObjectID)
+	loggingWithContext(ctx).Debugmf(logModLeaveRequestMgmt, "Created leave request in DB (LastInsertID,PID=%s)", leaveRequest.PID.Hex())
+	return &leaveRequest, nil
+}
+
+// withdraw a pending leave request submitted by the relative, return error
+func withdrawLeaveRequest(ctx context.Context, relativePID primitive.ObjectID, leavePID primitive.ObjectID) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModLeaveRequestMgmt, err.Error())
+		}
+	}()
+
+	var updateFilter = bson.D{{"_id", leavePID}, {"relative_pid", relativePID}, {"status", LeaveStatusPending}}
+	var updateOptions = bson.D{{"$set", bson.D{{"status", LeaveStatusWithdrawn}, {"decide_ts", time.Now().Unix()}}}}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	updateResult, err := dbPool.Collection(DBCollectionLeaveRequest).UpdateOne(dbCtx, updateFilter, updateOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return err
+	}
+	if updateResult.MatchedCount == 0 {
+		err = fmt.Errorf("[%s] - No pending leave request (PID %s) of relative (PID %s)", serverErrorMessages[seResourceNotFound],
+			leavePID.Hex(), relativePID.Hex())
+		return err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModLeaveRequestMgmt, "Withdrew leave request (PID %s)", leavePID.Hex())
+	return nil
+}
+
+// approve/reject a pending leave request by the course teacher; approval creates an absence course record
+// and a makeup entitlement; return leave request, error
+func decideLeaveRequest(ctx context.Context, leaveReq *LeaveRequestReq) (*LeaveRequest, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModLeaveRequestMgmt, err.Error())
+		}
+	}()
+
+	leaveRequests, err := findLeaveRequest(ctx, leaveReq.LeavePID, nil, nil)
+	if err != nil || len(leaveRequests) == 0 || leaveReq.LeavePID.IsZero() {
+		err = fmt.Errorf("[%s] - No leave request found with PID %s", serverErrorMessages[seResourceNotFound], leaveReq.LeavePID.Hex())
+		return nil, err
+	}
+	var leaveRequest = leaveRequests[0]
+	courses, err := findCourse(ctx, leaveRequest.CoursePID)
+	if err != nil || len(courses) == 0 {
+		err = fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], leaveRequest.CoursePID.Hex())
+		return nil, err
+	}
+	// lead or substitute in charge of the class the student will miss
+	var staffRole = courseStaffRoleAt(courses[0], leaveReq.TeacherPID, leaveRequest.StartTS)
+	if leaveReq.TeacherPID.IsZero() || (staffRole != CourseStaffLead && staffRole != CourseStaffSubstitute) {
+		err = fmt.Errorf("[%s] - Teacher (PID %s) is not the teacher of course (PID %s)", serverErrorMessages[seResourceNotMatched],
+			leaveReq.TeacherPID.Hex(), leaveRequest.CoursePID.Hex())
+		return nil, err
+	}
+	var targetTag = leaveReq.TargetTag
+	for i := 0; targetTag == "" && i < len(courses[0].CourseTargets); i++ {
+		if !courses[0].CourseTargets[i].Retired {
+			targetTag = courses[0].CourseTargets[i].Tag
+		}
+	}
+
+	var status = LeaveStatusRejected
+	if leaveReq.Approve {
+		status = LeaveStatusApproved
+	}
+	var decideTS = time.Now().Unix()
+	session, err := dbPool.Client().StartSession()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	defer session.EndSession(dbCtx)
+
+	// claim the pending request (concurrent decisions: only one matches); approval books absence record (consumes a credit)
+	// and makeup entitlement in the same transaction, so a failed approval leaves the request pending
+	_, err = session.WithTransaction(dbCtx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		updateResult, err := dbPool.Collection(DBCollectionLeaveRequest).UpdateOne(sessCtx,
+			bson.D{{"_id", leaveRequest.PID}, {"status", LeaveStatusPending}},
+			bson.D{{"$set", bson.D{{"status", status}, {"decider_pid", leaveReq.TeacherPID}, {"decision_note", leaveReq.Note}, {"decide_ts", decideTS}}}})
+		if err != nil {
+			return nil, fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		}
+		if updateResult.MatchedCount == 0 {
+			return nil, fmt.Errorf("[%s] - Leave request (PID %s) is not pending (status %s)", serverErrorMessages[seResourceConflict],
+				leaveRequest.PID.Hex(), leaveRequest.Status)
+		}
+		if !leaveReq.Approve {
+			return nil, nil
+		}
+
+		var courseRecord = CourseRecord{
+			StudentPID: leaveRequest.StudentPID,
+			CoursePID:  leaveRequest.CoursePID,
+			TargetTag:  targetTag,
+			RecordTS:   leaveRequest.StartTS,
+			Attendance: AttendanceAbsent,
+		}
+		recordPID, err := createCourseRecord(sessCtx, &courseRecord)
+		if err != nil {
+			return nil, err
+		}
+		_, err = approveLessonCreditAbsence(sessCtx, recordPID, fmt.Sprintf("leave request %s", leaveRequest.PID.Hex()))
+		if err != nil {
+			return nil, err
+		}
+		_, err = dbPool.Collection(DBCollectionLeaveRequest).UpdateOne(sessCtx, bson.D{{"_id", leaveRequest.PID}},
+			bson.D{{"$set", bson.D{{"course_record_pid", recordPID}}}})
+		if err != nil {
+			return nil, fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		}
+		leaveRequest.CourseRecordPID = recordPID
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	leaveRequest.Status = status
+	leaveRequest.DeciderPID = leaveReq.TeacherPID
+	leaveRequest.DecisionNote = leaveReq.Note
+	leaveRequest.DecideTS = decideTS
+	if !leaveReq.Approve {
+		loggingWithContext(ctx).Debugmf(logModLeaveRequestMgmt, "Rejected leave request (PID %s)", leaveRequest.PID.Hex())
+		return leaveRequest, nil
+	}
+
+	loggingWithContext(ctx).Debugmf(logModLeaveRequestMgmt, "Approved leave request (PID %s) with absence record (PID %s)",
+		leaveRequest.PID.Hex(), leaveRequest.CourseRecordPID.Hex())
+	return leaveRequest, nil
+}
+
+// delete leave requests of a student in a course, return #delete entries, error
+func deleteLeaveRequest(ctx context.Context, studentPID primitive.ObjectID, coursePID primitive.ObjectID) (int, error) {
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionLeaveRequest).DeleteMany(dbCtx, bson.D{{"student_pid", studentPID}, {"course_pid", coursePID}})
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		loggingWithContext(ctx).Errormf(logModLeaveRequestMgmt, err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModLeaveRequestMgmt, "Deleted %d leave requests (student PID %s, course PID %s)",
+		deleteResult.DeletedCount, studentPID.Hex(), coursePID.Hex())
+	return int(deleteResult.DeletedCount), nil
+}
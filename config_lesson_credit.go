@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var lessonCreditConfigHandlerTable = map[string]gin.HandlerFunc{
+	"get": lessonCreditGetHandler,
+}
+
+var lessonCreditEntryTypeMap = map[string]bool{
+	LessonCreditGrant:   true,
+	LessonCreditConsume: true,
+	LessonCreditAbsence: true,
+	LessonCreditRedeem:  true,
+	LessonCreditAdjust:  true,
+}
+
+func lessonCreditGetHandler(ctx *gin.Context) {
+	// params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var entries []*LessonCreditEntry
+	var err error
+	var studentPID, coursePID primitive.ObjectID
+
+	// optional student/course filters (student_pid=?, course_pid=?)
+	if sPID := ctx.Request.URL.Query().Get("student_pid"); sPID != "" && sPID != "all" {
+		studentPID, err = primitive.ObjectIDFromHex(sPID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid student PID (student_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+	if cPID := ctx.Request.URL.Query().Get("course_pid"); cPID != "" && cPID != "all" {
+		coursePID, err = primitive.ObjectIDFromHex(cPID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid course PID (course_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
+	entries, err = findLessonCreditEntry(ctx.Request.Context(), studentPID, coursePID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = entries
+	return
+}
+
+// find lesson credit ledger entries (nil objectid for all), newest first, return entry slice, error
+func findLessonCreditEntry(ctx context.Context, studentPID primitive.ObjectID, coursePID primitive.ObjectID) ([]*LessonCreditEntry, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModLessonCreditMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetSort(bson.D{{"create_ts", -1}, {"_id", -1}})
+	var findFilter bson.D = bson.D{}
+	if !studentPID.IsZero() {
+		findFilter = append(findFilter, bson.E{"student_pid", studentPID})
+	}
+	if !coursePID.IsZero() {
+		findFilter = append(findFilter, bson.E{"course_pid", coursePID})
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionLessonCredit).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	entries := []*LessonCreditEntry{}
+	for findCursor.Next(dbCtx) {
+		var entry LessonCreditEntry
+		err = findCursor.Decode(&entry)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModLessonCreditMgmt, "Found %d lesson credit entries from DB (studentPID=%v, coursePID=%v)",
+		len(entries), studentPID.Hex(), coursePID.Hex())
+	return entries, nil
+}
+
+// find lesson credit balances of enrolled students (one per student-course reference), return balance slice, error
+func findLessonCreditBalance(ctx context.Context, studentPID primitive.ObjectID, coursePID primitive.ObjectID) ([]*LessonCreditBalance, error) {
+	references, err := findStudentCourseRef(ctx, studentPID, coursePID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := findLessonCreditEntry(ctx, studentPID, coursePID)
+	if err != nil {
+		return nil, err
+	}
+
+	var balanceMap = lessonCreditBalanceMap(entries)
+	var balances = []*LessonCreditBalance{}
+	for i := range references {
+		balance, exist := balanceMap[[2]primitive.ObjectID{references[i].StudentPID, references[i].CoursePID}]
+		if !exist {
+			balance = &LessonCreditBalance{StudentPID: references[i].StudentPID, CoursePID: references[i].CoursePID}
+		}
+		balances = append(balances, balance)
+	}
+	return balances, nil
+}
+
+// sum up ledger entries per student and course
+func lessonCreditBalanceMap(entries []*LessonCreditEntry) map[[2]primitive.ObjectID]*LessonCreditBalance {
+	var balanceMap = map[[2]primitive.ObjectID]*LessonCreditBalance{}
+	for _, entry := range entries {
+		var key = [2]primitive.ObjectID{entry.StudentPID, entry.CoursePID}
+		balance, exist := balanceMap[key]
+		if !exist {
+			balance = &LessonCreditBalance{StudentPID: entry.StudentPID, CoursePID: entry.CoursePID}
+			balanceMap[key] = balance
+		}
+		balance.Credits += entry.Credits
+		balance.MakeUps += entry.MakeUps
+		switch entry.EntryType {
+		case LessonCreditGrant:
+			balance.Purchased += entry.Credits
+		case LessonCreditConsume:
+			balance.Attended++
+		case LessonCreditAbsence:
+			balance.Missed++
+		case LessonCreditRedeem:
+			balance.MadeUp++
+		}
+	}
+	return balanceMap
+}
+
+// create lesson credit entry (grant/adjust by staff, absence by approval), return PID, error
+func createLessonCreditEntry(ctx context.Context, entry *LessonCreditEntry) (primitive.ObjectID, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModLessonCreditMgmt, err.Error())
+		}
+	}()
+
+	if entry.StudentPID.IsZero() || entry.CoursePID.IsZero() {
+		err = fmt.Errorf("[%s] - No student PID or course PID specified", serverErrorMessages[seInputJSONNotValid])
+		return primitive.NilObjectID, err
+	}
+	if !lessonCreditEntryTypeMap[entry.EntryType] {
+		err = fmt.Errorf("[%s] - Invalid lesson credit entry type \"%s\"", serverErrorMessages[seInputSchemaNotValid], entry.EntryType)
+		return primitive.NilObjectID, err
+	}
+	entry.PID = primitive.NilObjectID
+	entry.CreateTS = time.Now().Unix()
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionLessonCredit).InsertOne(dbCtx, entry)
+	if err != nil {
+		if dbIsDuplicateKeyError(err) {
+			err = fmt.Errorf("[%s] - Lesson credit entry \"%s\" already exists for course record (PID %s)", serverErrorMessages[seResourceDuplicated],
+				entry.EntryType, entry.CourseRecordPID.Hex())
+			return primitive.NilObjectID, err
+		}
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return primitive.NilObjectID, err
+	}
+
+	entry.PID = insertResult.InsertedID.(primitive.ObjectID)
+	loggingWithContext(ctx).Debugmf(logModLessonCreditMgmt, "Created lesson credit entry in DB (LastInsertID,PID=%s, type %s, credits %d, makeups %d)",
+		entry.PID.Hex(), entry.EntryType, entry.Credits, entry.MakeUps)
+	return entry.PID, nil
+}
+
+// approve absence of an absent course record -> one makeup entitlement, return entry, error
+func approveLessonCreditAbsence(ctx context.Context, recordPID primitive.ObjectID, note string) (*LessonCreditEntry, error) {
+	if recordPID.IsZero() {
+		return nil, fmt.Errorf("[%s] - No course record PID specified", serverErrorMessages[seInputJSONNotValid])
+	}
+	courseRecords, err := findCourseRecord(ctx, recordPID)
+	if err != nil || len(courseRecords) == 0 {
+		return nil, fmt.Errorf("[%s] - No course record found with PID %s", serverErrorMessages[seResourceNotFound], recordPID.Hex())
+	}
+	if courseRecords[0].Attendance != AttendanceAbsent {
+		return nil, fmt.Errorf("[%s] - Course record (PID %s) is not an absence (attendance \"%s\")", serverErrorMessages[seResourceNotMatched],
+			recordPID.Hex(), courseRecords[0].Attendance)
+	}
+
+	var entry = LessonCreditEntry{
+		StudentPID:      courseRecords[0].StudentPID,
+		CoursePID:       courseRecords[0].CoursePID,
+		EntryType:       LessonCreditAbsence,
+		MakeUps:         1,
+		CourseRecordPID: recordPID,
+		Note:            note,
+		InstitutePID:    courseRecords[0].InstitutePID,
+	}
+	_, err = createLessonCreditEntry(ctx, &entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// check student has a makeup entitlement left for a makeup record (its own redemption, if any, is given back first)
+func lessonCreditCheckMakeUp(ctx context.Context, studentPID primitive.ObjectID, coursePID primitive.ObjectID, recordPID primitive.ObjectID) error {
+	entries, err := findLessonCreditEntry(ctx, studentPID, coursePID)
+	if err != nil {
+		return err
+	}
+
+	var makeUps int
+	for _, entry := range entries {
+		if entry.EntryType == LessonCreditRedeem && !recordPID.IsZero() && entry.CourseRecordPID == recordPID {
+			continue
+		}
+		makeUps += entry.MakeUps
+	}
+	if makeUps <= 0 {
+		return fmt.Errorf("[%s] - Student (PID %s) has no makeup entitlement left in course (PID %s) -> approve an absence first",
+			serverErrorMessages[seResourceConflict], studentPID.Hex(), coursePID.Hex())
+	}
+	return nil
+}
+
+// re-apply ledger entries of course records: non-makeup records consume one credit, makeup records redeem one entitlement,
+// absence entitlement is withdrawn once a record is no longer absent; return error
+func applyLessonCreditRecords(ctx context.Context, courseRecords []*CourseRecord) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModLessonCreditMgmt, err.Error())
+		}
+	}()
+
+	if len(courseRecords) == 0 {
+		return nil
+	}
+
+	var now = time.Now().Unix()
+	var recordPIDs = bson.A{}
+	var attendedPIDs = bson.A{}
+	var coursePIDMap = map[primitive.ObjectID]bool{}
+	var entryDocuments = []interface{}{}
+	for _, courseRecord := range courseRecords {
+		recordPIDs = append(recordPIDs, courseRecord.PID)
+		if courseRecord.Attendance != AttendanceAbsent {
+			attendedPIDs = append(attendedPIDs, courseRecord.PID)
+		}
+		coursePIDMap[courseRecord.CoursePID] = true
+
+		var entry = LessonCreditEntry{
+			StudentPID:      courseRecord.StudentPID,
+			CoursePID:       courseRecord.CoursePID,
+			EntryType:       LessonCreditConsume,
+			Credits:         -1,
+			CourseRecordPID: courseRecord.PID,
+			CreateTS:        now,
+			InstitutePID:    courseRecord.InstitutePID,
+		}
+		if courseRecord.IsMakeUp {
+			entry.EntryType = LessonCreditRedeem
+			entry.Credits = 0
+			entry.MakeUps = -1
+		}
+		entryDocuments = append(entryDocuments, &entry)
+	}
+
+	// balances before the change, for low balance alerts
+	var balancesBefore = map[[2]primitive.ObjectID]*LessonCreditBalance{}
+	for coursePID := range coursePIDMap {
+		entries, findErr := findLessonCreditEntry(ctx, primitive.NilObjectID, coursePID)
+		if findErr != nil {
+			err = findErr
+			return err
+		}
+		for key, balance := range lessonCreditBalanceMap(entries) {
+			balancesBefore[key] = balance
+		}
+	}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	_, err = dbPool.Collection(DBCollectionLessonCredit).DeleteMany(dbCtx, bson.D{
+		{"course_record_pid", bson.D{{"$in", recordPIDs}}},
+		{"entry_type", bson.D{{"$in", bson.A{LessonCreditConsume, LessonCreditRedeem}}}},
+	})
+	if err == nil && len(attendedPIDs) > 0 {
+		_, err = dbPool.Collection(DBCollectionLessonCredit).DeleteMany(dbCtx, bson.D{
+			{"course_record_pid", bson.D{{"$in", attendedPIDs}}},
+			{"entry_type", LessonCreditAbsence},
+		})
+	}
+	if err == nil {
+		_, err = dbPool.Collection(DBCollectionLessonCredit).InsertMany(dbCtx, entryDocuments)
+	}
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return err
+	}
+	loggingWithContext(ctx).Debugmf(logModLessonCreditMgmt, "Applied lesson credit entries of %d course records", len(courseRecords))
+
+	for coursePID := range coursePIDMap {
+		lessonCreditLowBalanceCheck(ctx, coursePID, balancesBefore)
+	}
+	return nil
+}
+
+// alert relatives of students whose credit balance dropped to the low balance threshold (alert failures are only logged)
+func lessonCreditLowBalanceCheck(ctx context.Context, coursePID primitive.ObjectID, balancesBefore map[[2]primitive.ObjectID]*LessonCreditBalance) {
+	var threshold = serverConfig.LessonCreditLowBalance
+	if threshold < 0 {
+		return
+	}
+	entries, err := findLessonCreditEntry(ctx, primitive.NilObjectID, coursePID)
+	if err != nil {
+		return
+	}
+
+	for key, balance := range lessonCreditBalanceMap(entries) {
+		var creditsBefore int
+		if balanceBefore, exist := balancesBefore[key]; exist {
+			creditsBefore = balanceBefore.Credits
+		}
+		if balance.Credits > threshold || creditsBefore <= threshold {
+			continue
+		}
+
+		var alert = LessonCreditAlert{
+			StudentPID:   balance.StudentPID,
+			CoursePID:    balance.CoursePID,
+			Credits:      balance.Credits,
+			CreateTS:     time.Now().Unix(),
+			InstitutePID: entries[0].InstitutePID, // entries of one course
+		}
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		_, err = dbPool.Collection(DBCollectionLessonCreditAlert).InsertOne(dbCtx, &alert)
+		dbCancel()
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModLessonCreditMgmt, "Could not create low balance alert (student PID %s, course PID %s): %s",
+				balance.StudentPID.Hex(), balance.CoursePID.Hex(), err.Error())
+			continue
+		}
+		loggingWithContext(ctx).Infomf(logModLessonCreditMgmt, "Low lesson credit balance %d (student PID %s, course PID %s)",
+			balance.Credits, balance.StudentPID.Hex(), balance.CoursePID.Hex())
+	}
+}
+
+// find low balance alerts of students, newest first, return alert slice, error
+func findLessonCreditAlert(ctx context.Context, studentPIDs []primitive.ObjectID) ([]*LessonCreditAlert, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModLessonCreditMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetSort(bson.D{{"create_ts", -1}})
+	var findFilter = bson.D{{"student_pid", bson.D{{"$in", studentPIDs}}}}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionLessonCreditAlert).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	alerts := []*LessonCreditAlert{}
+	for findCursor.Next(dbCtx) {
+		var alert LessonCreditAlert
+		err = findCursor.Decode(&alert)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		alerts = append(alerts, &alert)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModLessonCreditMgmt, "Found %d lesson credit alerts from DB (%d students)", len(alerts), len(studentPIDs))
+	return alerts, nil
+}
+
+// delete ledger entries of a course record, return #delete entries, error
+func deleteLessonCreditByRecordPID(ctx context.Context, recordPID primitive.ObjectID) (int, error) {
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionLessonCredit).DeleteMany(dbCtx, bson.D{{"course_record_pid", recordPID}})
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		loggingWithContext(ctx).Errormf(logModLessonCreditMgmt, err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModLessonCreditMgmt, "Deleted %d lesson credit entries (course record PID %s)", deleteResult.DeletedCount, recordPID.Hex())
+	return int(deleteResult.DeletedCount), nil
+}
+
+// delete ledger entries and alerts of a student in a course, return #delete entries, error
+func deleteLessonCredit(ctx context.Context, studentPID primitive.ObjectID, coursePID primitive.ObjectID) (int, error) {
+	var deleteFilter = bson.D{{"student_pid", studentPID}, {"course_pid", coursePID}}
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionLessonCredit).DeleteMany(dbCtx, deleteFilter)
+	if err == nil {
+		_, err = dbPool.Collection(DBCollectionLessonCreditAlert).DeleteMany(dbCtx, deleteFilter)
+	}
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		loggingWithContext(ctx).Errormf(logModLessonCreditMgmt, err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModLessonCreditMgmt, "Deleted %d lesson credit entries (student PID %s, course PID %s)",
+		deleteResult.DeletedCount, studentPID.Hex(), coursePID.Hex())
+	return int(deleteResult.DeletedCount), nil
+}
+
+// grant (positive) or adjust (negative) lesson credits of an enrolled student, return entry, error
+func grantLessonCredit(ctx context.Context, creditReq *LessonCreditReq) (*LessonCreditEntry, error) {
+	if creditReq.Credits == 0 {
+		return nil, fmt.Errorf("[%s] - Please specify non-zero credits", serverErrorMessages[seInputJSONNotValid])
+	}
+	references, err := findStudentCourseRef(ctx, creditReq.StudentPID, creditReq.CoursePID)
+	if err != nil || len(references) == 0 || creditReq.StudentPID.IsZero() || creditReq.CoursePID.IsZero() {
+		return nil, fmt.Errorf("[%s] - No student-course reference found with student PID %s and course PID %s", serverErrorMessages[seResourceNotFound],
+			creditReq.StudentPID.Hex(), creditReq.CoursePID.Hex())
+	}
+
+	var balancesBefore map[[2]primitive.ObjectID]*LessonCreditBalance
+	entries, err := findLessonCreditEntry(ctx, primitive.NilObjectID, creditReq.CoursePID)
+	if err != nil {
+		return nil, err
+	}
+	balancesBefore = lessonCreditBalanceMap(entries)
+
+	var entry = LessonCreditEntry{
+		StudentPID:   creditReq.StudentPID,
+		CoursePID:    creditReq.CoursePID,
+		EntryType:    LessonCreditGrant,
+		Credits:      creditReq.Credits,
+		Note:         creditReq.Note,
+		InstitutePID: references[0].InstitutePID,
+	}
+	if creditReq.Credits < 0 {
+		entry.EntryType = LessonCreditAdjust
+	}
+	_, err = createLessonCreditEntry(ctx, &entry)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Credits < 0 {
+		lessonCreditLowBalanceCheck(ctx, entry.CoursePID, balancesBefore)
+	}
+	return &entry, nil
+}
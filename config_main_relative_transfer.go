@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var mainRelativeTransferConfigHandlerTable = map[string]gin.HandlerFunc{
+	"get": mainRelativeTransferGetHandler,
+}
+
+func mainRelativeTransferGetHandler(ctx *gin.Context) {
+	// params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var transfers []*MainRelativeTransfer
+	var err error
+	var studentPID primitive.ObjectID
+
+	sPID := ctx.Request.URL.Query().Get("student_pid")
+	if sPID == "all" {
+		studentPID = primitive.NilObjectID
+	} else {
+		studentPID, err = primitive.ObjectIDFromHex(sPID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid student PID (student_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
+	// pid: nil objectid for all, others for specified one
+	transfers, err = findMainRelativeTransfer(ctx.Request.Context(), studentPID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = transfers
+	return
+}
+
+// find main relative transfer records (latest first), return record slice, error
+func findMainRelativeTransfer(ctx context.Context, studentPID primitive.ObjectID) ([]*MainRelativeTransfer, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find().SetSort(bson.D{{"transfer_ts", -1}})
+	var findFilter bson.D = bson.D{}
+	if !studentPID.IsZero() {
+		findFilter = append(findFilter, bson.E{"student_pid", studentPID})
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionMainRelativeTransfer).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	transfers := []*MainRelativeTransfer{}
+	for findCursor.Next(dbCtx) {
+		var transfer MainRelativeTransfer
+		err = findCursor.Decode(&transfer)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		transfers = append(transfers, &transfer)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Found %d main relative transfer results from DB (studentPID=%v)", len(transfers), studentPID.Hex())
+	return transfers, nil
+}
+
+// create main relative transfer record, return PID, error
+func createMainRelativeTransfer(ctx context.Context, transfer *MainRelativeTransfer) (primitive.ObjectID, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
+		}
+	}()
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionMainRelativeTransfer).InsertOne(dbCtx, transfer)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return primitive.NilObjectID, err
+	}
+
+	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Created main relative transfer record in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	return lastInsertID, nil
+}
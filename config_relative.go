@@ -44,7 +44,7 @@ func relativeGetHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	relatives, err = findRelative(pid)
+	relatives, err = findRelative(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -73,7 +73,7 @@ func relativePostHandler(ctx *gin.Context) {
 		return
 	}
 
-	relativePID, err = createRelative(&relative)
+	relativePID, err = createRelative(ctx.Request.Context(), &relative)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -101,7 +101,7 @@ func relativePutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateRelative(&relative)
+	err = updateRelative(ctx.Request.Context(), &relative)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -135,7 +135,7 @@ func relativeDeleteHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteRelative(pid)
+	deletedRows, err = deleteRelative(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -146,11 +146,11 @@ func relativeDeleteHandler(ctx *gin.Context) {
 }
 
 // find relative, return relative slice, error
-func findRelative(pid primitive.ObjectID) ([]*Relative, error) {
+func findRelative(ctx context.Context, pid primitive.ObjectID) ([]*Relative, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModRelativeMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModRelativeMgmt, err.Error())
 		}
 	}()
 
@@ -162,19 +162,22 @@ func findRelative(pid primitive.ObjectID) ([]*Relative, error) {
 		findOptions.SetLimit(1)
 		findFilter = bson.D{{"_id", pid}}
 	}
+	findFilter = relativeTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionRelative).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionRelative).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	relatives := []*Relative{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var relative Relative
 		err = findCursor.Decode(&relative)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		relatives = append(relatives, &relative)
@@ -182,62 +185,78 @@ func findRelative(pid primitive.ObjectID) ([]*Relative, error) {
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModRelativeMgmt, "Found %d relative results from DB (PID=%v)", len(relatives), pid.Hex())
+	loggingWithContext(ctx).Debugmf(logModRelativeMgmt, "Found %d relative results from DB (PID=%v)", len(relatives), pid.Hex())
 	return relatives, nil
 }
 
+// restrict a relative filter to relatives bound to students of caller's institute (relatives are not owned by an institute)
+func relativeTenantFilter(ctx context.Context, filter bson.D) bson.D {
+	institutePID := tenantFromContext(ctx)
+	if institutePID.IsZero() {
+		return filter
+	}
+	return bson.D{{"$and", bson.A{filter, bson.D{{"institute_pids", institutePID}}}}}
+}
+
 // find relative by wechat id, return relative slice, error
-func findRelativeByWXID(relativeWXID string) (*Relative, error) {
+func findRelativeByWXID(ctx context.Context, relativeWXID string) (*Relative, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModRelativeMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModRelativeMgmt, err.Error())
 		}
 	}()
 
 	var relative Relative
-	var findFilter = bson.D{{"relative_wxid", relativeWXID}}
-	err = dbPool.Collection(DBCollectionRelative).FindOne(context.TODO(), findFilter).Decode(&relative)
+	findFilter := relativeTenantFilter(ctx, bson.D{{"relative_wxid", relativeWXID}})
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	err = dbPool.Collection(DBCollectionRelative).FindOne(dbCtx, findFilter).Decode(&relative)
 	if err != nil {
 		err = fmt.Errorf("[%s] - could not find relative by wechat id %s [errinfo %s]", serverErrorMessages[seDBResourceQuery],
 			relativeWXID, err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModRelativeMgmt, "Found relative from DB (WXID %s PID=%s)", relativeWXID, relative.PID.Hex())
+	loggingWithContext(ctx).Debugmf(logModRelativeMgmt, "Found relative from DB (WXID %s PID=%s)", relativeWXID, relative.PID.Hex())
 	return &relative, nil
 }
 
 // create relative, return PID, error
-func createRelative(relative *Relative) (primitive.ObjectID, error) {
+func createRelative(ctx context.Context, relative *Relative) (primitive.ObjectID, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModRelativeMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModRelativeMgmt, err.Error())
 		}
 	}()
 
-	insertResult, err := dbPool.Collection(DBCollectionRelative).InsertOne(context.TODO(), relative)
+	// institutes follow student bindings
+	relative.InstitutePIDs = []primitive.ObjectID{}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionRelative).InsertOne(dbCtx, relative)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return primitive.NilObjectID, err
 	}
 
 	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModRelativeMgmt, "Created relative in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	loggingWithContext(ctx).Debugmf(logModRelativeMgmt, "Created relative in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
 	return lastInsertID, nil
 }
 
 // update relative, return error
-func updateRelative(relative *Relative) error {
+func updateRelative(ctx context.Context, relative *Relative) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModRelativeMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModRelativeMgmt, err.Error())
 		}
 	}()
 
@@ -247,7 +266,7 @@ func updateRelative(relative *Relative) error {
 		return err
 	}
 
-	var updateFilter = bson.D{{"_id", relative.PID}}
+	updateFilter := relativeTenantFilter(ctx, bson.D{{"_id", relative.PID}})
 	var updateBSONDocument = bson.D{}
 	relativeBSONData, err := bson.Marshal(relative)
 	if err != nil {
@@ -259,15 +278,24 @@ func updateRelative(relative *Relative) error {
 		err = fmt.Errorf("[%s] - could not convert relative (PID %s) to bson document", serverErrorMessages[seInputBSONNotValid], relative.PID.Hex())
 		return err
 	}
-	var updateOptions = bson.D{{"$set", updateBSONDocument}}
+	// institutes follow student bindings and are not set by clients
+	var setDocument = bson.D{}
+	for _, element := range updateBSONDocument {
+		if element.Key != "institute_pids" {
+			setDocument = append(setDocument, element)
+		}
+	}
+	var updateOptions = bson.D{{"$set", setDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionRelative).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionRelative).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModRelativeMgmt, "Update relative (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModRelativeMgmt, "Update relative (PID %s): matched %d modified %d",
 		relative.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
 		err = fmt.Errorf("[%s] - could not find relative (PID %s)", serverErrorMessages[seResourceNotFound], relative.PID.Hex())
@@ -280,16 +308,16 @@ func updateRelative(relative *Relative) error {
 }
 
 // delete relative, return #delete entries, error
-func deleteRelative(pid primitive.ObjectID) (int, error) {
+func deleteRelative(ctx context.Context, pid primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModRelativeMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModRelativeMgmt, err.Error())
 		}
 	}()
 
 	// check relative-student dependency
-	studentRelativeReferences, err := findStudentRelativeRef(primitive.NilObjectID, pid)
+	studentRelativeReferences, err := findStudentRelativeRef(ctx, primitive.NilObjectID, pid)
 	if err == nil && len(studentRelativeReferences) > 0 {
 		err = fmt.Errorf("[%s] - student-relative dependency unresolved (e.g. student PID %s relative PID %s)",
 			serverErrorMessages[seDependencyIssue], studentRelativeReferences[0].StudentPID.Hex(), studentRelativeReferences[0].RelativePID.Hex())
@@ -300,13 +328,60 @@ func deleteRelative(pid primitive.ObjectID) (int, error) {
 	if !pid.IsZero() {
 		deleteFilter = append(deleteFilter, bson.E{"_id", pid})
 	}
+	deleteFilter = relativeTenantFilter(ctx, deleteFilter)
 
-	deleteResult, err := dbPool.Collection(DBCollectionRelative).DeleteMany(context.TODO(), deleteFilter)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionRelative).DeleteMany(dbCtx, deleteFilter)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return 0, err
 	}
 
-	logging.Debugmf(logModRelativeMgmt, "Deleted %d relative results from DB", deleteResult.DeletedCount)
+	loggingWithContext(ctx).Debugmf(logModRelativeMgmt, "Deleted %d relative results from DB", deleteResult.DeletedCount)
 	return int(deleteResult.DeletedCount), nil
 }
+
+// set institutes of relatives from institutes of their bound students (tenant scope of relatives), return error
+func updateRelativeInstitutes(ctx context.Context, relativePIDs []primitive.ObjectID) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModRelativeMgmt, err.Error())
+		}
+	}()
+
+	for _, relativePID := range relativePIDs {
+		var institutePIDs = []primitive.ObjectID{}
+		var instituteMap = map[primitive.ObjectID]bool{}
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+		findCursor, findErr := dbPool.Collection(DBCollectionStudentRelativeRef).Find(dbCtx, bson.D{{"relative_pid", relativePID}},
+			options.Find().SetProjection(bson.D{{"institute_pid", 1}}))
+		for findErr == nil && findCursor.Next(dbCtx) {
+			var reference StudentRelativeRef
+			if findErr = findCursor.Decode(&reference); findErr == nil && !reference.InstitutePID.IsZero() && !instituteMap[reference.InstitutePID] {
+				instituteMap[reference.InstitutePID] = true
+				institutePIDs = append(institutePIDs, reference.InstitutePID)
+			}
+		}
+		if findErr == nil {
+			findErr = findCursor.Err()
+		}
+		dbCancel()
+		if findErr != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(findErr)], findErr.Error())
+			return err
+		}
+
+		dbCtx, dbCancel = dbContextWithTimeout(ctx, dbOpWrite)
+		_, err = dbPool.Collection(DBCollectionRelative).UpdateOne(dbCtx, bson.D{{"_id", relativePID}},
+			bson.D{{"$set", bson.D{{"institute_pids", institutePIDs}}}})
+		dbCancel()
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return err
+		}
+		loggingWithContext(ctx).Debugmf(logModRelativeMgmt, "Relative (PID %s) is bound to students of %d institutes", relativePID.Hex(), len(institutePIDs))
+	}
+	return nil
+}
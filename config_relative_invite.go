@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var relativeInviteConfigHandlerTable = map[string]gin.HandlerFunc{
+	"get":    relativeInviteGetHandler,
+	"delete": relativeInviteDeleteHandler,
+}
+
+// random bytes of an invite code (hex encoded, invite codes are not limited by attempts like binding codes)
+const relativeInviteCodeBytes = 16
+
+// relativeInviteCodeGenerate returns an unpredictable invite code
+func relativeInviteCodeGenerate() (string, error) {
+	code := make([]byte, relativeInviteCodeBytes)
+	if _, err := rand.Read(code); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(code), nil
+}
+
+func relativeInviteGetHandler(ctx *gin.Context) {
+	// params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var invites []*RelativeInvite
+	var err error
+	var studentPID primitive.ObjectID
+
+	sPID := ctx.Request.URL.Query().Get("student_pid")
+	if sPID == "all" {
+		studentPID = primitive.NilObjectID
+	} else {
+		studentPID, err = primitive.ObjectIDFromHex(sPID)
+		if err != nil {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid student PID (student_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
+	// pid: nil objectid for all, others for specified one
+	invites, err = findRelativeInvite(ctx.Request.Context(), studentPID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = invites
+	return
+}
+
+func relativeInviteDeleteHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var err error
+	var deletedRows int
+	var pid primitive.ObjectID
+	pid, err = primitive.ObjectIDFromHex(params.PID)
+	if err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specifiy a valid PID (mongoDB ObjectID)", serverErrorMessages[seInputParamNotValid])
+		return
+	}
+
+	deletedRows, err = deleteRelativeInvite(ctx.Request.Context(), pid)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = deletedRows
+	return
+}
+
+// find pending (not expired, not redeemed) relative invites of a student, return invite slice, error
+func findRelativeInvite(ctx context.Context, studentPID primitive.ObjectID) ([]*RelativeInvite, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
+		}
+	}()
+
+	var findOptions = options.Find()
+	var findFilter = bson.D{{"invite_expire", bson.D{{"$gte", time.Now().Unix()}}}, {"status", bson.D{{"$ne", RelativeInviteStatusRedeemed}}}}
+	if !studentPID.IsZero() {
+		findFilter = append(findFilter, bson.E{"student_pid", studentPID})
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionRelativeInvite).Find(dbCtx, findFilter, findOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	invites := []*RelativeInvite{}
+	for findCursor.Next(dbCtx) {
+		var invite RelativeInvite
+		err = findCursor.Decode(&invite)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		invites = append(invites, &invite)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Found %d relative invite results from DB (studentPID=%v)", len(invites), studentPID.Hex())
+	return invites, nil
+}
+
+// find relative invite by invite code, return invite (nil if no such code), error
+func findRelativeInviteByCode(ctx context.Context, inviteCode string) (*RelativeInvite, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
+		}
+	}()
+
+	var invite RelativeInvite
+	findFilter := bson.D{{"invite_code", inviteCode}}
+	findFilter = dbTenantFilter(ctx, findFilter)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findErr := dbPool.Collection(DBCollectionRelativeInvite).FindOne(dbCtx, findFilter).Decode(&invite)
+	if errors.Is(findErr, mongo.ErrNoDocuments) {
+		return nil, nil
+	} else if findErr != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(findErr)], findErr.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Found relative invite from DB (invitePID=%s, studentPID=%s)", invite.PID.Hex(), invite.StudentPID.Hex())
+	return &invite, nil
+}
+
+// create relative invite, return PID, error
+func createRelativeInvite(ctx context.Context, invite *RelativeInvite) (primitive.ObjectID, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
+		}
+	}()
+
+	if !relativePermissionMap[invite.Permission] {
+		err = fmt.Errorf("[%s] - Relative permission must be %s or %s", serverErrorMessages[seInputParamNotValid],
+			RelativePermissionView, RelativePermissionComment)
+		return primitive.NilObjectID, err
+	}
+
+	invite.Status = RelativeInviteStatusPending
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionRelativeInvite).InsertOne(dbCtx, invite)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return primitive.NilObjectID, err
+	}
+
+	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Created relative invite in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	return lastInsertID, nil
+}
+
+// redeem relative invite: claim invite (marked redeemed by relative) and create secondary reference in one transaction,
+// so an invite is redeemed once and a failed binding leaves it pending, return reference PID, error
+func redeemRelativeInvite(ctx context.Context, invite *RelativeInvite, reference *StudentRelativeRef) (primitive.ObjectID, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
+		}
+	}()
+
+	session, err := dbPool.Client().StartSession()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return primitive.NilObjectID, err
+	}
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	defer session.EndSession(dbCtx)
+
+	referencePID, err := session.WithTransaction(dbCtx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		// compare-and-set on status -> only one relative can redeem the invite
+		var claimFilter = bson.D{{"_id", invite.PID}, {"invite_code", invite.InviteCode}, {"status", bson.D{{"$ne", RelativeInviteStatusRedeemed}}}}
+		var claimOptions = bson.D{{"$set", bson.D{{"status", RelativeInviteStatusRedeemed}, {"redeemer_pid", reference.RelativePID}, {"redeem_ts", time.Now().Unix()}}}}
+		claimResult, err := dbPool.Collection(DBCollectionRelativeInvite).UpdateOne(sessCtx, claimFilter, claimOptions)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		}
+		if claimResult.MatchedCount == 0 {
+			return nil, fmt.Errorf("[%s] - relative invite (PID %s) has been redeemed or revoked by another request", serverErrorMessages[seResourceConflict], invite.PID.Hex())
+		}
+
+		return createStudentRelativeRef(sessCtx, reference)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Redeemed relative invite (PID %s) by relative (PID %s)", invite.PID.Hex(), reference.RelativePID.Hex())
+	return referencePID.(primitive.ObjectID), nil
+}
+
+// delete relative invite, return #delete entries, error
+func deleteRelativeInvite(ctx context.Context, pid primitive.ObjectID) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
+		}
+	}()
+
+	deleteFilter := bson.D{{"_id", pid}}
+	deleteFilter = dbTenantFilter(ctx, deleteFilter)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionRelativeInvite).DeleteOne(dbCtx, deleteFilter)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Deleted %d relative invites from DB (PID %s)", deleteResult.DeletedCount, pid.Hex())
+	return int(deleteResult.DeletedCount), nil
+}
+
+// delete all relative invites of a student, return #delete entries, error
+func deleteRelativeInviteByStudentPID(ctx context.Context, studentPID primitive.ObjectID) (int, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
+		}
+	}()
+
+	deleteFilter := bson.D{{"student_pid", studentPID}}
+	deleteFilter = dbTenantFilter(ctx, deleteFilter)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionRelativeInvite).DeleteMany(dbCtx, deleteFilter)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return 0, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Deleted %d relative invites from DB (studentPID %s)", deleteResult.DeletedCount, studentPID.Hex())
+	return int(deleteResult.DeletedCount), nil
+}
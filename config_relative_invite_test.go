@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// teacher of another institute cannot delete an invite
+func TestRelativeInviteDeleteCrossTenant(t *testing.T) {
+	testDBSetup(t)
+	student, relatives := testStudentRelatives(t, 1)
+	var invite = RelativeInvite{
+		StudentPID:   student.PID,
+		InviterPID:   relatives[0].PID,
+		InviteExpire: time.Now().Add(time.Hour).Unix(),
+		Relationship: "Father",
+		Permission:   RelativePermissionView,
+		CreateTS:     time.Now().Unix(),
+		InstitutePID: student.InstitutePID,
+	}
+	var err error
+	if invite.InviteCode, err = relativeInviteCodeGenerate(); err != nil {
+		t.Fatalf("could not generate invite code: %s", err.Error())
+	}
+	if invite.PID, err = createRelativeInvite(context.Background(), &invite); err != nil {
+		t.Fatalf("could not create invite: %s", err.Error())
+	}
+	teacherContext := func(institutePID primitive.ObjectID) context.Context {
+		return context.WithValue(context.Background(), tenantContextKey{}, &tenantScope{InstitutePID: institutePID, TeacherPID: primitive.NewObjectID()})
+	}
+
+	otherContext := teacherContext(primitive.NewObjectID())
+	if deletedCount, err := deleteRelativeInvite(otherContext, invite.PID); err != nil || deletedCount != 0 {
+		t.Errorf("other institute: got %d deleted invites (error %v), want none", deletedCount, err)
+	}
+	if deletedCount, err := deleteRelativeInviteByStudentPID(otherContext, student.PID); err != nil || deletedCount != 0 {
+		t.Errorf("other institute: got %d deleted invites of student (error %v), want none", deletedCount, err)
+	}
+	if inviteFound, err := findRelativeInviteByCode(context.Background(), invite.InviteCode); err != nil || inviteFound == nil {
+		t.Fatalf("invite deleted by other institute")
+	}
+
+	if deletedCount, err := deleteRelativeInvite(teacherContext(student.InstitutePID), invite.PID); err != nil || deletedCount != 1 {
+		t.Errorf("own institute: got %d deleted invites (error %v), want 1", deletedCount, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/gin-gonic/gin"
@@ -21,11 +22,9 @@ var studentConfigHandlerTable = map[string]gin.HandlerFunc{
 	"delete": studentDeleteHandler,
 }
 
-func studentGetImageName(student *Student) string {
-	if student == nil {
-		return ""
-	}
-	return "image-student-profile-" + student.PID.Hex() + ".jpg"
+// blob name of a student image variant, versioned so that a new upload never reuses a cached URL
+func studentGetImageName(studentPID primitive.ObjectID, version int64, size int) string {
+	return fmt.Sprintf("image-student-profile-%s-v%d-%d.jpg", studentPID.Hex(), version, size)
 }
 
 func studentGetHandler(ctx *gin.Context) {
@@ -51,8 +50,71 @@ func studentGetHandler(ctx *gin.Context) {
 		}
 	}
 
-	// pid: nil objectid for all, others for specified one
-	students, err = findStudent(pid)
+	// relatives (relative_wxid=?) only see their bound students with relative-visible fields
+	if relativeWXID := ctx.Request.URL.Query().Get("relative_wxid"); relativeWXID != "" {
+		var views []*StudentRelativeView
+		views, err = findStudentRelativeView(ctx.Request.Context(), relativeWXID, pid)
+		if err != nil {
+			response.Status = http.StatusConflict
+			response.Message = err.Error()
+			return
+		}
+		response.Payload = views
+		return
+	}
+
+	// staff view only for teachers and super-admin, limited to students of one institute
+	// (teacher's own one, super-admin gives institute_pid=?)
+	if !ginContextIsStaff(ctx) {
+		response.Status = http.StatusForbidden
+		response.Message = fmt.Sprintf("[%s] - Teacher token (%s header) or admin token is required without relative_wxid=?",
+			serverErrorMessages[seInputParamNotValid], ginHeaderAuthorization)
+		return
+	}
+	var institutePID = tenantFromContext(ctx.Request.Context())
+	if institute := ctx.Request.URL.Query().Get("institute_pid"); institute != "" {
+		var queryPID primitive.ObjectID
+		queryPID, err = primitive.ObjectIDFromHex(institute)
+		if err != nil || queryPID.IsZero() {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid institute PID (institute_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+		if err = tenantCheck(ctx.Request.Context(), queryPID); err != nil {
+			response.Status = http.StatusForbidden
+			response.Message = err.Error()
+			return
+		}
+		institutePID = queryPID
+	}
+	if institutePID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specifiy an institute PID (institute_pid=?)", serverErrorMessages[seInputParamNotValid])
+		return
+	}
+
+	// pid: nil objectid for all (archived students only if status=archived/all is given), others for specified one
+	if pid.IsZero() {
+		var statuses []string
+		switch status := ctx.Request.URL.Query().Get("status"); status {
+		case "":
+			statuses = []string{StudentStatusActive, StudentStatusPaused}
+		case "all":
+			statuses = nil
+		case "archived":
+			statuses = []string{StudentStatusGraduated, StudentStatusWithdrawn}
+		default:
+			if !studentStatusMap[status] {
+				response.Status = http.StatusBadRequest
+				response.Message = fmt.Sprintf("[%s] - Please specifiy a valid student status (status=?)", serverErrorMessages[seInputParamNotValid])
+				return
+			}
+			statuses = []string{status}
+		}
+		students, err = findStudentByStatus(ctx.Request.Context(), institutePID, statuses, nil)
+	} else {
+		students, err = findStudentByStatus(ctx.Request.Context(), institutePID, nil, []primitive.ObjectID{pid})
+	}
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -81,7 +143,7 @@ func studentPostHandler(ctx *gin.Context) {
 		return
 	}
 
-	studentPID, err = createStudent(&student)
+	studentPID, err = createStudent(ctx.Request.Context(), &student)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -109,7 +171,7 @@ func studentPutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateStudent(&student)
+	err = updateStudent(ctx.Request.Context(), &student)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -143,7 +205,7 @@ func studentDeleteHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteStudent(pid)
+	deletedRows, err = deleteStudent(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -154,11 +216,11 @@ func studentDeleteHandler(ctx *gin.Context) {
 }
 
 // find student, return student slice, error
-func findStudent(pid primitive.ObjectID) ([]*Student, error) {
+func findStudent(ctx context.Context, pid primitive.ObjectID) ([]*Student, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModStudentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
 		}
 	}()
 
@@ -170,19 +232,22 @@ func findStudent(pid primitive.ObjectID) ([]*Student, error) {
 		findOptions.SetLimit(1)
 		findFilter = bson.D{{"_id", pid}}
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionStudent).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionStudent).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	students := []*Student{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var student Student
 		err = findCursor.Decode(&student)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		students = append(students, &student)
@@ -190,68 +255,204 @@ func findStudent(pid primitive.ObjectID) ([]*Student, error) {
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModStudentMgmt, "Found %d student results from DB (PID=%v)", len(students), pid.Hex())
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Found %d student results from DB (PID=%v)", len(students), pid.Hex())
 	return students, nil
 }
 
-// find student by binding code
-func findStudentByBindingCode(bindingCode string) (*Student, error) {
+// find students of an institute (nil objectid for all) by lifecycle status (nil for all, active also for students older than lifecycle)
+// among student PIDs (nil for all), return student slice, error
+func findStudentByStatus(ctx context.Context, institutePID primitive.ObjectID, statuses []string, studentPIDs []primitive.ObjectID) ([]*Student, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModStudentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
 		}
 	}()
 
-	var student Student
-	findFilter := bson.D{{"binding_code", bindingCode}}
-	err = dbPool.Collection(DBCollectionStudent).FindOne(context.TODO(), findFilter).Decode(&student)
+	var findOptions = options.Find()
+	var findFilter = bson.D{}
+	if statuses != nil {
+		var statusFilter = bson.A{}
+		for _, status := range statuses {
+			statusFilter = append(statusFilter, status)
+			if status == StudentStatusActive {
+				statusFilter = append(statusFilter, nil)
+			}
+		}
+		findFilter = append(findFilter, bson.E{"status", bson.D{{"$in", statusFilter}}})
+	}
+	if studentPIDs != nil {
+		findFilter = append(findFilter, bson.E{"_id", bson.D{{"$in", studentPIDs}}})
+	}
+	if !institutePID.IsZero() {
+		findFilter = append(findFilter, bson.E{"institute_pid", institutePID})
+	}
+	findFilter = dbTenantFilter(ctx, findFilter)
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionStudent).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModStudentMgmt, "Found student from DB (studentPID=%s, bindingCode=%s)", student.PID.Hex(), bindingCode)
-	return &student, nil
+	students := []*Student{}
+	for findCursor.Next(dbCtx) {
+		var student Student
+		err = findCursor.Decode(&student)
+		if err != nil {
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+			return nil, err
+		}
+		students = append(students, &student)
+	}
+
+	err = findCursor.Err()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Found %d student results from DB (institutePID=%v, statuses=%v)", len(students), institutePID.Hex(), statuses)
+	return students, nil
+}
+
+// check student profile (institute, birthdate, gender, emergency contacts), return error
+func studentProfileCheck(ctx context.Context, student *Student) error {
+	if student.InstitutePID.IsZero() {
+		return fmt.Errorf("[%s] - No institute PID specified", serverErrorMessages[seResourceNotFound])
+	}
+	if err := tenantCheck(ctx, student.InstitutePID); err != nil {
+		return err
+	}
+	institutes, err := findInstitute(ctx, student.InstitutePID)
+	if err != nil || len(institutes) == 0 {
+		return fmt.Errorf("[%s] - No institutes found with PID %s", serverErrorMessages[seResourceNotFound], student.InstitutePID.Hex())
+	}
+	if student.Birthdate != "" {
+		birthdate, err := time.Parse(scheduleDateLayout, student.Birthdate)
+		if err != nil || birthdate.After(time.Now()) {
+			return fmt.Errorf("[%s] - Birthdate must be a past date YYYY-MM-DD (\"%s\")", serverErrorMessages[seInputSchemaNotValid], student.Birthdate)
+		}
+	}
+	if !studentGenderMap[student.Gender] {
+		return fmt.Errorf("[%s] - Gender can only be %s/%s/%s or empty", serverErrorMessages[seInputSchemaNotValid],
+			StudentGenderFemale, StudentGenderMale, StudentGenderOther)
+	}
+	if student.EmergencyContacts == nil {
+		student.EmergencyContacts = []EmergencyContact{}
+	}
+	for _, contact := range student.EmergencyContacts {
+		if contact.Name == "" || contact.PhoneNumber == "" {
+			return fmt.Errorf("[%s] - Emergency contact needs name and phone number (\"%s\")", serverErrorMessages[seInputSchemaNotValid], contact.Name)
+		}
+	}
+	return nil
+}
+
+// relative-visible fields of a student
+func studentRelativeView(student *Student) *StudentRelativeView {
+	var studentImageSizes = map[int]string{}
+	for _, variant := range student.StudentImageVariants {
+		studentImageSizes[variant.Size] = variant.ImageURL
+	}
+	return &StudentRelativeView{
+		PID:               student.PID,
+		StudentName:       student.StudentName,
+		StudentImageURL:   student.StudentImageURL,
+		StudentImageSizes: studentImageSizes,
+		InstitutePID:      student.InstitutePID,
+		Birthdate:         student.Birthdate,
+		Gender:            student.Gender,
+		Allergies:         student.Allergies,
+		EmergencyContacts: student.EmergencyContacts,
+		Status:            studentStatus(student),
+	}
+}
+
+// find students bound to a relative (also archived ones) as relative views, student PID nil objectid for all, return view slice, error
+func findStudentRelativeView(ctx context.Context, relativeWXID string, studentPID primitive.ObjectID) ([]*StudentRelativeView, error) {
+	relative, err := findRelativeByWXID(ctx, relativeWXID)
+	if err != nil || relative == nil {
+		return nil, fmt.Errorf("[%s] - No relative found with wechat id \"%s\"", serverErrorMessages[seResourceNotFound], relativeWXID)
+	}
+	references, err := findStudentRelativeRef(ctx, studentPID, relative.PID)
+	if err != nil {
+		return nil, err
+	}
+	var studentPIDs = []primitive.ObjectID{}
+	for i := range references {
+		studentPIDs = append(studentPIDs, references[i].StudentPID)
+	}
+	students, err := findStudentByStatus(ctx, primitive.NilObjectID, nil, studentPIDs)
+	if err != nil {
+		return nil, err
+	}
+	var views = []*StudentRelativeView{}
+	for i := range students {
+		views = append(views, studentRelativeView(students[i]))
+	}
+	return views, nil
+}
+
+// lifecycle status of a student (students older than lifecycle are active)
+func studentStatus(student *Student) string {
+	if student.Status == "" {
+		return StudentStatusActive
+	}
+	return student.Status
 }
 
 // create student, return PID, error
-func createStudent(student *Student) (primitive.ObjectID, error) {
+func createStudent(ctx context.Context, student *Student) (primitive.ObjectID, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModStudentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
 		}
 	}()
 
-	insertResult, err := dbPool.Collection(DBCollectionStudent).InsertOne(context.TODO(), student)
+	err = studentProfileCheck(ctx, student)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
 		return primitive.NilObjectID, err
 	}
 
-	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModStudentMgmt, "Created student in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	// new students are active
+	student.Status = StudentStatusActive
+	student.StatusTS = time.Now().Unix()
+	student.StatusHistory = []StudentStatusEvent{{Status: StudentStatusActive, ChangeTS: student.StatusTS}}
+
+	// student image is only set by image upload workflow
+	student.StudentImageName = ""
+	student.StudentImageURL = ""
+	student.StudentImageVersion = 0
+	student.StudentImageVariants = []StudentImageVariant{}
 
-	// update student image name/url
-	student.PID = lastInsertID
-	student.StudentImageName = studentGetImageName(student)
-	student.StudentImageURL = azMediaContainerURL.String() + "/" + student.StudentImageName
-	updateStudent(student)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionStudent).InsertOne(dbCtx, student)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return primitive.NilObjectID, err
+	}
+
+	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Created student in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
 
 	return lastInsertID, nil
 }
 
 // update student, return error
-func updateStudent(student *Student) error {
+func updateStudent(ctx context.Context, student *Student) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModStudentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
 		}
 	}()
 
@@ -261,12 +462,33 @@ func updateStudent(student *Student) error {
 		return err
 	}
 
-	// student image name/url
-	student.StudentImageName = studentGetImageName(student)
-	student.StudentImageURL = azMediaContainerURL.String() + "/" + student.StudentImageName
+	err = studentProfileCheck(ctx, student)
+	if err != nil {
+		return err
+	}
+
+	// lifecycle status is only changed by status workflow, student image by image upload workflow
+	students, err := findStudent(ctx, student.PID)
+	if err != nil || len(students) == 0 {
+		err = fmt.Errorf("[%s] - could not find student (PID %s)", serverErrorMessages[seResourceNotFound], student.PID.Hex())
+		return err
+	}
+	student.Status = studentStatus(students[0])
+	student.StatusTS = students[0].StatusTS
+	student.StatusHistory = students[0].StatusHistory
+	if student.StatusHistory == nil {
+		student.StatusHistory = []StudentStatusEvent{}
+	}
+	student.StudentImageName = students[0].StudentImageName
+	student.StudentImageURL = students[0].StudentImageURL
+	student.StudentImageVersion = students[0].StudentImageVersion
+	student.StudentImageVariants = students[0].StudentImageVariants
+	if student.StudentImageVariants == nil {
+		student.StudentImageVariants = []StudentImageVariant{}
+	}
 
 	// update student
-	var updateFilter = bson.D{{"_id", student.PID}}
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", student.PID}})
 	var updateBSONDocument = bson.D{}
 	studentBSONData, err := bson.Marshal(student)
 	if err != nil {
@@ -280,13 +502,15 @@ func updateStudent(student *Student) error {
 	}
 	var updateOptions = bson.D{{"$set", updateBSONDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionStudent).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionStudent).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModStudentMgmt, "Update student (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Update student (PID %s): matched %d modified %d",
 		student.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
 		err = fmt.Errorf("[%s] - could not find student (PID %s)", serverErrorMessages[seResourceNotFound], student.PID.Hex())
@@ -298,17 +522,137 @@ func updateStudent(student *Student) error {
 	return nil
 }
 
+// change lifecycle status of a student (media tier restored when an archived student comes back), return student, error
+func updateStudentStatus(ctx context.Context, statusReq *StudentStatusReq) (*Student, error) {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	if !studentStatusMap[statusReq.Status] {
+		err = fmt.Errorf("[%s] - Student status can only be %s/%s/%s/%s", serverErrorMessages[seInputSchemaNotValid],
+			StudentStatusActive, StudentStatusPaused, StudentStatusGraduated, StudentStatusWithdrawn)
+		return nil, err
+	}
+	students, err := findStudent(ctx, statusReq.StudentPID)
+	if err != nil || len(students) == 0 || statusReq.StudentPID.IsZero() {
+		err = fmt.Errorf("[%s] - No students found with PID %s", serverErrorMessages[seResourceNotFound], statusReq.StudentPID.Hex())
+		return nil, err
+	}
+	var student = students[0]
+	var previousStatus = studentStatus(student)
+	if previousStatus == statusReq.Status {
+		err = fmt.Errorf("[%s] - student (PID %s) is already %s", serverErrorMessages[seResourceNotChange], student.PID.Hex(), statusReq.Status)
+		return nil, err
+	}
+
+	// only if status was not changed concurrently (students older than lifecycle have no status)
+	var previousStatuses = bson.A{student.Status}
+	if student.Status == "" {
+		previousStatuses = append(previousStatuses, nil)
+	}
+	var statusEvent = StudentStatusEvent{Status: statusReq.Status, ChangeTS: time.Now().Unix(), Note: statusReq.Note}
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", student.PID}, {"status", bson.D{{"$in", previousStatuses}}}})
+	var updateOptions = bson.D{
+		{"$set", bson.D{{"status", statusEvent.Status}, {"status_ts", statusEvent.ChangeTS}}},
+		{"$push", bson.D{{"status_history", statusEvent}}},
+	}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	updateResult, err := dbPool.Collection(DBCollectionStudent).UpdateOne(dbCtx, updateFilter, updateOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return nil, err
+	}
+	if updateResult.MatchedCount == 0 {
+		err = fmt.Errorf("[%s] - student (PID %s) status was changed concurrently, please retry", serverErrorMessages[seResourceConflict], student.PID.Hex())
+		return nil, err
+	}
+	student.Status = statusEvent.Status
+	student.StatusTS = statusEvent.ChangeTS
+	student.StatusHistory = append(student.StatusHistory, statusEvent)
+	loggingWithContext(ctx).Infomf(logModStudentMgmt, "Student (PID %s) status changed: %s -> %s", student.PID.Hex(), previousStatus, student.Status)
+
+	// media moved to cool tier while archived is served from hot tier again
+	if studentArchivedStatusMap[previousStatus] && !studentArchivedStatusMap[student.Status] {
+		_, err = cloudMediaStudentTier(ctx, student.PID, azblob.AccessTierHot)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return student, nil
+}
+
+// blob names of a student image (all variants, older students may only have a manually uploaded image)
+func studentImageBlobNames(student *Student) []string {
+	var imageNames = []string{}
+	var imageNameMap = map[string]bool{"": true}
+	for _, variant := range student.StudentImageVariants {
+		if !imageNameMap[variant.ImageName] {
+			imageNames = append(imageNames, variant.ImageName)
+			imageNameMap[variant.ImageName] = true
+		}
+	}
+	if !imageNameMap[student.StudentImageName] {
+		imageNames = append(imageNames, student.StudentImageName)
+	}
+	return imageNames
+}
+
+// replace student image by uploaded variants (largest first), only if image was not replaced concurrently, return error
+func updateStudentImage(ctx context.Context, student *Student, version int64, variants []StudentImageVariant) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
+		}
+	}()
+
+	if len(variants) == 0 {
+		err = fmt.Errorf("[%s] - student (PID %s) image has no variants", serverErrorMessages[seInputParamNotValid], student.PID.Hex())
+		return err
+	}
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", student.PID}, {"student_image_name", student.StudentImageName}})
+	var updateOptions = bson.D{{"$set", bson.D{
+		{"student_image_name", variants[0].ImageName},
+		{"student_image_url", variants[0].ImageURL},
+		{"student_image_version", version},
+		{"student_image_variants", variants},
+	}}}
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	updateResult, err := dbPool.Collection(DBCollectionStudent).UpdateOne(dbCtx, updateFilter, updateOptions)
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return err
+	}
+	if updateResult.MatchedCount == 0 {
+		err = fmt.Errorf("[%s] - student (PID %s) image was changed concurrently, please retry", serverErrorMessages[seResourceConflict], student.PID.Hex())
+		return err
+	}
+	student.StudentImageName = variants[0].ImageName
+	student.StudentImageURL = variants[0].ImageURL
+	student.StudentImageVersion = version
+	student.StudentImageVariants = variants
+	loggingWithContext(ctx).Infomf(logModStudentMgmt, "Student (PID %s) image updated to version %d", student.PID.Hex(), version)
+	return nil
+}
+
 // delete student, return #delete entries, error
-func deleteStudent(pid primitive.ObjectID) (int, error) {
+func deleteStudent(ctx context.Context, pid primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModStudentMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModStudentMgmt, err.Error())
 		}
 	}()
 
 	// check course-student dependency
-	studentCourseReferences, err := findStudentCourseRef(pid, primitive.NilObjectID)
+	studentCourseReferences, err := findStudentCourseRef(ctx, pid, primitive.NilObjectID)
 	if err == nil && len(studentCourseReferences) > 0 {
 		err = fmt.Errorf("[%s] - student-course dependency unresolved (e.g. student PID %s course PID %s)",
 			serverErrorMessages[seDependencyIssue], studentCourseReferences[0].StudentPID.Hex(), studentCourseReferences[0].CoursePID.Hex())
@@ -316,14 +660,14 @@ func deleteStudent(pid primitive.ObjectID) (int, error) {
 	}
 
 	// check relative-student dependency
-	studentRelativeReferences, err := findStudentRelativeRef(pid, primitive.NilObjectID)
+	studentRelativeReferences, err := findStudentRelativeRef(ctx, pid, primitive.NilObjectID)
 	if err == nil && len(studentRelativeReferences) > 0 {
 		err = fmt.Errorf("[%s] - student-relative dependency unresolved (e.g. student PID %s relative PID %s)",
 			serverErrorMessages[seDependencyIssue], studentRelativeReferences[0].StudentPID.Hex(), studentRelativeReferences[0].RelativePID.Hex())
 		return 0, err
 	}
 
-	students, findErr := findStudent(pid)
+	students, findErr := findStudent(ctx, pid)
 	if findErr != nil {
 		err = fmt.Errorf("[%s] - could not delete student (PID %s) due to DB query/find error occurs", serverErrorMessages[seDBResourceQuery], pid.Hex())
 		return 0, err
@@ -331,33 +675,39 @@ func deleteStudent(pid primitive.ObjectID) (int, error) {
 
 	var deleteCnt int64
 	for i := range students {
-		_, deleteCloudMediaErr := deleteCloudMediaByStudentPID(students[i].PID, false) // onlyNilCourseRecord = true to delete all cloud media
+		_, deleteCloudMediaErr := deleteCloudMediaByStudentPID(ctx, students[i].PID, false) // onlyNilCourseRecord = true to delete all cloud media
 		if deleteCloudMediaErr != nil {
 			err = fmt.Errorf("[%s] - stop deleting student (PID %s) since cloud media could not be deleted: %s",
 				serverErrorMessages[seCloudOpsError], students[i].PID.Hex(), deleteCloudMediaErr.Error())
 			return int(deleteCnt), err
 		}
 
-		if students[i].StudentImageName != "" {
-			if deleteStudentImageErr := azureStorageDeleteBlob(azMediaContainerURL, students[i].StudentImageName); deleteStudentImageErr != nil {
+		for _, imageName := range studentImageBlobNames(students[i]) {
+			if deleteStudentImageErr := azureStorageDeleteBlob(ctx, azMediaContainerURL, imageName); deleteStudentImageErr != nil {
 				if serr, ok := deleteStudentImageErr.(azblob.StorageError); !ok || serr.ServiceCode() != azblob.ServiceCodeBlobNotFound {
-					err = fmt.Errorf("[%s] - could not delete student image at cloud (PID: %s image name:%s image url:%s) due to error: [%s]",
-						serverErrorMessages[seCloudOpsError], students[i].PID.Hex(), students[i].StudentImageName, students[i].StudentImageURL, deleteStudentImageErr.Error())
+					err = fmt.Errorf("[%s] - could not delete student image at cloud (PID: %s image name:%s) due to error: [%s]",
+						serverErrorMessages[seCloudOpsError], students[i].PID.Hex(), imageName, deleteStudentImageErr.Error())
 					return int(deleteCnt), err
 				}
 			}
 		}
 
+		// pending relative invites and binding codes have no use without student
+		deleteRelativeInviteByStudentPID(ctx, students[i].PID)
+		deleteBindingCodeByStudentPID(ctx, students[i].PID)
+
 		deleteFilter := bson.D{{"_id", students[i].PID}}
-		deleteResult, err := dbPool.Collection(DBCollectionStudent).DeleteMany(context.TODO(), deleteFilter)
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		deleteResult, err := dbPool.Collection(DBCollectionStudent).DeleteMany(dbCtx, deleteFilter)
+		dbCancel()
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return 0, err
 		}
 
 		deleteCnt += deleteResult.DeletedCount
 	}
 
-	logging.Debugmf(logModStudentMgmt, "Deleted %d student results from DB", deleteCnt)
+	loggingWithContext(ctx).Debugmf(logModStudentMgmt, "Deleted %d student results from DB", deleteCnt)
 	return int(deleteCnt), nil
 }
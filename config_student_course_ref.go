@@ -58,7 +58,7 @@ func studentCourseRefGetHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	references, err = findStudentCourseRef(studentPID, coursePID)
+	references, err = findStudentCourseRef(ctx.Request.Context(), studentPID, coursePID)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -87,7 +87,7 @@ func studentCourseRefPostHandler(ctx *gin.Context) {
 		return
 	}
 
-	referencePID, err = createStudentCourseRef(&reference)
+	referencePID, err = createStudentCourseRef(ctx.Request.Context(), &reference)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -115,7 +115,7 @@ func studentCourseRefPutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateStudentCourseRef(&reference)
+	err = updateStudentCourseRef(ctx.Request.Context(), &reference)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -163,7 +163,7 @@ func studentCourseRefDeleteHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteStudentCourseRef(studentPID, coursePID)
+	deletedRows, err = deleteStudentCourseRef(ctx.Request.Context(), studentPID, coursePID)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -174,11 +174,11 @@ func studentCourseRefDeleteHandler(ctx *gin.Context) {
 }
 
 // find student-course references, return references slice, error
-func findStudentCourseRef(studentPID primitive.ObjectID, coursePID primitive.ObjectID) ([]*StudentCourseRef, error) {
+func findStudentCourseRef(ctx context.Context, studentPID primitive.ObjectID, coursePID primitive.ObjectID) ([]*StudentCourseRef, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModReferenceMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
 		}
 	}()
 
@@ -190,19 +190,22 @@ func findStudentCourseRef(studentPID primitive.ObjectID, coursePID primitive.Obj
 	if !coursePID.IsZero() {
 		findFilter = append(findFilter, bson.E{"course_pid", coursePID})
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionStudentCourseRef).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionStudentCourseRef).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	references := []*StudentCourseRef{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var reference StudentCourseRef
 		err = findCursor.Decode(&reference)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		references = append(references, &reference)
@@ -210,21 +213,21 @@ func findStudentCourseRef(studentPID primitive.ObjectID, coursePID primitive.Obj
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModReferenceMgmt, "Found %d student-course reference results from DB (studentPID=%v, coursePID=%v)",
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Found %d student-course reference results from DB (studentPID=%v, coursePID=%v)",
 		len(references), studentPID.Hex(), coursePID.Hex())
 	return references, nil
 }
 
 // create student-course reference, return PID, error
-func createStudentCourseRef(reference *StudentCourseRef) (primitive.ObjectID, error) {
+func createStudentCourseRef(ctx context.Context, reference *StudentCourseRef) (primitive.ObjectID, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModReferenceMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
 		}
 	}()
 
@@ -233,41 +236,71 @@ func createStudentCourseRef(reference *StudentCourseRef) (primitive.ObjectID, er
 		err = fmt.Errorf("[%s] - No student PID specified", serverErrorMessages[seResourceNotFound])
 		return primitive.NilObjectID, err
 	}
-	students, err := findStudent(reference.StudentPID)
+	students, err := findStudent(ctx, reference.StudentPID)
 	if err != nil || len(students) == 0 {
 		err = fmt.Errorf("[%s] - No students found with PID %s", serverErrorMessages[seResourceNotFound], reference.StudentPID.Hex())
 		return primitive.NilObjectID, err
 	}
+	if studentArchivedStatusMap[studentStatus(students[0])] {
+		err = fmt.Errorf("[%s] - Student (PID %s) is %s and cannot be enrolled", serverErrorMessages[seResourceConflict],
+			reference.StudentPID.Hex(), studentStatus(students[0]))
+		return primitive.NilObjectID, err
+	}
 
 	// course PID check
 	if reference.CoursePID.IsZero() {
 		err = fmt.Errorf("[%s] - No course PID specified", serverErrorMessages[seResourceNotFound])
 		return primitive.NilObjectID, err
 	}
-	courses, err := findCourse(reference.CoursePID)
+	courses, err := findCourse(ctx, reference.CoursePID)
 	if err != nil || len(courses) == 0 {
 		err = fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], reference.CoursePID.Hex())
 		return primitive.NilObjectID, err
 	}
+	if !students[0].InstitutePID.IsZero() && students[0].InstitutePID != courses[0].InstitutePID {
+		err = fmt.Errorf("[%s] - Student (PID %s) and course (PID %s) belong to different institutes", serverErrorMessages[seResourceNotMatched],
+			reference.StudentPID.Hex(), reference.CoursePID.Hex())
+		return primitive.NilObjectID, err
+	}
+	reference.InstitutePID = courses[0].InstitutePID
 
-	insertResult, err := dbPool.Collection(DBCollectionStudentCourseRef).InsertOne(context.TODO(), reference)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionStudentCourseRef).InsertOne(dbCtx, reference)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return primitive.NilObjectID, err
 	}
 
 	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModReferenceMgmt, "Created student-course reference in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Created student-course reference in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+
+	// enrolment grants lesson credits (reference is removed again if credits could not be booked)
+	if reference.Credits > 0 {
+		_, err = createLessonCreditEntry(ctx, &LessonCreditEntry{
+			StudentPID:   reference.StudentPID,
+			CoursePID:    reference.CoursePID,
+			EntryType:    LessonCreditGrant,
+			Credits:      reference.Credits,
+			Note:         "enrolment",
+			InstitutePID: reference.InstitutePID,
+		})
+		if err != nil {
+			_, _ = dbPool.Collection(DBCollectionStudentCourseRef).DeleteOne(dbCtx, bson.D{{"_id", lastInsertID}})
+			err = fmt.Errorf("%s -> student-course reference (PID %s) is rolled back", err.Error(), lastInsertID.Hex())
+			return primitive.NilObjectID, err
+		}
+	}
 
 	return lastInsertID, nil
 }
 
 // update student-course reference, return error
-func updateStudentCourseRef(reference *StudentCourseRef) error {
+func updateStudentCourseRef(ctx context.Context, reference *StudentCourseRef) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModReferenceMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
 		}
 	}()
 
@@ -282,7 +315,7 @@ func updateStudentCourseRef(reference *StudentCourseRef) error {
 		err = fmt.Errorf("[%s] - No student PID specified", serverErrorMessages[seResourceNotFound])
 		return err
 	}
-	students, err := findStudent(reference.StudentPID)
+	students, err := findStudent(ctx, reference.StudentPID)
 	if err != nil || len(students) == 0 {
 		err = fmt.Errorf("[%s] - No students found with PID %s", serverErrorMessages[seResourceNotFound], reference.StudentPID.Hex())
 		return err
@@ -293,14 +326,20 @@ func updateStudentCourseRef(reference *StudentCourseRef) error {
 		err = fmt.Errorf("[%s] - No course PID specified", serverErrorMessages[seResourceNotFound])
 		return err
 	}
-	courses, err := findCourse(reference.CoursePID)
+	courses, err := findCourse(ctx, reference.CoursePID)
 	if err != nil || len(courses) == 0 {
 		err = fmt.Errorf("[%s] - No courses found with PID %s", serverErrorMessages[seResourceNotFound], reference.CoursePID.Hex())
 		return err
 	}
+	if !students[0].InstitutePID.IsZero() && students[0].InstitutePID != courses[0].InstitutePID {
+		err = fmt.Errorf("[%s] - Student (PID %s) and course (PID %s) belong to different institutes", serverErrorMessages[seResourceNotMatched],
+			reference.StudentPID.Hex(), reference.CoursePID.Hex())
+		return err
+	}
+	reference.InstitutePID = courses[0].InstitutePID
 
 	// update student
-	var updateFilter = bson.D{{"_id", reference.PID}}
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", reference.PID}})
 	var updateBSONDocument = bson.D{}
 	referenceBSONData, err := bson.Marshal(reference)
 	if err != nil {
@@ -314,13 +353,15 @@ func updateStudentCourseRef(reference *StudentCourseRef) error {
 	}
 	var updateOptions = bson.D{{"$set", updateBSONDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionStudentCourseRef).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionStudentCourseRef).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModReferenceMgmt, "Update student-course reference (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Update student-course reference (PID %s): matched %d modified %d",
 		reference.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
 		err = fmt.Errorf("[%s] - could not find student-course reference (PID %s)", serverErrorMessages[seResourceNotFound], reference.PID.Hex())
@@ -333,15 +374,15 @@ func updateStudentCourseRef(reference *StudentCourseRef) error {
 }
 
 // delete student-course reference, return #delete entries, error
-func deleteStudentCourseRef(studentPID primitive.ObjectID, coursePID primitive.ObjectID) (int, error) {
+func deleteStudentCourseRef(ctx context.Context, studentPID primitive.ObjectID, coursePID primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModReferenceMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
 		}
 	}()
 
-	studentCourseReferences, findErr := findStudentCourseRef(studentPID, coursePID)
+	studentCourseReferences, findErr := findStudentCourseRef(ctx, studentPID, coursePID)
 	if findErr != nil {
 		err = fmt.Errorf("[%s] - could not delete student-course reference DB entries due to query error", serverErrorMessages[seResourceNotFound])
 		return 0, err
@@ -349,23 +390,37 @@ func deleteStudentCourseRef(studentPID primitive.ObjectID, coursePID primitive.O
 
 	var deleteCnt int64
 	for i := range studentCourseReferences {
-		_, deleteRecordErr := deleteCourseRecordByStudentPIDAndCoursePID(studentCourseReferences[i].StudentPID, studentCourseReferences[i].CoursePID)
+		_, deleteRecordErr := deleteCourseRecordByStudentPIDAndCoursePID(ctx, studentCourseReferences[i].StudentPID, studentCourseReferences[i].CoursePID)
 		if deleteRecordErr != nil {
 			err = fmt.Errorf("[%s] - stop deleting course-record reference (student PID %s course PID %s) since course record could not be deleted: %s",
 				serverErrorMessages[seCloudOpsError], studentCourseReferences[i].StudentPID, studentCourseReferences[i].CoursePID, deleteRecordErr.Error())
 			return int(deleteCnt), err
 		}
+		_, deleteCreditErr := deleteLessonCredit(ctx, studentCourseReferences[i].StudentPID, studentCourseReferences[i].CoursePID)
+		if deleteCreditErr != nil {
+			err = fmt.Errorf("[%s] - stop deleting course-record reference (student PID %s course PID %s) since lesson credit ledger could not be deleted: %s",
+				serverErrorMessages[seDependencyIssue], studentCourseReferences[i].StudentPID, studentCourseReferences[i].CoursePID, deleteCreditErr.Error())
+			return int(deleteCnt), err
+		}
+		_, deleteLeaveErr := deleteLeaveRequest(ctx, studentCourseReferences[i].StudentPID, studentCourseReferences[i].CoursePID)
+		if deleteLeaveErr != nil {
+			err = fmt.Errorf("[%s] - stop deleting course-record reference (student PID %s course PID %s) since leave requests could not be deleted: %s",
+				serverErrorMessages[seDependencyIssue], studentCourseReferences[i].StudentPID, studentCourseReferences[i].CoursePID, deleteLeaveErr.Error())
+			return int(deleteCnt), err
+		}
 
 		deleteFilter := bson.D{{"_id", studentCourseReferences[i].PID}}
-		deleteResult, err := dbPool.Collection(DBCollectionStudentCourseRef).DeleteMany(context.TODO(), deleteFilter)
+		dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+		deleteResult, err := dbPool.Collection(DBCollectionStudentCourseRef).DeleteMany(dbCtx, deleteFilter)
+		dbCancel()
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return 0, err
 		}
 
 		deleteCnt += deleteResult.DeletedCount
 	}
 
-	logging.Debugmf(logModReferenceMgmt, "Deleted %d student-course references from DB", deleteCnt)
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Deleted %d student-course references from DB", deleteCnt)
 	return int(deleteCnt), nil
 }
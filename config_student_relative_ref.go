@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -10,9 +11,16 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// unique index admitting one main relative per student
+const studentRelativeRefMainIndex = "student_pid_main_unique"
+
+// errStudentRelativeRefMainExists a main reference is refused because the student already has a main relative
+var errStudentRelativeRefMainExists = errors.New("could not add more")
+
 var studentRelativeRefConfigHandlerTable = map[string]gin.HandlerFunc{
 	"get":    studentRelativeRefGetHandler,
 	"post":   studentRelativeRefPostHandler,
@@ -58,7 +66,7 @@ func studentRelativeRefGetHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	references, err = findStudentRelativeRef(studentPID, relativePID)
+	references, err = findStudentRelativeRef(ctx.Request.Context(), studentPID, relativePID)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -87,7 +95,7 @@ func studentRelativeRefPostHandler(ctx *gin.Context) {
 		return
 	}
 
-	referencePID, err = createStudentRelativeRef(&reference)
+	referencePID, err = createStudentRelativeRef(ctx.Request.Context(), &reference)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -115,7 +123,7 @@ func studentRelativeRefPutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateStudentRelativeRef(&reference)
+	err = updateStudentRelativeRef(ctx.Request.Context(), &reference)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -163,7 +171,7 @@ func studentRelativeRefDeleteHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteStudentRelativeRef(studentPID, relativePID)
+	deletedRows, err = deleteStudentRelativeRef(ctx.Request.Context(), studentPID, relativePID)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -173,12 +181,31 @@ func studentRelativeRefDeleteHandler(ctx *gin.Context) {
 	return
 }
 
+// studentRelativeRefInitPermission sets default permission (main relative always view and comment), return error if not valid
+func studentRelativeRefInitPermission(reference *StudentRelativeRef) error {
+	if reference.IsMain {
+		reference.Permission = RelativePermissionComment
+	} else if reference.Permission == "" {
+		reference.Permission = RelativePermissionView
+	}
+	if !relativePermissionMap[reference.Permission] {
+		return fmt.Errorf("[%s] - Relative permission must be %s or %s", serverErrorMessages[seInputParamNotValid],
+			RelativePermissionView, RelativePermissionComment)
+	}
+	return nil
+}
+
+// studentRelativeRefCanComment checks if referenced relative is allowed to comment on student course records
+func studentRelativeRefCanComment(reference *StudentRelativeRef) bool {
+	return reference.IsMain || reference.Permission == RelativePermissionComment
+}
+
 // find student-relative references, return references slice, error
-func findStudentRelativeRef(studentPID primitive.ObjectID, relativePID primitive.ObjectID) ([]*StudentRelativeRef, error) {
+func findStudentRelativeRef(ctx context.Context, studentPID primitive.ObjectID, relativePID primitive.ObjectID) ([]*StudentRelativeRef, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModReferenceMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
 		}
 	}()
 
@@ -190,19 +217,22 @@ func findStudentRelativeRef(studentPID primitive.ObjectID, relativePID primitive
 	if !relativePID.IsZero() {
 		findFilter = append(findFilter, bson.E{"relative_pid", relativePID})
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionStudentRelativeRef).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionStudentRelativeRef).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	references := []*StudentRelativeRef{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var reference StudentRelativeRef
 		err = findCursor.Decode(&reference)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		references = append(references, &reference)
@@ -210,21 +240,21 @@ func findStudentRelativeRef(studentPID primitive.ObjectID, relativePID primitive
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModReferenceMgmt, "Found %d student-relative reference results from DB (studentPID=%v, relativePID=%v)",
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Found %d student-relative reference results from DB (studentPID=%v, relativePID=%v)",
 		len(references), studentPID.Hex(), relativePID.Hex())
 	return references, nil
 }
 
 // create student-relative reference, return PID, error
-func createStudentRelativeRef(reference *StudentRelativeRef) (primitive.ObjectID, error) {
+func createStudentRelativeRef(ctx context.Context, reference *StudentRelativeRef) (primitive.ObjectID, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModReferenceMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
 		}
 	}()
 
@@ -233,7 +263,7 @@ func createStudentRelativeRef(reference *StudentRelativeRef) (primitive.ObjectID
 		err = fmt.Errorf("[%s] - No student PID specified", serverErrorMessages[seResourceNotFound])
 		return primitive.NilObjectID, err
 	}
-	students, err := findStudent(reference.StudentPID)
+	students, err := findStudent(ctx, reference.StudentPID)
 	if err != nil || len(students) == 0 {
 		err = fmt.Errorf("[%s] - No students found with PID %s", serverErrorMessages[seResourceNotFound], reference.StudentPID.Hex())
 		return primitive.NilObjectID, err
@@ -244,14 +274,15 @@ func createStudentRelativeRef(reference *StudentRelativeRef) (primitive.ObjectID
 		err = fmt.Errorf("[%s] - No relative PID specified", serverErrorMessages[seResourceNotFound])
 		return primitive.NilObjectID, err
 	}
-	relatives, err := findRelative(reference.RelativePID)
+	// relatives are bound across institutes (not visible to an institute before binding)
+	relatives, err := findRelative(tenantUnscopedContext(ctx), reference.RelativePID)
 	if err != nil || len(relatives) == 0 {
 		err = fmt.Errorf("[%s] - No relatives found with PID %s", serverErrorMessages[seResourceNotFound], reference.RelativePID.Hex())
 		return primitive.NilObjectID, err
 	}
 
 	// only one relative must be main relationship
-	studentReferences, err := findStudentRelativeRef(reference.StudentPID, primitive.NilObjectID)
+	studentReferences, err := findStudentRelativeRef(ctx, reference.StudentPID, primitive.NilObjectID)
 	var mainReference *StudentRelativeRef = nil
 	if err == nil && len(studentReferences) > 0 {
 		for i := 0; i < len(studentReferences); i++ {
@@ -262,8 +293,8 @@ func createStudentRelativeRef(reference *StudentRelativeRef) (primitive.ObjectID
 		}
 	}
 	if mainReference != nil && reference.IsMain {
-		err = fmt.Errorf("[%s] - Student (PID %v) already has a main relative (PID %v) -> could not add more", serverErrorMessages[seResourceConflict],
-			mainReference.StudentPID.Hex(), mainReference.RelativePID.Hex())
+		err = fmt.Errorf("[%s] - Student (PID %v) already has a main relative (PID %v) -> %w", serverErrorMessages[seResourceConflict],
+			mainReference.StudentPID.Hex(), mainReference.RelativePID.Hex(), errStudentRelativeRefMainExists)
 		return primitive.NilObjectID, err
 	}
 
@@ -273,24 +304,46 @@ func createStudentRelativeRef(reference *StudentRelativeRef) (primitive.ObjectID
 		return primitive.NilObjectID, err
 	}
 
-	insertResult, err := dbPool.Collection(DBCollectionStudentRelativeRef).InsertOne(context.TODO(), reference)
+	// permission check
+	if err = studentRelativeRefInitPermission(reference); err != nil {
+		return primitive.NilObjectID, err
+	}
+	reference.InstitutePID = students[0].InstitutePID
+
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionStudentRelativeRef).InsertOne(dbCtx, reference)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		if dbDuplicateKeyIndex(err) == studentRelativeRefMainIndex {
+			// another request created the main reference after the check above
+			err = fmt.Errorf("[%s] - Student (PID %v) already has a main relative -> %w", serverErrorMessages[seResourceConflict],
+				reference.StudentPID.Hex(), errStudentRelativeRefMainExists)
+			return primitive.NilObjectID, err
+		}
+		if dbIsDuplicateKeyError(err) {
+			// another request created the same reference after the check above
+			err = fmt.Errorf("[%s] - Student (PID %v) already has a main relative or this relative (PID %v) -> %s", serverErrorMessages[seResourceConflict],
+				reference.StudentPID.Hex(), reference.RelativePID.Hex(), err.Error())
+			return primitive.NilObjectID, err
+		}
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return primitive.NilObjectID, err
 	}
 
 	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModReferenceMgmt, "Created student-relative reference in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Created student-relative reference in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
 
+	// relative becomes visible to the student's institute (failure is logged, reference stays)
+	updateRelativeInstitutes(ctx, []primitive.ObjectID{reference.RelativePID})
 	return lastInsertID, nil
 }
 
 // update student-relative reference, return error
-func updateStudentRelativeRef(reference *StudentRelativeRef) error {
+func updateStudentRelativeRef(ctx context.Context, reference *StudentRelativeRef) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModReferenceMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
 		}
 	}()
 
@@ -304,7 +357,7 @@ func updateStudentRelativeRef(reference *StudentRelativeRef) error {
 		err = fmt.Errorf("[%s] - No student PID specified", serverErrorMessages[seResourceNotFound])
 		return err
 	}
-	students, err := findStudent(reference.StudentPID)
+	students, err := findStudent(ctx, reference.StudentPID)
 	if err != nil || len(students) == 0 {
 		err = fmt.Errorf("[%s] - No students found with PID %s", serverErrorMessages[seResourceNotFound], reference.StudentPID.Hex())
 		return err
@@ -315,14 +368,15 @@ func updateStudentRelativeRef(reference *StudentRelativeRef) error {
 		err = fmt.Errorf("[%s] - No relative PID specified", serverErrorMessages[seResourceNotFound])
 		return err
 	}
-	relatives, err := findRelative(reference.RelativePID)
+	// relatives are bound across institutes (not visible to an institute before binding)
+	relatives, err := findRelative(tenantUnscopedContext(ctx), reference.RelativePID)
 	if err != nil || len(relatives) == 0 {
 		err = fmt.Errorf("[%s] - No relatives found with PID %s", serverErrorMessages[seResourceNotFound], reference.RelativePID.Hex())
 		return err
 	}
 
 	// only one relative can be main relationship
-	studentReferences, err := findStudentRelativeRef(reference.StudentPID, primitive.NilObjectID)
+	studentReferences, err := findStudentRelativeRef(ctx, reference.StudentPID, primitive.NilObjectID)
 	var mainReference *StudentRelativeRef = nil
 	if err == nil && len(studentReferences) > 0 {
 		for i := 0; i < len(studentReferences); i++ {
@@ -332,20 +386,36 @@ func updateStudentRelativeRef(reference *StudentRelativeRef) error {
 			}
 		}
 	}
-	if mainReference != nil && reference.IsMain {
-		err = fmt.Errorf("[%s] - Student (PID %v) already has a main relative (PID %v) -> could not add more", serverErrorMessages[seResourceConflict],
-			mainReference.StudentPID.Hex(), mainReference.RelativePID.Hex())
+	if mainReference != nil && mainReference.PID != reference.PID && reference.IsMain {
+		err = fmt.Errorf("[%s] - Student (PID %v) already has a main relative (PID %v) -> %w", serverErrorMessages[seResourceConflict],
+			mainReference.StudentPID.Hex(), mainReference.RelativePID.Hex(), errStudentRelativeRefMainExists)
 		return err
 	}
 
-	if mainReference == nil && !reference.IsMain {
+	if (mainReference == nil || mainReference.PID == reference.PID) && !reference.IsMain {
 		err = fmt.Errorf("[%s] - Student (PID %v) already has no main relative -> required at least one", serverErrorMessages[seResourceConflict],
 			reference.StudentPID.Hex())
 		return err
 	}
 
-	// update student
-	var updateFilter = bson.D{{"_id", reference.PID}}
+	// permission check
+	if err = studentRelativeRefInitPermission(reference); err != nil {
+		return err
+	}
+	reference.InstitutePID = students[0].InstitutePID
+
+	// previous relative of reference (institutes of both relatives follow the update)
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", reference.PID}})
+	var previous StudentRelativeRef
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	err = dbPool.Collection(DBCollectionStudentRelativeRef).FindOne(dbCtx, updateFilter).Decode(&previous)
+	if err != nil {
+		err = fmt.Errorf("[%s] - could not find student-relative reference (PID %s): %s", serverErrorMessages[seResourceNotFound], reference.PID.Hex(), err.Error())
+		return err
+	}
+
+	// update reference
 	var updateBSONDocument = bson.D{}
 	referenceBSONData, err := bson.Marshal(reference)
 	if err != nil {
@@ -359,13 +429,18 @@ func updateStudentRelativeRef(reference *StudentRelativeRef) error {
 	}
 	var updateOptions = bson.D{{"$set", updateBSONDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionStudentRelativeRef).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	insertResult, err := dbPool.Collection(DBCollectionStudentRelativeRef).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		if dbIsDuplicateKeyError(err) {
+			err = fmt.Errorf("[%s] - Student (PID %v) already has a main relative or this relative (PID %v) -> %s", serverErrorMessages[seResourceConflict],
+				reference.StudentPID.Hex(), reference.RelativePID.Hex(), err.Error())
+			return err
+		}
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModReferenceMgmt, "Update student-relative reference (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Update student-relative reference (PID %s): matched %d modified %d",
 		reference.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
 		err = fmt.Errorf("[%s] - could not find student-relative reference (PID %s)", serverErrorMessages[seResourceNotFound], reference.PID.Hex())
@@ -374,15 +449,16 @@ func updateStudentRelativeRef(reference *StudentRelativeRef) error {
 		err = fmt.Errorf("[%s] - student-relative reference (PID %s) not changed", serverErrorMessages[seResourceNotChange], reference.PID.Hex())
 		return err
 	}
+	updateRelativeInstitutes(ctx, []primitive.ObjectID{previous.RelativePID, reference.RelativePID})
 	return nil
 }
 
 // delete student-relative reference, return #delete entries, error
-func deleteStudentRelativeRef(studentPID primitive.ObjectID, relativePID primitive.ObjectID) (int, error) {
+func deleteStudentRelativeRef(ctx context.Context, studentPID primitive.ObjectID, relativePID primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModReferenceMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
 		}
 	}()
 
@@ -393,13 +469,88 @@ func deleteStudentRelativeRef(studentPID primitive.ObjectID, relativePID primiti
 	if !relativePID.IsZero() {
 		deleteFilter = append(deleteFilter, bson.E{"relative_pid", relativePID})
 	}
+	deleteFilter = dbTenantFilter(ctx, deleteFilter)
+
+	// relatives of deleted references (their institutes follow the remaining references)
+	references, err := findStudentRelativeRef(ctx, studentPID, relativePID)
+	if err != nil {
+		return 0, err
+	}
+	var relativePIDs = []primitive.ObjectID{}
+	for i := range references {
+		relativePIDs = append(relativePIDs, references[i].RelativePID)
+	}
 
-	deleteResult, err := dbPool.Collection(DBCollectionStudentRelativeRef).DeleteMany(context.TODO(), deleteFilter)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	deleteResult, err := dbPool.Collection(DBCollectionStudentRelativeRef).DeleteMany(dbCtx, deleteFilter)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return 0, err
 	}
 
-	logging.Debugmf(logModReferenceMgmt, "Deleted %d student-relative references from DB", deleteResult.DeletedCount)
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Deleted %d student-relative references from DB", deleteResult.DeletedCount)
+	updateRelativeInstitutes(ctx, relativePIDs)
 	return int(deleteResult.DeletedCount), nil
 }
+
+// transfer main relative status of a student from one bound relative to another, return error
+// demote and promote are conditional updates in one transaction, so concurrent transfers/bindings cannot produce two main relatives
+// and a failed transfer keeps the current main relative
+func transferMainStudentRelativeRef(ctx context.Context, studentPID primitive.ObjectID, fromRelativePID primitive.ObjectID, toRelativePID primitive.ObjectID) error {
+	var err error
+	defer func() {
+		if err != nil {
+			loggingWithContext(ctx).Errormf(logModReferenceMgmt, err.Error())
+		}
+	}()
+
+	if fromRelativePID == toRelativePID {
+		err = fmt.Errorf("[%s] - Relative (PID %s) is already main relative of student (PID %s)", serverErrorMessages[seResourceNotChange],
+			toRelativePID.Hex(), studentPID.Hex())
+		return err
+	}
+
+	// demote current main relative (keeps reference with view and comment permission) and promote secondary relative
+	// in one transaction, so a failed promotion leaves the current main relative untouched
+	session, err := dbPool.Client().StartSession()
+	if err != nil {
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		return err
+	}
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	defer session.EndSession(dbCtx)
+
+	_, err = session.WithTransaction(dbCtx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var demoteFilter = bson.D{{"student_pid", studentPID}, {"relative_pid", fromRelativePID}, {"is_main", true}}
+		var demoteOptions = bson.D{{"$set", bson.D{{"is_main", false}, {"permission", RelativePermissionComment}}}}
+		demoteResult, err := dbPool.Collection(DBCollectionStudentRelativeRef).UpdateOne(sessCtx, demoteFilter, demoteOptions)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		}
+		if demoteResult.MatchedCount == 0 {
+			return nil, fmt.Errorf("[%s] - Relative (PID %s) is not main relative of student (PID %s)", serverErrorMessages[seResourceConflict],
+				fromRelativePID.Hex(), studentPID.Hex())
+		}
+
+		var promoteFilter = bson.D{{"student_pid", studentPID}, {"relative_pid", toRelativePID}, {"is_main", false}}
+		var promoteOptions = bson.D{{"$set", bson.D{{"is_main", true}, {"permission", RelativePermissionComment}}}}
+		promoteResult, err := dbPool.Collection(DBCollectionStudentRelativeRef).UpdateOne(sessCtx, promoteFilter, promoteOptions)
+		if err != nil {
+			return nil, fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
+		}
+		if promoteResult.MatchedCount == 0 {
+			return nil, fmt.Errorf("[%s] - Relative (PID %s) is not bound to student (PID %s) as secondary relative", serverErrorMessages[seResourceNotFound],
+				toRelativePID.Hex(), studentPID.Hex())
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	loggingWithContext(ctx).Debugmf(logModReferenceMgmt, "Transferred main relative of student (PID %s) from relative (PID %s) to relative (PID %s)",
+		studentPID.Hex(), fromRelativePID.Hex(), toRelativePID.Hex())
+	return nil
+}
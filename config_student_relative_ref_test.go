@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// concurrent main references of one student -> partial unique index admits exactly one
+func TestStudentRelativeRefMainRace(t *testing.T) {
+	testDBSetup(t)
+	student, relatives := testStudentRelatives(t, testRaceRelatives)
+
+	for round := 0; round < testRaceRounds; round++ {
+		testUnbindStudent(t, student.PID)
+		var successCount int
+		var successLock sync.Mutex
+		var jobs []func()
+		for _, relative := range relatives {
+			var reference = StudentRelativeRef{
+				StudentPID:   student.PID,
+				RelativePID:  relative.PID,
+				Relationship: "Father",
+				IsMain:       true,
+			}
+			jobs = append(jobs, func() {
+				if _, err := createStudentRelativeRef(context.Background(), &reference); err == nil {
+					successLock.Lock()
+					successCount++
+					successLock.Unlock()
+				}
+			})
+		}
+		testParallel(t, jobs, testRaceTimeout)
+		if successCount != 1 {
+			t.Errorf("round %d: %d main references created", round, successCount)
+		}
+		testBindingInvariants(t, round, student.PID, false)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -44,7 +45,7 @@ func teacherGetHandler(ctx *gin.Context) {
 	}
 
 	// pid: nil objectid for all, others for specified one
-	teachers, err = findTeacher(pid)
+	teachers, err = findTeacher(ctx.Request.Context(), pid)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -73,7 +74,7 @@ func teacherPostHandler(ctx *gin.Context) {
 		return
 	}
 
-	teacherPID, err = createTeacher(&teacher)
+	teacherPID, err = createTeacher(ctx.Request.Context(), &teacher)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -101,7 +102,7 @@ func teacherPutHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = updateTeacher(&teacher)
+	err = updateTeacher(ctx.Request.Context(), &teacher)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -134,8 +135,19 @@ func teacherDeleteHandler(ctx *gin.Context) {
 		}
 	}
 
+	// optional teacher taking over active course staff entries (reassign_pid=?)
+	var reassignPID = primitive.NilObjectID
+	if reassign := ctx.Request.URL.Query().Get("reassign_pid"); reassign != "" {
+		reassignPID, err = primitive.ObjectIDFromHex(reassign)
+		if err != nil || pid.IsZero() {
+			response.Status = http.StatusBadRequest
+			response.Message = fmt.Sprintf("[%s] - Please specifiy a valid teacher PID to reassign courses to (reassign_pid=?)", serverErrorMessages[seInputParamNotValid])
+			return
+		}
+	}
+
 	// pid: nil objectid for all, others for specified one
-	deletedRows, err = deleteTeacher(pid)
+	deletedRows, err = deleteTeacher(ctx.Request.Context(), pid, reassignPID)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
@@ -146,11 +158,11 @@ func teacherDeleteHandler(ctx *gin.Context) {
 }
 
 // find teacher, return teacher slice, error
-func findTeacher(pid primitive.ObjectID) ([]*Teacher, error) {
+func findTeacher(ctx context.Context, pid primitive.ObjectID) ([]*Teacher, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModTeacherMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModTeacherMgmt, err.Error())
 		}
 	}()
 
@@ -162,19 +174,22 @@ func findTeacher(pid primitive.ObjectID) ([]*Teacher, error) {
 		findOptions.SetLimit(1)
 		findFilter = bson.D{{"_id", pid}}
 	}
+	findFilter = dbTenantFilter(ctx, findFilter)
 
-	findCursor, err := dbPool.Collection(DBCollectionTeacher).Find(context.TODO(), findFilter, findOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	findCursor, err := dbPool.Collection(DBCollectionTeacher).Find(dbCtx, findFilter, findOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
 	teachers := []*Teacher{}
-	for findCursor.Next(context.TODO()) {
+	for findCursor.Next(dbCtx) {
 		var teacher Teacher
 		err = findCursor.Decode(&teacher)
 		if err != nil {
-			err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+			err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 			return nil, err
 		}
 		teachers = append(teachers, &teacher)
@@ -182,41 +197,43 @@ func findTeacher(pid primitive.ObjectID) ([]*Teacher, error) {
 
 	err = findCursor.Err()
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModTeacherMgmt, "Found %d teacher results from DB (PID=%v)", len(teachers), pid.Hex())
+	loggingWithContext(ctx).Debugmf(logModTeacherMgmt, "Found %d teacher results from DB (PID=%v)", len(teachers), pid.Hex())
 	return teachers, nil
 }
 
 // find teacher by teacherUID
-func findTeacherByUID(teacherUID string) (*Teacher, error) {
+func findTeacherByUID(ctx context.Context, teacherUID string) (*Teacher, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModTeacherMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModTeacherMgmt, err.Error())
 		}
 	}()
 
 	var teacher Teacher
-	findFilter := bson.D{{"teacher_uid", teacherUID}}
-	err = dbPool.Collection(DBCollectionTeacher).FindOne(context.TODO(), findFilter).Decode(&teacher)
+	findFilter := dbTenantFilter(ctx, bson.D{{"teacher_uid", teacherUID}})
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	err = dbPool.Collection(DBCollectionTeacher).FindOne(dbCtx, findFilter).Decode(&teacher)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return nil, err
 	}
 
-	logging.Debugmf(logModTeacherMgmt, "Found teacher from DB (teacherUID=%s)", teacherUID)
+	loggingWithContext(ctx).Debugmf(logModTeacherMgmt, "Found teacher from DB (teacherUID=%s)", teacherUID)
 	return &teacher, nil
 }
 
 // create teacher, return PID, error
-func createTeacher(teacher *Teacher) (primitive.ObjectID, error) {
+func createTeacher(ctx context.Context, teacher *Teacher) (primitive.ObjectID, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModTeacherMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModTeacherMgmt, err.Error())
 		}
 	}()
 
@@ -225,29 +242,35 @@ func createTeacher(teacher *Teacher) (primitive.ObjectID, error) {
 		err = fmt.Errorf("[%s] - No institute PID specified", serverErrorMessages[seResourceNotFound])
 		return primitive.NilObjectID, err
 	}
-	institutes, err := findInstitute(teacher.InstitutePID)
+	err = tenantCheck(ctx, teacher.InstitutePID)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	institutes, err := findInstitute(ctx, teacher.InstitutePID)
 	if err != nil || len(institutes) == 0 {
 		err = fmt.Errorf("[%s] - No institutes found with PID %s", serverErrorMessages[seResourceNotFound], teacher.InstitutePID.Hex())
 		return primitive.NilObjectID, err
 	}
 
-	insertResult, err := dbPool.Collection(DBCollectionTeacher).InsertOne(context.TODO(), teacher)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionTeacher).InsertOne(dbCtx, teacher)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return primitive.NilObjectID, err
 	}
 
 	lastInsertID := insertResult.InsertedID.(primitive.ObjectID)
-	logging.Debugmf(logModTeacherMgmt, "Created teacher in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
+	loggingWithContext(ctx).Debugmf(logModTeacherMgmt, "Created teacher in DB (LastInsertID,PID=%s)", lastInsertID.Hex())
 	return lastInsertID, nil
 }
 
 // update teacher, return error
-func updateTeacher(teacher *Teacher) error {
+func updateTeacher(ctx context.Context, teacher *Teacher) error {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModTeacherMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModTeacherMgmt, err.Error())
 		}
 	}()
 
@@ -262,13 +285,17 @@ func updateTeacher(teacher *Teacher) error {
 		err = fmt.Errorf("[%s] - No institute PID specified", serverErrorMessages[seResourceNotFound])
 		return err
 	}
-	institutes, err := findInstitute(teacher.InstitutePID)
+	err = tenantCheck(ctx, teacher.InstitutePID)
+	if err != nil {
+		return err
+	}
+	institutes, err := findInstitute(ctx, teacher.InstitutePID)
 	if err != nil || len(institutes) == 0 {
 		err = fmt.Errorf("[%s] - No institutes found with PID %s", serverErrorMessages[seResourceNotFound], teacher.InstitutePID.Hex())
 		return err
 	}
 
-	var updateFilter = bson.D{{"_id", teacher.PID}}
+	var updateFilter = dbTenantFilter(ctx, bson.D{{"_id", teacher.PID}})
 	var updateBSONDocument = bson.D{}
 	teacherBSONData, err := bson.Marshal(teacher)
 	if err != nil {
@@ -282,13 +309,15 @@ func updateTeacher(teacher *Teacher) error {
 	}
 	var updateOptions = bson.D{{"$set", updateBSONDocument}}
 
-	insertResult, err := dbPool.Collection(DBCollectionTeacher).UpdateOne(context.TODO(), updateFilter, updateOptions)
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpWrite)
+	defer dbCancel()
+	insertResult, err := dbPool.Collection(DBCollectionTeacher).UpdateOne(dbCtx, updateFilter, updateOptions)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return err
 	}
 
-	logging.Debugmf(logModTeacherMgmt, "Update teacher (PID %s): matched %d modified %d",
+	loggingWithContext(ctx).Debugmf(logModTeacherMgmt, "Update teacher (PID %s): matched %d modified %d",
 		teacher.PID.Hex(), insertResult.MatchedCount, insertResult.ModifiedCount)
 	if insertResult.MatchedCount == 0 {
 		err = fmt.Errorf("[%s] - could not find teacher (PID %s)", serverErrorMessages[seResourceNotFound], teacher.PID.Hex())
@@ -300,12 +329,12 @@ func updateTeacher(teacher *Teacher) error {
 	return nil
 }
 
-// delete teacher, return #delete entries, error
-func deleteTeacher(pid primitive.ObjectID) (int, error) {
+// delete teacher (active course staff entries handed over to reassign PID if given), return #delete entries, error
+func deleteTeacher(ctx context.Context, pid primitive.ObjectID, reassignPID primitive.ObjectID) (int, error) {
 	var err error
 	defer func() {
 		if err != nil {
-			logging.Errormf(logModTeacherMgmt, err.Error())
+			loggingWithContext(ctx).Errormf(logModTeacherMgmt, err.Error())
 		}
 	}()
 
@@ -317,26 +346,52 @@ func deleteTeacher(pid primitive.ObjectID) (int, error) {
 		teacherFindFilter = append(teacherFindFilter, bson.E{"teacher_pid", pid})
 		assistantFindFilter = append(assistantFindFilter, bson.E{"assistant_pid", pid})
 	}
+	deleteFilter = dbTenantFilter(ctx, deleteFilter)
+	teacherFindFilter = dbTenantFilter(ctx, teacherFindFilter)
+	assistantFindFilter = dbTenantFilter(ctx, assistantFindFilter)
+
+	if !reassignPID.IsZero() {
+		_, err = reassignCourseStaff(ctx, pid, reassignPID)
+		if err != nil {
+			return 0, err
+		}
+	}
 
-	// check course dependency
+	// check course dependency (current teacher/assistant, active or upcoming staff entries)
 	var course Course
-	if dbPool.Collection(DBCollectionCourse).FindOne(context.TODO(), teacherFindFilter).Decode(&course) == nil {
+	dbCtx, dbCancel := dbContextWithTimeout(ctx, dbOpRead)
+	defer dbCancel()
+	if dbPool.Collection(DBCollectionCourse).FindOne(dbCtx, teacherFindFilter).Decode(&course) == nil {
 		err = fmt.Errorf("[%s] - teacher-course dependency unresolved (e.g. teacher PID %s course PID %s)",
 			serverErrorMessages[seDependencyIssue], course.TeacherPID.Hex(), course.PID.Hex())
 		return 0, err
 	}
-	if dbPool.Collection(DBCollectionCourse).FindOne(context.TODO(), assistantFindFilter).Decode(&course) == nil {
+	if dbPool.Collection(DBCollectionCourse).FindOne(dbCtx, assistantFindFilter).Decode(&course) == nil {
 		err = fmt.Errorf("[%s] - assistant-course dependency unresolved (e.g. assistant PID %s course PID %s)",
 			serverErrorMessages[seDependencyIssue], course.AssistantPID.Hex(), course.PID.Hex())
 		return 0, err
 	}
+	if !pid.IsZero() {
+		var courses []*Course
+		courses, err = findCourseByStaffPID(ctx, pid)
+		if err != nil {
+			return 0, err
+		}
+		for _, staffCourse := range courses {
+			if courseStaffActive(staffCourse, pid, time.Now().Unix()) {
+				err = fmt.Errorf("[%s] - teacher (PID %s) is on active staff of course (PID %s) -> specify reassign_pid to hand over",
+					serverErrorMessages[seDependencyIssue], pid.Hex(), staffCourse.PID.Hex())
+				return 0, err
+			}
+		}
+	}
 
-	deleteResult, err := dbPool.Collection(DBCollectionTeacher).DeleteMany(context.TODO(), deleteFilter)
+	deleteResult, err := dbPool.Collection(DBCollectionTeacher).DeleteMany(dbCtx, deleteFilter)
 	if err != nil {
-		err = fmt.Errorf("[%s] - %s", serverErrorMessages[seDBResourceQuery], err.Error())
+		err = fmt.Errorf("[%s] - %s", serverErrorMessages[dbErrorCode(err)], err.Error())
 		return 0, err
 	}
 
-	logging.Debugmf(logModTeacherMgmt, "Deleted %d teacher results from DB", deleteResult.DeletedCount)
+	loggingWithContext(ctx).Debugmf(logModTeacherMgmt, "Deleted %d teacher results from DB", deleteResult.DeletedCount)
 	return int(deleteResult.DeletedCount), nil
 }
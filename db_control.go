@@ -2,24 +2,39 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	DBCollectionInstitute          = "institute"
-	DBCollectionTeacher            = "teacher"
-	DBCollectionCourse             = "course"
-	DBCollectionCourseRecord       = "course_record"
-	DBCollectionCourseComment      = "course_comment"
-	DBCollectionRelative           = "relative"
-	DBCollectionStudent            = "student"
-	DBCollectionCloudMedia         = "cloudmedia"
-	DBCollectionStudentRelativeRef = "student_relative_ref"
-	DBCollectionStudentCourseRef   = "student_course_ref"
+	DBCollectionInstitute            = "institute"
+	DBCollectionTeacher              = "teacher"
+	DBCollectionCourse               = "course"
+	DBCollectionCourseRecord         = "course_record"
+	DBCollectionCourseComment        = "course_comment"
+	DBCollectionRelative             = "relative"
+	DBCollectionStudent              = "student"
+	DBCollectionCloudMedia           = "cloudmedia"
+	DBCollectionStudentRelativeRef   = "student_relative_ref"
+	DBCollectionStudentCourseRef     = "student_course_ref"
+	DBCollectionRelativeInvite       = "relative_invite"
+	DBCollectionMainRelativeTransfer = "main_relative_transfer"
+	DBCollectionBindingCode          = "binding_code"
+	DBCollectionBindingAttempt       = "binding_attempt"
+	DBCollectionClassSession         = "class_session"
+	DBCollectionCourseSchedule       = "course_schedule"
+	DBCollectionLessonCredit         = "lesson_credit"
+	DBCollectionLessonCreditAlert    = "lesson_credit_alert"
+	DBCollectionLeaveRequest         = "leave_request"
+	DBCollectionCurriculumVersion    = "curriculum_version"
 )
 
 var dbPool *mongo.Database
@@ -28,6 +43,7 @@ func dbPoolInit(sc *ServerConfig) (*mongo.Database, error) {
 	dbURL := fmt.Sprintf("mongodb://%s:%s@%s/%s", sc.DBUsername, sc.DBPassword, sc.DBHostAddress, sc.DBName)
 	dbClientOptions := options.Client().ApplyURI(dbURL)
 	dbClientOptions.SetConnectTimeout(5 * time.Second)
+	dbClientOptions.SetMonitor(dbCommandMonitor())
 
 	// Connect to MongoDB
 	dbClient, connErr := mongo.Connect(context.TODO(), dbClientOptions)
@@ -42,5 +58,209 @@ func dbPoolInit(sc *ServerConfig) (*mongo.Database, error) {
 	}
 
 	database := dbClient.Database(sc.DBName)
+
+	// enforce invariants that must hold across concurrent requests
+	indexErr := dbEnsureIndexes(context.TODO(), database, sc)
+	if indexErr != nil {
+		return nil, indexErr
+	}
 	return database, nil
 }
+
+// DB operation classes (each class has its own configurable timeout)
+const (
+	dbOpRead = iota
+	dbOpWrite
+)
+
+// dbContextWithTimeout derives a DB operation context from request context
+func dbContextWithTimeout(ctx context.Context, opClass int) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := serverConfig.DBReadTimeout
+	if opClass == dbOpWrite {
+		timeout = serverConfig.DBWriteTimeout
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+}
+
+// dbErrorCode maps DB errors to server error code (DB_TIMEOUT for deadline exceeded)
+func dbErrorCode(err error) int {
+	if err == nil {
+		return seNoError
+	}
+	if errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		return seDBTimeout
+	}
+	return seDBResourceQuery
+}
+
+// dbTenantFilter restricts a filter to documents of caller's institute (unchanged for unscoped calls)
+func dbTenantFilter(ctx context.Context, filter bson.D) bson.D {
+	institutePID := tenantFromContext(ctx)
+	if institutePID.IsZero() {
+		return filter
+	}
+	return bson.D{{"$and", bson.A{filter, bson.D{{"institute_pid", institutePID}}}}}
+}
+
+// dbDuplicateKeyErrorCode is the mongo server error code for unique index violation
+const dbDuplicateKeyErrorCode = 11000
+
+// dbDuplicateKeyIndexPattern finds index name in a duplicate key write error ("... index: <name> dup key: ...")
+var dbDuplicateKeyIndexPattern = regexp.MustCompile(`index: (\S+) dup key`)
+
+// dbDuplicateKeyIndex returns name of the unique index violated by a write, "" if it is no duplicate key error
+func dbDuplicateKeyIndex(err error) string {
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) {
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == dbDuplicateKeyErrorCode {
+				if match := dbDuplicateKeyIndexPattern.FindStringSubmatch(writeError.Message); match != nil {
+					return match[1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// dbIsDuplicateKeyError checks if a DB error is caused by unique index violation
+func dbIsDuplicateKeyError(err error) bool {
+	var writeException mongo.WriteException
+	if errors.As(err, &writeException) {
+		for _, writeError := range writeException.WriteErrors {
+			if writeError.Code == dbDuplicateKeyErrorCode {
+				return true
+			}
+		}
+	}
+	var commandError mongo.CommandError
+	if errors.As(err, &commandError) {
+		return commandError.Code == dbDuplicateKeyErrorCode
+	}
+	return false
+}
+
+// dbEnsureIndexes creates indexes that enforce cross-request invariants and data expiry (same as db_mgmt/create_db.js)
+func dbEnsureIndexes(ctx context.Context, database *mongo.Database, sc *ServerConfig) error {
+	// at most one main relative per student and one reference per student-relative pair
+	err := dbEnsureUniqueIndex(ctx, database.Collection(DBCollectionStudentRelativeRef), bson.D{{"student_pid", 1}, {"relative_pid", 1}}, "", nil)
+	if err != nil {
+		return err
+	}
+	err = dbEnsureUniqueIndex(ctx, database.Collection(DBCollectionStudentRelativeRef), bson.D{{"student_pid", 1}}, studentRelativeRefMainIndex, bson.D{{"is_main", true}})
+	if err != nil {
+		return err
+	}
+
+	// invite code must identify a single invite
+	err = dbEnsureUniqueIndex(ctx, database.Collection(DBCollectionRelativeInvite), bson.D{{"invite_code", 1}}, "", nil)
+	if err != nil {
+		return err
+	}
+
+	// a curriculum version of a course is kept once
+	err = dbEnsureUniqueIndex(ctx, database.Collection(DBCollectionCurriculumVersion), bson.D{{"course_pid", 1}, {"version", 1}}, "", nil)
+	if err != nil {
+		return err
+	}
+
+	// active binding code must identify a single student, and a student has at most one active code
+	var activeFilter = bson.D{{"status", BindingCodeStatusActive}}
+	err = dbEnsureUniqueIndex(ctx, database.Collection(DBCollectionBindingCode), bson.D{{"binding_code", 1}}, bindingCodeActiveIndex, activeFilter)
+	if err != nil {
+		return err
+	}
+	err = dbEnsureUniqueIndex(ctx, database.Collection(DBCollectionBindingCode), bson.D{{"student_pid", 1}}, bindingCodeStudentIndex, activeFilter)
+	if err != nil {
+		return err
+	}
+
+	// TTL indexes: used binding codes kept as history, failed binding attempts kept for attempt window
+	err = dbEnsureTTLIndex(ctx, database.Collection(DBCollectionBindingCode), "expire_at", int32(sc.BindingCodeHistoryDays*24*3600))
+	if err != nil {
+		return err
+	}
+	err = dbEnsureTTLIndex(ctx, database.Collection(DBCollectionBindingAttempt), "attempt_at", int32(sc.BindingAttemptWindow*60))
+	if err != nil {
+		return err
+	}
+	_, err = database.Collection(DBCollectionBindingAttempt).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"relative_wxid", 1}, {"attempt_at", 1}}},
+		{Keys: bson.D{{"binding_code", 1}, {"attempt_at", 1}}},
+		{Keys: bson.D{{"client_ip", 1}, {"attempt_at", 1}}},
+	})
+	return err
+}
+
+// dbEnsureUniqueIndex creates unique (partial if filter given) index, if existing documents violate it the index is skipped
+// and the duplicates are logged so that server still starts (remove them with db_mgmt/dedup_unique_indexes.js and restart)
+func dbEnsureUniqueIndex(ctx context.Context, collection *mongo.Collection, keys bson.D, name string, partialFilter bson.D) error {
+	indexOptions := options.Index().SetUnique(true)
+	if name != "" {
+		indexOptions.SetName(name)
+	}
+	if partialFilter != nil {
+		indexOptions.SetPartialFilterExpression(partialFilter)
+	}
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: indexOptions})
+	if err == nil || !dbIsDuplicateKeyError(err) {
+		return err
+	}
+
+	logging.Errormf(logModDBControl, "Unique index %v on %s is not created, existing documents violate it -> run db_mgmt/dedup_unique_indexes.js and restart: %s",
+		keys, collection.Name(), err.Error())
+	dbLogDuplicates(ctx, collection, keys, partialFilter)
+	return nil
+}
+
+// dbLogDuplicates logs PIDs of documents sharing the same keys (documents matching partial filter only)
+func dbLogDuplicates(ctx context.Context, collection *mongo.Collection, keys bson.D, partialFilter bson.D) {
+	var groupKeys = bson.D{}
+	for _, key := range keys {
+		groupKeys = append(groupKeys, bson.E{key.Key, "$" + key.Key})
+	}
+	if partialFilter == nil {
+		partialFilter = bson.D{}
+	}
+	cursor, err := collection.Aggregate(ctx, bson.A{
+		bson.D{{"$match", partialFilter}},
+		bson.D{{"$group", bson.D{{"_id", groupKeys}, {"pids", bson.D{{"$push", "$_id"}}}, {"count", bson.D{{"$sum", 1}}}}}},
+		bson.D{{"$match", bson.D{{"count", bson.D{{"$gt", 1}}}}}},
+	})
+	if err != nil {
+		logging.Errormf(logModDBControl, "Could not find duplicates in %s: %s", collection.Name(), err.Error())
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var duplicate struct {
+			Keys bson.M               `bson:"_id"`
+			PIDs []primitive.ObjectID `bson:"pids"`
+		}
+		if cursor.Decode(&duplicate) != nil {
+			continue
+		}
+		logging.Errormf(logModDBControl, "Duplicate %s documents %v share %v", collection.Name(), duplicate.PIDs, duplicate.Keys)
+	}
+}
+
+// dbIndexOptionsConflictCodes are mongo server error codes for an existing index with different options
+var dbIndexOptionsConflictCodes = map[int32]bool{85: true, 86: true}
+
+// dbEnsureTTLIndex creates TTL index, existing index with another expiry is kept (drop it to apply a new expiry)
+func dbEnsureTTLIndex(ctx context.Context, collection *mongo.Collection, field string, expireSeconds int32) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{field, 1}},
+		Options: options.Index().SetExpireAfterSeconds(expireSeconds),
+	})
+	var commandError mongo.CommandError
+	if errors.As(err, &commandError) && dbIndexOptionsConflictCodes[commandError.Code] {
+		logging.Warnmf(logModDBControl, "TTL index on %s.%s exists with different expiry -> keep existing index: %s", collection.Name(), field, err.Error())
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// test DB name (host and credentials from server config and its env overrides), DB tests are skipped without it
+const testDBNameEnv = "KLOG_TEST_DB_NAME"
+
+var testDBOnce sync.Once
+var testDBErr error
+
+// testDBSetup connects global DB pool to test DB once, skips test if no test DB is given
+func testDBSetup(t *testing.T) {
+	if os.Getenv(testDBNameEnv) == "" {
+		t.Skipf("no test DB (set %s to run DB tests)", testDBNameEnv)
+	}
+	testDBOnce.Do(func() {
+		configFile := serverConfigFile
+		if envConfigFile := os.Getenv(serverConfigFileEnv); envConfigFile != "" {
+			configFile = envConfigFile
+		}
+		var sc *ServerConfig
+		if sc, testDBErr = readServerConfig(configFile); testDBErr != nil {
+			return
+		}
+		if testDBErr = applyServerConfigEnv(sc); testDBErr != nil {
+			return
+		}
+		initDefaultServerConfig(sc)
+		sc.DBName = os.Getenv(testDBNameEnv)
+		sc.LoggingDestination = "stdout"
+		// failed bindings of race tests must not hit attempt limits
+		sc.BindingMaxAttemptsPerWXID = 1 << 20
+		sc.BindingMaxAttemptsPerCode = 1 << 20
+		sc.BindingMaxAttemptsPerIP = 1 << 20
+		sc.BindingMaxAttemptsTotal = 1 << 20
+		serverConfig = sc
+
+		logging = loggingInitSetup(sc)
+		if testDBErr = loggingRegisterModules(logging, logModEnabledTable); testDBErr != nil {
+			return
+		}
+		dbPool, testDBErr = dbPoolInit(sc)
+	})
+	if testDBErr != nil {
+		t.Fatalf("could not connect test DB: %s", testDBErr.Error())
+	}
+}
+
+// testStudentRelatives creates a student and relatives (removed with their references, binding codes and invites after test)
+func testStudentRelatives(t *testing.T, relativeCount int) (*Student, []*Relative) {
+	var ctx = context.Background()
+	var student = Student{
+		PID:          primitive.NewObjectID(),
+		StudentName:  "test student",
+		InstitutePID: primitive.NewObjectID(),
+		Status:       StudentStatusActive,
+	}
+	if _, err := dbPool.Collection(DBCollectionStudent).InsertOne(ctx, &student); err != nil {
+		t.Fatalf("could not create test student: %s", err.Error())
+	}
+
+	var relatives []*Relative
+	var relativePIDs []primitive.ObjectID
+	var relativeWXIDs []string
+	for i := 0; i < relativeCount; i++ {
+		var relative = Relative{
+			PID:           primitive.NewObjectID(),
+			RelativeName:  fmt.Sprintf("test relative %d", i),
+			RelativeWXID:  fmt.Sprintf("test_wxid_%s_%d", student.PID.Hex(), i),
+			InstitutePIDs: []primitive.ObjectID{},
+		}
+		if _, err := dbPool.Collection(DBCollectionRelative).InsertOne(ctx, &relative); err != nil {
+			t.Fatalf("could not create test relative: %s", err.Error())
+		}
+		relatives = append(relatives, &relative)
+		relativePIDs = append(relativePIDs, relative.PID)
+		relativeWXIDs = append(relativeWXIDs, relative.RelativeWXID)
+	}
+
+	t.Cleanup(func() {
+		dbPool.Collection(DBCollectionStudentRelativeRef).DeleteMany(ctx, bson.D{{"student_pid", student.PID}})
+		dbPool.Collection(DBCollectionBindingCode).DeleteMany(ctx, bson.D{{"student_pid", student.PID}})
+		dbPool.Collection(DBCollectionRelativeInvite).DeleteMany(ctx, bson.D{{"student_pid", student.PID}})
+		dbPool.Collection(DBCollectionBindingAttempt).DeleteMany(ctx, bson.D{{"relative_wxid", bson.D{{"$in", relativeWXIDs}}}})
+		dbPool.Collection(DBCollectionRelative).DeleteMany(ctx, bson.D{{"_id", bson.D{{"$in", relativePIDs}}}})
+		dbPool.Collection(DBCollectionStudent).DeleteOne(ctx, bson.D{{"_id", student.PID}})
+	})
+	return &student, relatives
+}
+
+// testRouter serves workflow handlers without auth middleware (callers act as super-admin)
+func testRouter(handlers map[string]gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	for apiURL, apiHandler := range handlers {
+		router.POST(apiURL, apiHandler)
+	}
+	return router
+}
+
+// testPost sends json request to router, returns status and response payload
+func testPost(router *gin.Engine, apiURL string, request interface{}) (int, json.RawMessage) {
+	body, _ := json.Marshal(request)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, apiURL, bytes.NewReader(body)))
+	var response struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder.Code, response.Payload
+}
+
+// testParallel runs jobs at once and waits for all of them (at most timeout)
+func testParallel(t *testing.T, jobs []func(), timeout time.Duration) {
+	var start sync.WaitGroup
+	var done = make(chan struct{})
+	var finished sync.WaitGroup
+	start.Add(1)
+	finished.Add(len(jobs))
+	for _, job := range jobs {
+		go func(job func()) {
+			defer finished.Done()
+			start.Wait()
+			job()
+		}(job)
+	}
+	start.Done()
+	go func() {
+		finished.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("parallel jobs not finished within %v", timeout)
+	}
+}
+
+func TestDBDuplicateKeyIndex(t *testing.T) {
+	duplicate := func(message string) error {
+		return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: dbDuplicateKeyErrorCode, Message: message}}}
+	}
+	var cases = []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"main index", duplicate("E11000 duplicate key error collection: klog.student_relative_ref index: student_pid_main_unique dup key: { student_pid: ObjectId('5f1d7a') }"), studentRelativeRefMainIndex},
+		{"wrapped", fmt.Errorf("insert: %w", duplicate("E11000 duplicate key error collection: klog.binding_code index: "+bindingCodeStudentIndex+" dup key: { }")), bindingCodeStudentIndex},
+		{"no index in message", duplicate("E11000 duplicate key error"), ""},
+		{"other write error", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 121, Message: "index: x dup key"}}}, ""},
+		{"no write exception", fmt.Errorf("index: x dup key"), ""},
+	}
+	for _, c := range cases {
+		if got := dbDuplicateKeyIndex(c.err); got != c.want {
+			t.Errorf("%s: got index %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -100,11 +100,46 @@ db.createCollection("course", {
                                 bsonType: "string",
                                 minLength: 1,
                                 description: "required string (>= 1 length)"
+                            },
+                            level: {
+                                bsonType: "int",
+                                description: "optional int - curriculum level (0 for unleveled)"
+                            },
+                            order: {
+                                bsonType: "int",
+                                description: "optional int - order within level"
+                            },
+                            retired: {
+                                bsonType: "bool",
+                                description: "optional boolean - kept for existing records only"
                             }
                         }
                     },
                     description: "optional course target description array"
                 },
+                curriculum_version: {
+                    bsonType: "int",
+                    description: "optional int - current version of course targets (see curriculum_version collection)"
+                },
+                rubric: {
+                    bsonType: ["array"],
+                    items: {
+                        bsonType: "object",
+                        required: ["score", "label"],
+                        properties: {
+                            score: {
+                                bsonType: "int",
+                                description: "required int (distinct within rubric)"
+                            },
+                            label: {
+                                bsonType: "string",
+                                minLength: 1,
+                                description: "required string (>= 1 length)"
+                            }
+                        }
+                    },
+                    description: "optional rubric of target assessments (default 1-5 if empty)"
+                },
                 teacher_pid: {
                     bsonType: "objectId",
                     description: "required ObjectId"
@@ -113,6 +148,33 @@ db.createCollection("course", {
                     bsonType: "objectId",
                     description: "required ObjectId"
                 },
+                staff: {
+                    bsonType: ["array"],
+                    items: {
+                        bsonType: "object",
+                        required: ["teacher_pid", "role", "start_ts", "end_ts"],
+                        properties: {
+                            teacher_pid: {
+                                bsonType: "objectId",
+                                description: "required ObjectId"
+                            },
+                            role: {
+                                bsonType: "string",
+                                enum: ["lead", "assistant", "substitute"],
+                                description: "required string: lead/assistant/substitute"
+                            },
+                            start_ts: {
+                                bsonType: "long",
+                                description: "required int64 (unix timestamp, effective from)"
+                            },
+                            end_ts: {
+                                bsonType: "long",
+                                description: "required int64 (unix timestamp, effective until, 0 for open-ended)"
+                            }
+                        }
+                    },
+                    description: "optional course staff array (staffing history)"
+                },
                 institute_pid: {
                     bsonType: "objectId",
                     description: "required ObjectId"
@@ -124,6 +186,7 @@ db.createCollection("course", {
     validationAction: "error"
 });
 db.course.createIndex({"course_uid": 1}, {unique: true});
+db.course.createIndex({"staff.teacher_pid": 1});
 
 
 // teacher collection
@@ -174,7 +237,7 @@ db.createCollection("student", {
     validator: {
         $jsonSchema: {
             bsonType: "object",
-            required: ["student_name", "student_image_name", "student_image_url", "binding_code", "binding_expire"],
+            required: ["student_name", "student_image_name", "student_image_url"],
             properties: {
                 student_name: {
                     bsonType: "string",
@@ -189,13 +252,188 @@ db.createCollection("student", {
                     bsonType: "string",
                     description: "required string"
                 },
+                student_image_version: {
+                    bsonType: "long",
+                    description: "optional int64 (image upload version, part of image blob names)"
+                },
+                student_image_variants: {
+                    bsonType: ["array"],
+                    items: {
+                        bsonType: "object",
+                        required: ["size", "image_name", "image_url"],
+                        properties: {
+                            size: {
+                                bsonType: "int",
+                                description: "required int (pixel, square image)"
+                            },
+                            image_name: {
+                                bsonType: "string",
+                                description: "required string"
+                            },
+                            image_url: {
+                                bsonType: "string",
+                                description: "required string"
+                            }
+                        }
+                    },
+                    description: "optional image variant array (largest first)"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional objectid (required for new students, older students may lack it)"
+                },
+                birthdate: {
+                    bsonType: "string",
+                    pattern: "^([0-9]{4}-[0-9]{2}-[0-9]{2})?$",
+                    description: "optional date string YYYY-MM-DD"
+                },
+                gender: {
+                    bsonType: "string",
+                    enum: ["", "female", "male", "other"],
+                    description: "optional string: female/male/other"
+                },
+                allergies: {
+                    bsonType: "string",
+                    description: "optional string"
+                },
+                notes: {
+                    bsonType: "string",
+                    description: "optional string (staff only)"
+                },
+                emergency_contacts: {
+                    bsonType: ["array"],
+                    items: {
+                        bsonType: "object",
+                        required: ["name", "phone_number"],
+                        properties: {
+                            name: {
+                                bsonType: "string",
+                                description: "required string"
+                            },
+                            relation: {
+                                bsonType: "string",
+                                description: "optional string"
+                            },
+                            phone_number: {
+                                bsonType: "string",
+                                description: "required string"
+                            }
+                        }
+                    },
+                    description: "optional emergency contact array"
+                },
+                status: {
+                    bsonType: "string",
+                    enum: ["active", "paused", "graduated", "withdrawn"],
+                    description: "optional lifecycle status string: active/paused/graduated/withdrawn (graduated/withdrawn are archived)"
+                },
+                status_ts: {
+                    bsonType: "long",
+                    description: "optional int64 (unix timestamp of last status change)"
+                },
+                status_history: {
+                    bsonType: ["array"],
+                    items: {
+                        bsonType: "object",
+                        required: ["status", "change_ts"],
+                        properties: {
+                            status: {
+                                bsonType: "string",
+                                description: "required string"
+                            },
+                            change_ts: {
+                                bsonType: "long",
+                                description: "required int64 (unix timestamp)"
+                            },
+                            note: {
+                                bsonType: "string",
+                                description: "optional string"
+                            }
+                        }
+                    },
+                    description: "optional status change array (oldest first)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+
+db.student.createIndex( { "status": 1, "status_ts": 1 } );
+db.student.createIndex( { "institute_pid": 1 } );
+
+
+// binding_code collection (one active code per student, used codes kept as history until expire_at)
+db.createCollection("binding_code", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["student_pid", "binding_code", "status", "create_ts", "binding_expire", "expire_at"],
+            properties: {
+                student_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
                 binding_code: {
                     bsonType: "string",
-                    description: "required string"
+                    description: "required string (numeric code)"
+                },
+                status: {
+                    bsonType: "string",
+                    enum: ["active", "redeemed", "revoked"],
+                    description: "required status string: active/redeemed/revoked"
+                },
+                create_ts: {
+                    bsonType: "long",
+                    description: "required int64 (unix timestamp)"
                 },
                 binding_expire: {
                     bsonType: "long",
                     description: "required int64 (unix timestamp)"
+                },
+                expire_at: {
+                    bsonType: "date",
+                    description: "required date (history removed by TTL index)"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of student (tenant scope)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+db.binding_code.createIndex( { "binding_code": 1 }, { name: "binding_code_active_unique", unique: true, partialFilterExpression: { "status": "active" } } );
+db.binding_code.createIndex( { "student_pid": 1 }, { name: "student_pid_active_unique", unique: true, partialFilterExpression: { "status": "active" } } );
+db.binding_code.createIndex( { "expire_at": 1 }, { expireAfterSeconds: 90 * 24 * 3600 } );
+db.binding_code.createIndex( { "institute_pid": 1 } );
+
+
+// binding_attempt collection (binding attempts, removed when binding succeeds, kept for attempt window)
+db.createCollection("binding_attempt", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["relative_wxid", "binding_code", "attempt_at"],
+            properties: {
+                relative_wxid: {
+                    bsonType: "string",
+                    description: "required string"
+                },
+                binding_code: {
+                    bsonType: "string",
+                    description: "required string"
+                },
+                client_ip: {
+                    bsonType: "string",
+                    description: "optional string (missing for attempts recorded before IP limiting)"
+                },
+                attempt_at: {
+                    bsonType: "date",
+                    description: "required date"
                 }
             }
         }
@@ -203,6 +441,10 @@ db.createCollection("student", {
     validationLevel: "strict",
     validationAction: "error"
 });
+db.binding_attempt.createIndex( { "attempt_at": 1 }, { expireAfterSeconds: 15 * 60 } );
+db.binding_attempt.createIndex( { "relative_wxid": 1, "attempt_at": 1 } );
+db.binding_attempt.createIndex( { "binding_code": 1, "attempt_at": 1 } );
+db.binding_attempt.createIndex( { "client_ip": 1, "attempt_at": 1 } );
 
 
 // relative collection
@@ -229,6 +471,11 @@ db.createCollection("relative", {
                 email: {
                     bsonType: "string",
                     description: "required string"
+                },
+                institute_pids: {
+                    bsonType: "array",
+                    items: { bsonType: "objectId" },
+                    description: "optional ObjectId array - institutes of bound students (tenant scope)"
                 }
             }
         }
@@ -237,6 +484,7 @@ db.createCollection("relative", {
     validationAction: "error"
 });
 db.relative.createIndex({"relative_wxid": 1}, {unique: true});
+db.relative.createIndex( { "institute_pids": 1 } );
 
 
 // course_record collection
@@ -265,6 +513,45 @@ db.createCollection("course_record", {
                 is_makeup: {
                     bsonType: "bool",
                     description: "required boolean type to indicate if this is a makeup course record"
+                },
+                session_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId of class session (nil for single records)"
+                },
+                attendance: {
+                    bsonType: "string",
+                    enum: ["present", "absent", "makeup"],
+                    description: "optional attendance string: present/absent/makeup"
+                },
+                targets: {
+                    bsonType: ["array"],
+                    items: {
+                        bsonType: "object",
+                        required: ["tag", "score"],
+                        properties: {
+                            tag: {
+                                bsonType: "string",
+                                description: "required string - related to course target tag"
+                            },
+                            score: {
+                                bsonType: "int",
+                                description: "required int - score of course rubric"
+                            },
+                            note: {
+                                bsonType: "string",
+                                description: "optional string"
+                            }
+                        }
+                    },
+                    description: "optional assessed course target array"
+                },
+                curriculum_version: {
+                    bsonType: "int",
+                    description: "optional int - curriculum version in force when the record was created"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of course (tenant scope)"
                 }
             }
         }
@@ -274,33 +561,65 @@ db.createCollection("course_record", {
 });
 
 
-// course_comment collection
-db.createCollection("course_comment", {
+db.course_record.createIndex( { "session_pid": 1, "student_pid": 1 } );
+db.course_record.createIndex( { "student_pid": 1, "course_pid": 1, "record_ts": 1 } );
+db.course_record.createIndex( { "institute_pid": 1 } );
+
+
+// curriculum_version collection (immutable snapshots of course targets)
+db.createCollection("curriculum_version", {
     validator: {
         $jsonSchema: {
             bsonType: "object",
-            required: ["course_record_pid", "comment_person_pid", "comment_person_type", "comment_ts", "comment_body"],
+            required: ["course_pid", "version", "targets", "create_ts"],
             properties: {
-                course_record_pid: {
+                course_pid: {
                     bsonType: "objectId",
                     description: "required ObjectId"
                 },
-                comment_person_pid: {
-                    bsonType: "objectId",
-                    description: "required ObjectId of the person who gives this comment"
+                version: {
+                    bsonType: "int",
+                    minimum: 1,
+                    description: "required int (>= 1)"
                 },
-                comment_person_type: {
-                    bsonType: "string",
-                    enum: ["teacher", "relative", "others"],
-                    description: "required person type string: teacher/relative/others"
+                targets: {
+                    bsonType: ["array"],
+                    items: {
+                        bsonType: "object",
+                        required: ["tag", "desc"],
+                        properties: {
+                            tag: {
+                                bsonType: "string",
+                                minLength: 1,
+                                description: "required string (>= 1 length)"
+                            },
+                            desc: {
+                                bsonType: "string",
+                                description: "required string"
+                            },
+                            level: {
+                                bsonType: "int",
+                                description: "optional int"
+                            },
+                            order: {
+                                bsonType: "int",
+                                description: "optional int"
+                            },
+                            retired: {
+                                bsonType: "bool",
+                                description: "optional boolean"
+                            }
+                        }
+                    },
+                    description: "required course target array of this version"
                 },
-                comment_ts: {
+                create_ts: {
                     bsonType: "long",
                     description: "required int64 (unix timestamp)"
                 },
-                comment_body: {
-                    bsonType: "string",
-                    description: "required comment body string"
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of course (tenant scope)"
                 }
             }
         }
@@ -308,57 +627,74 @@ db.createCollection("course_comment", {
     validationLevel: "strict",
     validationAction: "error"
 });
+db.curriculum_version.createIndex( { "course_pid": 1, "version": 1 }, { unique: true } );
+db.curriculum_version.createIndex( { "institute_pid": 1 } );
 
 
-// cloudmedia collection
-db.createCollection("cloudmedia", {
+// course_schedule collection
+db.createCollection("course_schedule", {
     validator: {
         $jsonSchema: {
             bsonType: "object",
-            required: ["student_pid", "course_record_pid", "media_type", "media_name", "media_url", "rank_score", "media_tags", "create_ts", "content_length"],
+            required: ["course_pid", "weekdays", "interval_weeks", "start_time", "duration_minutes", "term_start", "term_end"],
             properties: {
-                student_pid: {
+                course_pid: {
                     bsonType: "objectId",
                     description: "required ObjectId"
                 },
-                course_record_pid: {
-                    bsonType: "objectId",
-                    description: "required ObjectId"
+                weekdays: {
+                    bsonType: "array",
+                    items: {
+                        bsonType: "int",
+                        minimum: 0,
+                        maximum: 6
+                    },
+                    description: "required weekday array (0 sunday - 6 saturday)"
                 },
-                media_type: {
+                interval_weeks: {
+                    bsonType: "int",
+                    minimum: 1,
+                    description: "required int (1 for every week)"
+                },
+                start_time: {
                     bsonType: "string",
-                    enum: ["video", "image", "others"],
-                    description: "required string - video/image/others"
+                    pattern: "^[0-2][0-9]:[0-5][0-9]$",
+                    description: "required string (HH:MM)"
                 },
-                media_name: {
+                duration_minutes: {
+                    bsonType: "int",
+                    minimum: 1,
+                    description: "required int (minutes)"
+                },
+                time_zone: {
                     bsonType: "string",
-                    minLength: 1,
-                    description: "required string (media blob name)"
+                    description: "optional IANA time zone name"
                 },
-                media_url: {
+                term_start: {
                     bsonType: "string",
-                    minLength: 1,
-                    description: "required string (media blob full url)"
+                    description: "required string (YYYY-MM-DD)"
                 },
-                media_tags: {
-                    bsonType: ["array"],
+                term_end: {
+                    bsonType: "string",
+                    description: "required string (YYYY-MM-DD)"
+                },
+                holidays: {
+                    bsonType: "array",
                     items: {
-                        bsonType: "string",
-                        description: "required tag string"
+                        bsonType: "string"
                     },
-                    description: "media understanding tags"
-                },
-                rank_score: {
-                    bsonType: "double",
-                    description: "required double/float64"
+                    description: "optional date array (YYYY-MM-DD)"
                 },
-                create_ts: {
-                    bsonType: "long",
-                    description: "required int64 (unix timestamp)"
+                cancellations: {
+                    bsonType: "array",
+                    items: {
+                        bsonType: "string"
+                    },
+                    description: "optional cancelled occurrence date array (YYYY-MM-DD)"
                 },
-                content_length: {
-                    bsonType: "long",
-                    description: "required int64"
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of course (tenant scope)"
                 }
             }
         }
@@ -366,39 +702,591 @@ db.createCollection("cloudmedia", {
     validationLevel: "strict",
     validationAction: "error"
 });
-db.cloudmedia.createIndex({"media_name": 1}, {unique: true});
+db.course_schedule.createIndex( { "course_pid": 1 } );
+db.course_schedule.createIndex( { "institute_pid": 1 } );
 
 
-// student-relative reference
-db.createCollection("student_relative_ref", {
+// class_session collection
+db.createCollection("class_session", {
     validator: {
         $jsonSchema: {
             bsonType: "object",
-            required: ["student_pid", "relative_pid", "relationship", "is_main"],
+            required: ["course_pid", "teacher_pid", "target_tag", "start_ts", "end_ts", "create_ts"],
             properties: {
-                student_pid: {
+                course_pid: {
                     bsonType: "objectId",
                     description: "required ObjectId"
                 },
-                relative_pid: {
+                teacher_pid: {
                     bsonType: "objectId",
                     description: "required ObjectId"
                 },
-                relationship: {
+                target_tag: {
                     bsonType: "string",
-                    description: "required string (e.g., father, mother, uncle, aunt, etc.)"
+                    description: "required string - related to course target tag"
                 },
-                is_main: {
-                    bsonType: "bool",
-                    description: "required boolean type to indicate if this is main relationship"
-                }
-            }
-        }
-    },
-    validationLevel: "strict",
+                start_ts: {
+                    bsonType: "long",
+                    description: "required int64 (unix timestamp)"
+                },
+                end_ts: {
+                    bsonType: "long",
+                    description: "required int64 (unix timestamp)"
+                },
+                create_ts: {
+                    bsonType: "long",
+                    description: "required int64 (unix timestamp)"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of course (tenant scope)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+db.class_session.createIndex( { "course_pid": 1, "start_ts": -1 } );
+db.class_session.createIndex( { "institute_pid": 1 } );
+
+
+// lesson_credit collection (ledger, balance is the sum of entries)
+db.createCollection("lesson_credit", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["student_pid", "course_pid", "entry_type", "credits", "make_ups", "create_ts"],
+            properties: {
+                student_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                course_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                entry_type: {
+                    enum: ["grant", "consume", "absence", "redeem", "adjust"],
+                    description: "required entry type"
+                },
+                credits: {
+                    bsonType: "int",
+                    description: "required int (signed lesson credit change)"
+                },
+                make_ups: {
+                    bsonType: "int",
+                    description: "required int (signed makeup entitlement change)"
+                },
+                course_record_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId (consume/absence/redeem entries)"
+                },
+                note: {
+                    bsonType: "string",
+                    description: "optional string"
+                },
+                create_ts: {
+                    bsonType: "long",
+                    description: "required long"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of course (tenant scope)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+db.lesson_credit.createIndex( { "student_pid": 1, "course_pid": 1, "create_ts": -1 } );
+db.lesson_credit.createIndex( { "course_pid": 1 } );
+// one consume/redeem and one absence entry per course record
+db.lesson_credit.createIndex(
+    { "course_record_pid": 1, "entry_type": 1 },
+    { unique: true, partialFilterExpression: { "course_record_pid": { $exists: true } } }
+);
+db.lesson_credit.createIndex( { "institute_pid": 1 } );
+
+
+// lesson_credit_alert collection (low balance alerts shown to relatives)
+db.createCollection("lesson_credit_alert", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["student_pid", "course_pid", "credits", "create_ts"],
+            properties: {
+                student_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                course_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                credits: {
+                    bsonType: "int",
+                    description: "required int"
+                },
+                create_ts: {
+                    bsonType: "long",
+                    description: "required long"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of course (tenant scope)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+db.lesson_credit_alert.createIndex( { "student_pid": 1, "create_ts": -1 } );
+db.lesson_credit_alert.createIndex( { "institute_pid": 1 } );
+
+
+// leave_request collection (absence announced by relatives, decided by the course teacher)
+db.createCollection("leave_request", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["student_pid", "relative_pid", "course_pid", "schedule_pid", "date", "start_ts", "end_ts", "status", "create_ts"],
+            properties: {
+                student_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                relative_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                course_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                schedule_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                date: {
+                    bsonType: "string",
+                    description: "required string (YYYY-MM-DD)"
+                },
+                start_ts: {
+                    bsonType: "long",
+                    description: "required long"
+                },
+                end_ts: {
+                    bsonType: "long",
+                    description: "required long"
+                },
+                reason: {
+                    bsonType: "string",
+                    description: "optional string"
+                },
+                status: {
+                    enum: ["pending", "approved", "rejected", "withdrawn"],
+                    description: "required status"
+                },
+                decider_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId (teacher)"
+                },
+                course_record_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId (absence record of approved request)"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of course (tenant scope)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+db.leave_request.createIndex( { "student_pid": 1, "schedule_pid": 1, "date": 1 } );
+db.leave_request.createIndex( { "course_pid": 1, "start_ts": 1 } );
+db.leave_request.createIndex( { "course_record_pid": 1 }, { sparse: true } );
+db.leave_request.createIndex( { "institute_pid": 1 } );
+
+
+// course_comment collection
+db.createCollection("course_comment", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["course_record_pid", "comment_person_pid", "comment_person_type", "comment_ts", "comment_body"],
+            properties: {
+                course_record_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                comment_person_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId of the person who gives this comment"
+                },
+                comment_person_type: {
+                    bsonType: "string",
+                    enum: ["teacher", "relative", "others"],
+                    description: "required person type string: teacher/relative/others"
+                },
+                comment_ts: {
+                    bsonType: "long",
+                    description: "required int64 (unix timestamp)"
+                },
+                comment_body: {
+                    bsonType: "string",
+                    description: "required comment body string"
+                },
+                staff_role: {
+                    bsonType: "string",
+                    enum: ["lead", "assistant", "substitute"],
+                    description: "optional string - course staff role of commenting teacher at record time"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of course record (tenant scope)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+db.course_comment.createIndex( { "institute_pid": 1 } );
+
+
+// cloudmedia collection
+db.createCollection("cloudmedia", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["student_pid", "course_record_pid", "media_type", "media_name", "media_url", "rank_score", "media_tags", "create_ts", "content_length"],
+            properties: {
+                student_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId (first linked student)"
+                },
+                student_links: {
+                    bsonType: ["array", "null"],
+                    description: "optional array (students of group media, null for media with student_pid only)",
+                    items: {
+                        bsonType: "object",
+                        required: ["student_pid", "hidden"],
+                        properties: {
+                            student_pid: {
+                                bsonType: "objectId",
+                                description: "required ObjectId"
+                            },
+                            hidden: {
+                                bsonType: "bool",
+                                description: "required bool (not shown to relatives of student)"
+                            }
+                        }
+                    }
+                },
+                course_record_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                media_type: {
+                    bsonType: "string",
+                    enum: ["video", "image", "others"],
+                    description: "required string - video/image/others"
+                },
+                media_name: {
+                    bsonType: "string",
+                    minLength: 1,
+                    description: "required string (media blob name)"
+                },
+                media_url: {
+                    bsonType: "string",
+                    minLength: 1,
+                    description: "required string (media blob full url)"
+                },
+                media_tags: {
+                    bsonType: ["array"],
+                    items: {
+                        bsonType: "string",
+                        description: "required tag string"
+                    },
+                    description: "media understanding tags"
+                },
+                rank_score: {
+                    bsonType: "double",
+                    description: "required double/float64"
+                },
+                create_ts: {
+                    bsonType: "long",
+                    description: "required int64 (unix timestamp)"
+                },
+                content_length: {
+                    bsonType: "long",
+                    description: "required int64"
+                },
+                storage_tier: {
+                    bsonType: "string",
+                    enum: ["Hot", "Cool"],
+                    description: "optional blob access tier string (default hot)"
+                },
+                tier_ts: {
+                    bsonType: "long",
+                    description: "optional int64 (unix timestamp of last tier change)"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of student or class session (tenant scope)"
+                },
+                media_variants: {
+                    bsonType: ["object", "null"],
+                    additionalProperties: {
+                        bsonType: "object",
+                        required: ["media_name", "media_url"],
+                        properties: {
+                            media_name: {
+                                bsonType: "string",
+                                description: "required string"
+                            },
+                            media_url: {
+                                bsonType: "string",
+                                description: "required string"
+                            },
+                            width: {
+                                bsonType: "int",
+                                description: "optional int (pixel)"
+                            },
+                            height: {
+                                bsonType: "int",
+                                description: "optional int (pixel)"
+                            },
+                            content_length: {
+                                bsonType: "long",
+                                description: "optional int64"
+                            }
+                        }
+                    },
+                    description: "optional resized image variants by name (thumbnail/medium), null until generated"
+                },
+                capture_ts: {
+                    bsonType: "long",
+                    description: "optional int64 (capture time from EXIF/mp4 metadata, 0 if unknown)"
+                },
+                width: {
+                    bsonType: "int",
+                    description: "optional int (pixel as displayed, 0 if unknown)"
+                },
+                height: {
+                    bsonType: "int",
+                    description: "optional int (pixel as displayed, 0 if unknown)"
+                },
+                duration: {
+                    bsonType: "double",
+                    description: "optional double (second, videos)"
+                },
+                orientation: {
+                    bsonType: "int",
+                    minimum: 0,
+                    maximum: 8,
+                    description: "optional int (EXIF orientation 1-8, 0 if unknown)"
+                },
+                metadata_stripped: {
+                    bsonType: "bool",
+                    description: "optional bool (location/device metadata removed from image blob)"
+                },
+                metadata_strip_skipped: {
+                    bsonType: "bool",
+                    description: "optional bool (image format or size cannot be stripped of metadata)"
+                },
+                content_type: {
+                    bsonType: "string",
+                    description: "optional string (MIME type sniffed from blob content)"
+                },
+                content_hash: {
+                    bsonType: "string",
+                    description: "optional string (SHA-256 hex of blob content, images after metadata stripping)"
+                },
+                perceptual_hash: {
+                    bsonType: "string",
+                    description: "optional string (64 bit difference hash hex of images)"
+                },
+                near_duplicate_of: {
+                    bsonType: "objectId",
+                    description: "optional objectId (similar earlier media of same course record/class session)"
+                },
+                collapsed: {
+                    bsonType: "bool",
+                    description: "optional bool (near-duplicate collapsed by teacher, hidden from relatives)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+db.cloudmedia.createIndex({"media_name": 1}, {unique: true});
+db.cloudmedia.createIndex( { "session_pid": 1 } );
+db.cloudmedia.createIndex( { "institute_pid": 1 } );
+db.cloudmedia.createIndex( { "media_type": 1, "media_variants": 1 } );
+db.cloudmedia.createIndex( { "media_type": 1, "metadata_stripped": 1 } );
+db.cloudmedia.createIndex( { "content_hash": 1 } );
+db.cloudmedia.createIndex( { "student_links.student_pid": 1 } );
+db.cloudmedia.createIndex( { "student_pid": 1 } );
+db.cloudmedia.createIndex( { "course_record_pid": 1 } );
+
+
+// student-relative reference
+db.createCollection("student_relative_ref", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["student_pid", "relative_pid", "relationship", "is_main"],
+            properties: {
+                student_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                relative_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                relationship: {
+                    bsonType: "string",
+                    description: "required string (e.g., father, mother, uncle, aunt, etc.)"
+                },
+                is_main: {
+                    bsonType: "bool",
+                    description: "required boolean type to indicate if this is main relationship"
+                },
+                permission: {
+                    bsonType: "string",
+                    enum: ["view", "view_comment"],
+                    description: "optional permission string: view/view_comment (main relative always view_comment)"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of student (tenant scope)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
     validationAction: "error"
 });
 db.student_relative_ref.createIndex( { "student_pid": 1, "relative_pid": 1 }, { unique: true } );
+db.student_relative_ref.createIndex( { "student_pid": 1 }, { name: "student_pid_main_unique", unique: true, partialFilterExpression: { "is_main": true } } );
+db.student_relative_ref.createIndex( { "institute_pid": 1 } );
+
+// relative invite (secondary relative invited by main relative)
+db.createCollection("relative_invite", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["student_pid", "inviter_pid", "invite_code", "invite_expire", "relationship", "permission", "create_ts"],
+            properties: {
+                student_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                inviter_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId of main relative"
+                },
+                invite_code: {
+                    bsonType: "string",
+                    minLength: 1,
+                    description: "required string"
+                },
+                invite_expire: {
+                    bsonType: "long",
+                    description: "required int64 (unix timestamp)"
+                },
+                relationship: {
+                    bsonType: "string",
+                    description: "required string (e.g., father, mother, uncle, aunt, etc.)"
+                },
+                permission: {
+                    bsonType: "string",
+                    enum: ["view", "view_comment"],
+                    description: "required permission string: view/view_comment"
+                },
+                create_ts: {
+                    bsonType: "long",
+                    description: "required int64 (unix timestamp)"
+                },
+                status: {
+                    bsonType: "string",
+                    enum: ["pending", "redeemed"],
+                    description: "optional status string: pending/redeemed (missing for invites created before redeem status)"
+                },
+                redeemer_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId of relative who redeemed the invite"
+                },
+                redeem_ts: {
+                    bsonType: "long",
+                    description: "optional int64 (unix timestamp)"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of student (tenant scope)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+db.relative_invite.createIndex( { "invite_code": 1 }, { unique: true } );
+db.relative_invite.createIndex( { "institute_pid": 1 } );
+
+// main relative transfer history
+db.createCollection("main_relative_transfer", {
+    validator: {
+        $jsonSchema: {
+            bsonType: "object",
+            required: ["student_pid", "from_relative_pid", "to_relative_pid", "operator_type", "transfer_ts"],
+            properties: {
+                student_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId"
+                },
+                from_relative_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId of previous main relative"
+                },
+                to_relative_pid: {
+                    bsonType: "objectId",
+                    description: "required ObjectId of new main relative"
+                },
+                operator_type: {
+                    bsonType: "string",
+                    enum: ["relative", "admin"],
+                    description: "required operator type string: relative/admin"
+                },
+                operator_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId of operating relative"
+                },
+                transfer_ts: {
+                    bsonType: "long",
+                    description: "required int64 (unix timestamp)"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of student (tenant scope)"
+                }
+            }
+        }
+    },
+    validationLevel: "strict",
+    validationAction: "error"
+});
+db.main_relative_transfer.createIndex( { "student_pid": 1, "transfer_ts": -1 } );
+db.main_relative_transfer.createIndex( { "institute_pid": 1 } );
 
 // course-student reference
 db.createCollection("student_course_ref", {
@@ -414,6 +1302,14 @@ db.createCollection("student_course_ref", {
                 student_pid: {
                     bsonType: "objectId",
                     description: "required ObjectId"
+                },
+                credits: {
+                    bsonType: "int",
+                    description: "optional int (lesson credits granted at enrolment)"
+                },
+                institute_pid: {
+                    bsonType: "objectId",
+                    description: "optional ObjectId - institute of course (tenant scope)"
                 }
             }
         }
@@ -422,6 +1318,7 @@ db.createCollection("student_course_ref", {
     validationAction: "error"
 });
 db.student_course_ref.createIndex( { "course_pid": 1, "student_pid": 1 }, { unique: true } );
+db.student_course_ref.createIndex( { "institute_pid": 1 } );
 
 
 // db info
@@ -0,0 +1,54 @@
+conn = Mongo();
+db = conn.getDB("klog");
+
+// remove duplicates created before the unique indexes of db_control.go (dbEnsureIndexes) existed, server skips an index
+// (and logs the duplicates) while existing documents violate it, run this script and restart server to create them
+
+// duplicates: groups of documents (oldest first) sharing the same keys
+function duplicates(collection, keys, filter) {
+    var groupKeys = {};
+    Object.keys(keys).forEach(function (key) {
+        groupKeys[key] = "$" + key;
+    });
+    return db.getCollection(collection).aggregate([
+        { $match: filter },
+        { $sort: { "_id": 1 } },
+        { $group: { _id: groupKeys, pids: { $push: "$_id" }, count: { $sum: 1 } } },
+        { $match: { count: { $gt: 1 } } }
+    ]).toArray();
+}
+
+// student relative references: one reference per student-relative pair (main one kept)
+duplicates("student_relative_ref", { "student_pid": 1, "relative_pid": 1 }, {}).forEach(function (group) {
+    var main = db.student_relative_ref.findOne({ "_id": { $in: group.pids }, "is_main": true });
+    var keep = main == null ? group.pids[0] : main._id;
+    db.student_relative_ref.deleteMany({ "_id": { $in: group.pids, $ne: keep } });
+    print("student " + group._id.student_pid + " relative " + group._id.relative_pid + ": kept reference " + keep + ", removed " + (group.count - 1));
+});
+
+// student relative references: one main relative per student (oldest kept as main)
+duplicates("student_relative_ref", { "student_pid": 1 }, { "is_main": true }).forEach(function (group) {
+    db.student_relative_ref.updateMany({ "_id": { $in: group.pids.slice(1) } }, { $set: { "is_main": false } });
+    print("student " + group._id.student_pid + ": kept main reference " + group.pids[0] + ", " + (group.count - 1) + " set to non-main");
+});
+
+// relative invites: a shared invite code may bind the wrong student -> all invites with it removed (to be issued again)
+duplicates("relative_invite", { "invite_code": 1 }, {}).forEach(function (group) {
+    db.relative_invite.deleteMany({ "_id": { $in: group.pids } });
+    print("invite code " + group._id.invite_code + ": removed " + group.count + " invites");
+});
+
+// binding codes: one active code per student (newest kept) and per code (all revoked, a new one is generated on demand)
+duplicates("binding_code", { "student_pid": 1 }, { "status": "active" }).forEach(function (group) {
+    db.binding_code.updateMany({ "_id": { $in: group.pids.slice(0, -1) } }, { $set: { "status": "revoked" } });
+    print("student " + group._id.student_pid + ": kept active binding code " + group.pids[group.count - 1] + ", revoked " + (group.count - 1));
+});
+duplicates("binding_code", { "binding_code": 1 }, { "status": "active" }).forEach(function (group) {
+    db.binding_code.updateMany({ "_id": { $in: group.pids } }, { $set: { "status": "revoked" } });
+    print("binding code " + group._id.binding_code + ": revoked " + group.count + " codes");
+});
+
+// curriculum versions: content differs per version -> not merged, to be renumbered manually
+duplicates("curriculum_version", { "course_pid": 1, "version": 1 }, {}).forEach(function (group) {
+    print("course " + group._id.course_pid + " version " + group._id.version + " is kept " + group.count + " times (" + group.pids.join(", ") + ") -> please renumber manually");
+});
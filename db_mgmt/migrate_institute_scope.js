@@ -0,0 +1,77 @@
+conn = Mongo();
+db = conn.getDB("klog");
+
+// backfill institute_pid of documents created before institute (tenant) scoping, documents without it are only visible to super-admin
+var nilObjectID = ObjectId("000000000000000000000000");
+var noInstitute = { $in: [null, nilObjectID] };
+
+// students: institute of first enrolled course
+db.student.find({ "institute_pid": noInstitute }).forEach(function (student) {
+    var reference = db.student_course_ref.findOne({ "student_pid": student._id });
+    var course = reference == null ? null : db.course.findOne({ "_id": reference.course_pid });
+    if (course == null) {
+        print("student " + student._id + " is not enrolled in any course -> please set institute_pid manually");
+        return;
+    }
+    db.student.updateOne({ "_id": student._id }, { $set: { "institute_pid": course.institute_pid } });
+});
+
+// course records: institute of course
+db.course_record.find({ "institute_pid": noInstitute }).forEach(function (record) {
+    var course = db.course.findOne({ "_id": record.course_pid });
+    if (course != null) {
+        db.course_record.updateOne({ "_id": record._id }, { $set: { "institute_pid": course.institute_pid } });
+    }
+});
+
+// course comments: institute of course record
+db.course_comment.find({ "institute_pid": noInstitute }).forEach(function (comment) {
+    var record = db.course_record.findOne({ "_id": comment.course_record_pid });
+    if (record != null && record.institute_pid != null && !record.institute_pid.equals(nilObjectID)) {
+        db.course_comment.updateOne({ "_id": comment._id }, { $set: { "institute_pid": record.institute_pid } });
+    }
+});
+
+// cloud media: institute of student, session media institute of session course
+db.cloudmedia.find({ "institute_pid": noInstitute }).forEach(function (media) {
+    var institutePID = null;
+    if (media.session_pid != null && !media.session_pid.equals(nilObjectID)) {
+        var session = db.class_session.findOne({ "_id": media.session_pid });
+        var course = session == null ? null : db.course.findOne({ "_id": session.course_pid });
+        institutePID = course == null ? null : course.institute_pid;
+    } else {
+        var student = db.student.findOne({ "_id": media.student_pid });
+        institutePID = student == null ? null : student.institute_pid;
+    }
+    if (institutePID != null && !institutePID.equals(nilObjectID)) {
+        db.cloudmedia.updateOne({ "_id": media._id }, { $set: { "institute_pid": institutePID } });
+    }
+});
+
+// documents referring to a course: institute of course
+["class_session", "course_schedule", "curriculum_version", "leave_request", "lesson_credit", "lesson_credit_alert", "student_course_ref"].forEach(function (collection) {
+    db.getCollection(collection).find({ "institute_pid": noInstitute }).forEach(function (document) {
+        var course = db.course.findOne({ "_id": document.course_pid });
+        if (course != null) {
+            db.getCollection(collection).updateOne({ "_id": document._id }, { $set: { "institute_pid": course.institute_pid } });
+        }
+    });
+});
+
+// documents referring to a student: institute of student
+["binding_code", "relative_invite", "main_relative_transfer", "student_relative_ref"].forEach(function (collection) {
+    db.getCollection(collection).find({ "institute_pid": noInstitute }).forEach(function (document) {
+        var student = db.student.findOne({ "_id": document.student_pid });
+        if (student != null && student.institute_pid != null && !student.institute_pid.equals(nilObjectID)) {
+            db.getCollection(collection).updateOne({ "_id": document._id }, { $set: { "institute_pid": student.institute_pid } });
+        }
+    });
+});
+
+// relatives: institutes of bound students
+db.relative.find({}).forEach(function (relative) {
+    var institutePIDs = db.student_relative_ref.distinct("institute_pid", { "relative_pid": relative._id }).filter(function (institutePID) {
+        return institutePID != null && !institutePID.equals(nilObjectID);
+    });
+    db.relative.updateOne({ "_id": relative._id }, { $set: { "institute_pids": institutePIDs } });
+});
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"logrus"
 	"net/http"
+	"regexp"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	//"reflect"
 	"strings"
@@ -22,18 +28,83 @@ var ginConfigAPITable = map[string]map[string]gin.HandlerFunc{
 	"/api/0/config/cloudmedia":                 cloudMediaConfigHandlerTable,
 	"/api/0/config/reference/student_relative": studentRelativeRefConfigHandlerTable,
 	"/api/0/config/reference/student_course":   studentCourseRefConfigHandlerTable,
+	"/api/0/config/relative_invite":            relativeInviteConfigHandlerTable,
+	"/api/0/config/main_relative_transfer":     mainRelativeTransferConfigHandlerTable,
+	"/api/0/config/binding_code":               bindingCodeConfigHandlerTable,
+	"/api/0/config/class_session":              classSessionConfigHandlerTable,
+	"/api/0/config/course_schedule":            courseScheduleConfigHandlerTable,
+	"/api/0/config/lesson_credit":              lessonCreditConfigHandlerTable,
+	"/api/0/config/leave_request":              leaveRequestConfigHandlerTable,
+	"/api/0/config/curriculum_version":         curriculumVersionConfigHandlerTable,
 }
 
 var ginWorkflowAPITable = map[string]gin.HandlerFunc{
-	"/api/0/workflow/teacher/login":        teacherLoginHandler,
-	"/api/0/workflow/student/generatecode": studentGenerateCodeHandler,
-	"/api/0/workflow/student/bind":         studentBindingRelativeHandler,
-	"/api/0/workflow/student/unbind":       studentUnbindingRelativeHandler,
-	"/api/0/workflow/student/mediaquery":   studentMediaQueryHandler,
-	"/api/0/workflow/relative/wxlogin":     relativeWeChatLoginHandler,
-	"/api/0/workflow/relative/findstudent": relativeFindBoundStudentHandler,
-	// "/api/0/workflow/relative/extra/add":    relativeExtraAddHandler,
-	// "/api/0/workflow/relative/extra/delete": relativeExtraDeleteHandler,
+	"/api/0/workflow/teacher/login":              teacherLoginHandler,
+	"/api/0/workflow/teacher/session/create":     teacherSessionCreateHandler,
+	"/api/0/workflow/teacher/session/attendance": teacherSessionAttendanceHandler,
+	"/api/0/workflow/teacher/session/detail":     teacherSessionDetailHandler,
+	"/api/0/workflow/teacher/leave/decide":       teacherLeaveDecideHandler,
+	"/api/0/workflow/teacher/daily":              teacherDailyHandler,
+	"/api/0/workflow/teacher/media/duplicates":   teacherMediaDuplicatesHandler,
+	"/api/0/workflow/teacher/media/collapse":     teacherMediaCollapseHandler,
+	"/api/0/workflow/schedule/upcoming":          scheduleUpcomingHandler,
+	"/api/0/workflow/schedule/cancel":            scheduleCancelHandler,
+	"/api/0/workflow/schedule/feedurl":           scheduleFeedURLHandler,
+	"/api/0/workflow/credit/balance":             creditBalanceHandler,
+	"/api/0/workflow/credit/history":             creditHistoryHandler,
+	"/api/0/workflow/credit/grant":               creditGrantHandler,
+	"/api/0/workflow/credit/absence":             creditAbsenceHandler,
+	"/api/0/workflow/curriculum/clone":           curriculumCloneHandler,
+	"/api/0/workflow/student/generatecode":       studentGenerateCodeHandler,
+	"/api/0/workflow/student/revokecode":         studentRevokeCodeHandler,
+	"/api/0/workflow/student/bind":               studentBindingRelativeHandler,
+	"/api/0/workflow/student/unbind":             studentUnbindingRelativeHandler,
+	"/api/0/workflow/student/mediaquery":         studentMediaQueryHandler,
+	"/api/0/workflow/student/progress":           studentProgressHandler,
+	"/api/0/workflow/student/status":             studentStatusHandler,
+	"/api/0/workflow/student/image":              studentImageUploadHandler,
+	"/api/0/workflow/relative/wxlogin":           relativeWeChatLoginHandler,
+	"/api/0/workflow/relative/findstudent":       relativeFindBoundStudentHandler,
+	"/api/0/workflow/relative/extra/add":         relativeExtraAddHandler,
+	"/api/0/workflow/relative/extra/delete":      relativeExtraDeleteHandler,
+	"/api/0/workflow/relative/extra/list":        relativeExtraListHandler,
+	"/api/0/workflow/relative/main/transfer":     relativeMainTransferHandler,
+	"/api/0/workflow/relative/credit/alerts":     relativeCreditAlertHandler,
+	"/api/0/workflow/relative/leave/submit":      relativeLeaveSubmitHandler,
+	"/api/0/workflow/relative/leave/withdraw":    relativeLeaveWithdrawHandler,
+	"/api/0/workflow/relative/leave/list":        relativeLeaveListHandler,
+}
+
+// ginWorkflowPublicAPI workflow apis open to relatives and login (others require teacher or admin token)
+var ginWorkflowPublicAPI = map[string]bool{
+	"/api/0/workflow/teacher/login":           true,
+	"/api/0/workflow/student/bind":            true,
+	"/api/0/workflow/relative/wxlogin":        true,
+	"/api/0/workflow/relative/findstudent":    true,
+	"/api/0/workflow/relative/extra/add":      true,
+	"/api/0/workflow/relative/extra/delete":   true,
+	"/api/0/workflow/relative/extra/list":     true,
+	"/api/0/workflow/relative/main/transfer":  true,
+	"/api/0/workflow/relative/credit/alerts":  true,
+	"/api/0/workflow/relative/leave/submit":   true,
+	"/api/0/workflow/relative/leave/withdraw": true,
+	"/api/0/workflow/relative/leave/list":     true,
+}
+
+// ginWorkflowRelativeAPI workflow apis serving staff and relatives of a student (handler checks caller: relative_wxid bound
+// to the student, or teacher token of its institute or admin token)
+var ginWorkflowRelativeAPI = map[string]bool{
+	"/api/0/workflow/schedule/upcoming":  true,
+	"/api/0/workflow/schedule/feedurl":   true,
+	"/api/0/workflow/credit/balance":     true,
+	"/api/0/workflow/credit/history":     true,
+	"/api/0/workflow/student/mediaquery": true,
+	"/api/0/workflow/student/progress":   true,
+}
+
+// ginConfigRelativeAPI config apis also serving relatives (handler checks caller, others require teacher or admin token)
+var ginConfigRelativeAPI = map[string]map[string]bool{
+	"/api/0/config/student": {"get": true},
 }
 
 // GinParameter a generic paramter wrapper for gin web framework handler
@@ -51,6 +122,163 @@ type GinResponse struct {
 	Payload interface{} `json:"payload"`
 }
 
+const (
+	ginHeaderRequestID    = "X-Request-ID"
+	ginContextRequestID   = "REQUEST_ID"
+	ginHeaderInstitutePID = "X-Institute-PID"
+)
+
+// request id context key (request scoped value for DB/storage/logging calls)
+type requestIDContextKey struct{}
+
+// client supplied request ids are accepted only if they are short and log-safe
+var ginRequestIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._\-]{1,64}$`)
+
+// ginRequestIDMiddleware accepts X-Request-ID from client or assigns a new one
+func ginRequestIDMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(ginHeaderRequestID)
+		if !ginRequestIDPattern.MatchString(requestID) {
+			requestID = xid.New().String()
+		}
+		ctx.Set(ginContextRequestID, requestID)
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), requestIDContextKey{}, requestID))
+		ctx.Header(ginHeaderRequestID, requestID)
+		ctx.Next()
+	}
+}
+
+// requestIDFromContext returns request id stored by ginRequestIDMiddleware ("" if none)
+func requestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if requestID, ok := ctx.Value(requestIDContextKey{}).(string); ok {
+		return requestID
+	}
+	return ""
+}
+
+// tenant scope context key (caller's institute for DB calls)
+type tenantContextKey struct{}
+
+// tenantScope caller's institute, super-admin (admin token) may act across institutes without one
+type tenantScope struct {
+	InstitutePID primitive.ObjectID
+	TeacherPID   primitive.ObjectID // logged in teacher (nil objectid for admin and anonymous callers)
+	SuperAdmin   bool
+}
+
+// ginTenantMiddleware takes caller's institute from teacher auth token, admin token holders act as super-admin
+// and may pick an institute with X-Institute-PID header (header is ignored for other callers)
+func ginTenantMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var scope = tenantScope{SuperAdmin: ginContextIsAdmin(ctx)}
+		if authorization := ctx.GetHeader(ginHeaderAuthorization); authorization != "" && !scope.SuperAdmin {
+			teacherPID, institutePID, err := teacherTokenParse(authorization)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"message": fmt.Sprintf("[%s] - Teacher token is not valid: %s", serverErrorMessages[seResourceNotMatched], err.Error()),
+				})
+				return
+			}
+			scope.TeacherPID = teacherPID
+			scope.InstitutePID = institutePID
+		} else if institute := ctx.GetHeader(ginHeaderInstitutePID); institute != "" && scope.SuperAdmin {
+			institutePID, err := primitive.ObjectIDFromHex(institute)
+			if err != nil || institutePID.IsZero() {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+					"message": fmt.Sprintf("[%s] - Please specifiy a valid institute PID (%s header)", serverErrorMessages[seInputParamNotValid], ginHeaderInstitutePID),
+				})
+				return
+			}
+			scope.InstitutePID = institutePID
+		}
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), tenantContextKey{}, &scope))
+		ctx.Next()
+	}
+}
+
+// ginTenantRequiredMiddleware rejects requests of callers other than teachers and super-admin (config and staff workflow api)
+func ginTenantRequiredMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !ginContextIsStaff(ctx) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"message": fmt.Sprintf("[%s] - Teacher token (%s header) or admin token is required", serverErrorMessages[seInputParamNotValid], ginHeaderAuthorization),
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// ginContextIsStaff checks if caller is a logged in teacher (scoped to its institute) or super-admin
+func ginContextIsStaff(ctx *gin.Context) bool {
+	scope := tenantScopeFromContext(ctx.Request.Context())
+	return scope != nil && (scope.SuperAdmin || (!scope.TeacherPID.IsZero() && !scope.InstitutePID.IsZero()))
+}
+
+// tenantScopeFromContext returns tenant scope stored by ginTenantMiddleware (nil if none, e.g. background jobs)
+func tenantScopeFromContext(ctx context.Context) *tenantScope {
+	if ctx == nil {
+		return nil
+	}
+	if scope, ok := ctx.Value(tenantContextKey{}).(*tenantScope); ok {
+		return scope
+	}
+	return nil
+}
+
+// tenantFromContext returns institute DB calls are scoped to (nil objectid for unscoped calls)
+func tenantFromContext(ctx context.Context) primitive.ObjectID {
+	if scope := tenantScopeFromContext(ctx); scope != nil {
+		return scope.InstitutePID
+	}
+	return primitive.NilObjectID
+}
+
+// tenantUnscopedContext derives a context for lookups of identities not owned by an institute (e.g. relatives to bind)
+func tenantUnscopedContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, &tenantScope{})
+}
+
+// tenantCheck rejects references to another institute than caller's one
+func tenantCheck(ctx context.Context, institutePID primitive.ObjectID) error {
+	tenantPID := tenantFromContext(ctx)
+	if !tenantPID.IsZero() && tenantPID != institutePID {
+		return fmt.Errorf("[%s] - Institute PID %s does not match caller's institute (PID %s)", serverErrorMessages[seResourceNotMatched],
+			institutePID.Hex(), tenantPID.Hex())
+	}
+	return nil
+}
+
+// ginAccessLogMiddleware writes access log entries through logging module (JSON in release mode)
+func ginAccessLogMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		startTime := time.Now()
+		path := ctx.Request.URL.Path
+		if ctx.Request.URL.RawQuery != "" {
+			path = path + "?" + ctx.Request.URL.RawQuery
+		}
+
+		ctx.Next()
+
+		accessEntry := loggingWithContext(ctx.Request.Context()).WithFields(logrus.Fields{
+			"method":        ctx.Request.Method,
+			"path":          path,
+			"status":        ctx.Writer.Status(),
+			"latency_ms":    float64(time.Since(startTime).Microseconds()) / 1000.0,
+			"client_ip":     ctx.ClientIP(),
+			"user_agent":    ctx.Request.UserAgent(),
+			"response_size": ctx.Writer.Size(),
+		})
+		if len(ctx.Errors) > 0 {
+			accessEntry = accessEntry.WithField("errors", ctx.Errors.String())
+		}
+		accessEntry.Infomf(logModGinAccess, "GIN: [%s] %s | %d", ctx.Request.Method, path, ctx.Writer.Status())
+	}
+}
+
 func ginContextRequestParameter(ctx *gin.Context) *GinParameter {
 	var tokenString string = ""
 	if token, exist := ctx.Get("JWT_TOKEN"); exist {
@@ -64,7 +292,7 @@ func ginContextRequestParameter(ctx *gin.Context) *GinParameter {
 	switch strings.ToLower(ctx.Request.Method) {
 	case "post", "put":
 		if reqBuffer, err := ioutil.ReadAll(ctx.Request.Body); err != nil {
-			logging.Warnmf(logModGinContext, "Http request body read err: %v\n", err.Error())
+			loggingWithContext(ctx.Request.Context()).Warnmf(logModGinContext, "Http request body read err: %v\n", err.Error())
 		} else {
 			bodyData = reqBuffer
 		}
@@ -74,7 +302,20 @@ func ginContextRequestParameter(ctx *gin.Context) *GinParameter {
 	return &GinParameter{tokenString, primaryKey, secondarykey, bodyData}
 }
 
+// ginResponseIsTimeout checks if an error response was caused by a DB or storage timeout (not a conflict of the request)
+func ginResponseIsTimeout(response *GinResponse) bool {
+	if response.Status != http.StatusConflict && response.Status != http.StatusInternalServerError {
+		return false
+	}
+	return strings.Contains(response.Message, "["+serverErrorMessages[seDBTimeout]+"]") ||
+		strings.Contains(response.Message, context.DeadlineExceeded.Error())
+}
+
 func ginContextProcessResponse(ctx *gin.Context, response *GinResponse) {
+	// timeouts are reported as such, so that clients can retry instead of treating them as conflicts
+	if ginResponseIsTimeout(response) {
+		response.Status = http.StatusGatewayTimeout
+	}
 	responseContent := gin.H{}
 	if response.Status == http.StatusOK {
 		if response.Payload != nil {
@@ -91,7 +332,7 @@ func ginContextProcessResponse(ctx *gin.Context, response *GinResponse) {
 		responseContent["message"] = response.Message
 	}
 	ctx.JSON(response.Status, responseContent)
-	logging.Debugmf(logModGinContext, "GIN: [%s] FROM %v | URL %v | RESPONSE CODE %v", ctx.Request.Method, ctx.Request.RemoteAddr, ctx.Request.URL, response.Status)
+	loggingWithContext(ctx.Request.Context()).Debugmf(logModGinContext, "GIN: [%s] FROM %v | URL %v | RESPONSE CODE %v", ctx.Request.Method, ctx.Request.RemoteAddr, ctx.Request.URL, response.Status)
 }
 
 /* gin input struct check */
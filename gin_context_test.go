@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGinResponseIsTimeout(t *testing.T) {
+	var cases = []struct {
+		name    string
+		status  int
+		message string
+		timeout bool
+	}{
+		{"db timeout", http.StatusConflict, "[DB_TIMEOUT] - context deadline exceeded", true},
+		{"wrapped db timeout", http.StatusConflict, "[DB_TIMEOUT] - find failed --> could not bind student", true},
+		{"storage timeout", http.StatusInternalServerError, "[CLOUD_OPS_ERROR] - could not upload blob: context deadline exceeded", true},
+		{"conflict", http.StatusConflict, "[RESOURCE_CONFLICT] - binding code has been redeemed", false},
+		{"bad request", http.StatusBadRequest, "[DB_TIMEOUT] - not a server side timeout", false},
+		{"ok", http.StatusOK, "", false},
+	}
+	for _, c := range cases {
+		if got := ginResponseIsTimeout(&GinResponse{Status: c.status, Message: c.message}); got != c.timeout {
+			t.Errorf("%s: got timeout %v, want %v", c.name, got, c.timeout)
+		}
+	}
+}
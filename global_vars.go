@@ -7,6 +7,7 @@ const (
 	seInputJSONNotValid   = -iota
 	seInputBSONNotValid   = -iota
 	seDBResourceQuery     = -iota
+	seDBTimeout           = -iota
 	seResourceNotFound    = -iota
 	seResourceNotMatched  = -iota
 	seResourceDuplicated  = -iota
@@ -28,6 +29,7 @@ var serverErrorMessages = map[int]string{
 	seInputJSONNotValid:   "INVALID_INPUT_JSON",
 	seInputBSONNotValid:   "INVALID_INPUT_BSON",
 	seDBResourceQuery:     "DB_QUERY_ERROR",
+	seDBTimeout:           "DB_TIMEOUT",
 	seResourceNotFound:    "RESOURCE_NOT_FOUND",
 	seResourceNotMatched:  "RESOURCE_NOT_MATCHED",
 	seResourceDuplicated:  "RESOURCE_DUPLICATED",
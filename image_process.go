@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // register png decoder
+	"math/bits"
+	"strconv"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register webp decoder
+)
+
+const (
+	imageMaxPixels       = 50000000 // decoded pixels, rejects decompression bombs before decoding
+	imageJPEGQuality     = 85
+	imageContentTypeJPEG = "image/jpeg"
+	imageExifTagOrient   = 0x0112
+)
+
+// image formats accepted for uploads (names of registered image decoders)
+var imageUploadFormats = map[string]bool{
+	"jpeg": true,
+	"png":  true,
+	"webp": true,
+}
+
+// decode uploaded image, return image, format, error
+func imageDecodeUpload(data []byte) (image.Image, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("[%s] - image could not be decoded (JPEG/PNG/WebP only): %s", serverErrorMessages[seInputParamNotValid], err.Error())
+	}
+	if !imageUploadFormats[format] {
+		return nil, "", fmt.Errorf("[%s] - image format %s is not supported (JPEG/PNG/WebP only)", serverErrorMessages[seInputParamNotValid], format)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > imageMaxPixels {
+		return nil, "", fmt.Errorf("[%s] - image size %dx%d is not supported (max %d pixels)", serverErrorMessages[seInputParamNotValid],
+			config.Width, config.Height, imageMaxPixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("[%s] - image could not be decoded: %s", serverErrorMessages[seInputParamNotValid], err.Error())
+	}
+	return img, format, nil
+}
+
+// exif data (tiff header and IFDs) embedded in an image, nil if there is none
+func imageExifTIFF(data []byte, format string) []byte {
+	var exifHeader = []byte("Exif\x00\x00")
+	switch format {
+	case "jpeg":
+		// APP1 segment starting with exif header, segments end at start of scan
+		for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+			marker := data[pos+1]
+			if marker == 0xFF {
+				pos++
+				continue
+			}
+			if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+				pos += 2
+				continue
+			}
+			if marker == 0xDA || marker == 0xD9 {
+				return nil
+			}
+			length := int(binary.BigEndian.Uint16(data[pos+2:]))
+			if length < 2 || pos+2+length > len(data) {
+				return nil
+			}
+			segment := data[pos+4 : pos+2+length]
+			if marker == 0xE1 && bytes.HasPrefix(segment, exifHeader) {
+				return segment[len(exifHeader):]
+			}
+			pos += 2 + length
+		}
+	case "png":
+		// eXIf chunk
+		for pos := 8; pos+8 <= len(data); {
+			length := int(binary.BigEndian.Uint32(data[pos:]))
+			if length < 0 || pos+12+length > len(data) {
+				return nil
+			}
+			if string(data[pos+4:pos+8]) == "eXIf" {
+				return data[pos+8 : pos+8+length]
+			}
+			pos += 12 + length
+		}
+	case "webp":
+		// EXIF chunk of RIFF container (some writers keep the jpeg exif header)
+		for pos := 12; pos+8 <= len(data); {
+			length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+			if length < 0 || pos+8+length > len(data) {
+				return nil
+			}
+			if string(data[pos:pos+4]) == "EXIF" {
+				return bytes.TrimPrefix(data[pos+8:pos+8+length], exifHeader)
+			}
+			pos += 8 + length + length%2
+		}
+	}
+	return nil
+}
+
+// exif data reader (tiff byte order and IFDs)
+type imageExif struct {
+	tiff  []byte
+	order binary.ByteOrder
+}
+
+// one IFD entry of exif data (value bytes resolved from inline value or offset)
+type imageExifEntry struct {
+	Type  uint16
+	Count uint32
+	Data  []byte
+	order binary.ByteOrder
+}
+
+// byte size of exif value types (BYTE, ASCII, SHORT, LONG, RATIONAL, SBYTE, UNDEFINED, SSHORT, SLONG, SRATIONAL)
+var imageExifTypeSize = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8}
+
+// exif reader of tiff data, nil if data is no valid tiff
+func imageExifParse(tiff []byte) *imageExif {
+	if len(tiff) < 8 {
+		return nil
+	}
+	switch string(tiff[:2]) {
+	case "II":
+		return &imageExif{tiff, binary.LittleEndian}
+	case "MM":
+		return &imageExif{tiff, binary.BigEndian}
+	}
+	return nil
+}
+
+// offset of first IFD (IFD0)
+func (exif *imageExif) firstIFD() uint32 {
+	return exif.order.Uint32(exif.tiff[4:])
+}
+
+// entries of IFD at offset by tag (broken entries are left out)
+func (exif *imageExif) entries(offset uint32) map[uint16]imageExifEntry {
+	var entries = map[uint16]imageExifEntry{}
+	var ifd = int(offset)
+	if offset < 8 || ifd+2 > len(exif.tiff) {
+		return entries
+	}
+	count := int(exif.order.Uint16(exif.tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		pos := ifd + 2 + i*12
+		if pos+12 > len(exif.tiff) {
+			break
+		}
+		var entry = imageExifEntry{Type: exif.order.Uint16(exif.tiff[pos+2:]), Count: exif.order.Uint32(exif.tiff[pos+4:]), order: exif.order}
+		typeSize, ok := imageExifTypeSize[entry.Type]
+		if !ok || entry.Count > uint32(len(exif.tiff)) {
+			continue
+		}
+		size := int(typeSize * entry.Count)
+		if size <= 4 {
+			entry.Data = exif.tiff[pos+8 : pos+8+size]
+		} else {
+			valueOffset := int(exif.order.Uint32(exif.tiff[pos+8:]))
+			if valueOffset < 0 || valueOffset+size > len(exif.tiff) {
+				continue
+			}
+			entry.Data = exif.tiff[valueOffset : valueOffset+size]
+		}
+		entries[exif.order.Uint16(exif.tiff[pos:])] = entry
+	}
+	return entries
+}
+
+// first value of a SHORT/LONG entry
+func (entry imageExifEntry) uint() (uint32, bool) {
+	switch {
+	case entry.Type == 3 && len(entry.Data) >= 2:
+		return uint32(entry.order.Uint16(entry.Data)), true
+	case entry.Type == 4 && len(entry.Data) >= 4:
+		return entry.order.Uint32(entry.Data), true
+	}
+	return 0, false
+}
+
+// value of an ASCII entry
+func (entry imageExifEntry) ascii() string {
+	if entry.Type != 2 {
+		return ""
+	}
+	return string(bytes.TrimRight(entry.Data, "\x00 "))
+}
+
+// exif orientation of an image (1-8), 1 if not given
+func imageExifOrientation(data []byte, format string) int {
+	exif := imageExifParse(imageExifTIFF(data, format))
+	if exif == nil {
+		return 1
+	}
+	orientation, ok := exif.entries(exif.firstIFD())[imageExifTagOrient].uint()
+	if !ok || orientation < 1 || orientation > 8 {
+		return 1
+	}
+	return int(orientation)
+}
+
+// largest square at the center of bounds
+func imageCenterSquare(bounds image.Rectangle) image.Rectangle {
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
+
+// resize source rectangle of an image to width x height, transparent pixels on white background
+func imageResize(img image.Image, src image.Rectangle, width int, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Over, nil)
+	return dst
+}
+
+// size fitting source rectangle into maxSide x maxSide keeping aspect ratio (never enlarged)
+func imageFitSize(src image.Rectangle, maxSide int) (int, int) {
+	width, height := src.Dx(), src.Dy()
+	if width <= maxSide && height <= maxSide {
+		return width, height
+	}
+	if width >= height {
+		return maxSide, imageMax((height*maxSide+width/2)/width, 1)
+	}
+	return imageMax((width*maxSide+height/2)/height, 1), maxSide
+}
+
+func imageMax(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// turn image upright as given by exif orientation
+func imageOrient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 { // 90/270 degree rotations swap width and height
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirror horizontal
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90 counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			dst.SetRGBA(x, y, img.RGBAAt(img.Bounds().Min.X+sx, img.Bounds().Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// 64 bit difference hash of upright image (hex), similar images differ in few bits
+func imagePerceptualHash(img image.Image, orientation int) string {
+	small := imageOrient(imageResize(img, img.Bounds(), 9, 9), orientation)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if imageLuma(small.RGBAAt(x, y)) < imageLuma(small.RGBAAt(x+1, y)) {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// bits differing between two perceptual hashes, -1 if a hash is not valid
+func imagePerceptualDistance(hash1 string, hash2 string) int {
+	value1, err1 := strconv.ParseUint(hash1, 16, 64)
+	value2, err2 := strconv.ParseUint(hash2, 16, 64)
+	if err1 != nil || err2 != nil {
+		return -1
+	}
+	return bits.OnesCount64(value1 ^ value2)
+}
+
+func imageLuma(c color.RGBA) int {
+	return 299*int(c.R) + 587*int(c.G) + 114*int(c.B)
+}
+
+// encode image as jpeg
+func imageEncodeJPEG(img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: imageJPEGQuality}); err != nil {
+		return nil, fmt.Errorf("[%s] - image could not be encoded: %s", serverErrorMessages[seUnresolvedError], err.Error())
+	}
+	return buffer.Bytes(), nil
+}
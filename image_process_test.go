@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testImage small image for encoder based samples
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 3; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 60), uint8(y * 80), 128, 255})
+		}
+	}
+	return img
+}
+
+// testJPEG jpeg with exif (APP1) and comment segments after SOI
+func testJPEG(t *testing.T, exif []byte) []byte {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	var data = []byte{0xFF, 0xD8}
+	if exif != nil {
+		app1 := append([]byte("Exif\x00\x00"), exif...)
+		data = append(data, 0xFF, 0xE1)
+		data = append(data, mediaBigEndian16(uint16(len(app1)+2))...)
+		data = append(data, app1...)
+	}
+	comment := []byte("device serial 1234")
+	data = append(data, 0xFF, 0xFE)
+	data = append(data, mediaBigEndian16(uint16(len(comment)+2))...)
+	data = append(data, comment...)
+	return append(data, encoded.Bytes()[2:]...)
+}
+
+// testPNGChunk one png chunk with crc
+func testPNGChunk(chunkType string, content []byte) []byte {
+	chunk := append([]byte(chunkType), content...)
+	data := mediaBigEndian32(uint32(len(content)))
+	data = append(data, chunk...)
+	return append(data, mediaBigEndian32(crc32.ChecksumIEEE(chunk))...)
+}
+
+// testPNG png with eXIf and text chunks after IHDR
+func testPNG(t *testing.T, exif []byte) []byte {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	raw := encoded.Bytes()
+	ihdrEnd := 8 + 12 + int(binary.BigEndian.Uint32(raw[8:]))
+	var data = append([]byte{}, raw[:ihdrEnd]...)
+	if exif != nil {
+		data = append(data, testPNGChunk("eXIf", exif)...)
+	}
+	data = append(data, testPNGChunk("tEXt", []byte("Comment\x00device serial 1234"))...)
+	return append(data, raw[ihdrEnd:]...)
+}
+
+// testWebPChunk one riff chunk with padding
+func testWebPChunk(chunkType string, content []byte) []byte {
+	data := append([]byte(chunkType), mediaLittleEndian32(uint32(len(content)))...)
+	data = append(data, content...)
+	if len(content)%2 == 1 {
+		data = append(data, 0)
+	}
+	return data
+}
+
+// testWebP extended webp with exif (jpeg exif header kept like some writers do) and xmp chunks
+func testWebP(exif []byte) []byte {
+	var flags byte = 0x04
+	if exif != nil {
+		flags |= 0x08
+	}
+	var chunks = testWebPChunk("VP8X", []byte{flags, 0, 0, 0, 3, 0, 0, 2, 0, 0})
+	chunks = append(chunks, testWebPChunk("VP8L", []byte{0x2F, 3, 0x80, 0, 0, 0x47})...)
+	if exif != nil {
+		chunks = append(chunks, testWebPChunk("EXIF", append([]byte("Exif\x00\x00"), exif...))...)
+	}
+	chunks = append(chunks, testWebPChunk("XMP ", []byte("<x:xmpmeta>gps</x:xmpmeta>"))...)
+	data := append([]byte("RIFF"), mediaLittleEndian32(uint32(len(chunks)+4))...)
+	data = append(data, "WEBP"...)
+	return append(data, chunks...)
+}
+
+func TestImageExifTIFF(t *testing.T) {
+	exif := imageExifBuild(6, "2021:03:04 05:06:07", "+08:00")
+	jpegData := testJPEG(t, exif)
+	pngData := testPNG(t, exif)
+	webpData := testWebP(exif)
+
+	// APP1 length beyond end of data
+	jpegOverflow := append([]byte{}, jpegData...)
+	binary.BigEndian.PutUint16(jpegOverflow[4:], 0xFFFF)
+	// APP1 length shorter than length field
+	jpegShort := append([]byte{}, jpegData...)
+	binary.BigEndian.PutUint16(jpegShort[4:], 1)
+	// eXIf chunk length beyond end of data
+	pngOverflow := append([]byte{}, pngData...)
+	binary.BigEndian.PutUint32(pngOverflow[33:], 0xFFFFFFF0)
+	// VP8X chunk length beyond end of data
+	webpOverflow := append([]byte{}, webpData...)
+	binary.LittleEndian.PutUint32(webpOverflow[16:], 0xFFFFFFF0)
+
+	var cases = []struct {
+		name   string
+		data   []byte
+		format string
+		want   []byte
+	}{
+		{"jpeg", jpegData, "jpeg", exif},
+		{"jpeg without exif", testJPEG(t, nil), "jpeg", nil},
+		{"jpeg segment overflow", jpegOverflow, "jpeg", nil},
+		{"jpeg segment too short", jpegShort, "jpeg", nil},
+		{"jpeg no segments", []byte{0xFF, 0xD8}, "jpeg", nil},
+		{"jpeg not a marker", []byte{0xFF, 0xD8, 0x00, 0xE1, 0x00, 0x10}, "jpeg", nil},
+		{"png", pngData, "png", exif},
+		{"png without exif", testPNG(t, nil), "png", nil},
+		{"png chunk overflow", pngOverflow, "png", nil},
+		{"png signature only", pngData[:8], "png", nil},
+		{"webp", webpData, "webp", exif},
+		{"webp without exif", testWebP(nil), "webp", nil},
+		{"webp chunk overflow", webpOverflow, "webp", nil},
+		{"webp header only", webpData[:12], "webp", nil},
+		{"empty", nil, "jpeg", nil},
+		{"unknown format", jpegData, "gif", nil},
+	}
+	for _, c := range cases {
+		if got := imageExifTIFF(c.data, c.format); !bytes.Equal(got, c.want) {
+			t.Errorf("%s: got %d bytes exif, want %d bytes", c.name, len(got), len(c.want))
+		}
+	}
+
+	// truncated data never panics and never returns data beyond its end
+	for _, c := range cases[:len(cases)-2] {
+		for end := 0; end < len(c.data); end++ {
+			if got := imageExifTIFF(c.data[:end], c.format); len(got) > end {
+				t.Errorf("%s truncated at %d: exif longer than data", c.name, end)
+			}
+		}
+	}
+}
+
+// testTIFF little-endian tiff with one IFD at offset 8 and given entries (tag, type, count, value or offset)
+func testTIFF(entries [][4]uint32, tail []byte) []byte {
+	var tiff = []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	var field = make([]byte, 4)
+	binary.LittleEndian.PutUint16(field, uint16(len(entries)))
+	tiff = append(tiff, field[:2]...)
+	for _, entry := range entries {
+		binary.LittleEndian.PutUint16(field, uint16(entry[0]))
+		tiff = append(tiff, field[:2]...)
+		binary.LittleEndian.PutUint16(field, uint16(entry[1]))
+		tiff = append(tiff, field[:2]...)
+		binary.LittleEndian.PutUint32(field, entry[2])
+		tiff = append(tiff, field...)
+		binary.LittleEndian.PutUint32(field, entry[3])
+		tiff = append(tiff, field...)
+	}
+	tiff = append(tiff, 0, 0, 0, 0)
+	return append(tiff, tail...)
+}
+
+func TestImageExifEntries(t *testing.T) {
+	// value area starts after header (8), count (2), 3 entries (36) and next IFD offset (4)
+	valid := testTIFF([][4]uint32{
+		{imageExifTagOrient, 3, 1, 6},
+		{imageExifTagDateTime, 2, 20, 50},
+		{imageExifTagExifIFD, 4, 1, 0},
+	}, []byte("2020:01:02 03:04:05\x00"))
+
+	var cases = []struct {
+		name   string
+		tiff   []byte
+		offset uint32
+		tags   []uint16
+	}{
+		{"valid", valid, 8, []uint16{imageExifTagOrient, imageExifTagDateTime, imageExifTagExifIFD}},
+		{"offset inside header", valid, 4, nil},
+		{"offset beyond data", valid, uint32(len(valid)), nil},
+		{"offset at last byte", valid, uint32(len(valid) - 1), nil},
+		{"truncated entries", valid[:8+2+12+5], 8, []uint16{imageExifTagOrient}},
+		{"without next IFD offset", testTIFF([][4]uint32{{imageExifTagOrient, 3, 1, 1}}, nil)[:8+2+12], 8, []uint16{imageExifTagOrient}},
+		{"unknown type", testTIFF([][4]uint32{{imageExifTagOrient, 99, 1, 1}}, nil), 8, nil},
+		{"value offset beyond data", testTIFF([][4]uint32{{imageExifTagDateTime, 2, 20, 1000}}, nil), 8, nil},
+		{"value offset overflow", testTIFF([][4]uint32{{imageExifTagDateTime, 2, 20, 0xFFFFFFF0}}, nil), 8, nil},
+		{"huge count", testTIFF([][4]uint32{{imageExifTagDateTime, 5, 0xFFFFFFFF, 8}}, nil), 8, nil},
+	}
+	for _, c := range cases {
+		exif := imageExifParse(c.tiff)
+		if exif == nil {
+			t.Fatalf("%s: tiff not parsed", c.name)
+		}
+		entries := exif.entries(c.offset)
+		if len(entries) != len(c.tags) {
+			t.Errorf("%s: got %d entries, want %d", c.name, len(entries), len(c.tags))
+		}
+		for _, tag := range c.tags {
+			if _, ok := entries[tag]; !ok {
+				t.Errorf("%s: entry %#x missing", c.name, tag)
+			}
+		}
+	}
+
+	// entry count beyond data reads up to end of data only
+	countOverflow := append([]byte{}, valid...)
+	binary.LittleEndian.PutUint16(countOverflow[8:], 0xFFFF)
+	for _, tag := range []uint16{imageExifTagOrient, imageExifTagDateTime, imageExifTagExifIFD} {
+		if _, ok := imageExifParse(countOverflow).entries(8)[tag]; !ok {
+			t.Errorf("entry count overflow: entry %#x missing", tag)
+		}
+	}
+
+	entries := imageExifParse(valid).entries(8)
+	if orientation, ok := entries[imageExifTagOrient].uint(); !ok || orientation != 6 {
+		t.Errorf("orientation: got %d, want 6", orientation)
+	}
+	if dateTime := entries[imageExifTagDateTime].ascii(); dateTime != "2020:01:02 03:04:05" {
+		t.Errorf("date time: got %q", dateTime)
+	}
+
+	for _, tiff := range [][]byte{nil, []byte("II*\x00"), []byte("XX*\x00\x08\x00\x00\x00")} {
+		if imageExifParse(tiff) != nil {
+			t.Errorf("%q: not valid tiff parsed", tiff)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"logrus"
@@ -46,6 +47,7 @@ var ljGinLogger = &lumberjack.Logger{
 const (
 	logModMain              = "MAIN_MODDULE"
 	logModGinContext        = "GIN_CONTEXT"
+	logModGinAccess         = "GIN_ACCESS"
 	logModDBControl         = "DB_CONTROL"
 	logModInstituteMgmt     = "INSTITUTE_MGMT"
 	logModTeacherMgmt       = "TEACHER_MGMT"
@@ -56,11 +58,15 @@ const (
 	logModStudentMgmt       = "STUDENT_MGMT"
 	logModCloudMediaMgmt    = "CLOUDMEDIA_MGMT"
 	logModReferenceMgmt     = "REFERENCE_MGMT"
+	logModClassSessionMgmt  = "CLASS_SESSION_MGMT"
+	logModLessonCreditMgmt  = "LESSON_CREDIT_MGMT"
+	logModLeaveRequestMgmt  = "LEAVE_REQUEST_MGMT"
 )
 
 var logModEnabledTable = map[string]bool{
 	logModMain:              true,
 	logModGinContext:        true,
+	logModGinAccess:         true,
 	logModDBControl:         true,
 	logModInstituteMgmt:     true,
 	logModTeacherMgmt:       true,
@@ -71,11 +77,27 @@ var logModEnabledTable = map[string]bool{
 	logModStudentMgmt:       true,
 	logModCloudMediaMgmt:    true,
 	logModReferenceMgmt:     true,
+	logModClassSessionMgmt:  true,
+	logModLessonCreditMgmt:  true,
+	logModLeaveRequestMgmt:  true,
 }
 
 // Logging global customized logging module
 var logging *logrus.Logger
 
+// logging field names shared by request scoped entries
+const (
+	logFieldRequestID = "request_id"
+)
+
+// loggingWithContext returns a logging entry carrying request scoped fields (e.g. request id)
+func loggingWithContext(ctx context.Context) *logrus.Entry {
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		return logging.WithField(logFieldRequestID, requestID)
+	}
+	return logrus.NewEntry(logging)
+}
+
 func loggingCallerBeautifier(f *runtime.Frame) (funciton string, file string) {
 	var funcName = f.Function
 	var fileName = path.Base(f.File) + ":" + strconv.Itoa(f.Line)
@@ -129,6 +151,13 @@ func loggingRegisterModules(l *logrus.Logger, moduleTable map[string]bool) error
 	return nil
 }
 
+// loggingApplyModules enables/disables registered modules (unknown modules are ignored)
+func loggingApplyModules(l *logrus.Logger, moduleTable map[string]bool) {
+	for module, enabled := range moduleTable {
+		l.SetModuleEnabled(module, enabled)
+	}
+}
+
 func loggingErrRedirect(errFile string) error {
 	// rotate error log file
 	var errFileSize int64 = 0
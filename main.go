@@ -19,12 +19,11 @@ func main() {
 
 	// global serverConfig variable
 	var scErr error
-	serverConfig, scErr = readServerConfig(serverConfigFile)
+	serverConfig, scErr = loadServerConfig(serverConfigFile)
 	if scErr != nil {
 		fmt.Printf("Could not load server configuration\n")
 		panic(scErr)
 	}
-	initDefaultServerConfig(serverConfig)
 
 	// logging setup
 	var loggingErr error
@@ -33,12 +32,16 @@ func main() {
 		fmt.Printf("Could not register logging modules\n")
 		panic(loggingErr)
 	}
+	loggingApplyModules(logging, serverConfig.LoggingModules)
 	if loggingErr = loggingErrRedirect(errLogFile); loggingErr != nil {
 		fmt.Printf("Could not redirect logging error to %s\n", errLogFile)
 		panic(loggingErr)
 	}
 	logging.Infomln(logModMain, "Logging module loaded.")
 
+	// reload safe subset of server config on SIGHUP
+	serverConfigWatchSignal()
+
 	// db setup
 	var dbErr error
 	dbPool, dbErr = dbPoolInit(serverConfig)
@@ -63,49 +66,81 @@ func main() {
 		logging.Panicmf(logModMain, "Unable to load azure storage container - Error msg: %s", azureContainerErr.Error())
 	}
 	logging.Infomln(logModMain, "Azure storage container loaded.")
+	cloudMediaTieringStart()
+	cloudMediaVariantBackfillStart()
+
+	// metrics setup
+	metricsInit()
+	logging.Infomln(logModMain, "Metrics module loaded.")
 
 	// gin web framework
-	gin.SetMode(gin.DebugMode)
+	if serverConfig.LoggingReleaseMode {
+		gin.SetMode(gin.ReleaseMode)
+	} else {
+		gin.SetMode(gin.DebugMode)
+	}
 	gin.DefaultWriter = ljGinLogger
 	//gin.DefaultErrorWriter = ljErrLogger
 
 	r := gin.New()
-	r.Use(gin.Logger())
+	r.Use(ginRequestIDMiddleware())
+	r.Use(ginAccessLogMiddleware())
+	r.Use(ginMetricsMiddleware()) // outside recovery to count panicking requests as 500
 	r.Use(gin.Recovery())
 
 	// CORS middleware
 	r.Use(cors.New(cors.Config{
-		AllowOriginFunc: func(origin string) bool {
-			return true
-		},
+		AllowOriginFunc:  serverConfigAllowOrigin,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", ginHeaderRequestID, ginHeaderInstitutePID, ginHeaderAdminToken},
+		ExposeHeaders:    []string{"Content-Length", ginHeaderRequestID},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// tenant scope (caller's institute) for all api handlers
+	r.Use(ginTenantMiddleware())
+
 	debug.SetTraceback("crash")
 
-	// regiester config api handlers
+	// regiester config api handlers (scoped to caller's institute)
 	for apiURL, apiHandlerTable := range ginConfigAPITable {
 		for apiMethod, apiHandler := range apiHandlerTable {
+			var apiHandlers = []gin.HandlerFunc{ginTenantRequiredMiddleware(), apiHandler}
+			if ginConfigRelativeAPI[apiURL][apiMethod] {
+				apiHandlers = apiHandlers[1:]
+			}
 			switch apiMethod {
 			case "get":
-				r.GET(apiURL, apiHandler)
+				r.GET(apiURL, apiHandlers...)
 			case "post":
-				r.POST(apiURL, apiHandler)
+				r.POST(apiURL, apiHandlers...)
 			case "put":
-				r.PUT(apiURL, apiHandler)
+				r.PUT(apiURL, apiHandlers...)
 			case "delete":
-				r.DELETE(apiURL, apiHandler)
+				r.DELETE(apiURL, apiHandlers...)
 			}
 		}
 	}
 	// register workflow api handlers
 	for apiURL, apiHandler := range ginWorkflowAPITable {
-		r.POST(apiURL, apiHandler)
+		if ginWorkflowPublicAPI[apiURL] || ginWorkflowRelativeAPI[apiURL] {
+			r.POST(apiURL, apiHandler)
+		} else {
+			r.POST(apiURL, ginTenantRequiredMiddleware(), apiHandler)
+		}
+	}
+	// register metrics endpoint (separate listen address, or api port for admin token holders)
+	if serverConfig.MetricsListenAddress != "" {
+		metricsServe(serverConfig.MetricsListenAddress)
+	} else {
+		r.GET("/metrics", metricsHandler())
 	}
+	// register admin api handlers
+	r.POST("/api/0/admin/config/reload", serverConfigReloadHandler)
+	r.POST("/api/0/admin/media/stripmetadata", cloudMediaStripMetadataHandler)
+	r.GET("/api/0/workflow/student/qrcode", ginTenantRequiredMiddleware(), studentBindingQRCodeHandler)
+	r.GET("/api/0/calendar/:owner/:feed", scheduleCalendarFeedHandler)
 
 	if serverConfig.RunHTTPS {
 		logging.Infomf(logModMain, "HTTPS Server is listening on port %d", serverConfig.ServerHTTPSecurePort)
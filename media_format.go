@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"path"
+	"strings"
+)
+
+const mediaSniffSize = 512 // leading blob bytes read for format detection
+
+// media format detected from blob content
+type mediaFormat struct {
+	MediaType   string // cloud media type the format is allowed for
+	ContentType string
+	Extension   string
+	ImageFormat string // format name for metadata stripping (images only)
+}
+
+var (
+	// images are limited to formats whose location/device metadata can be stripped (no GIF/HEIC/HEIF/AVIF)
+	mediaFormatJPEG = mediaFormat{CloudMediaTypeImage, "image/jpeg", ".jpg", "jpeg"}
+	mediaFormatPNG  = mediaFormat{CloudMediaTypeImage, "image/png", ".png", "png"}
+	mediaFormatWebP = mediaFormat{CloudMediaTypeImage, "image/webp", ".webp", "webp"}
+	mediaFormatMP4  = mediaFormat{CloudMediaTypeVideo, "video/mp4", ".mp4", ""}
+	mediaFormatMOV  = mediaFormat{CloudMediaTypeVideo, "video/quicktime", ".mov", ""}
+	mediaFormat3GP  = mediaFormat{CloudMediaTypeVideo, "video/3gpp", ".3gp", ""}
+	mediaFormat3G2  = mediaFormat{CloudMediaTypeVideo, "video/3gpp2", ".3g2", ""}
+	mediaFormatWebM = mediaFormat{CloudMediaTypeVideo, "video/webm", ".webm", ""}
+	mediaFormatPDF  = mediaFormat{CloudMediaTypeOthers, "application/pdf", ".pdf", ""}
+	mediaFormatMP3  = mediaFormat{CloudMediaTypeOthers, "audio/mpeg", ".mp3", ""}
+	mediaFormatM4A  = mediaFormat{CloudMediaTypeOthers, "audio/mp4", ".m4a", ""}
+	mediaFormatWAV  = mediaFormat{CloudMediaTypeOthers, "audio/wav", ".wav", ""}
+)
+
+// ISO base media (ftyp box) brands of allowed formats
+var mediaFormatBrands = map[string]mediaFormat{
+	"isom": mediaFormatMP4,
+	"iso2": mediaFormatMP4,
+	"iso4": mediaFormatMP4,
+	"iso5": mediaFormatMP4,
+	"iso6": mediaFormatMP4,
+	"mp41": mediaFormatMP4,
+	"mp42": mediaFormatMP4,
+	"avc1": mediaFormatMP4,
+	"M4V ": mediaFormatMP4,
+	"dash": mediaFormatMP4,
+	"qt  ": mediaFormatMOV,
+	"3gp4": mediaFormat3GP,
+	"3gp5": mediaFormat3GP,
+	"3gp6": mediaFormat3GP,
+	"3gg6": mediaFormat3GP,
+	"3g2a": mediaFormat3G2,
+	"M4A ": mediaFormatM4A,
+	"M4B ": mediaFormatM4A,
+}
+
+// format of media by its leading bytes (magic numbers), false if format is unknown or not allowed
+func mediaSniffFormat(data []byte) (mediaFormat, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xFF\xD8\xFF")):
+		return mediaFormatJPEG, true
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1A\n")):
+		return mediaFormatPNG, true
+	case bytes.HasPrefix(data, []byte("\x1A\x45\xDF\xA3")):
+		return mediaFormatWebM, true
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return mediaFormatPDF, true
+	case bytes.HasPrefix(data, []byte("ID3")):
+		return mediaFormatMP3, true
+	case len(data) >= 2 && data[0] == 0xFF && (data[1] == 0xFB || data[1] == 0xF3 || data[1] == 0xF2): // mpeg audio frame
+		return mediaFormatMP3, true
+	case len(data) >= 12 && string(data[:4]) == "RIFF":
+		switch string(data[8:12]) {
+		case "WEBP":
+			return mediaFormatWebP, true
+		case "WAVE":
+			return mediaFormatWAV, true
+		}
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		// major brand, then compatible brands (within box and read data)
+		size := int(binary.BigEndian.Uint32(data))
+		if size < 16 || size > len(data) {
+			size = len(data)
+		}
+		for pos := 8; pos+4 <= size; pos += 4 {
+			if pos == 12 {
+				continue // minor version
+			}
+			if format, ok := mediaFormatBrands[string(data[pos:pos+4])]; ok {
+				return format, true
+			}
+		}
+	}
+	return mediaFormat{}, false
+}
+
+// declared content type (of client upload) does not contradict sniffed content type,
+// unspecific types are accepted, application types must match exactly
+func mediaContentTypeMatches(declared string, sniffed string) bool {
+	declaredType, _, err := mime.ParseMediaType(declared)
+	if err != nil || declaredType == "" || declaredType == "application/octet-stream" || declaredType == "binary/octet-stream" {
+		return true
+	}
+	if strings.HasPrefix(sniffed, "application/") {
+		return declaredType == sniffed
+	}
+	return strings.SplitN(declaredType, "/", 2)[0] == strings.SplitN(sniffed, "/", 2)[0]
+}
+
+// content disposition of media blob (images/videos shown inline, others downloaded as file)
+func mediaContentDisposition(blobName string, format mediaFormat) string {
+	if format.MediaType == CloudMediaTypeImage || format.MediaType == CloudMediaTypeVideo {
+		return "inline"
+	}
+	fileName := path.Base(blobName)
+	if !strings.EqualFold(path.Ext(fileName), format.Extension) {
+		fileName += format.Extension
+	}
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": fileName}); disposition != "" {
+		return disposition
+	}
+	return "attachment"
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"time"
+)
+
+const (
+	imageExifTagDateTime         = 0x0132 // IFD0, last change
+	imageExifTagExifIFD          = 0x8769 // IFD0, offset of exif sub-IFD
+	imageExifTagDateTimeOriginal = 0x9003 // exif sub-IFD, capture time
+	imageExifTagOffsetOriginal   = 0x9011 // exif sub-IFD, time zone of capture time (+hh:mm)
+	imageExifTimeLayout          = "2006:01:02 15:04:05"
+	mp4EpochOffset               = 2082844800       // seconds between 1904-01-01 (mp4 epoch) and 1970-01-01
+	mp4HeaderMaxCount            = 64               // top-level boxes searched for moov
+	mp4MoovMaxSize               = 16 * 1024 * 1024 // byte, larger moov boxes are not read
+)
+
+// capture metadata of image/video media (zero values if unknown)
+type mediaMetadata struct {
+	CaptureTS   int64
+	Width       int // pixel as displayed (orientation applied)
+	Height      int
+	Duration    float64 // second
+	Orientation int     // exif orientation (1-8)
+}
+
+// metadata of an image (JPEG/PNG/WebP), capture time without time zone is taken as server local time
+func mediaImageMetadata(data []byte) mediaMetadata {
+	var metadata mediaMetadata
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return metadata
+	}
+	metadata.Width, metadata.Height = config.Width, config.Height
+	metadata.Orientation = imageExifOrientation(data, format)
+	if metadata.Orientation >= 5 {
+		metadata.Width, metadata.Height = metadata.Height, metadata.Width
+	}
+
+	metadata.CaptureTS = mediaExifTime(mediaExifCaptureTime(imageExifParse(imageExifTIFF(data, format))))
+	return metadata
+}
+
+// exif capture time and its time zone offset (empty if not given), last change time if capture time is missing
+func mediaExifCaptureTime(exif *imageExif) (string, string) {
+	if exif == nil {
+		return "", ""
+	}
+	ifd0 := exif.entries(exif.firstIFD())
+	if exifIFD, ok := ifd0[imageExifTagExifIFD].uint(); ok {
+		subIFD := exif.entries(exifIFD)
+		if original := subIFD[imageExifTagDateTimeOriginal].ascii(); original != "" {
+			return original, subIFD[imageExifTagOffsetOriginal].ascii()
+		}
+	}
+	return ifd0[imageExifTagDateTime].ascii(), ""
+}
+
+// unix timestamp of exif date time (with optional +hh:mm offset), 0 if not valid
+func mediaExifTime(dateTime string, offset string) int64 {
+	if dateTime == "" {
+		return 0
+	}
+	var captureTime time.Time
+	var err error
+	if offset != "" {
+		captureTime, err = time.Parse(imageExifTimeLayout+"-07:00", dateTime+offset)
+	} else {
+		captureTime, err = time.ParseInLocation(imageExifTimeLayout, dateTime, time.Local)
+	}
+	if err != nil || captureTime.Year() < 1970 {
+		return 0
+	}
+	return captureTime.Unix()
+}
+
+// iterate mp4/mov boxes in data, stop if fn returns false
+func mp4Boxes(data []byte, fn func(boxType string, payload []byte) bool) {
+	for pos := 0; pos+8 <= len(data); {
+		size, header := int64(binary.BigEndian.Uint32(data[pos:])), 8
+		boxType := string(data[pos+4 : pos+8])
+		switch size {
+		case 0: // box extends to end of data
+			size = int64(len(data) - pos)
+		case 1: // 64-bit size follows box type
+			if pos+16 > len(data) {
+				return
+			}
+			size, header = int64(binary.BigEndian.Uint64(data[pos+8:])), 16
+		}
+		if size < int64(header) || size > int64(len(data)-pos) {
+			return
+		}
+		if !fn(boxType, data[pos+header:pos+int(size)]) {
+			return
+		}
+		pos += int(size)
+	}
+}
+
+// top-level mp4/mov box header (size including header, header length), false if not valid
+func mp4BoxHeader(data []byte) (string, int64, int64, bool) {
+	if len(data) < 8 {
+		return "", 0, 0, false
+	}
+	size, header := int64(binary.BigEndian.Uint32(data)), int64(8)
+	if size == 1 {
+		if len(data) < 16 {
+			return "", 0, 0, false
+		}
+		size, header = int64(binary.BigEndian.Uint64(data[8:])), 16
+	}
+	if size != 0 && size < header {
+		return "", 0, 0, false
+	}
+	return string(data[4:8]), size, header, true
+}
+
+// metadata of a video from its moov box payload (capture time from movie header, dimensions and rotation from video track)
+func mediaVideoMetadata(moov []byte) mediaMetadata {
+	var metadata mediaMetadata
+	mp4Boxes(moov, func(boxType string, payload []byte) bool {
+		switch boxType {
+		case "mvhd":
+			var creation, timescale, duration uint64
+			if len(payload) >= 32 && payload[0] == 1 {
+				creation = binary.BigEndian.Uint64(payload[4:])
+				timescale = uint64(binary.BigEndian.Uint32(payload[20:]))
+				duration = binary.BigEndian.Uint64(payload[24:])
+			} else if len(payload) >= 20 {
+				creation = uint64(binary.BigEndian.Uint32(payload[4:]))
+				timescale = uint64(binary.BigEndian.Uint32(payload[12:]))
+				duration = uint64(binary.BigEndian.Uint32(payload[16:]))
+			}
+			if creation > mp4EpochOffset {
+				metadata.CaptureTS = int64(creation - mp4EpochOffset)
+			}
+			if timescale > 0 {
+				metadata.Duration = float64(duration) / float64(timescale)
+			}
+		case "trak":
+			if metadata.Width == 0 && mp4IsVideoTrack(payload) {
+				metadata.Width, metadata.Height, metadata.Orientation = mp4TrackDisplay(payload)
+			}
+		}
+		return true
+	})
+	return metadata
+}
+
+// track has a video handler (trak/mdia/hdlr)
+func mp4IsVideoTrack(trak []byte) bool {
+	var video = false
+	mp4Boxes(trak, func(boxType string, payload []byte) bool {
+		if boxType == "mdia" {
+			mp4Boxes(payload, func(boxType string, payload []byte) bool {
+				if boxType == "hdlr" && len(payload) >= 12 {
+					video = string(payload[8:12]) == "vide"
+					return false
+				}
+				return true
+			})
+			return false
+		}
+		return true
+	})
+	return video
+}
+
+// displayed size and exif orientation of a video track (track header size and rotation matrix)
+func mp4TrackDisplay(trak []byte) (int, int, int) {
+	var width, height, orientation = 0, 0, 0
+	mp4Boxes(trak, func(boxType string, payload []byte) bool {
+		if boxType != "tkhd" {
+			return true
+		}
+		var matrix = 40 // version 0 (32-bit times)
+		if len(payload) > 0 && payload[0] == 1 {
+			matrix = 52
+		}
+		if len(payload) < matrix+44 {
+			return false
+		}
+		a := int32(binary.BigEndian.Uint32(payload[matrix:]))
+		b := int32(binary.BigEndian.Uint32(payload[matrix+4:]))
+		width = int(binary.BigEndian.Uint32(payload[matrix+36:]) >> 16)
+		height = int(binary.BigEndian.Uint32(payload[matrix+40:]) >> 16)
+		switch {
+		case a == 0 && b > 0: // rotate 90
+			orientation = 6
+		case a == 0 && b < 0: // rotate 270
+			orientation = 8
+		case a < 0: // rotate 180
+			orientation = 3
+		default:
+			orientation = 1
+		}
+		if orientation == 6 || orientation == 8 {
+			width, height = height, width
+		}
+		return false
+	})
+	return width, height, orientation
+}
+
+// image without location/device metadata (exif replaced by orientation and capture time, xmp/iptc/text removed), true if data changed
+func imageStripMetadata(data []byte, format string) ([]byte, bool) {
+	exif := imageExifParse(imageExifTIFF(data, format))
+	var orientation uint32
+	if exif != nil {
+		orientation, _ = exif.entries(exif.firstIFD())[imageExifTagOrient].uint()
+	}
+	captureTime, captureOffset := mediaExifCaptureTime(exif)
+	minimal := imageExifBuild(orientation, captureTime, captureOffset)
+
+	var stripped []byte
+	switch format {
+	case "jpeg":
+		stripped = imageStripJPEG(data, minimal)
+	case "png":
+		stripped = imageStripPNG(data, minimal)
+	case "webp":
+		stripped = imageStripWebP(data, minimal)
+	}
+	if stripped == nil || bytes.Equal(stripped, data) {
+		return data, false
+	}
+	return stripped, true
+}
+
+// minimal big-endian exif (orientation, capture time and its offset), nil if there is nothing to keep
+func imageExifBuild(orientation uint32, captureTime string, captureOffset string) []byte {
+	type exifEntry struct {
+		tag   uint16
+		typ   uint16
+		count uint32
+		value []byte // inline if up to 4 bytes
+	}
+	var ifd0, subIFD []exifEntry
+	if orientation >= 1 && orientation <= 8 {
+		ifd0 = append(ifd0, exifEntry{imageExifTagOrient, 3, 1, []byte{0, byte(orientation), 0, 0}})
+	}
+	if captureTime != "" {
+		subIFD = append(subIFD, exifEntry{imageExifTagDateTimeOriginal, 2, uint32(len(captureTime) + 1), append([]byte(captureTime), 0)})
+		if captureOffset != "" {
+			subIFD = append(subIFD, exifEntry{imageExifTagOffsetOriginal, 2, uint32(len(captureOffset) + 1), append([]byte(captureOffset), 0)})
+		}
+		ifd0 = append(ifd0, exifEntry{imageExifTagExifIFD, 4, 1, nil}) // sub-IFD offset set below
+	}
+	if len(ifd0) == 0 {
+		return nil
+	}
+
+	// layout: header, IFD0, sub-IFD, values longer than 4 bytes
+	ifd0Offset := 8
+	subIFDOffset := ifd0Offset + 2 + 12*len(ifd0) + 4
+	valueOffset := subIFDOffset
+	if len(subIFD) > 0 {
+		valueOffset += 2 + 12*len(subIFD) + 4
+	}
+	var tiff = []byte{'M', 'M', 0, 42, 0, 0, 0, byte(ifd0Offset)}
+	var values []byte
+	writeIFD := func(entries []exifEntry) {
+		tiff = append(tiff, mediaBigEndian16(uint16(len(entries)))...)
+		for _, entry := range entries {
+			tiff = append(tiff, mediaBigEndian16(entry.tag)...)
+			tiff = append(tiff, mediaBigEndian16(entry.typ)...)
+			tiff = append(tiff, mediaBigEndian32(entry.count)...)
+			switch {
+			case entry.tag == imageExifTagExifIFD:
+				tiff = append(tiff, mediaBigEndian32(uint32(subIFDOffset))...)
+			case len(entry.value) <= 4:
+				tiff = append(tiff, append(entry.value, make([]byte, 4-len(entry.value))...)...)
+			default:
+				tiff = append(tiff, mediaBigEndian32(uint32(valueOffset+len(values)))...)
+				values = append(values, entry.value...)
+			}
+		}
+		tiff = append(tiff, mediaBigEndian32(0)...) // no next IFD
+	}
+	writeIFD(ifd0)
+	if len(subIFD) > 0 {
+		writeIFD(subIFD)
+	}
+	return append(tiff, values...)
+}
+
+// jpeg without APP1 (exif/xmp), APP13 (iptc) and comment segments, minimal exif inserted after SOI/JFIF, nil if not valid
+func imageStripJPEG(data []byte, exif []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	var segments [][]byte
+	var pos = 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil
+		}
+		marker := data[pos+1]
+		if marker == 0xFF { // fill byte
+			pos++
+			continue
+		}
+		if marker == 0xDA { // start of scan, rest is image data
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil
+		}
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			segments = append(segments, data[pos:pos+2+length])
+		}
+		pos += 2 + length
+	}
+
+	var stripped = []byte{0xFF, 0xD8}
+	var insertAt = 0
+	if len(segments) > 0 && segments[0][1] == 0xE0 { // keep JFIF first
+		insertAt = 1
+	}
+	for i := 0; i <= len(segments); i++ {
+		if i == insertAt && exif != nil {
+			app1 := append([]byte("Exif\x00\x00"), exif...)
+			stripped = append(stripped, 0xFF, 0xE1)
+			stripped = append(stripped, mediaBigEndian16(uint16(len(app1)+2))...)
+			stripped = append(stripped, app1...)
+		}
+		if i < len(segments) {
+			stripped = append(stripped, segments[i]...)
+		}
+	}
+	return append(stripped, data[pos:]...)
+}
+
+// png without eXIf and text chunks, minimal exif inserted after IHDR, nil if not valid
+func imageStripPNG(data []byte, exif []byte) []byte {
+	if len(data) < 8 {
+		return nil
+	}
+	var stripped = append([]byte{}, data[:8]...)
+	for pos := 8; pos < len(data); {
+		if pos+12 > len(data) {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return nil
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		switch chunkType {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+		default:
+			stripped = append(stripped, data[pos:pos+12+length]...)
+		}
+		if chunkType == "IHDR" && exif != nil {
+			chunk := append([]byte("eXIf"), exif...)
+			stripped = append(stripped, mediaBigEndian32(uint32(len(exif)))...)
+			stripped = append(stripped, chunk...)
+			stripped = append(stripped, mediaBigEndian32(crc32.ChecksumIEEE(chunk))...)
+		}
+		pos += 12 + length
+	}
+	return stripped
+}
+
+// webp without EXIF/XMP chunks, minimal exif appended (extended format only), nil if not valid
+func imageStripWebP(data []byte, exif []byte) []byte {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil
+	}
+	var stripped = append([]byte{}, data[:12]...)
+	var extended = -1 // position of VP8X flags
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return nil
+		}
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + length + length%2
+		if length < 0 || end > len(data) {
+			return nil
+		}
+		chunkType := string(data[pos : pos+4])
+		if chunkType != "EXIF" && chunkType != "XMP " {
+			if chunkType == "VP8X" {
+				extended = len(stripped) + 8
+			}
+			stripped = append(stripped, data[pos:end]...)
+		}
+		pos = end
+	}
+	if extended < 0 || extended >= len(stripped) {
+		return stripped // simple format carries no metadata
+	}
+	stripped[extended] &^= 0x0C // exif and xmp flags
+	if exif != nil {
+		stripped[extended] |= 0x08
+		stripped = append(stripped, 'E', 'X', 'I', 'F')
+		stripped = append(stripped, mediaLittleEndian32(uint32(len(exif)))...)
+		stripped = append(stripped, exif...)
+		if len(exif)%2 == 1 {
+			stripped = append(stripped, 0)
+		}
+	}
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+	return stripped
+}
+
+// big-endian and little-endian bytes of integers (exif, png and webp data)
+func mediaBigEndian16(value uint16) []byte {
+	var data = make([]byte, 2)
+	binary.BigEndian.PutUint16(data, value)
+	return data
+}
+
+func mediaBigEndian32(value uint32) []byte {
+	var data = make([]byte, 4)
+	binary.BigEndian.PutUint32(data, value)
+	return data
+}
+
+func mediaLittleEndian32(value uint32) []byte {
+	var data = make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, value)
+	return data
+}
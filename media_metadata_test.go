@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"strings"
+	"testing"
+)
+
+// testBox one mp4 box with 32-bit size
+func testBox(boxType string, payload []byte) []byte {
+	return append(append(mediaBigEndian32(uint32(8+len(payload))), boxType...), payload...)
+}
+
+func TestMp4Boxes(t *testing.T) {
+	largeBox := append(append(mediaBigEndian32(1), "mdat"...), make([]byte, 8)...)
+	binary.BigEndian.PutUint64(largeBox[8:], 20)
+	largeBox = append(largeBox, "data"...)
+	negativeBox := append(append(mediaBigEndian32(1), "mdat"...), 0xFF, 0, 0, 0, 0, 0, 0, 0x10)
+
+	var cases = []struct {
+		name  string
+		data  []byte
+		stop  string // box type to stop at
+		types []string
+	}{
+		{"two boxes", append(testBox("ftyp", []byte("isom")), testBox("moov", nil)...), "", []string{"ftyp", "moov"}},
+		{"size zero extends to end", append(testBox("ftyp", nil), append(mediaBigEndian32(0), "mdat1234"...)...), "", []string{"ftyp", "mdat"}},
+		{"64-bit size", largeBox, "", []string{"mdat"}},
+		{"64-bit size truncated", largeBox[:12], "", nil},
+		{"64-bit size negative", negativeBox, "", nil},
+		{"size smaller than header", append(mediaBigEndian32(4), "free"...), "", nil},
+		{"size beyond data", append(testBox("ftyp", nil), append(mediaBigEndian32(100), "moov"...)...), "", []string{"ftyp"}},
+		{"header truncated", append(testBox("ftyp", nil), 0, 0, 0), "", []string{"ftyp"}},
+		{"stop at box", append(testBox("ftyp", nil), testBox("moov", nil)...), "ftyp", []string{"ftyp"}},
+		{"empty", nil, "", nil},
+	}
+	for _, c := range cases {
+		var types []string
+		mp4Boxes(c.data, func(boxType string, payload []byte) bool {
+			types = append(types, boxType)
+			return boxType != c.stop
+		})
+		if strings.Join(types, ",") != strings.Join(c.types, ",") {
+			t.Errorf("%s: got boxes %v, want %v", c.name, types, c.types)
+		}
+	}
+
+	// truncated nested boxes never panic
+	moov := testBox("moov", append(testBox("mvhd", make([]byte, 100)), testBox("trak", testBox("tkhd", make([]byte, 84)))...))
+	for end := 0; end < len(moov); end++ {
+		mediaVideoMetadata(moov[:end])
+	}
+}
+
+func TestImageExifBuild(t *testing.T) {
+	var cases = []struct {
+		name          string
+		orientation   uint32
+		captureTime   string
+		captureOffset string
+		empty         bool
+	}{
+		{"orientation only", 6, "", "", false},
+		{"capture time only", 0, "2021:03:04 05:06:07", "", false},
+		{"all", 8, "2021:03:04 05:06:07", "+08:00", false},
+		{"offset without time", 3, "", "+08:00", false},
+		{"orientation out of range", 9, "", "", true},
+		{"nothing to keep", 0, "", "+08:00", true},
+	}
+	for _, c := range cases {
+		tiff := imageExifBuild(c.orientation, c.captureTime, c.captureOffset)
+		if c.empty {
+			if tiff != nil {
+				t.Errorf("%s: got %d bytes exif, want none", c.name, len(tiff))
+			}
+			continue
+		}
+		exif := imageExifParse(tiff)
+		if exif == nil {
+			t.Fatalf("%s: built exif not parsed", c.name)
+		}
+		var wantOrientation = c.orientation
+		if wantOrientation < 1 || wantOrientation > 8 {
+			wantOrientation = 0
+		}
+		if orientation, _ := exif.entries(exif.firstIFD())[imageExifTagOrient].uint(); orientation != wantOrientation {
+			t.Errorf("%s: got orientation %d, want %d", c.name, orientation, wantOrientation)
+		}
+		var wantOffset = c.captureOffset
+		if c.captureTime == "" {
+			wantOffset = ""
+		}
+		if captureTime, captureOffset := mediaExifCaptureTime(exif); captureTime != c.captureTime || captureOffset != wantOffset {
+			t.Errorf("%s: got capture time %q %q, want %q %q", c.name, captureTime, captureOffset, c.captureTime, wantOffset)
+		}
+	}
+}
+
+// testExifWithGPS exif with orientation, capture time and a GPS IFD pointer (private data to be stripped)
+func testExifWithGPS() []byte {
+	tiff := imageExifBuild(6, "2021:03:04 05:06:07", "+08:00")
+	return append(tiff, []byte("GPS 52.5200N 13.4050E")...)
+}
+
+func TestImageStripMetadata(t *testing.T) {
+	minimal := imageExifBuild(6, "2021:03:04 05:06:07", "+08:00")
+	var samples = []struct {
+		format string
+		data   []byte
+		strip  func([]byte, []byte) []byte
+		decode bool
+	}{
+		{"jpeg", testJPEG(t, testExifWithGPS()), imageStripJPEG, true},
+		{"png", testPNG(t, testExifWithGPS()), imageStripPNG, true},
+		{"webp", testWebP(testExifWithGPS()), imageStripWebP, false},
+	}
+	for _, s := range samples {
+		stripped, changed := imageStripMetadata(s.data, s.format)
+		if !changed {
+			t.Fatalf("%s: metadata not stripped", s.format)
+		}
+		for _, private := range []string{"GPS", "device serial", "xmpmeta"} {
+			if bytes.Contains(stripped, []byte(private)) {
+				t.Errorf("%s: %q kept", s.format, private)
+			}
+		}
+		if got := imageExifTIFF(stripped, s.format); !bytes.Equal(got, minimal) {
+			t.Errorf("%s: got %d bytes exif, want minimal %d bytes", s.format, len(got), len(minimal))
+		}
+		if s.decode {
+			if _, _, err := image.Decode(bytes.NewReader(stripped)); err != nil {
+				t.Errorf("%s: stripped image not decoded: %s", s.format, err.Error())
+			}
+		}
+
+		// stripping again changes nothing
+		if _, changed = imageStripMetadata(stripped, s.format); changed {
+			t.Errorf("%s: stripped image changed again", s.format)
+		}
+
+		// truncated data never panics
+		for end := 0; end < len(s.data); end++ {
+			s.strip(s.data[:end], minimal)
+		}
+	}
+}
+
+func TestImageStripMalformed(t *testing.T) {
+	jpegData := testJPEG(t, testExifWithGPS())
+	jpegOverflow := append([]byte{}, jpegData...)
+	binary.BigEndian.PutUint16(jpegOverflow[4:], 0xFFFF)
+	pngData := testPNG(t, testExifWithGPS())
+	pngOverflow := append([]byte{}, pngData...)
+	binary.BigEndian.PutUint32(pngOverflow[33:], 0xFFFFFFF0)
+	webpData := testWebP(testExifWithGPS())
+	webpOverflow := append([]byte{}, webpData...)
+	binary.LittleEndian.PutUint32(webpOverflow[16:], 0xFFFFFFF0)
+	webpSimple := append([]byte("RIFF\x0E\x00\x00\x00WEBP"), testWebPChunk("VP8L", []byte{0x2F, 3})...)
+
+	var cases = []struct {
+		name  string
+		data  []byte
+		strip func([]byte, []byte) []byte
+		valid bool
+	}{
+		{"jpeg no SOI", jpegData[2:], imageStripJPEG, false},
+		{"jpeg segment overflow", jpegOverflow, imageStripJPEG, false},
+		{"jpeg no start of scan", jpegData[:40], imageStripJPEG, false},
+		{"png too short", pngData[:4], imageStripPNG, false},
+		{"png chunk overflow", pngOverflow, imageStripPNG, false},
+		{"png truncated chunk", pngData[:len(pngData)-3], imageStripPNG, false},
+		{"webp no RIFF", append([]byte("RIFX"), webpData[4:]...), imageStripWebP, false},
+		{"webp chunk overflow", webpOverflow, imageStripWebP, false},
+		{"webp truncated chunk header", webpData[:len(webpData)-3], imageStripWebP, false},
+		{"webp simple format", webpSimple, imageStripWebP, true},
+	}
+	for _, c := range cases {
+		if got := c.strip(c.data, nil); (got != nil) != c.valid {
+			t.Errorf("%s: got valid %v, want %v", c.name, got != nil, c.valid)
+		}
+	}
+}
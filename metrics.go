@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const metricsNamespace = "klog"
+
+var (
+	metricsHTTPRequestTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests handled, partitioned by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	metricsHTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency, partitioned by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	metricsDBOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "mongodb",
+		Name:      "operation_duration_seconds",
+		Help:      "MongoDB command latency, partitioned by collection, command and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"collection", "command", "result"})
+
+	metricsStorageOperationTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "storage",
+		Name:      "operations_total",
+		Help:      "Number of blob storage operations, partitioned by operation and result.",
+	}, []string{"operation", "result"})
+
+	metricsStorageUploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "storage",
+		Name:      "uploaded_bytes_total",
+		Help:      "Number of bytes uploaded to blob storage.",
+	})
+
+	metricsBindingCodeIssuedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "binding",
+		Name:      "codes_issued_total",
+		Help:      "Number of student binding codes issued.",
+	})
+
+	metricsBindingCodeRedeemedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "binding",
+		Name:      "codes_redeemed_total",
+		Help:      "Number of student binding code redemption attempts, partitioned by result.",
+	}, []string{"result"})
+)
+
+const (
+	metricsResultSuccess  = "success"
+	metricsResultError    = "error"
+	metricsResultNotFound = "not_found"
+	metricsResultExpired  = "expired"
+	metricsResultConflict = "conflict"
+	metricsResultLimited  = "limited"
+)
+
+func metricsInit() {
+	prometheus.MustRegister(
+		metricsHTTPRequestTotal,
+		metricsHTTPRequestDuration,
+		metricsDBOperationDuration,
+		metricsStorageOperationTotal,
+		metricsStorageUploadBytes,
+		metricsBindingCodeIssuedTotal,
+		metricsBindingCodeRedeemedTotal,
+	)
+}
+
+// metricsHandler exposes all registered metrics (prometheus text format) to admin token holders
+func metricsHandler() gin.HandlerFunc {
+	handler := promhttp.Handler()
+	return func(ctx *gin.Context) {
+		if !ginContextIsAdmin(ctx) {
+			ctx.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(ctx.Writer, ctx.Request)
+	}
+}
+
+// metricsServe exposes metrics without auth on a separate (internal) listen address
+func metricsServe(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		logging.Infomf(logModMain, "Metrics server is listening on %s", address)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			logging.Errormf(logModMain, "Metrics server stopped: %s", err.Error())
+		}
+	}()
+}
+
+// ginMetricsMiddleware records request count and latency per route/status
+func ginMetricsMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		startTime := time.Now()
+		ctx.Next()
+
+		// use the registered route pattern to keep label cardinality bounded
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(ctx.Writer.Status())
+		metricsHTTPRequestTotal.WithLabelValues(ctx.Request.Method, route, status).Inc()
+		metricsHTTPRequestDuration.WithLabelValues(ctx.Request.Method, route, status).Observe(time.Since(startTime).Seconds())
+	}
+}
+
+// dbCommandMonitor times every mongo command and labels it with the target collection
+func dbCommandMonitor() *event.CommandMonitor {
+	var pendingCommands sync.Map // request id -> collection name
+
+	finished := func(evt *event.CommandFinishedEvent, result string) {
+		collection := "unknown"
+		if value, ok := pendingCommands.Load(evt.RequestID); ok {
+			collection = value.(string)
+			pendingCommands.Delete(evt.RequestID)
+		}
+		metricsDBOperationDuration.WithLabelValues(collection, evt.CommandName, result).Observe(float64(evt.DurationNanos) / float64(time.Second))
+	}
+
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			// the first command element holds the collection name for CRUD commands (e.g. {"find": "student", ...})
+			collection := evt.DatabaseName
+			if element, err := evt.Command.IndexErr(0); err == nil {
+				if name, ok := element.Value().StringValueOK(); ok {
+					collection = name
+				}
+			}
+			pendingCommands.Store(evt.RequestID, collection)
+		},
+		Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+			finished(&evt.CommandFinishedEvent, metricsResultSuccess)
+		},
+		Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+			finished(&evt.CommandFinishedEvent, metricsResultError)
+		},
+	}
+}
+
+// metricsStorageOperation counts a blob storage operation by result
+func metricsStorageOperation(operation string, err error) {
+	if err != nil {
+		metricsStorageOperationTotal.WithLabelValues(operation, metricsResultError).Inc()
+	} else {
+		metricsStorageOperationTotal.WithLabelValues(operation, metricsResultSuccess).Inc()
+	}
+}
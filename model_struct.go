@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -32,51 +34,282 @@ type Teacher struct {
 	InstitutePID primitive.ObjectID `json:"institute_pid" bson:"institute_pid"`
 }
 
-// CourseTarget struct
+// TeacherLoginResp struct (teacher with auth token for Authorization header)
+type TeacherLoginResp struct {
+	*Teacher
+	AuthToken   string `json:"auth_token"`
+	TokenExpire int64  `json:"token_expire"` // unix seconds
+}
+
+// CourseTarget struct (one target of a course curriculum)
 type CourseTarget struct {
-	Tag  string `json:"tag" bson:"tag"`
-	Desc string `json:"desc" bson:"desc"`
+	Tag     string `json:"tag" bson:"tag"`
+	Desc    string `json:"desc" bson:"desc"`
+	Level   int    `json:"level" bson:"level"`     // curriculum level, 0 for unleveled
+	Order   int    `json:"order" bson:"order"`     // order within level
+	Retired bool   `json:"retired" bson:"retired"` // kept for existing records, not used by new ones
+}
+
+// CurriculumVersion struct (snapshot of course targets, a new version is kept whenever targets change)
+type CurriculumVersion struct {
+	PID          primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	CoursePID    primitive.ObjectID `json:"course_pid" bson:"course_pid"`
+	Version      int                `json:"version" bson:"version"`
+	Targets      []CourseTarget     `json:"targets" bson:"targets"`
+	CreateTS     int64              `json:"create_ts" bson:"create_ts"`
+	InstitutePID primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of course (tenant scope)
+}
+
+// CurriculumCloneReq struct (copy curriculum of a course into another course, also across institutes)
+type CurriculumCloneReq struct {
+	SourceCoursePID primitive.ObjectID `json:"source_course_pid"`
+	SourceVersion   int                `json:"source_version"` // current version if 0
+	TargetCoursePID primitive.ObjectID `json:"target_course_pid"`
+	IncludeRetired  bool               `json:"include_retired"`
+	CloneRubric     bool               `json:"clone_rubric"`
+}
+
+// CourseStaff struct (one teacher of a course with role, effective from start to end, end 0 for open-ended)
+type CourseStaff struct {
+	TeacherPID primitive.ObjectID `json:"teacher_pid" bson:"teacher_pid"`
+	Role       string             `json:"role" bson:"role"`
+	StartTS    int64              `json:"start_ts" bson:"start_ts"`
+	EndTS      int64              `json:"end_ts" bson:"end_ts"`
+}
+
+// RubricLevel struct (one score of a course rubric, e.g. 3 "meets target")
+type RubricLevel struct {
+	Score int    `json:"score" bson:"score"`
+	Label string `json:"label" bson:"label"`
 }
 
 // Course struct
 type Course struct {
-	PID           primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
-	CourseUID     string             `json:"course_uid" bson:"course_uid"`
-	CourseName    string             `json:"course_name" bson:"course_name"`
-	CourseIntro   string             `json:"course_intro" bson:"course_intro"`
-	CourseTargets []CourseTarget     `json:"course_targets" bson:"course_targets"`
-	TeacherPID    primitive.ObjectID `json:"teacher_pid" bson:"teacher_pid"`
-	AssistantPID  primitive.ObjectID `json:"assistant_pid" bson:"assistant_pid"`
-	InstitutePID  primitive.ObjectID `json:"institute_pid" bson:"institute_pid"`
+	PID               primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	CourseUID         string             `json:"course_uid" bson:"course_uid"`
+	CourseName        string             `json:"course_name" bson:"course_name"`
+	CourseIntro       string             `json:"course_intro" bson:"course_intro"`
+	CourseTargets     []CourseTarget     `json:"course_targets" bson:"course_targets"`
+	Rubric            []RubricLevel      `json:"rubric" bson:"rubric"`                         // scores of target assessments, empty for default rubric (1-5)
+	CurriculumVersion int                `json:"curriculum_version" bson:"curriculum_version"` // version of course targets
+	TeacherPID        primitive.ObjectID `json:"teacher_pid" bson:"teacher_pid"`
+	AssistantPID      primitive.ObjectID `json:"assistant_pid" bson:"assistant_pid"`
+	Staff             []CourseStaff      `json:"staff" bson:"staff"` // staffing history, teacher/assistant PID are kept on it
+	InstitutePID      primitive.ObjectID `json:"institute_pid" bson:"institute_pid"`
+}
+
+// CourseSchedule struct (weekly recurrence within a term, teacher/assistant taken from course)
+type CourseSchedule struct {
+	PID             primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	CoursePID       primitive.ObjectID `json:"course_pid" bson:"course_pid"`
+	Weekdays        []int              `json:"weekdays" bson:"weekdays"`             // 0 (sunday) - 6 (saturday)
+	IntervalWeeks   int                `json:"interval_weeks" bson:"interval_weeks"` // 1 for every week, 2 for every other week ...
+	StartTime       string             `json:"start_time" bson:"start_time"`         // HH:MM (local time of time zone)
+	DurationMinutes int                `json:"duration_minutes" bson:"duration_minutes"`
+	TimeZone        string             `json:"time_zone" bson:"time_zone"`         // IANA time zone name, empty for server local time
+	TermStart       string             `json:"term_start" bson:"term_start"`       // YYYY-MM-DD
+	TermEnd         string             `json:"term_end" bson:"term_end"`           // YYYY-MM-DD
+	Holidays        []string           `json:"holidays" bson:"holidays"`           // YYYY-MM-DD, no class on these days
+	Cancellations   []string           `json:"cancellations" bson:"cancellations"` // YYYY-MM-DD, cancelled occurrences
+	Location        string             `json:"location" bson:"location"`
+	UpdateTS        int64              `json:"update_ts" bson:"update_ts"`
+	InstitutePID    primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of course (tenant scope)
+}
+
+// ScheduleOccurrence struct (one expanded class meeting of a course schedule)
+type ScheduleOccurrence struct {
+	SchedulePID  primitive.ObjectID `json:"schedule_pid"`
+	CoursePID    primitive.ObjectID `json:"course_pid"`
+	CourseName   string             `json:"course_name"`
+	TeacherPID   primitive.ObjectID `json:"teacher_pid"`   // lead (or substitute) staff at start
+	AssistantPID primitive.ObjectID `json:"assistant_pid"` // first assistant staff at start
+	Staff        []CourseStaff      `json:"staff"`         // all staff at start
+	Date         string             `json:"date"`
+	StartTS      int64              `json:"start_ts"`
+	EndTS        int64              `json:"end_ts"`
+	Location     string             `json:"location"`
+	Cancelled    bool               `json:"cancelled"`
+}
+
+// ScheduleQueryReq struct (one of teacher/student/relative PID)
+type ScheduleQueryReq struct {
+	OwnerType    string             `json:"owner_type"`
+	OwnerPID     primitive.ObjectID `json:"owner_pid"`
+	Days         int                `json:"days"`
+	RelativeWXID string             `json:"relative_wxid"` // caller of feed url request (relative or bound student owner)
+}
+
+// ScheduleCancelReq struct
+type ScheduleCancelReq struct {
+	SchedulePID primitive.ObjectID `json:"schedule_pid"`
+	Date        string             `json:"date"`
+	Restore     bool               `json:"restore"`
 }
 
 // Student struct
 type Student struct {
-	PID              primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
-	StudentName      string             `json:"student_name" bson:"student_name"`
-	StudentImageName string             `json:"student_image_name" bson:"student_image_name"`
-	StudentImageURL  string             `json:"student_image_url" bson:"student_image_url"`
-	BindingCode      string             `json:"binding_code" bson:"binding_code"`
-	BindingExpire    int64              `json:"binding_expire" bson:"binding_expire"`
+	PID                  primitive.ObjectID    `json:"pid" bson:"_id,omitempty"`
+	StudentName          string                `json:"student_name" bson:"student_name"`
+	StudentImageName     string                `json:"student_image_name" bson:"student_image_name"`
+	StudentImageURL      string                `json:"student_image_url" bson:"student_image_url"`
+	InstitutePID         primitive.ObjectID    `json:"institute_pid" bson:"institute_pid"`
+	Birthdate            string                `json:"birthdate" bson:"birthdate"` // YYYY-MM-DD, empty if unknown
+	Gender               string                `json:"gender" bson:"gender"`       // empty if not given
+	Allergies            string                `json:"allergies" bson:"allergies"`
+	Notes                string                `json:"notes" bson:"notes"` // staff only
+	EmergencyContacts    []EmergencyContact    `json:"emergency_contacts" bson:"emergency_contacts"`
+	Status               string                `json:"status" bson:"status"`                                 // lifecycle status, empty for students older than lifecycle (active)
+	StatusTS             int64                 `json:"status_ts" bson:"status_ts"`                           // last status change
+	StatusHistory        []StudentStatusEvent  `json:"status_history" bson:"status_history"`                 // status changes, oldest first
+	StudentImageVersion  int64                 `json:"student_image_version" bson:"student_image_version"`   // increased by every image upload, part of image blob names
+	StudentImageVariants []StudentImageVariant `json:"student_image_variants" bson:"student_image_variants"` // resized images of upload, largest first
+}
+
+// StudentImageVariant struct (one standard size of an uploaded student image)
+type StudentImageVariant struct {
+	Size      int    `json:"size" bson:"size"` // pixel, square image
+	ImageName string `json:"image_name" bson:"image_name"`
+	ImageURL  string `json:"image_url" bson:"image_url"`
+}
+
+// EmergencyContact struct (person to call for a student if relatives cannot be reached)
+type EmergencyContact struct {
+	Name        string `json:"name" bson:"name"`
+	Relation    string `json:"relation" bson:"relation"`
+	PhoneNumber string `json:"phone_number" bson:"phone_number"`
+}
+
+// StudentRelativeView struct (student fields visible to relatives, staff-only fields left out)
+type StudentRelativeView struct {
+	PID               primitive.ObjectID `json:"pid"`
+	StudentName       string             `json:"student_name"`
+	StudentImageURL   string             `json:"student_image_url"`
+	StudentImageSizes map[int]string     `json:"student_image_sizes"` // image URL by size
+	InstitutePID      primitive.ObjectID `json:"institute_pid"`
+	Birthdate         string             `json:"birthdate"`
+	Gender            string             `json:"gender"`
+	Allergies         string             `json:"allergies"`
+	EmergencyContacts []EmergencyContact `json:"emergency_contacts"`
+	Status            string             `json:"status"`
+}
+
+// StudentStatusEvent struct (one lifecycle status change of a student)
+type StudentStatusEvent struct {
+	Status   string `json:"status" bson:"status"`
+	ChangeTS int64  `json:"change_ts" bson:"change_ts"`
+	Note     string `json:"note" bson:"note"`
+}
+
+// StudentStatusReq struct
+type StudentStatusReq struct {
+	StudentPID primitive.ObjectID `json:"student_pid"`
+	Status     string             `json:"status"`
+	Note       string             `json:"note"`
 }
 
 // Relative struct
 type Relative struct {
-	PID          primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
-	RelativeName string             `json:"relative_name" bson:"relative_name"`
-	RelativeWXID string             `json:"relative_wxid" bson:"relative_wxid"`
-	PhoneNumber  string             `json:"phone_number" bson:"phone_number"`
-	Email        string             `json:"email" bson:"email"`
+	PID           primitive.ObjectID   `json:"pid" bson:"_id,omitempty"`
+	RelativeName  string               `json:"relative_name" bson:"relative_name"`
+	RelativeWXID  string               `json:"relative_wxid" bson:"relative_wxid"`
+	PhoneNumber   string               `json:"phone_number" bson:"phone_number"`
+	Email         string               `json:"email" bson:"email"`
+	InstitutePIDs []primitive.ObjectID `json:"institute_pids" bson:"institute_pids"` // institutes of bound students (tenant scope)
 }
 
 // CourseRecord struct
 type CourseRecord struct {
-	PID        primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	PID               primitive.ObjectID   `json:"pid" bson:"_id,omitempty"`
+	StudentPID        primitive.ObjectID   `json:"student_pid" bson:"student_pid"`
+	CoursePID         primitive.ObjectID   `json:"course_pid" bson:"course_pid"`
+	TargetTag         string               `json:"target_tag" bson:"target_tag"`
+	RecordTS          int64                `json:"record_ts" bson:"record_ts"`
+	IsMakeUp          bool                 `json:"is_makeup" bson:"is_makeup"`
+	SessionPID        primitive.ObjectID   `json:"session_pid" bson:"session_pid"` // nil for records created without class session
+	Attendance        string               `json:"attendance" bson:"attendance"`
+	Targets           []CourseRecordTarget `json:"targets" bson:"targets"`                       // assessed course targets
+	CurriculumVersion int                  `json:"curriculum_version" bson:"curriculum_version"` // course curriculum version when created (0 for older records)
+	InstitutePID      primitive.ObjectID   `json:"institute_pid" bson:"institute_pid"`           // institute of course (tenant scope)
+}
+
+// CourseRecordTarget struct (assessment of one course target in a course record)
+type CourseRecordTarget struct {
+	Tag   string `json:"tag" bson:"tag"`
+	Score int    `json:"score" bson:"score"` // score of course rubric
+	Note  string `json:"note" bson:"note"`
+}
+
+// StudentProgressReq struct
+type StudentProgressReq struct {
+	StudentPID   primitive.ObjectID `json:"student_pid"`
+	CoursePID    primitive.ObjectID `json:"course_pid"` // all enrolled courses if empty
+	StartTS      int64              `json:"start_ts"`
+	EndTS        int64              `json:"end_ts"`        // now if empty
+	RelativeWXID string             `json:"relative_wxid"` // relative caller (staff callers send auth token instead)
+}
+
+// CourseProgress struct (per-target progress of a student in a course)
+type CourseProgress struct {
+	CoursePID  primitive.ObjectID `json:"course_pid"`
+	CourseName string             `json:"course_name"`
+	Rubric     []RubricLevel      `json:"rubric"`
+	Targets    []*TargetProgress  `json:"targets"`
+}
+
+// TargetProgress struct (scores of one course target over time)
+type TargetProgress struct {
+	Tag     string           `json:"tag"`
+	Desc    string           `json:"desc"`
+	Level   int              `json:"level"`
+	Retired bool             `json:"retired"`
+	Points  []*ProgressPoint `json:"points"` // oldest first
+	Average float64          `json:"average"`
+	Latest  int              `json:"latest"`
+	Trend   float64          `json:"trend"` // least squares slope, score change per 30 days
+}
+
+// ProgressPoint struct
+type ProgressPoint struct {
+	RecordPID primitive.ObjectID `json:"record_pid"`
+	RecordTS  int64              `json:"record_ts"`
+	Score     int                `json:"score"`
+}
+
+// ClassSession struct (one class meeting, course records of attending students are created together)
+type ClassSession struct {
+	PID          primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	CoursePID    primitive.ObjectID `json:"course_pid" bson:"course_pid"`
+	TeacherPID   primitive.ObjectID `json:"teacher_pid" bson:"teacher_pid"`
+	TargetTag    string             `json:"target_tag" bson:"target_tag"`
+	StartTS      int64              `json:"start_ts" bson:"start_ts"`
+	EndTS        int64              `json:"end_ts" bson:"end_ts"`
+	CreateTS     int64              `json:"create_ts" bson:"create_ts"`
+	InstitutePID primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of course (tenant scope)
+}
+
+// ClassSessionAttendance struct
+type ClassSessionAttendance struct {
 	StudentPID primitive.ObjectID `json:"student_pid" bson:"student_pid"`
-	CoursePID  primitive.ObjectID `json:"course_pid" bson:"course_pid"`
-	TargetTag  string             `json:"target_tag" bson:"target_tag"`
-	RecordTS   int64              `json:"record_ts" bson:"record_ts"`
-	IsMakeUp   bool               `json:"is_makeup" bson:"is_makeup"`
+	Attendance string             `json:"attendance" bson:"attendance"`
+}
+
+// ClassSessionCreateReq struct (students not listed in attendance are present)
+type ClassSessionCreateReq struct {
+	ClassSession `bson:",inline"`
+	Attendances  []ClassSessionAttendance `json:"attendances" bson:"attendances"`
+}
+
+// ClassSessionAttendanceReq struct
+type ClassSessionAttendanceReq struct {
+	SessionPID  primitive.ObjectID       `json:"session_pid" bson:"session_pid"`
+	Attendances []ClassSessionAttendance `json:"attendances" bson:"attendances"`
+}
+
+// ClassSessionDetail struct
+type ClassSessionDetail struct {
+	Session *ClassSession   `json:"session"`
+	Records []*CourseRecord `json:"records"`
+	Media   []*CloudMedia   `json:"media"`
 }
 
 // CourseComment struct
@@ -87,20 +320,77 @@ type CourseComment struct {
 	CommentPersonType string             `json:"comment_person_type" bson:"comment_person_type"`
 	CommentTS         int64              `json:"comment_ts" bson:"comment_ts"`
 	CommentBody       string             `json:"comment_body" bson:"comment_body"`
+	StaffRole         string             `json:"staff_role,omitempty" bson:"staff_role,omitempty"` // course staff role of teacher at record time
+	InstitutePID      primitive.ObjectID `json:"institute_pid" bson:"institute_pid"`               // institute of course record (tenant scope)
 }
 
 // CloudMedia struct
 type CloudMedia struct {
-	PID             primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
-	StudentPID      primitive.ObjectID `json:"student_pid" bson:"student_pid"`
-	CourseRecordPID primitive.ObjectID `json:"course_record_pid" bson:"course_record_pid"`
-	MediaType       string             `json:"media_type" bson:"media_type"`
-	MediaName       string             `json:"media_name" bson:"media_name"`
-	MediaURL        string             `json:"media_url" bson:"media_url"`
-	RankScore       float64            `json:"rank_score" bson:"rank_score"`
-	MediaTags       []string           `json:"media_tags" bson:"media_tags"`
-	CreateTS        int64              `json:"create_ts" bson:"create_ts"`
-	ContentLength   int64              `json:"content_length" bson:"content_length"`
+	PID                  primitive.ObjectID           `json:"pid" bson:"_id,omitempty"`
+	StudentPID           primitive.ObjectID           `json:"student_pid" bson:"student_pid"`     // first linked student
+	StudentLinks         []CloudMediaStudentLink      `json:"student_links" bson:"student_links"` // students of (group) media, null for media created before group media (student_pid only)
+	CourseRecordPID      primitive.ObjectID           `json:"course_record_pid" bson:"course_record_pid"`
+	SessionPID           primitive.ObjectID           `json:"session_pid" bson:"session_pid"` // session media (student pid nil) is shared by attending students
+	MediaType            string                       `json:"media_type" bson:"media_type"`
+	MediaName            string                       `json:"media_name" bson:"media_name"`
+	MediaURL             string                       `json:"media_url" bson:"media_url"`
+	RankScore            float64                      `json:"rank_score" bson:"rank_score"`
+	MediaTags            []string                     `json:"media_tags" bson:"media_tags"`
+	CreateTS             int64                        `json:"create_ts" bson:"create_ts"`
+	ContentLength        int64                        `json:"content_length" bson:"content_length"`
+	StorageTier          string                       `json:"storage_tier,omitempty" bson:"storage_tier,omitempty"` // blob access tier, empty for default (hot)
+	TierTS               int64                        `json:"tier_ts,omitempty" bson:"tier_ts,omitempty"`           // last tier change
+	InstitutePID         primitive.ObjectID           `json:"institute_pid" bson:"institute_pid"`                   // institute of student or class session (tenant scope)
+	MediaVariants        map[string]CloudMediaVariant `json:"media_variants" bson:"media_variants"`                 // resized images by variant name, null if not generated yet (empty if image cannot be resized)
+	CaptureTS            int64                        `json:"capture_ts" bson:"capture_ts"`                         // capture time from EXIF/mp4 metadata, 0 if unknown (create_ts is used instead)
+	Width                int                          `json:"width" bson:"width"`                                   // pixel as displayed, 0 if unknown
+	Height               int                          `json:"height" bson:"height"`                                 // pixel as displayed, 0 if unknown
+	Duration             float64                      `json:"duration" bson:"duration"`                             // second (videos), 0 if unknown
+	Orientation          int                          `json:"orientation" bson:"orientation"`                       // EXIF orientation 1-8 (video rotation as EXIF value), 0 if unknown
+	MetadataStripped     bool                         `json:"metadata_stripped" bson:"metadata_stripped"`           // location/device metadata removed from image blob
+	MetadataStripSkipped bool                         `json:"metadata_strip_skipped" bson:"metadata_strip_skipped"` // image format or size cannot be stripped (stored before format checks)
+	ContentType          string                       `json:"content_type" bson:"content_type"`                     // sniffed from blob content (blob Content-Type header), empty for media created before
+	ContentHash          string                       `json:"content_hash" bson:"content_hash"`                     // SHA-256 (hex) of blob content (images as stored after metadata stripping), empty if not computed yet
+	PerceptualHash       string                       `json:"perceptual_hash" bson:"perceptual_hash"`               // 64 bit difference hash (hex) of images, empty if not computed or no image
+	NearDuplicateOf      primitive.ObjectID           `json:"near_duplicate_of" bson:"near_duplicate_of"`           // similar earlier media of same course record/class session (collapsed into it if collapsed), nil if none
+	Collapsed            bool                         `json:"collapsed" bson:"collapsed"`                           // near-duplicate collapsed by teacher, hidden from relatives
+}
+
+// CloudMediaStudentLink struct (student a media is linked to)
+type CloudMediaStudentLink struct {
+	StudentPID primitive.ObjectID `json:"student_pid" bson:"student_pid"`
+	Hidden     bool               `json:"hidden" bson:"hidden"` // media is not shown to relatives of student
+}
+
+// CloudMediaStudentView struct (cloud media fields visible to relatives, linked students and internal fields left out)
+type CloudMediaStudentView struct {
+	PID             primitive.ObjectID           `json:"pid"`
+	CourseRecordPID primitive.ObjectID           `json:"course_record_pid"`
+	SessionPID      primitive.ObjectID           `json:"session_pid"`
+	MediaType       string                       `json:"media_type"`
+	MediaName       string                       `json:"media_name"`
+	MediaURL        string                       `json:"media_url"`
+	RankScore       float64                      `json:"rank_score"`
+	MediaTags       []string                     `json:"media_tags"`
+	CreateTS        int64                        `json:"create_ts"`
+	ContentLength   int64                        `json:"content_length"`
+	ContentType     string                       `json:"content_type"`
+	InstitutePID    primitive.ObjectID           `json:"institute_pid"`
+	MediaVariants   map[string]CloudMediaVariant `json:"media_variants"`
+	CaptureTS       int64                        `json:"capture_ts"`
+	Width           int                          `json:"width"`
+	Height          int                          `json:"height"`
+	Duration        float64                      `json:"duration"`
+	Orientation     int                          `json:"orientation"`
+}
+
+// CloudMediaVariant struct (resized image of image cloud media, stored next to original blob)
+type CloudMediaVariant struct {
+	MediaName     string `json:"media_name" bson:"media_name"`
+	MediaURL      string `json:"media_url" bson:"media_url"`
+	Width         int    `json:"width" bson:"width"`
+	Height        int    `json:"height" bson:"height"`
+	ContentLength int64  `json:"content_length" bson:"content_length"`
 }
 
 // StudentRelativeRef struct
@@ -110,6 +400,75 @@ type StudentRelativeRef struct {
 	RelativePID  primitive.ObjectID `json:"relative_pid" bson:"relative_pid"`
 	Relationship string             `json:"relationship" bson:"relationship"`
 	IsMain       bool               `json:"is_main" bson:"is_main"`
+	Permission   string             `json:"permission" bson:"permission"`
+	InstitutePID primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of student (tenant scope)
+}
+
+// RelativeInvite struct (invitation of a secondary relative created by main relative)
+type RelativeInvite struct {
+	PID          primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	StudentPID   primitive.ObjectID `json:"student_pid" bson:"student_pid"`
+	InviterPID   primitive.ObjectID `json:"inviter_pid" bson:"inviter_pid"`
+	InviteCode   string             `json:"invite_code" bson:"invite_code"`
+	InviteExpire int64              `json:"invite_expire" bson:"invite_expire"`
+	Relationship string             `json:"relationship" bson:"relationship"`
+	Permission   string             `json:"permission" bson:"permission"`
+	CreateTS     int64              `json:"create_ts" bson:"create_ts"`
+	Status       string             `json:"status" bson:"status"`                                 // pending/redeemed
+	RedeemerPID  primitive.ObjectID `json:"redeemer_pid,omitempty" bson:"redeemer_pid,omitempty"` // relative who redeemed the invite
+	RedeemTS     int64              `json:"redeem_ts,omitempty" bson:"redeem_ts,omitempty"`
+	InstitutePID primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of student (tenant scope)
+}
+
+// RelativeExtraInfo struct (main relative manages secondary relatives)
+type RelativeExtraInfo struct {
+	RelativeWXID string             `json:"relative_wxid"` // wechat id of main relative
+	StudentPID   primitive.ObjectID `json:"student_pid"`
+	Relationship string             `json:"relationship"`
+	Permission   string             `json:"permission"`
+	RelativePID  primitive.ObjectID `json:"relative_pid"` // secondary relative to revoke
+	InvitePID    primitive.ObjectID `json:"invite_pid"`   // pending invite to revoke
+}
+
+// MainRelativeTransfer struct (record of main relative status transfer)
+type MainRelativeTransfer struct {
+	PID             primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	StudentPID      primitive.ObjectID `json:"student_pid" bson:"student_pid"`
+	FromRelativePID primitive.ObjectID `json:"from_relative_pid" bson:"from_relative_pid"`
+	ToRelativePID   primitive.ObjectID `json:"to_relative_pid" bson:"to_relative_pid"`
+	OperatorType    string             `json:"operator_type" bson:"operator_type"`
+	OperatorPID     primitive.ObjectID `json:"operator_pid" bson:"operator_pid"` // nil for admin
+	TransferTS      int64              `json:"transfer_ts" bson:"transfer_ts"`
+	InstitutePID    primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of student (tenant scope)
+}
+
+// RelativeExtraList struct
+type RelativeExtraList struct {
+	References []*StudentRelativeRef `json:"references"`
+	Invites    []*RelativeInvite     `json:"invites"`
+}
+
+// BindingCode struct (short numeric code to bind a student with main relative, kept as history after use)
+type BindingCode struct {
+	PID          primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	StudentPID   primitive.ObjectID `json:"student_pid" bson:"student_pid"`
+	Code         string             `json:"binding_code" bson:"binding_code"`
+	Status       string             `json:"status" bson:"status"`
+	CreateTS     int64              `json:"create_ts" bson:"create_ts"`
+	ExpireTS     int64              `json:"binding_expire" bson:"binding_expire"`
+	ExpireAt     time.Time          `json:"-" bson:"expire_at"`                 // TTL index field (purged after history retention)
+	RelativePID  primitive.ObjectID `json:"relative_pid" bson:"relative_pid"`   // relative who redeemed the code
+	UpdateTS     int64              `json:"update_ts" bson:"update_ts"`         // redeem/revoke time
+	InstitutePID primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of student (tenant scope)
+}
+
+// BindingAttempt struct (failed binding attempt, used for attempt limiting)
+type BindingAttempt struct {
+	PID          primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	RelativeWXID string             `json:"relative_wxid" bson:"relative_wxid"`
+	Code         string             `json:"binding_code" bson:"binding_code"`
+	ClientIP     string             `json:"client_ip" bson:"client_ip"`
+	AttemptAt    time.Time          `json:"attempt_at" bson:"attempt_at"` // TTL index field (purged after attempt window)
 }
 
 // StudentRelativeBindInfo struct
@@ -122,9 +481,105 @@ type StudentRelativeBindInfo struct {
 
 // StudentCourseRef struct
 type StudentCourseRef struct {
-	PID        primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	PID          primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	StudentPID   primitive.ObjectID `json:"student_pid" bson:"student_pid"`
+	CoursePID    primitive.ObjectID `json:"course_pid" bson:"course_pid"`
+	Credits      int                `json:"credits" bson:"credits"`             // lesson credits granted at enrolment (balance kept in lesson credit ledger)
+	InstitutePID primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of course (tenant scope)
+}
+
+// LessonCreditEntry struct (lesson credit ledger entry of a student in a course)
+type LessonCreditEntry struct {
+	PID             primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	StudentPID      primitive.ObjectID `json:"student_pid" bson:"student_pid"`
+	CoursePID       primitive.ObjectID `json:"course_pid" bson:"course_pid"`
+	EntryType       string             `json:"entry_type" bson:"entry_type"`
+	Credits         int                `json:"credits" bson:"credits"`   // lesson credit change
+	MakeUps         int                `json:"make_ups" bson:"make_ups"` // makeup entitlement change
+	CourseRecordPID primitive.ObjectID `json:"course_record_pid" bson:"course_record_pid,omitempty"`
+	Note            string             `json:"note" bson:"note"`
+	CreateTS        int64              `json:"create_ts" bson:"create_ts"`
+	InstitutePID    primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of course (tenant scope)
+}
+
+// LessonCreditBalance struct
+type LessonCreditBalance struct {
 	StudentPID primitive.ObjectID `json:"student_pid" bson:"student_pid"`
 	CoursePID  primitive.ObjectID `json:"course_pid" bson:"course_pid"`
+	Credits    int                `json:"credits" bson:"credits"`   // remaining lesson credits
+	MakeUps    int                `json:"make_ups" bson:"make_ups"` // remaining makeup entitlements
+	Purchased  int                `json:"purchased" bson:"purchased"`
+	Attended   int                `json:"attended" bson:"attended"`
+	Missed     int                `json:"missed" bson:"missed"`
+	MadeUp     int                `json:"made_up" bson:"made_up"`
+}
+
+// LessonCreditAlert struct (low lesson credit balance, shown to relatives)
+type LessonCreditAlert struct {
+	PID          primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	StudentPID   primitive.ObjectID `json:"student_pid" bson:"student_pid"`
+	CoursePID    primitive.ObjectID `json:"course_pid" bson:"course_pid"`
+	Credits      int                `json:"credits" bson:"credits"`
+	CreateTS     int64              `json:"create_ts" bson:"create_ts"`
+	InstitutePID primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of course (tenant scope)
+}
+
+// LeaveRequest struct (absence of a student from an upcoming schedule occurrence, announced by a relative)
+type LeaveRequest struct {
+	PID             primitive.ObjectID `json:"pid" bson:"_id,omitempty"`
+	StudentPID      primitive.ObjectID `json:"student_pid" bson:"student_pid"`
+	RelativePID     primitive.ObjectID `json:"relative_pid" bson:"relative_pid"`
+	CoursePID       primitive.ObjectID `json:"course_pid" bson:"course_pid"`
+	SchedulePID     primitive.ObjectID `json:"schedule_pid" bson:"schedule_pid"`
+	Date            string             `json:"date" bson:"date"` // occurrence date (YYYY-MM-DD)
+	StartTS         int64              `json:"start_ts" bson:"start_ts"`
+	EndTS           int64              `json:"end_ts" bson:"end_ts"`
+	Reason          string             `json:"reason" bson:"reason"`
+	Status          string             `json:"status" bson:"status"`
+	DeciderPID      primitive.ObjectID `json:"decider_pid" bson:"decider_pid,omitempty"`
+	DecisionNote    string             `json:"decision_note" bson:"decision_note"`
+	CourseRecordPID primitive.ObjectID `json:"course_record_pid" bson:"course_record_pid,omitempty"` // absence record of an approved request
+	CreateTS        int64              `json:"create_ts" bson:"create_ts"`
+	DecideTS        int64              `json:"decide_ts" bson:"decide_ts"`
+	InstitutePID    primitive.ObjectID `json:"institute_pid" bson:"institute_pid"` // institute of course (tenant scope)
+}
+
+// LeaveRequestReq struct (submit/withdraw by relative, decide by teacher)
+type LeaveRequestReq struct {
+	RelativeWXID string             `json:"relative_wxid"`
+	StudentPID   primitive.ObjectID `json:"student_pid"`
+	SchedulePID  primitive.ObjectID `json:"schedule_pid"`
+	Date         string             `json:"date"`
+	Reason       string             `json:"reason"`
+	LeavePID     primitive.ObjectID `json:"leave_pid"`
+	TeacherPID   primitive.ObjectID `json:"teacher_pid"`
+	Approve      bool               `json:"approve"`
+	Note         string             `json:"note"`
+	TargetTag    string             `json:"target_tag"` // target tag of the absence record, first course target if empty
+}
+
+// TeacherDailyReq struct
+type TeacherDailyReq struct {
+	TeacherPID primitive.ObjectID `json:"teacher_pid"`
+	Date       string             `json:"date"` // YYYY-MM-DD (server local time), today if empty
+}
+
+// TeacherDailyView struct (one day of a teacher)
+type TeacherDailyView struct {
+	Date          string                `json:"date"`
+	Occurrences   []*ScheduleOccurrence `json:"occurrences"`
+	Sessions      []*ClassSession       `json:"sessions"`
+	LeaveRequests []*LeaveRequest       `json:"leave_requests"`
+}
+
+// LessonCreditReq struct
+type LessonCreditReq struct {
+	StudentPID      primitive.ObjectID `json:"student_pid"`
+	CoursePID       primitive.ObjectID `json:"course_pid"`
+	Credits         int                `json:"credits"`
+	Note            string             `json:"note"`
+	CourseRecordPID primitive.ObjectID `json:"course_record_pid"`
+	RelativeWXID    string             `json:"relative_wxid"`
 }
 
 // AzureBlobProp struct
@@ -132,13 +587,32 @@ type AzureBlobProp struct {
 	BlobName      string
 	CreateTS      int64
 	ContentLength int64
+	ContentType   string
+}
+
+// CloudMediaDuplicateReq struct (media of course record or class session)
+type CloudMediaDuplicateReq struct {
+	CourseRecordPID primitive.ObjectID `json:"course_record_pid" bson:"course_record_pid"`
+	SessionPID      primitive.ObjectID `json:"session_pid" bson:"session_pid"`
+}
+
+// CloudMediaDuplicateGroup struct (near-duplicate media, earliest first)
+type CloudMediaDuplicateGroup struct {
+	Media []*CloudMedia `json:"media" bson:"media"`
+}
+
+// CloudMediaCollapseReq struct (collapse near-duplicates into kept media)
+type CloudMediaCollapseReq struct {
+	KeepPID      primitive.ObjectID   `json:"keep_pid" bson:"keep_pid"`
+	CollapsePIDs []primitive.ObjectID `json:"collapse_pids" bson:"collapse_pids"`
 }
 
 // StudentMediaQueryReq struct
 type StudentMediaQueryReq struct {
-	StudentPID primitive.ObjectID `json:"student_pid" bson:"student_pid"`
-	StartTS    int64              `json:"start_ts" bson:"start_ts"`
-	EndTS      int64              `json:"end_ts" bson:"end_ts"`
+	StudentPID   primitive.ObjectID `json:"student_pid" bson:"student_pid"`
+	StartTS      int64              `json:"start_ts" bson:"start_ts"`
+	EndTS        int64              `json:"end_ts" bson:"end_ts"`
+	RelativeWXID string             `json:"relative_wxid" bson:"relative_wxid"` // relative caller (staff callers send auth token instead)
 }
 
 // RelativeWeChatLoginInfo struct
@@ -158,10 +632,123 @@ var CommentPersonTypeMap = map[string]bool{
 	CommentPersonTypeRelative: true,
 }
 
+const (
+	CourseStaffLead       = "lead"
+	CourseStaffAssistant  = "assistant"
+	CourseStaffSubstitute = "substitute" // replaces lead while effective
+)
+
+var courseStaffRoleMap = map[string]bool{
+	CourseStaffLead:       true,
+	CourseStaffAssistant:  true,
+	CourseStaffSubstitute: true,
+}
+
+const (
+	StudentStatusActive    = "active"
+	StudentStatusPaused    = "paused"
+	StudentStatusGraduated = "graduated" // archived
+	StudentStatusWithdrawn = "withdrawn" // archived
+)
+
+var studentStatusMap = map[string]bool{
+	StudentStatusActive:    true,
+	StudentStatusPaused:    true,
+	StudentStatusGraduated: true,
+	StudentStatusWithdrawn: true,
+}
+
+const (
+	StudentGenderFemale = "female"
+	StudentGenderMale   = "male"
+	StudentGenderOther  = "other"
+)
+
+var studentGenderMap = map[string]bool{
+	"":                  true,
+	StudentGenderFemale: true,
+	StudentGenderMale:   true,
+	StudentGenderOther:  true,
+}
+
+var studentArchivedStatusMap = map[string]bool{
+	StudentStatusGraduated: true,
+	StudentStatusWithdrawn: true,
+}
+
+const (
+	BindingCodeStatusActive   = "active"
+	BindingCodeStatusRedeemed = "redeemed"
+	BindingCodeStatusRevoked  = "revoked"
+)
+
+const (
+	RelativeInviteStatusPending  = "pending"
+	RelativeInviteStatusRedeemed = "redeemed"
+)
+
+const (
+	TransferOperatorTypeRelative = "relative"
+	TransferOperatorTypeAdmin    = "admin"
+)
+
+const (
+	RelativePermissionView    = "view"
+	RelativePermissionComment = "view_comment"
+)
+
+var relativePermissionMap = map[string]bool{
+	RelativePermissionView:    true,
+	RelativePermissionComment: true,
+}
+
+const (
+	ScheduleOwnerTeacher  = "teacher"
+	ScheduleOwnerStudent  = "student"
+	ScheduleOwnerRelative = "relative"
+)
+
+var scheduleOwnerMap = map[string]bool{
+	ScheduleOwnerTeacher:  true,
+	ScheduleOwnerStudent:  true,
+	ScheduleOwnerRelative: true,
+}
+
+const (
+	LessonCreditGrant   = "grant"   // credits purchased (enrolment or top-up)
+	LessonCreditConsume = "consume" // non-makeup course record
+	LessonCreditAbsence = "absence" // approved absence -> makeup entitlement
+	LessonCreditRedeem  = "redeem"  // makeup course record
+	LessonCreditAdjust  = "adjust"  // manual correction
+)
+
+const (
+	LeaveStatusPending   = "pending"
+	LeaveStatusApproved  = "approved"
+	LeaveStatusRejected  = "rejected"
+	LeaveStatusWithdrawn = "withdrawn"
+)
+
+const (
+	AttendancePresent = "present"
+	AttendanceAbsent  = "absent"
+	AttendanceMakeUp  = "makeup"
+)
+
+var attendanceMap = map[string]bool{
+	AttendancePresent: true,
+	AttendanceAbsent:  true,
+	AttendanceMakeUp:  true,
+}
+
 const (
 	CloudMediaTypeVideo  = "video"
 	CloudMediaTypeImage  = "image"
 	CloudMediaTypeOthers = "others"
+
+	// image cloud media variants
+	CloudMediaVariantThumbnail = "thumbnail"
+	CloudMediaVariantMedium    = "medium"
 )
 
 var cloudMediaTypeMap = map[string]bool{
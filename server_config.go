@@ -1,36 +1,79 @@
 package main
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
 )
 
 // ServerConfig global server config
+// every field can be overridden by its env variable, or by a secrets file whose path is given in <env>_FILE
 type ServerConfig struct {
-	ServerHTTPPort             int    `json:"serverHTTPPort"`
-	RunHTTPS                   bool   `json:"runHttps"`
-	ServerHTTPSecurePort       int    `json:"serverHTTPSecurePort"`
-	SSLCertPath                string `json:"sslCertPath"`
-	SSLKeyPath                 string `json:"sslKeyPath"`
-	LoggingReleaseMode         bool   `json:"loggingReleaseMode"`
-	LoggingLevel               string `json:"loggingLevel"`
-	LoggingDestination         string `json:"loggingDestination"`
-	DBHostAddress              string `json:"DBHostAddress"`
-	DBName                     string `json:"DBName"`
-	DBUsername                 string `json:"DBUsername"`
-	DBPassword                 string `json:"DBPassword"`
-	AzureStorageAccount        string `json:"azureStorageAccount"`
-	AzureStorageAccessKey      string `json:"azureStorageAccessKey"`
-	AzureStorageContainer      string `json:"azureStorageContainer"`
-	RelativeWeChatLoginURL     string `json:"relativeWeChatLoginURL"`
-	StudentBindingCodeLifeTime int    `json:"studentBindingCodeLifeTime"` // hour
+	ServerHTTPPort             int             `json:"serverHTTPPort" env:"KLOG_SERVER_HTTP_PORT"`
+	RunHTTPS                   bool            `json:"runHttps" env:"KLOG_RUN_HTTPS"`
+	ServerHTTPSecurePort       int             `json:"serverHTTPSecurePort" env:"KLOG_SERVER_HTTP_SECURE_PORT"`
+	SSLCertPath                string          `json:"sslCertPath" env:"KLOG_SSL_CERT_PATH"`
+	SSLKeyPath                 string          `json:"sslKeyPath" env:"KLOG_SSL_KEY_PATH"`
+	LoggingReleaseMode         bool            `json:"loggingReleaseMode" env:"KLOG_LOGGING_RELEASE_MODE"`
+	LoggingLevel               string          `json:"loggingLevel" env:"KLOG_LOGGING_LEVEL"` // reloadable
+	LoggingDestination         string          `json:"loggingDestination" env:"KLOG_LOGGING_DESTINATION"`
+	LoggingModules             map[string]bool `json:"loggingModules" env:"KLOG_LOGGING_MODULES"` // reloadable (MODULE=true,MODULE=false)
+	DBHostAddress              string          `json:"DBHostAddress" env:"KLOG_DB_HOST_ADDRESS"`
+	DBName                     string          `json:"DBName" env:"KLOG_DB_NAME"`
+	DBUsername                 string          `json:"DBUsername" env:"KLOG_DB_USERNAME"`
+	DBPassword                 string          `json:"DBPassword" env:"KLOG_DB_PASSWORD"`
+	AzureStorageAccount        string          `json:"azureStorageAccount" env:"KLOG_AZURE_STORAGE_ACCOUNT"`
+	AzureStorageAccessKey      string          `json:"azureStorageAccessKey" env:"KLOG_AZURE_STORAGE_ACCESS_KEY"`
+	AzureStorageContainer      string          `json:"azureStorageContainer" env:"KLOG_AZURE_STORAGE_CONTAINER"`
+	RelativeWeChatLoginURL     string          `json:"relativeWeChatLoginURL" env:"KLOG_RELATIVE_WECHAT_LOGIN_URL"`
+	StudentBindingCodeLifeTime int             `json:"studentBindingCodeLifeTime" env:"KLOG_STUDENT_BINDING_CODE_LIFETIME"` // hour, reloadable
+	BindingCodeHistoryDays     int             `json:"bindingCodeHistoryDays" env:"KLOG_BINDING_CODE_HISTORY_DAYS"`         // day, used codes kept as history
+	BindingAttemptWindow       int             `json:"bindingAttemptWindow" env:"KLOG_BINDING_ATTEMPT_WINDOW"`              // minute
+	BindingMaxAttemptsPerWXID  int             `json:"bindingMaxAttemptsPerWXID" env:"KLOG_BINDING_MAX_ATTEMPTS_PER_WXID"`  // failed attempts within window
+	BindingMaxAttemptsPerCode  int             `json:"bindingMaxAttemptsPerCode" env:"KLOG_BINDING_MAX_ATTEMPTS_PER_CODE"`  // failed attempts within window
+	BindingMaxAttemptsPerIP    int             `json:"bindingMaxAttemptsPerIP" env:"KLOG_BINDING_MAX_ATTEMPTS_PER_IP"`      // failed attempts within window
+	BindingMaxAttemptsTotal    int             `json:"bindingMaxAttemptsTotal" env:"KLOG_BINDING_MAX_ATTEMPTS_TOTAL"`       // failed attempts of all clients within window
+	DBReadTimeout              int             `json:"DBReadTimeout" env:"KLOG_DB_READ_TIMEOUT"`                            // millisecond
+	DBWriteTimeout             int             `json:"DBWriteTimeout" env:"KLOG_DB_WRITE_TIMEOUT"`                          // millisecond
+	StorageTimeout             int             `json:"storageTimeout" env:"KLOG_STORAGE_TIMEOUT"`                           // millisecond
+	StorageTransferTimeout     int             `json:"storageTransferTimeout" env:"KLOG_STORAGE_TRANSFER_TIMEOUT"`          // millisecond
+	CORSAllowOrigins           []string        `json:"corsAllowOrigins" env:"KLOG_CORS_ALLOW_ORIGINS"`                      // reloadable, empty for all origins
+	AdminToken                 string          `json:"adminToken" env:"KLOG_ADMIN_TOKEN"`                                   // empty to disable admin api
+	TeacherTokenSecret         string          `json:"teacherTokenSecret" env:"KLOG_TEACHER_TOKEN_SECRET"`                  // signs teacher auth tokens, empty to disable teacher login
+	TeacherTokenLifeTime       int             `json:"teacherTokenLifeTime" env:"KLOG_TEACHER_TOKEN_LIFETIME"`              // hour
+	CalendarFeedSecret         string          `json:"calendarFeedSecret" env:"KLOG_CALENDAR_FEED_SECRET"`                  // signs .ics feed URLs, empty to disable feeds
+	CalendarFeedDays           int             `json:"calendarFeedDays" env:"KLOG_CALENDAR_FEED_DAYS"`                      // day, upcoming occurrences in .ics feeds
+	LessonCreditLowBalance     int             `json:"lessonCreditLowBalance" env:"KLOG_LESSON_CREDIT_LOW_BALANCE"`         // alert relatives at or below this balance, negative to disable
+	MediaArchiveTierDays       int             `json:"mediaArchiveTierDays" env:"KLOG_MEDIA_ARCHIVE_TIER_DAYS"`             // day, media of archived students moves to cool tier, negative to disable
+	StudentImageMaxSize        int             `json:"studentImageMaxSize" env:"KLOG_STUDENT_IMAGE_MAX_SIZE"`               // MB, uploaded student image
+	MediaImageMaxSize          int             `json:"mediaImageMaxSize" env:"KLOG_MEDIA_IMAGE_MAX_SIZE"`                   // MB, image cloud media
+	MediaVideoMaxSize          int             `json:"mediaVideoMaxSize" env:"KLOG_MEDIA_VIDEO_MAX_SIZE"`                   // MB, video cloud media
+	MediaOthersMaxSize         int             `json:"mediaOthersMaxSize" env:"KLOG_MEDIA_OTHERS_MAX_SIZE"`                 // MB, other cloud media (documents, audio)
+	MetricsListenAddress       string          `json:"metricsListenAddress" env:"KLOG_METRICS_LISTEN_ADDRESS"`              // host:port serving /metrics without auth, empty for api port with admin token
 }
 
 var serverConfig *ServerConfig
 
+// serverConfigLock guards the reloadable subset of serverConfig (other fields are read-only after startup)
+var serverConfigLock sync.RWMutex
+
+const (
+	serverConfigFileEnv    = "KLOG_CONFIG_FILE"
+	serverConfigFileSuffix = "_FILE"
+	ginHeaderAdminToken    = "X-Admin-Token"
+)
+
 func readServerConfig(ConfigFile string) (*ServerConfig, error) {
 	configHandle, err := os.Open(ConfigFile)
 	if err != nil {
@@ -48,6 +91,103 @@ func readServerConfig(ConfigFile string) (*ServerConfig, error) {
 	return &serverconfig, nil
 }
 
+// loadServerConfig reads config file, applies env overrides and defaults, then validates the result
+func loadServerConfig(configFile string) (*ServerConfig, error) {
+	if envConfigFile := os.Getenv(serverConfigFileEnv); envConfigFile != "" {
+		configFile = envConfigFile
+	}
+	sc, err := readServerConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err = applyServerConfigEnv(sc); err != nil {
+		return nil, err
+	}
+	initDefaultServerConfig(sc)
+	if err = validateServerConfig(sc); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// applyServerConfigEnv overrides config fields from env variables (<env>_FILE takes precedence for secrets)
+func applyServerConfigEnv(sc *ServerConfig) error {
+	configValue := reflect.ValueOf(sc).Elem()
+	configType := configValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		envName := configType.Field(i).Tag.Get("env")
+		if envName == "" {
+			continue
+		}
+
+		envValue, exist := os.LookupEnv(envName)
+		if secretFile := os.Getenv(envName + serverConfigFileSuffix); secretFile != "" {
+			secretBytes, err := ioutil.ReadFile(secretFile)
+			if err != nil {
+				return fmt.Errorf("Server Config Secrets File Error (%s) - %v", envName+serverConfigFileSuffix, err.Error())
+			}
+			envValue, exist = strings.TrimSpace(string(secretBytes)), true
+		}
+		if !exist {
+			continue
+		}
+
+		if err := setServerConfigField(configValue.Field(i), envValue); err != nil {
+			return fmt.Errorf("Server Config Env Error (%s) - %v", envName, err.Error())
+		}
+	}
+	return nil
+}
+
+func setServerConfigField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(intValue))
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(boolValue)
+	case reflect.Slice:
+		// comma separated list
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		// comma separated key=bool pairs
+		items := map[string]bool{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			pair := strings.SplitN(item, "=", 2)
+			if len(pair) != 2 {
+				return fmt.Errorf("invalid key=value pair \"%s\"", item)
+			}
+			boolValue, err := strconv.ParseBool(strings.TrimSpace(pair[1]))
+			if err != nil {
+				return err
+			}
+			items[strings.TrimSpace(pair[0])] = boolValue
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Kind().String())
+	}
+	return nil
+}
+
 func initDefaultServerConfig(sc *ServerConfig) {
 	sc.LoggingLevel = strings.ToLower(sc.LoggingLevel)
 	if sc.LoggingLevel == "" {
@@ -59,4 +199,198 @@ func initDefaultServerConfig(sc *ServerConfig) {
 	if sc.StudentBindingCodeLifeTime == 0 {
 		sc.StudentBindingCodeLifeTime = 72
 	}
+	if sc.BindingCodeHistoryDays <= 0 {
+		sc.BindingCodeHistoryDays = 90
+	}
+	if sc.BindingAttemptWindow <= 0 {
+		sc.BindingAttemptWindow = 15
+	}
+	if sc.BindingMaxAttemptsPerWXID <= 0 {
+		sc.BindingMaxAttemptsPerWXID = 5
+	}
+	if sc.BindingMaxAttemptsPerCode <= 0 {
+		sc.BindingMaxAttemptsPerCode = 10
+	}
+	if sc.BindingMaxAttemptsPerIP <= 0 {
+		sc.BindingMaxAttemptsPerIP = 20
+	}
+	if sc.BindingMaxAttemptsTotal <= 0 {
+		sc.BindingMaxAttemptsTotal = 500
+	}
+	if sc.DBReadTimeout <= 0 {
+		sc.DBReadTimeout = 5000
+	}
+	if sc.DBWriteTimeout <= 0 {
+		sc.DBWriteTimeout = 10000
+	}
+	if sc.StorageTimeout <= 0 {
+		sc.StorageTimeout = 10000
+	}
+	if sc.StorageTransferTimeout <= 0 {
+		sc.StorageTransferTimeout = 120000
+	}
+	if sc.TeacherTokenLifeTime <= 0 {
+		sc.TeacherTokenLifeTime = 12
+	}
+	if sc.CalendarFeedDays <= 0 {
+		sc.CalendarFeedDays = 180
+	}
+	if sc.LessonCreditLowBalance == 0 {
+		sc.LessonCreditLowBalance = 2
+	}
+	if sc.MediaArchiveTierDays == 0 {
+		sc.MediaArchiveTierDays = 90
+	}
+	if sc.StudentImageMaxSize <= 0 {
+		sc.StudentImageMaxSize = 10
+	}
+	if sc.MediaImageMaxSize <= 0 {
+		sc.MediaImageMaxSize = 50
+	}
+	if sc.MediaVideoMaxSize <= 0 {
+		sc.MediaVideoMaxSize = 2048
+	}
+	if sc.MediaOthersMaxSize <= 0 {
+		sc.MediaOthersMaxSize = 100
+	}
+}
+
+// validateServerConfig rejects inconsistent configs, return all problems found in one error
+func validateServerConfig(sc *ServerConfig) error {
+	var problems []string
+	if sc.RunHTTPS {
+		if sc.ServerHTTPSecurePort <= 0 || sc.ServerHTTPSecurePort > 65535 {
+			problems = append(problems, fmt.Sprintf("invalid HTTPS port %d", sc.ServerHTTPSecurePort))
+		}
+		if sc.SSLCertPath == "" || sc.SSLKeyPath == "" {
+			problems = append(problems, "HTTPS enabled without SSL cert/key path")
+		} else {
+			if _, err := os.Stat(sc.SSLCertPath); err != nil {
+				problems = append(problems, fmt.Sprintf("SSL cert not readable (%s)", err.Error()))
+			}
+			if _, err := os.Stat(sc.SSLKeyPath); err != nil {
+				problems = append(problems, fmt.Sprintf("SSL key not readable (%s)", err.Error()))
+			}
+		}
+	} else if sc.ServerHTTPPort <= 0 || sc.ServerHTTPPort > 65535 {
+		problems = append(problems, fmt.Sprintf("invalid HTTP port %d", sc.ServerHTTPPort))
+	}
+	if _, ok := loggingLevelMap[sc.LoggingLevel]; !ok {
+		problems = append(problems, fmt.Sprintf("unknown logging level \"%s\"", sc.LoggingLevel))
+	}
+	switch sc.LoggingDestination {
+	case "stdout", "file", "stdout+file", "file+stdout":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown logging destination \"%s\"", sc.LoggingDestination))
+	}
+	for module := range sc.LoggingModules {
+		if _, ok := logModEnabledTable[module]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown logging module \"%s\"", module))
+		}
+	}
+	if sc.DBHostAddress == "" || sc.DBName == "" {
+		problems = append(problems, "DB host address and name are required")
+	}
+	if sc.DBUsername != "" && sc.DBPassword == "" {
+		problems = append(problems, "DB username given without DB password")
+	}
+	if sc.AzureStorageAccount == "" || sc.AzureStorageAccessKey == "" || sc.AzureStorageContainer == "" {
+		problems = append(problems, "azure storage account, access key and container are required")
+	}
+	if sc.StudentBindingCodeLifeTime < 0 {
+		problems = append(problems, fmt.Sprintf("invalid binding code lifetime %d", sc.StudentBindingCodeLifeTime))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Server Config Validation Error - %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// reloadServerConfig reloads config and applies the safe subset (logging level/modules, binding code lifetime, CORS origins)
+func reloadServerConfig() error {
+	sc, err := loadServerConfig(serverConfigFile)
+	if err != nil {
+		return err
+	}
+
+	serverConfigLock.Lock()
+	serverConfig.LoggingLevel = sc.LoggingLevel
+	serverConfig.LoggingModules = sc.LoggingModules
+	serverConfig.StudentBindingCodeLifeTime = sc.StudentBindingCodeLifeTime
+	serverConfig.CORSAllowOrigins = sc.CORSAllowOrigins
+	serverConfigLock.Unlock()
+
+	logging.SetLevel(loggingLevelMap[sc.LoggingLevel])
+	loggingApplyModules(logging, logModEnabledTable) // modules removed from config fall back to defaults
+	loggingApplyModules(logging, sc.LoggingModules)
+	return nil
+}
+
+// serverConfigBindingCodeLifeTime returns binding code lifetime in hour (reloadable)
+func serverConfigBindingCodeLifeTime() int {
+	serverConfigLock.RLock()
+	defer serverConfigLock.RUnlock()
+	return serverConfig.StudentBindingCodeLifeTime
+}
+
+// serverConfigAllowOrigin checks CORS origin against configured origins (reloadable, empty for all)
+func serverConfigAllowOrigin(origin string) bool {
+	serverConfigLock.RLock()
+	defer serverConfigLock.RUnlock()
+	if len(serverConfig.CORSAllowOrigins) == 0 {
+		return true
+	}
+	for _, allowOrigin := range serverConfig.CORSAllowOrigins {
+		if allowOrigin == "*" || strings.EqualFold(allowOrigin, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverConfigWatchSignal reloads config on SIGHUP
+func serverConfigWatchSignal() {
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGHUP)
+	go func() {
+		for range signalChan {
+			if err := reloadServerConfig(); err != nil {
+				logging.Errormf(logModMain, "Server config reload (SIGHUP) failed, keep current config: %s", err.Error())
+				continue
+			}
+			logging.Infomln(logModMain, "Server config reloaded (SIGHUP)")
+		}
+	}()
+}
+
+// ginContextIsAdmin checks admin token header against configured admin token (admin api disabled if not configured)
+func ginContextIsAdmin(ctx *gin.Context) bool {
+	adminToken := ctx.GetHeader(ginHeaderAdminToken)
+	return serverConfig.AdminToken != "" && subtle.ConstantTimeCompare([]byte(adminToken), []byte(serverConfig.AdminToken)) == 1
+}
+
+// serverConfigReloadHandler reloads config on admin request (requires admin token header)
+func serverConfigReloadHandler(ctx *gin.Context) {
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	if !ginContextIsAdmin(ctx) {
+		response.Status = http.StatusForbidden
+		response.Message = fmt.Sprintf("[%s] - Admin token is missing or not valid", serverErrorMessages[seInputParamNotValid])
+		return
+	}
+
+	if err := reloadServerConfig(); err != nil {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - Server config reload failed, keep current config: %s", serverErrorMessages[seDataParseError], err.Error())
+		return
+	}
+	loggingWithContext(ctx.Request.Context()).Infomln(logModMain, "Server config reloaded (admin api)")
+	response.Payload = "Server config reloaded"
+	return
 }
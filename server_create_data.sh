@@ -8,8 +8,10 @@ python3 api_demo/relative_create.py
 
 python3 api_demo/student_relative_ref_create.py
 python3 api_demo/student_course_ref_create.py
+python3 api_demo/course_schedule_create.py
 
 python3 api_demo/course_record_create.py
+python3 api_demo/class_session_create.py
 python3 api_demo/course_comment_create.py
 python3 api_demo/cloudmedia_create.py
 
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// lesson credit balances of a student (all enrolled courses if course_pid not given)
+func creditBalanceHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var creditReq LessonCreditReq
+	var err error
+	if err = json.Unmarshal(params.Data, &creditReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+	if creditReq.StudentPID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specify student_pid", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+	if err = studentAccessCheck(ctx, creditReq.StudentPID, creditReq.RelativeWXID); err != nil {
+		response.Status = http.StatusForbidden
+		response.Message = err.Error()
+		return
+	}
+
+	var balances []*LessonCreditBalance
+	balances, err = findLessonCreditBalance(ctx.Request.Context(), creditReq.StudentPID, creditReq.CoursePID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = balances
+	return
+}
+
+// lesson credit ledger history of a student (newest first)
+func creditHistoryHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var creditReq LessonCreditReq
+	var err error
+	if err = json.Unmarshal(params.Data, &creditReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+	if creditReq.StudentPID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specify student_pid", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+	if err = studentAccessCheck(ctx, creditReq.StudentPID, creditReq.RelativeWXID); err != nil {
+		response.Status = http.StatusForbidden
+		response.Message = err.Error()
+		return
+	}
+
+	var entries []*LessonCreditEntry
+	entries, err = findLessonCreditEntry(ctx.Request.Context(), creditReq.StudentPID, creditReq.CoursePID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = entries
+	return
+}
+
+// grant purchased lesson credits (negative credits for a correction)
+func creditGrantHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var creditReq LessonCreditReq
+	var err error
+	if err = json.Unmarshal(params.Data, &creditReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	var entry *LessonCreditEntry
+	entry, err = grantLessonCredit(ctx.Request.Context(), &creditReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = entry
+	return
+}
+
+// approve the absence of an absent course record -> one makeup entitlement
+func creditAbsenceHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var creditReq LessonCreditReq
+	var err error
+	if err = json.Unmarshal(params.Data, &creditReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	var entry *LessonCreditEntry
+	entry, err = approveLessonCreditAbsence(ctx.Request.Context(), creditReq.CourseRecordPID, creditReq.Note)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = entry
+	return
+}
+
+// low lesson credit balance alerts of students bound to a relative
+func relativeCreditAlertHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var creditReq LessonCreditReq
+	var err error
+	if err = json.Unmarshal(params.Data, &creditReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	// find relative by wechat id
+	var relativeFound *Relative
+	relativeFound, err = findRelativeByWXID(ctx.Request.Context(), creditReq.RelativeWXID)
+	if err != nil || relativeFound == nil {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - No relative found with wechat id \"%s\"", serverErrorMessages[seResourceNotFound], creditReq.RelativeWXID)
+		return
+	}
+
+	var references []*StudentRelativeRef
+	references, err = findStudentRelativeRef(ctx.Request.Context(), primitive.NilObjectID, relativeFound.PID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	var studentPIDs = []primitive.ObjectID{}
+	for i := range references {
+		studentPIDs = append(studentPIDs, references[i].StudentPID)
+	}
+
+	var alerts []*LessonCreditAlert
+	alerts, err = findLessonCreditAlert(ctx.Request.Context(), studentPIDs)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = alerts
+	return
+}
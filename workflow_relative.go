@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -91,7 +93,7 @@ func relativeFindBoundStudentHandler(ctx *gin.Context) {
 
 	// find relative by wechat id
 	var relativeFound *Relative
-	relativeFound, err = findRelativeByWXID(relativeWXID)
+	relativeFound, err = findRelativeByWXID(ctx.Request.Context(), relativeWXID)
 	if err != nil || relativeFound == nil {
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - No relative found with wechat id \"%s\"", serverErrorMessages[seResourceNotFound], relativeWXID)
@@ -99,7 +101,7 @@ func relativeFindBoundStudentHandler(ctx *gin.Context) {
 	}
 
 	var references []*StudentRelativeRef
-	references, err = findStudentRelativeRef(primitive.NilObjectID, relativeFound.PID)
+	references, err = findStudentRelativeRef(ctx.Request.Context(), primitive.NilObjectID, relativeFound.PID)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - %s -> could not search student-relative references with given relative_wxid %s",
@@ -110,3 +112,400 @@ func relativeFindBoundStudentHandler(ctx *gin.Context) {
 	response.Payload = references
 	return
 }
+
+// relativeExtraFindMainReference finds main relative by wechat id and checks it is main relative of the student
+func relativeExtraFindMainReference(ctx context.Context, extraInfo *RelativeExtraInfo) (*StudentRelativeRef, error) {
+	if extraInfo.RelativeWXID == "" || extraInfo.StudentPID.IsZero() {
+		return nil, fmt.Errorf("[%s] - Please specified valid relative_wxid and student_pid", serverErrorMessages[seInputJSONNotValid])
+	}
+
+	relativeFound, err := findRelativeByWXID(ctx, extraInfo.RelativeWXID)
+	if err != nil || relativeFound == nil {
+		return nil, fmt.Errorf("[%s] - No relative found with wechat id \"%s\"", serverErrorMessages[seResourceNotFound], extraInfo.RelativeWXID)
+	}
+
+	references, err := findStudentRelativeRef(ctx, extraInfo.StudentPID, relativeFound.PID)
+	if err != nil || len(references) == 0 || !references[0].IsMain {
+		return nil, fmt.Errorf("[%s] - Relative (PID %s) is not main relative of student (PID %s)", serverErrorMessages[seResourceConflict],
+			relativeFound.PID.Hex(), extraInfo.StudentPID.Hex())
+	}
+	return references[0], nil
+}
+
+// main relative invites a secondary relative (e.g. grandparents or the other parent)
+func relativeExtraAddHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var extraInfo RelativeExtraInfo
+	var err error
+	if err = json.Unmarshal(params.Data, &extraInfo); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	mainReference, err := relativeExtraFindMainReference(ctx.Request.Context(), &extraInfo)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	var invite RelativeInvite
+	invite.StudentPID = mainReference.StudentPID
+	invite.InviterPID = mainReference.RelativePID
+	invite.InstitutePID = mainReference.InstitutePID
+	invite.InviteCode, err = relativeInviteCodeGenerate()
+	if err != nil {
+		response.Status = http.StatusInternalServerError
+		response.Message = fmt.Sprintf("[%s] - could not generate invite code: %s", serverErrorMessages[seUnresolvedError], err.Error())
+		return
+	}
+	invite.CreateTS = time.Now().Unix()
+	invite.InviteExpire = invite.CreateTS + int64(3600*serverConfigBindingCodeLifeTime())
+	invite.Relationship = extraInfo.Relationship
+	if invite.Relationship == "" {
+		invite.Relationship = "Unknown"
+	}
+	invite.Permission = extraInfo.Permission
+	if invite.Permission == "" {
+		invite.Permission = RelativePermissionView
+	}
+
+	invite.PID, err = createRelativeInvite(ctx.Request.Context(), &invite)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	response.Payload = invite
+	return
+}
+
+// main relative revokes a secondary relative (relative_pid) or a pending invite (invite_pid)
+func relativeExtraDeleteHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var extraInfo RelativeExtraInfo
+	var err error
+	if err = json.Unmarshal(params.Data, &extraInfo); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	mainReference, err := relativeExtraFindMainReference(ctx.Request.Context(), &extraInfo)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	var deleteCnt int
+	if !extraInfo.InvitePID.IsZero() {
+		// pending invite must belong to the same student
+		var invites []*RelativeInvite
+		invites, err = findRelativeInvite(ctx.Request.Context(), mainReference.StudentPID)
+		for i := 0; err == nil && i < len(invites); i++ {
+			if invites[i].PID == extraInfo.InvitePID {
+				deleteCnt, err = deleteRelativeInvite(ctx.Request.Context(), invites[i].PID)
+				break
+			}
+		}
+	} else if !extraInfo.RelativePID.IsZero() {
+		if extraInfo.RelativePID == mainReference.RelativePID {
+			response.Status = http.StatusConflict
+			response.Message = fmt.Sprintf("[%s] - Main relative (PID %s) could not be revoked by itself", serverErrorMessages[seResourceConflict],
+				mainReference.RelativePID.Hex())
+			return
+		}
+		deleteCnt, err = deleteStudentRelativeRef(ctx.Request.Context(), mainReference.StudentPID, extraInfo.RelativePID)
+	} else {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specified relative_pid or invite_pid to revoke", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	if deleteCnt == 0 {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - No secondary relative or invite found for student (PID %s)", serverErrorMessages[seResourceNotFound],
+			mainReference.StudentPID.Hex())
+		return
+	}
+
+	response.Payload = deleteCnt
+	return
+}
+
+// main relative lists secondary relatives and pending invites
+func relativeExtraListHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var extraInfo RelativeExtraInfo
+	var err error
+	if err = json.Unmarshal(params.Data, &extraInfo); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	mainReference, err := relativeExtraFindMainReference(ctx.Request.Context(), &extraInfo)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	var extraList RelativeExtraList
+	extraList.References = []*StudentRelativeRef{}
+	references, err := findStudentRelativeRef(ctx.Request.Context(), mainReference.StudentPID, primitive.NilObjectID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	for i := range references {
+		if !references[i].IsMain {
+			extraList.References = append(extraList.References, references[i])
+		}
+	}
+	extraList.Invites, err = findRelativeInvite(ctx.Request.Context(), mainReference.StudentPID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	response.Payload = extraList
+	return
+}
+
+// current main relative (or admin with admin token) promotes a secondary relative (relative_pid) to main relative
+func relativeMainTransferHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var extraInfo RelativeExtraInfo
+	var err error
+	if err = json.Unmarshal(params.Data, &extraInfo); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+	if extraInfo.StudentPID.IsZero() || extraInfo.RelativePID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specified valid student_pid and relative_pid", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+
+	var transfer MainRelativeTransfer
+	var mainReference *StudentRelativeRef
+	if ginContextIsAdmin(ctx) {
+		var references []*StudentRelativeRef
+		references, err = findStudentRelativeRef(ctx.Request.Context(), extraInfo.StudentPID, primitive.NilObjectID)
+		for i := 0; err == nil && i < len(references); i++ {
+			if references[i].IsMain {
+				mainReference = references[i]
+				break
+			}
+		}
+		if mainReference == nil {
+			response.Status = http.StatusConflict
+			response.Message = fmt.Sprintf("[%s] - Student (PID %s) has no main relative", serverErrorMessages[seResourceNotFound], extraInfo.StudentPID.Hex())
+			return
+		}
+		transfer.OperatorType = TransferOperatorTypeAdmin
+	} else {
+		mainReference, err = relativeExtraFindMainReference(ctx.Request.Context(), &extraInfo)
+		if err != nil {
+			response.Status = http.StatusConflict
+			response.Message = err.Error()
+			return
+		}
+		transfer.OperatorType = TransferOperatorTypeRelative
+		transfer.OperatorPID = mainReference.RelativePID
+	}
+
+	err = transferMainStudentRelativeRef(ctx.Request.Context(), mainReference.StudentPID, mainReference.RelativePID, extraInfo.RelativePID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	// record transfer
+	transfer.StudentPID = mainReference.StudentPID
+	transfer.FromRelativePID = mainReference.RelativePID
+	transfer.ToRelativePID = extraInfo.RelativePID
+	transfer.TransferTS = time.Now().Unix()
+	transfer.InstitutePID = mainReference.InstitutePID
+	transfer.PID, err = createMainRelativeTransfer(ctx.Request.Context(), &transfer)
+	if err != nil {
+		loggingWithContext(ctx.Request.Context()).Warnmf(logModRelativeMgmt, "Main relative transferred but could not be recorded: %s", err.Error())
+	}
+
+	response.Payload = transfer
+	return
+}
+
+// relativeLeaveFindRelative finds relative of a leave request by wechat id
+func relativeLeaveFindRelative(ctx context.Context, leaveReq *LeaveRequestReq) (*Relative, error) {
+	if leaveReq.RelativeWXID == "" {
+		return nil, fmt.Errorf("[%s] - Could not retrieve relative_wxid", serverErrorMessages[seInputJSONNotValid])
+	}
+	relativeFound, err := findRelativeByWXID(ctx, leaveReq.RelativeWXID)
+	if err != nil || relativeFound == nil {
+		return nil, fmt.Errorf("[%s] - No relative found with wechat id \"%s\"", serverErrorMessages[seResourceNotFound], leaveReq.RelativeWXID)
+	}
+	return relativeFound, nil
+}
+
+// relative submits a leave request for an upcoming class of a bound student
+func relativeLeaveSubmitHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var leaveReq LeaveRequestReq
+	var err error
+	if err = json.Unmarshal(params.Data, &leaveReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	var relativeFound *Relative
+	relativeFound, err = relativeLeaveFindRelative(ctx.Request.Context(), &leaveReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	var leaveRequest *LeaveRequest
+	leaveRequest, err = createLeaveRequest(ctx.Request.Context(), relativeFound, &leaveReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = leaveRequest
+	return
+}
+
+// relative withdraws a pending leave request
+func relativeLeaveWithdrawHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var leaveReq LeaveRequestReq
+	var err error
+	if err = json.Unmarshal(params.Data, &leaveReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	var relativeFound *Relative
+	relativeFound, err = relativeLeaveFindRelative(ctx.Request.Context(), &leaveReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	err = withdrawLeaveRequest(ctx.Request.Context(), relativeFound.PID, leaveReq.LeavePID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = leaveReq.LeavePID
+	return
+}
+
+// relative lists leave requests of bound students
+func relativeLeaveListHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var leaveReq LeaveRequestReq
+	var err error
+	if err = json.Unmarshal(params.Data, &leaveReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	var relativeFound *Relative
+	relativeFound, err = relativeLeaveFindRelative(ctx.Request.Context(), &leaveReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	var references []*StudentRelativeRef
+	references, err = findStudentRelativeRef(ctx.Request.Context(), primitive.NilObjectID, relativeFound.PID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	var studentPIDs = []primitive.ObjectID{}
+	for i := range references {
+		studentPIDs = append(studentPIDs, references[i].StudentPID)
+	}
+
+	var leaveRequests []*LeaveRequest
+	leaveRequests, err = findLeaveRequest(ctx.Request.Context(), primitive.NilObjectID, studentPIDs, nil)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = leaveRequests
+	return
+}
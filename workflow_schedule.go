@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	scheduleUpcomingDefaultDays = 14
+	scheduleUpcomingMaxDays     = 180
+	scheduleFeedPastDays        = 30
+	scheduleFeedSuffix          = ".ics"
+	scheduleFeedTokenQuery      = "token"
+	scheduleFeedTokenLength     = 32
+	scheduleFeedContentType     = "text/calendar; charset=utf-8"
+	scheduleFeedURLFormat       = "/api/0/calendar/%s/%s%s?%s=%s"
+	scheduleFeedLineLimit       = 75
+)
+
+// list upcoming occurrences for a teacher/student/relative
+func scheduleUpcomingHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var queryReq ScheduleQueryReq
+	var err error
+	if err = json.Unmarshal(params.Data, &queryReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+	if queryReq.Days <= 0 {
+		queryReq.Days = scheduleUpcomingDefaultDays
+	} else if queryReq.Days > scheduleUpcomingMaxDays {
+		queryReq.Days = scheduleUpcomingMaxDays
+	}
+	if !scheduleOwnerMap[queryReq.OwnerType] || queryReq.OwnerPID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specify owner_type (%s/%s/%s) and owner_pid", serverErrorMessages[seInputJSONNotValid],
+			ScheduleOwnerTeacher, ScheduleOwnerStudent, ScheduleOwnerRelative)
+		return
+	}
+	if err = scheduleOwnerCheck(ctx, &queryReq); err != nil {
+		response.Status = http.StatusForbidden
+		response.Message = err.Error()
+		return
+	}
+
+	var courses []*Course
+	courses, err = scheduleOwnerCourses(ctx.Request.Context(), queryReq.OwnerType, queryReq.OwnerPID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	var now = time.Now()
+	var occurrences []*ScheduleOccurrence
+	occurrences, err = courseScheduleUpcoming(ctx.Request.Context(), courses, now, now.AddDate(0, 0, queryReq.Days))
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = scheduleOwnerOccurrences(occurrences, queryReq.OwnerType, queryReq.OwnerPID)
+	return
+}
+
+// cancel (or restore) a single occurrence of a course schedule
+func scheduleCancelHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var cancelReq ScheduleCancelReq
+	var err error
+	if err = json.Unmarshal(params.Data, &cancelReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	err = cancelCourseScheduleOccurrence(ctx.Request.Context(), &cancelReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = cancelReq.SchedulePID
+	return
+}
+
+// return signed .ics feed URL of a teacher/student/relative (subscribed in calendar apps)
+func scheduleFeedURLHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var queryReq ScheduleQueryReq
+	var err error
+	if err = json.Unmarshal(params.Data, &queryReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+	if serverConfig.CalendarFeedSecret == "" {
+		response.Status = http.StatusNotFound
+		response.Message = fmt.Sprintf("[%s] - Calendar feeds are disabled (no calendarFeedSecret configured)", serverErrorMessages[seAPINotSupport])
+		return
+	}
+	if !scheduleOwnerMap[queryReq.OwnerType] || queryReq.OwnerPID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specify owner_type (%s/%s/%s) and owner_pid", serverErrorMessages[seInputJSONNotValid],
+			ScheduleOwnerTeacher, ScheduleOwnerStudent, ScheduleOwnerRelative)
+		return
+	}
+	if err = scheduleOwnerCheck(ctx, &queryReq); err != nil {
+		response.Status = http.StatusForbidden
+		response.Message = err.Error()
+		return
+	}
+
+	response.Payload = map[string]string{
+		"feed_url": fmt.Sprintf(scheduleFeedURLFormat, queryReq.OwnerType, queryReq.OwnerPID.Hex(), scheduleFeedSuffix,
+			scheduleFeedTokenQuery, scheduleFeedToken(queryReq.OwnerType, queryReq.OwnerPID)),
+	}
+	return
+}
+
+// upcoming occurrences and feed url are only given to their owner: a relative (relative_wxid=?) for itself or a bound student,
+// a teacher (auth token) for itself or students and relatives of its institute, and super-admin for anyone
+func scheduleOwnerCheck(ctx *gin.Context, queryReq *ScheduleQueryReq) error {
+	if queryReq.RelativeWXID != "" {
+		relativeFound, err := findRelativeByWXID(ctx.Request.Context(), queryReq.RelativeWXID)
+		if err != nil || relativeFound == nil {
+			return fmt.Errorf("[%s] - No relative found with wechat id \"%s\"", serverErrorMessages[seResourceNotFound], queryReq.RelativeWXID)
+		}
+		switch queryReq.OwnerType {
+		case ScheduleOwnerRelative:
+			if relativeFound.PID == queryReq.OwnerPID {
+				return nil
+			}
+		case ScheduleOwnerStudent:
+			references, err := findStudentRelativeRef(ctx.Request.Context(), queryReq.OwnerPID, relativeFound.PID)
+			if err != nil {
+				return err
+			}
+			if len(references) > 0 {
+				return nil
+			}
+		}
+		return fmt.Errorf("[%s] - Relative (PID %s) is not %s (PID %s) or bound to it", serverErrorMessages[seResourceNotMatched],
+			relativeFound.PID.Hex(), queryReq.OwnerType, queryReq.OwnerPID.Hex())
+	}
+
+	if !ginContextIsStaff(ctx) {
+		return fmt.Errorf("[%s] - Please specify relative_wxid, teacher token (%s header) or admin token", serverErrorMessages[seInputParamNotValid],
+			ginHeaderAuthorization)
+	}
+	scope := tenantScopeFromContext(ctx.Request.Context())
+	if scope.SuperAdmin {
+		return nil
+	}
+	var ownerFound bool
+	switch queryReq.OwnerType {
+	case ScheduleOwnerTeacher:
+		ownerFound = queryReq.OwnerPID == scope.TeacherPID
+	case ScheduleOwnerStudent:
+		students, err := findStudent(ctx.Request.Context(), queryReq.OwnerPID)
+		if err != nil {
+			return err
+		}
+		ownerFound = len(students) > 0
+	case ScheduleOwnerRelative:
+		relatives, err := findRelative(ctx.Request.Context(), queryReq.OwnerPID)
+		if err != nil {
+			return err
+		}
+		ownerFound = len(relatives) > 0
+	}
+	if !ownerFound {
+		return fmt.Errorf("[%s] - Teacher (PID %s) may not access schedule of %s (PID %s)", serverErrorMessages[seResourceNotMatched],
+			scope.TeacherPID.Hex(), queryReq.OwnerType, queryReq.OwnerPID.Hex())
+	}
+	return nil
+}
+
+// serve .ics feed (GET /api/0/calendar/:owner/:feed, feed is <pid>.ics, token query required)
+func scheduleCalendarFeedHandler(ctx *gin.Context) {
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+
+	ownerType := ctx.Param("owner")
+	ownerPID, err := primitive.ObjectIDFromHex(strings.TrimSuffix(ctx.Param("feed"), scheduleFeedSuffix))
+	token := ctx.Query(scheduleFeedTokenQuery)
+	if serverConfig.CalendarFeedSecret == "" || err != nil || !scheduleOwnerMap[ownerType] ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(scheduleFeedToken(ownerType, ownerPID))) != 1 {
+		response.Status = http.StatusNotFound
+		response.Message = fmt.Sprintf("[%s] - No calendar feed found", serverErrorMessages[seResourceNotFound])
+		ginContextProcessResponse(ctx, &response)
+		return
+	}
+
+	courses, err := scheduleOwnerCourses(ctx.Request.Context(), ownerType, ownerPID)
+	var occurrences []*ScheduleOccurrence
+	if err == nil {
+		var now = time.Now()
+		occurrences, err = courseScheduleUpcoming(ctx.Request.Context(), courses, now.AddDate(0, 0, -scheduleFeedPastDays),
+			now.AddDate(0, 0, serverConfig.CalendarFeedDays))
+	}
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		ginContextProcessResponse(ctx, &response)
+		return
+	}
+
+	occurrences = scheduleOwnerOccurrences(occurrences, ownerType, ownerPID)
+	ctx.Data(http.StatusOK, scheduleFeedContentType, []byte(scheduleCalendarFeed(ownerType, occurrences)))
+}
+
+// HMAC token of a feed owner (feed URL cannot carry auth headers)
+func scheduleFeedToken(ownerType string, ownerPID primitive.ObjectID) string {
+	mac := hmac.New(sha256.New, []byte(serverConfig.CalendarFeedSecret))
+	mac.Write([]byte(ownerType + ":" + ownerPID.Hex()))
+	return hex.EncodeToString(mac.Sum(nil))[:scheduleFeedTokenLength]
+}
+
+// courses of a teacher (taught or assisted), a student (enrolled) or a relative (enrolled by bound students)
+func scheduleOwnerCourses(ctx context.Context, ownerType string, ownerPID primitive.ObjectID) ([]*Course, error) {
+	if ownerPID.IsZero() {
+		return nil, fmt.Errorf("[%s] - Please specify owner_pid", serverErrorMessages[seInputJSONNotValid])
+	}
+
+	var studentPIDs = []primitive.ObjectID{}
+	switch ownerType {
+	case ScheduleOwnerTeacher:
+		return findCourseByStaffPID(ctx, ownerPID)
+	case ScheduleOwnerStudent:
+		studentPIDs = append(studentPIDs, ownerPID)
+	case ScheduleOwnerRelative:
+		references, err := findStudentRelativeRef(ctx, primitive.NilObjectID, ownerPID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range references {
+			studentPIDs = append(studentPIDs, references[i].StudentPID)
+		}
+	default:
+		return nil, fmt.Errorf("[%s] - owner_type must be %s/%s/%s", serverErrorMessages[seInputJSONNotValid],
+			ScheduleOwnerTeacher, ScheduleOwnerStudent, ScheduleOwnerRelative)
+	}
+
+	var coursePIDMap = map[primitive.ObjectID]bool{}
+	var coursePIDs = []primitive.ObjectID{}
+	for _, studentPID := range studentPIDs {
+		references, err := findStudentCourseRef(ctx, studentPID, primitive.NilObjectID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range references {
+			if !coursePIDMap[references[i].CoursePID] {
+				coursePIDMap[references[i].CoursePID] = true
+				coursePIDs = append(coursePIDs, references[i].CoursePID)
+			}
+		}
+	}
+	return findCourseByPIDs(ctx, coursePIDs)
+}
+
+// render occurrences as iCalendar (RFC 5545), times in UTC
+func scheduleCalendarFeed(ownerType string, occurrences []*ScheduleOccurrence) string {
+	const icsTimeLayout = "20060102T150405Z"
+	var builder strings.Builder
+	var writeLine = func(line string) {
+		// fold long lines (continuation lines start with a space)
+		for len(line) > scheduleFeedLineLimit {
+			cut := scheduleFeedLineLimit
+			for cut > 1 && line[cut]&0xC0 == 0x80 { // do not split utf-8 sequences
+				cut--
+			}
+			builder.WriteString(line[:cut] + "\r\n")
+			line = " " + line[cut:]
+		}
+		builder.WriteString(line + "\r\n")
+	}
+
+	var stamp = time.Now().UTC().Format(icsTimeLayout)
+	writeLine("BEGIN:VCALENDAR")
+	writeLine("VERSION:2.0")
+	writeLine("PRODID:-//klog//course schedule//EN")
+	writeLine("CALSCALE:GREGORIAN")
+	writeLine("METHOD:PUBLISH")
+	writeLine("X-WR-CALNAME:" + scheduleCalendarEscape("klog "+ownerType+" courses"))
+	for _, occurrence := range occurrences {
+		status := "CONFIRMED"
+		if occurrence.Cancelled {
+			status = "CANCELLED"
+		}
+		writeLine("BEGIN:VEVENT")
+		writeLine(fmt.Sprintf("UID:%s-%s@klog", occurrence.SchedulePID.Hex(), strings.Replace(occurrence.Date, "-", "", -1)))
+		writeLine("DTSTAMP:" + stamp)
+		writeLine("DTSTART:" + time.Unix(occurrence.StartTS, 0).UTC().Format(icsTimeLayout))
+		writeLine("DTEND:" + time.Unix(occurrence.EndTS, 0).UTC().Format(icsTimeLayout))
+		writeLine("SUMMARY:" + scheduleCalendarEscape(occurrence.CourseName))
+		if occurrence.Location != "" {
+			writeLine("LOCATION:" + scheduleCalendarEscape(occurrence.Location))
+		}
+		writeLine("STATUS:" + status)
+		writeLine("END:VEVENT")
+	}
+	writeLine("END:VCALENDAR")
+	return builder.String()
+}
+
+// escape iCalendar text value
+func scheduleCalendarEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
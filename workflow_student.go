@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sort"
 	"time"
 
+	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/gin-gonic/gin"
-	"github.com/rs/xid"
+	"github.com/skip2/go-qrcode"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+const (
+	studentImageQueryStudent = "student_pid"
+	studentImageCacheControl = "public, max-age=31536000, immutable" // image blob names change with every upload
+)
+
+// standard sizes of student images (pixel, square), largest first
+var studentImageVariantSizes = []int{512, 256, 128}
+
 func studentGenerateCodeHandler(ctx *gin.Context) {
 	params := ginContextRequestParameter(ctx)
 	response := GinResponse{
@@ -38,7 +49,7 @@ func studentGenerateCodeHandler(ctx *gin.Context) {
 
 	// find student by PID
 	var students []*Student
-	students, err = findStudent(studentRelativeBindInfo.StudentPID)
+	students, err = findStudent(ctx.Request.Context(), studentRelativeBindInfo.StudentPID)
 	if err != nil || len(students) == 0 {
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - No student found with PID %s", serverErrorMessages[seResourceNotFound], studentRelativeBindInfo.StudentPID.Hex())
@@ -47,7 +58,7 @@ func studentGenerateCodeHandler(ctx *gin.Context) {
 	var studentFound = students[0]
 
 	// do not generate code if a main relative relationship exists
-	studentReferences, err := findStudentRelativeRef(studentFound.PID, primitive.NilObjectID)
+	studentReferences, err := findStudentRelativeRef(ctx.Request.Context(), studentFound.PID, primitive.NilObjectID)
 	var mainReference *StudentRelativeRef = nil
 	if err == nil && len(studentReferences) > 0 {
 		for i := 0; i < len(studentReferences); i++ {
@@ -64,12 +75,30 @@ func studentGenerateCodeHandler(ctx *gin.Context) {
 		return
 	}
 
-	// generate binding code
-	studentFound.BindingCode = xid.New().String()
-	studentFound.BindingExpire = int64(time.Now().Unix()) + int64(3600*serverConfig.StudentBindingCodeLifeTime) // expired after one week
-	updateStudent(studentFound)
+	// revoke previous code and generate a new one (unique index allows one active code per student)
+	revokeBindingCode(ctx.Request.Context(), studentFound.PID)
+	var bindingCode *BindingCode
+	bindingCode, err = createBindingCode(ctx.Request.Context(), studentFound)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("%s -> no binding code generated", err.Error())
+		return
+	}
+
+	// a concurrent binding may have created the main relative after the check above -> revoke the new code
+	studentReferences, err = findStudentRelativeRef(ctx.Request.Context(), studentFound.PID, primitive.NilObjectID)
+	for i := 0; err == nil && i < len(studentReferences); i++ {
+		if studentReferences[i].IsMain {
+			revokeBindingCode(ctx.Request.Context(), studentFound.PID)
+			response.Status = http.StatusConflict
+			response.Message = fmt.Sprintf("[%s] - Student (PID %s) already has a main relative binding (PID %s) -> no binding code generated",
+				serverErrorMessages[seResourceConflict], studentFound.PID.Hex(), studentReferences[i].RelativePID.Hex())
+			return
+		}
+	}
+	metricsBindingCodeIssuedTotal.Inc()
 
-	response.Payload = studentFound
+	response.Payload = bindingCode
 	return
 }
 
@@ -92,41 +121,76 @@ func studentBindingRelativeHandler(ctx *gin.Context) {
 	}
 
 	// check student binding code and relative wechat id
-	if studentRelativeBindInfo.RelativeWXID == "" || studentRelativeBindInfo.BindingCode == "" {
+	var code = bindingCodeFromInput(studentRelativeBindInfo.BindingCode)
+	if studentRelativeBindInfo.RelativeWXID == "" || code == "" {
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - Please specified valid relative_wxid and binding_code", serverErrorMessages[seInputJSONNotValid])
 		return
 	}
 
+	// attempt limiting (short codes could be brute-forced): attempt is recorded before any lookup and removed again once binding
+	// succeeds, so unknown wechat ids and concurrent requests are counted too, then limited per wechat id, code, client IP and in total
+	attemptPID, attemptErr := createBindingAttempt(ctx.Request.Context(), studentRelativeBindInfo.RelativeWXID, code, ctx.ClientIP())
+	if attemptErr != nil || bindingAttemptLimited(ctx.Request.Context(), studentRelativeBindInfo.RelativeWXID, code, ctx.ClientIP()) {
+		metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultLimited).Inc()
+		response.Status = http.StatusTooManyRequests
+		response.Message = fmt.Sprintf("[%s] - Too many failed binding attempts, please retry in %d minutes", serverErrorMessages[seResourceConflict],
+			serverConfig.BindingAttemptWindow)
+		return
+	}
+
 	// find relative by wechat id
 	var relativeFound *Relative
-	relativeFound, err = findRelativeByWXID(studentRelativeBindInfo.RelativeWXID)
+	relativeFound, err = findRelativeByWXID(ctx.Request.Context(), studentRelativeBindInfo.RelativeWXID)
 	if err != nil || relativeFound == nil {
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - No relative found with wechat id \"%s\"", serverErrorMessages[seResourceNotFound], studentRelativeBindInfo.RelativeWXID)
 		return
 	}
 
-	// find student by binding code
-	var studentFound *Student
-	studentFound, err = findStudentByBindingCode(studentRelativeBindInfo.BindingCode)
-	if err != nil || studentFound == nil {
+	// binding code may be an invite from main relative -> bind as secondary relative
+	var inviteFound *RelativeInvite
+	inviteFound, err = findRelativeInviteByCode(ctx.Request.Context(), code)
+	if err == nil && inviteFound != nil {
+		studentRedeemRelativeInvite(ctx, &response, inviteFound, relativeFound, &studentRelativeBindInfo)
+		if response.Status == http.StatusOK {
+			deleteBindingAttempt(ctx.Request.Context(), attemptPID)
+		}
+		return
+	}
+
+	// find active binding code
+	var bindingCode *BindingCode
+	bindingCode, err = findActiveBindingCode(ctx.Request.Context(), code, primitive.NilObjectID)
+	if err != nil || bindingCode == nil {
+		metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultNotFound).Inc()
 		response.Status = http.StatusConflict
-		response.Message = fmt.Sprintf("[%s] - No student found with binding code \"%s\"", serverErrorMessages[seResourceNotFound], studentRelativeBindInfo.BindingCode)
+		response.Message = fmt.Sprintf("[%s] - No student found with binding code \"%s\"", serverErrorMessages[seResourceNotFound], code)
 		return
 	}
 
 	// check if binding code is expired
 	var curTS = int64(time.Now().Unix())
-	if curTS > studentFound.BindingExpire {
+	if curTS > bindingCode.ExpireTS {
+		metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultExpired).Inc()
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - Binding code (%s) for student (PID %s) is expired at %v", serverErrorMessages[seResourceExpired],
-			studentFound.BindingCode, studentFound.PID.Hex(), time.Unix(studentFound.BindingExpire, 0).Format(time.RFC3339))
+			bindingCode.Code, bindingCode.StudentPID.Hex(), time.Unix(bindingCode.ExpireTS, 0).Format(time.RFC3339))
+		return
+	}
+
+	// claim binding code atomically -> only one request can redeem it
+	err = claimBindingCode(ctx.Request.Context(), bindingCode, relativeFound.PID)
+	if err != nil {
+		metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultConflict).Inc()
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("%s --> could not bind student (PID %s) and relative (PID %s)",
+			err.Error(), bindingCode.StudentPID.Hex(), relativeFound.PID.Hex())
 		return
 	}
 
 	var reference StudentRelativeRef
-	reference.StudentPID = studentFound.PID
+	reference.StudentPID = bindingCode.StudentPID
 	reference.RelativePID = relativeFound.PID
 	reference.IsMain = true
 	if studentRelativeBindInfo.Relationship == "" {
@@ -136,23 +200,72 @@ func studentBindingRelativeHandler(ctx *gin.Context) {
 	}
 
 	var referencePID = primitive.NilObjectID
-	referencePID, err = createStudentRelativeRef(&reference)
+	referencePID, err = createStudentRelativeRef(ctx.Request.Context(), &reference)
 	if err != nil {
+		// give the code back unless student already has a main relative (code is useless then)
+		if !errors.Is(err, errStudentRelativeRefMainExists) {
+			restoreBindingCode(ctx.Request.Context(), bindingCode, relativeFound.PID)
+		}
+		metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultConflict).Inc()
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - %s --> could not bind student (PID %s) and relative (PID %s)", serverErrorMessages[seResourceConflict],
-			err.Error(), studentFound.PID.Hex(), relativeFound.PID.Hex())
+			err.Error(), bindingCode.StudentPID.Hex(), relativeFound.PID.Hex())
 		return
 	}
 
-	// remove binding code from student information
-	studentFound.BindingCode = ""
-	studentFound.BindingExpire = 0
-	updateStudent(studentFound)
+	// a concurrent code generation may have issued a new code before the main relative was created -> revoke it
+	revokeBindingCode(ctx.Request.Context(), bindingCode.StudentPID)
+	deleteBindingAttempt(ctx.Request.Context(), attemptPID)
+	metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultSuccess).Inc()
 
 	response.Payload = referencePID
 	return
 }
 
+// studentRedeemRelativeInvite binds student with a secondary (non-main) relative using an invite of main relative
+func studentRedeemRelativeInvite(ctx *gin.Context, response *GinResponse, invite *RelativeInvite, relative *Relative, bindInfo *StudentRelativeBindInfo) {
+	// check if invite is expired
+	var curTS = int64(time.Now().Unix())
+	if curTS > invite.InviteExpire {
+		metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultExpired).Inc()
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - Invite code (%s) for student (PID %s) is expired at %v", serverErrorMessages[seResourceExpired],
+			invite.InviteCode, invite.StudentPID.Hex(), time.Unix(invite.InviteExpire, 0).Format(time.RFC3339))
+		return
+	}
+
+	if invite.Status == RelativeInviteStatusRedeemed {
+		metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultConflict).Inc()
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - Invite code (%s) for student (PID %s) has been redeemed", serverErrorMessages[seResourceConflict],
+			invite.InviteCode, invite.StudentPID.Hex())
+		return
+	}
+
+	var reference StudentRelativeRef
+	reference.StudentPID = invite.StudentPID
+	reference.RelativePID = relative.PID
+	reference.IsMain = false
+	reference.Permission = invite.Permission
+	reference.Relationship = invite.Relationship
+	if bindInfo.Relationship != "" {
+		reference.Relationship = bindInfo.Relationship
+	}
+
+	// invite is claimed together with the binding -> redeemed once, still pending if binding fails
+	referencePID, err := redeemRelativeInvite(ctx.Request.Context(), invite, &reference)
+	if err != nil {
+		metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultConflict).Inc()
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("%s --> could not bind student (PID %s) and relative (PID %s)",
+			err.Error(), invite.StudentPID.Hex(), relative.PID.Hex())
+		return
+	}
+
+	metricsBindingCodeRedeemedTotal.WithLabelValues(metricsResultSuccess).Inc()
+	response.Payload = referencePID
+}
+
 // unbind all relatives for a student (delete main relative-> other should be deleted)
 func studentUnbindingRelativeHandler(ctx *gin.Context) {
 	params := ginContextRequestParameter(ctx)
@@ -179,7 +292,7 @@ func studentUnbindingRelativeHandler(ctx *gin.Context) {
 	}
 
 	var deleteCnt int = 0
-	deleteCnt, err = deleteStudentRelativeRef(studentRelativeBindInfo.StudentPID, primitive.NilObjectID)
+	deleteCnt, err = deleteStudentRelativeRef(ctx.Request.Context(), studentRelativeBindInfo.StudentPID, primitive.NilObjectID)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - Error occurs during unbind student (PID %s) relative references - %s",
@@ -187,10 +300,119 @@ func studentUnbindingRelativeHandler(ctx *gin.Context) {
 		return
 	}
 
+	// pending invites of secondary relatives are no longer valid without main relative
+	deleteRelativeInviteByStudentPID(ctx.Request.Context(), studentRelativeBindInfo.StudentPID)
+	revokeBindingCode(ctx.Request.Context(), studentRelativeBindInfo.StudentPID)
+
 	response.Payload = fmt.Sprintf("Unbind %d relatives for student (PID %s)", deleteCnt, studentRelativeBindInfo.StudentPID.Hex())
 	return
 }
 
+// revoke active binding code of a student (e.g. code printed or shared by mistake)
+func studentRevokeCodeHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var studentRelativeBindInfo StudentRelativeBindInfo
+	var err error
+	if err = json.Unmarshal(params.Data, &studentRelativeBindInfo); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	// check student PID
+	if studentRelativeBindInfo.StudentPID.IsZero() {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - Please specified valid student PID", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+
+	var revokeCnt int
+	revokeCnt, err = revokeBindingCode(ctx.Request.Context(), studentRelativeBindInfo.StudentPID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	response.Payload = fmt.Sprintf("Revoke %d binding codes for student (PID %s)", revokeCnt, studentRelativeBindInfo.StudentPID.Hex())
+	return
+}
+
+// render active binding code of a student as PNG QR code image (GET, student_pid=?)
+func studentBindingQRCodeHandler(ctx *gin.Context) {
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+
+	studentPID, err := primitive.ObjectIDFromHex(ctx.Request.URL.Query().Get(bindingCodeQRQueryStudent))
+	if err != nil || studentPID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specifiy a valid student PID (student_pid=?)", serverErrorMessages[seInputParamNotValid])
+		ginContextProcessResponse(ctx, &response)
+		return
+	}
+
+	bindingCode, err := findActiveBindingCode(ctx.Request.Context(), "", studentPID)
+	if err != nil || bindingCode == nil || time.Now().Unix() > bindingCode.ExpireTS {
+		response.Status = http.StatusNotFound
+		response.Message = fmt.Sprintf("[%s] - No valid binding code for student (PID %s), please generate a new one",
+			serverErrorMessages[seResourceNotFound], studentPID.Hex())
+		ginContextProcessResponse(ctx, &response)
+		return
+	}
+
+	png, err := qrcode.Encode(bindingCodeQRPrefix+bindingCode.Code, qrcode.Medium, bindingCodeQRImageSize)
+	if err != nil {
+		response.Status = http.StatusInternalServerError
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seUnresolvedError], err.Error())
+		ginContextProcessResponse(ctx, &response)
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, bindingCodeQRContentType, png)
+}
+
+// studentAccessCheck lets a relative (relative_wxid) bound to the student, a teacher of the student's institute (auth token)
+// or super-admin read student data, return error
+func studentAccessCheck(ctx *gin.Context, studentPID primitive.ObjectID, relativeWXID string) error {
+	if studentPID.IsZero() {
+		return fmt.Errorf("[%s] - Please specify student_pid", serverErrorMessages[seInputJSONNotValid])
+	}
+	if relativeWXID != "" {
+		relativeFound, err := findRelativeByWXID(ctx.Request.Context(), relativeWXID)
+		if err != nil || relativeFound == nil {
+			return fmt.Errorf("[%s] - No relative found with wechat id \"%s\"", serverErrorMessages[seResourceNotFound], relativeWXID)
+		}
+		references, err := findStudentRelativeRef(ctx.Request.Context(), studentPID, relativeFound.PID)
+		if err != nil {
+			return err
+		}
+		if len(references) == 0 {
+			return fmt.Errorf("[%s] - Relative (PID %s) is not bound to student (PID %s)", serverErrorMessages[seResourceNotMatched],
+				relativeFound.PID.Hex(), studentPID.Hex())
+		}
+		return nil
+	}
+
+	if !ginContextIsStaff(ctx) {
+		return fmt.Errorf("[%s] - Please specify relative_wxid, teacher token (%s header) or admin token", serverErrorMessages[seInputParamNotValid],
+			ginHeaderAuthorization)
+	}
+	students, err := findStudent(ctx.Request.Context(), studentPID)
+	if err != nil || len(students) == 0 {
+		return fmt.Errorf("[%s] - No student found with PID %s", serverErrorMessages[seResourceNotFound], studentPID.Hex())
+	}
+	return nil
+}
+
 func studentMediaQueryHandler(ctx *gin.Context) {
 	params := ginContextRequestParameter(ctx)
 	response := GinResponse{
@@ -207,17 +429,22 @@ func studentMediaQueryHandler(ctx *gin.Context) {
 		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
 		return
 	}
+	if err = studentAccessCheck(ctx, mediaReq.StudentPID, mediaReq.RelativeWXID); err != nil {
+		response.Status = http.StatusForbidden
+		response.Message = err.Error()
+		return
+	}
 
 	// find student by PID
 	var students []*Student
-	students, err = findStudent(mediaReq.StudentPID)
+	students, err = findStudent(ctx.Request.Context(), mediaReq.StudentPID)
 	if err != nil || len(students) == 0 {
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - No student found with PID %s", serverErrorMessages[seResourceNotFound], mediaReq.StudentPID.Hex())
 		return
 	}
 
-	cloudMediaSlice, err := findCloudMediaByStudentPID(mediaReq.StudentPID, false)
+	cloudMediaSlice, err := findCloudMediaByStudentPID(ctx.Request.Context(), mediaReq.StudentPID, false)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - Error occurs when searching cloud media for student (PID %s): %s",
@@ -225,17 +452,304 @@ func studentMediaQueryHandler(ctx *gin.Context) {
 		return
 	}
 
+	// session media is shared by students attending the session (present or makeup)
+	courseRecords, err := findCourseRecordByStudentPIDAndCoursePID(ctx.Request.Context(), mediaReq.StudentPID, primitive.NilObjectID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - Error occurs when searching course records for student (PID %s): %s",
+			serverErrorMessages[seResourceNotFound], mediaReq.StudentPID.Hex(), err.Error())
+		return
+	}
+	var sessionPIDs = []primitive.ObjectID{}
+	for i := range courseRecords {
+		if !courseRecords[i].SessionPID.IsZero() && courseRecords[i].Attendance != AttendanceAbsent {
+			sessionPIDs = append(sessionPIDs, courseRecords[i].SessionPID)
+		}
+	}
+	sessionMediaSlice, err := findCloudMediaBySessionPID(ctx.Request.Context(), sessionPIDs)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - Error occurs when searching session media for student (PID %s): %s",
+			serverErrorMessages[seResourceNotFound], mediaReq.StudentPID.Hex(), err.Error())
+		return
+	}
+	cloudMediaSlice = append(cloudMediaSlice, sessionMediaSlice...)
+
+	// near-duplicates collapsed by teachers and group media hidden for the student are left out
 	cloudMediaRes := []*CloudMedia{}
 	for i := range cloudMediaSlice {
-		if cloudMediaSlice[i].CreateTS <= mediaReq.EndTS && cloudMediaSlice[i].CreateTS >= mediaReq.StartTS {
+		if cloudMediaSlice[i].Collapsed {
+			continue
+		}
+		if link := cloudMediaStudentLink(cloudMediaSlice[i], mediaReq.StudentPID); link != nil && link.Hidden {
+			continue
+		}
+		if mediaTS := cloudMediaTS(cloudMediaSlice[i]); mediaTS <= mediaReq.EndTS && mediaTS >= mediaReq.StartTS {
 			cloudMediaRes = append(cloudMediaRes, cloudMediaSlice[i])
 		}
 	}
 
 	sort.Slice(cloudMediaRes, func(i, j int) bool {
-		return cloudMediaRes[i].CreateTS < cloudMediaRes[j].CreateTS
+		return cloudMediaTS(cloudMediaRes[i]) < cloudMediaTS(cloudMediaRes[j])
 	})
 
-	response.Payload = cloudMediaRes
+	// relatives see media without the other students it is linked to
+	views := []*CloudMediaStudentView{}
+	for i := range cloudMediaRes {
+		views = append(views, cloudMediaStudentView(cloudMediaRes[i]))
+	}
+	response.Payload = views
 	return
 }
+
+// per-target progress (rubric scores over time) of a student in one or all enrolled courses
+func studentProgressHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var progressReq StudentProgressReq
+	var err error
+	if err = json.Unmarshal(params.Data, &progressReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+	if progressReq.StudentPID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specify student_pid", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+	if err = studentAccessCheck(ctx, progressReq.StudentPID, progressReq.RelativeWXID); err != nil {
+		response.Status = http.StatusForbidden
+		response.Message = err.Error()
+		return
+	}
+	if progressReq.EndTS <= 0 {
+		progressReq.EndTS = time.Now().Unix()
+	}
+
+	// enrolled courses (or the given one)
+	var references []*StudentCourseRef
+	references, err = findStudentCourseRef(ctx.Request.Context(), progressReq.StudentPID, progressReq.CoursePID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	var coursePIDs = []primitive.ObjectID{}
+	for i := range references {
+		coursePIDs = append(coursePIDs, references[i].CoursePID)
+	}
+	var courses []*Course
+	courses, err = findCourseByPIDs(ctx.Request.Context(), coursePIDs)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+
+	var courseRecords []*CourseRecord
+	courseRecords, err = findCourseRecordByStudentPIDAndCoursePID(ctx.Request.Context(), progressReq.StudentPID, progressReq.CoursePID)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	sort.Slice(courseRecords, func(i, j int) bool {
+		return courseRecords[i].RecordTS < courseRecords[j].RecordTS
+	})
+
+	var progresses = []*CourseProgress{}
+	for _, course := range courses {
+		progresses = append(progresses, studentCourseProgress(course, courseRecords, progressReq.StartTS, progressReq.EndTS))
+	}
+	response.Payload = progresses
+	return
+}
+
+// progress of course targets from assessed course records (sorted by record time) within [startTS, endTS]
+func studentCourseProgress(course *Course, courseRecords []*CourseRecord, startTS int64, endTS int64) *CourseProgress {
+	const trendPeriod = 30 * 24 * 3600
+	var progress = CourseProgress{
+		CoursePID:  course.PID,
+		CourseName: course.CourseName,
+		Rubric:     courseRubric(course),
+		Targets:    []*TargetProgress{},
+	}
+	var targetMap = map[string]*TargetProgress{}
+	for _, courseTarget := range course.CourseTargets {
+		var target = TargetProgress{Tag: courseTarget.Tag, Desc: courseTarget.Desc, Level: courseTarget.Level, Retired: courseTarget.Retired,
+			Points: []*ProgressPoint{}}
+		targetMap[courseTarget.Tag] = &target
+		progress.Targets = append(progress.Targets, &target)
+	}
+
+	for _, courseRecord := range courseRecords {
+		if courseRecord.CoursePID != course.PID || courseRecord.RecordTS < startTS || courseRecord.RecordTS > endTS {
+			continue
+		}
+		for _, assessed := range courseRecord.Targets {
+			if target, exist := targetMap[assessed.Tag]; exist {
+				target.Points = append(target.Points, &ProgressPoint{RecordPID: courseRecord.PID, RecordTS: courseRecord.RecordTS, Score: assessed.Score})
+			}
+		}
+	}
+
+	// average, latest score and least squares slope of score over time
+	for _, target := range progress.Targets {
+		var count = float64(len(target.Points))
+		if count == 0 {
+			continue
+		}
+		var sumT, sumS, sumTT, sumTS float64
+		for _, point := range target.Points {
+			t := float64(point.RecordTS-target.Points[0].RecordTS) / trendPeriod
+			s := float64(point.Score)
+			sumT += t
+			sumS += s
+			sumTT += t * t
+			sumTS += t * s
+		}
+		target.Average = sumS / count
+		target.Latest = target.Points[len(target.Points)-1].Score
+		if denominator := count*sumTT - sumT*sumT; denominator > 0 {
+			target.Trend = (count*sumTS - sumT*sumS) / denominator
+		}
+	}
+	return &progress
+}
+
+// change lifecycle status of a student (active/paused/graduated/withdrawn)
+func studentStatusHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var statusReq StudentStatusReq
+	var err error
+	if err = json.Unmarshal(params.Data, &statusReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	var student *Student
+	student, err = updateStudentStatus(ctx.Request.Context(), &statusReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = student
+	return
+}
+
+// upload student image (JPEG/PNG/WebP as request body), stored as upright center-cropped jpeg in standard sizes
+func studentImageUploadHandler(ctx *gin.Context) {
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var maxSize = int64(serverConfig.StudentImageMaxSize) * 1024 * 1024
+	if ctx.Request.ContentLength > maxSize {
+		response.Status = http.StatusRequestEntityTooLarge
+		response.Message = fmt.Sprintf("[%s] - Student image is larger than %d MB", serverErrorMessages[seInputParamNotValid], serverConfig.StudentImageMaxSize)
+		return
+	}
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxSize)
+	params := ginContextRequestParameter(ctx)
+
+	studentPID, err := primitive.ObjectIDFromHex(ctx.Request.URL.Query().Get(studentImageQueryStudent))
+	if err != nil || studentPID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specifiy a valid student PID (student_pid=?)", serverErrorMessages[seInputParamNotValid])
+		return
+	}
+	if len(params.Data) == 0 {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please upload a student image (JPEG/PNG/WebP up to %d MB) as request body",
+			serverErrorMessages[seInputParamNotValid], serverConfig.StudentImageMaxSize)
+		return
+	}
+
+	var students []*Student
+	students, err = findStudent(ctx.Request.Context(), studentPID)
+	if err != nil || len(students) == 0 {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - No student found with PID %s", serverErrorMessages[seResourceNotFound], studentPID.Hex())
+		return
+	}
+	var student = students[0]
+	var previousImageNames = studentImageBlobNames(student)
+
+	img, format, err := imageDecodeUpload(params.Data)
+	if err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = err.Error()
+		return
+	}
+	var orientation = imageExifOrientation(params.Data, format)
+	var square = imageCenterSquare(img.Bounds())
+
+	// new blob names per upload (upload time), old URLs stay cached by clients but are not referenced anymore
+	var version = time.Now().UnixNano()
+	if version <= student.StudentImageVersion {
+		version = student.StudentImageVersion + 1
+	}
+	var variants = []StudentImageVariant{}
+	var uploadedNames = []string{}
+	for _, size := range studentImageVariantSizes {
+		var data []byte
+		data, err = imageEncodeJPEG(imageOrient(imageResize(img, square, size, size), orientation))
+		if err == nil {
+			var variant = StudentImageVariant{Size: size, ImageName: studentGetImageName(student.PID, version, size)}
+			variant.ImageURL = azMediaContainerURL.String() + "/" + variant.ImageName
+			err = azureStorageUploadBuffer(ctx.Request.Context(), azMediaContainerURL, variant.ImageName, data, imageContentTypeJPEG, studentImageCacheControl)
+			if err == nil {
+				variants = append(variants, variant)
+				uploadedNames = append(uploadedNames, variant.ImageName)
+			}
+		}
+		if err != nil {
+			studentImageDeleteBlobs(ctx.Request.Context(), uploadedNames)
+			response.Status = http.StatusConflict
+			response.Message = fmt.Sprintf("[%s] - could not store student (PID %s) image: %s", serverErrorMessages[seCloudOpsError], student.PID.Hex(), err.Error())
+			return
+		}
+	}
+
+	err = updateStudentImage(ctx.Request.Context(), student, version, variants)
+	if err != nil {
+		studentImageDeleteBlobs(ctx.Request.Context(), uploadedNames)
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	studentImageDeleteBlobs(ctx.Request.Context(), previousImageNames)
+
+	response.Payload = student
+	return
+}
+
+// delete student image blobs which are not referenced (anymore), failures are only logged (blob recycling removes leftovers)
+func studentImageDeleteBlobs(ctx context.Context, imageNames []string) {
+	for _, imageName := range imageNames {
+		if err := azureStorageDeleteBlob(ctx, azMediaContainerURL, imageName); err != nil {
+			if serr, ok := err.(azblob.StorageError); !ok || serr.ServiceCode() != azblob.ServiceCodeBlobNotFound {
+				loggingWithContext(ctx).Warnmf(logModStudentMgmt, "Could not delete student image %s: %s", imageName, err.Error())
+			}
+		}
+	}
+}
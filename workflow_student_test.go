@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	testRaceRounds    = 10
+	testRaceRelatives = 6
+	testRaceWorkers   = 8
+	testRaceTimeout   = 30 * time.Second
+	testAttemptLimit  = 5
+)
+
+// testUnbindStudent removes all references and active binding codes of a student
+func testUnbindStudent(t *testing.T, studentPID primitive.ObjectID) {
+	if _, err := deleteStudentRelativeRef(context.Background(), studentPID, primitive.NilObjectID); err != nil {
+		t.Fatalf("could not unbind student: %s", err.Error())
+	}
+	if _, err := revokeBindingCode(context.Background(), studentPID); err != nil {
+		t.Fatalf("could not revoke binding code: %s", err.Error())
+	}
+}
+
+// testBindingInvariants checks at most one main relative and one active code, and no active code next to a main relative
+func testBindingInvariants(t *testing.T, round int, studentPID primitive.ObjectID, checkCode bool) {
+	references, err := findStudentRelativeRef(context.Background(), studentPID, primitive.NilObjectID)
+	if err != nil {
+		t.Fatalf("round %d: could not find references: %s", round, err.Error())
+	}
+	var mainCount = 0
+	for _, reference := range references {
+		if reference.IsMain {
+			mainCount++
+		}
+	}
+	bindingCodes, err := findBindingCode(context.Background(), studentPID)
+	if err != nil {
+		t.Fatalf("round %d: could not find binding codes: %s", round, err.Error())
+	}
+	var activeCount = 0
+	for _, bindingCode := range bindingCodes {
+		if bindingCode.Status == BindingCodeStatusActive {
+			activeCount++
+		}
+	}
+
+	if mainCount > 1 {
+		t.Errorf("round %d: %d main relatives", round, mainCount)
+	}
+	if activeCount > 1 {
+		t.Errorf("round %d: %d active binding codes", round, activeCount)
+	}
+	if checkCode && mainCount == 1 && activeCount > 0 {
+		t.Errorf("round %d: active binding code pending while main relative exists", round)
+	}
+}
+
+// testGenerateCode issues a binding code through generate code workflow, empty if refused
+func testGenerateCode(router *gin.Engine, studentPID primitive.ObjectID) string {
+	status, payload := testPost(router, "/generatecode", StudentRelativeBindInfo{StudentPID: studentPID})
+	if status != http.StatusOK {
+		return ""
+	}
+	var bindingCode BindingCode
+	json.Unmarshal(payload, &bindingCode)
+	return bindingCode.Code
+}
+
+// many relatives redeem one code, and code generation races with binding
+func TestBindingGenerateCodeRace(t *testing.T) {
+	testDBSetup(t)
+	student, relatives := testStudentRelatives(t, testRaceRelatives)
+	router := testRouter(map[string]gin.HandlerFunc{
+		"/generatecode": studentGenerateCodeHandler,
+		"/bind":         studentBindingRelativeHandler,
+	})
+	bind := func(code string, relative *Relative) int {
+		status, _ := testPost(router, "/bind", StudentRelativeBindInfo{RelativeWXID: relative.RelativeWXID, BindingCode: code, Relationship: "Mother"})
+		return status
+	}
+
+	for round := 0; round < testRaceRounds; round++ {
+		// one code redeemed by all relatives at once -> exactly one binding
+		testUnbindStudent(t, student.PID)
+		code := testGenerateCode(router, student.PID)
+		if code == "" {
+			t.Fatalf("round %d: no binding code generated", round)
+		}
+		var successCount int
+		var successLock sync.Mutex
+		var jobs []func()
+		for _, relative := range relatives {
+			relative := relative
+			jobs = append(jobs, func() {
+				if bind(code, relative) == http.StatusOK {
+					successLock.Lock()
+					successCount++
+					successLock.Unlock()
+				}
+			})
+		}
+		testParallel(t, jobs, testRaceTimeout)
+		if successCount != 1 {
+			t.Errorf("round %d: %d successful bindings with one code", round, successCount)
+		}
+		testBindingInvariants(t, round, student.PID, true)
+
+		// new codes generated while relatives redeem the previous one
+		testUnbindStudent(t, student.PID)
+		code = testGenerateCode(router, student.PID)
+		jobs = nil
+		for i := 0; i < testRaceWorkers; i++ {
+			jobs = append(jobs, func() { testGenerateCode(router, student.PID) })
+		}
+		for _, relative := range relatives {
+			relative := relative
+			jobs = append(jobs, func() { bind(code, relative) })
+		}
+		testParallel(t, jobs, testRaceTimeout)
+		testBindingInvariants(t, round, student.PID, true)
+	}
+}
+
+// many relatives redeem one invite at once -> exactly one secondary relative, invite kept as redeemed
+func TestRelativeInviteRedeemRace(t *testing.T) {
+	testDBSetup(t)
+	student, relatives := testStudentRelatives(t, testRaceRelatives)
+	router := testRouter(map[string]gin.HandlerFunc{
+		"/bind": studentBindingRelativeHandler,
+	})
+
+	for round := 0; round < testRaceRounds; round++ {
+		testUnbindStudent(t, student.PID)
+		var invite = RelativeInvite{
+			StudentPID:   student.PID,
+			InviterPID:   relatives[0].PID,
+			InviteExpire: time.Now().Add(time.Hour).Unix(),
+			Relationship: "Father",
+			Permission:   RelativePermissionView,
+			CreateTS:     time.Now().Unix(),
+			InstitutePID: student.InstitutePID,
+		}
+		var err error
+		if invite.InviteCode, err = relativeInviteCodeGenerate(); err != nil {
+			t.Fatalf("round %d: could not generate invite code: %s", round, err.Error())
+		}
+		if _, err = createRelativeInvite(context.Background(), &invite); err != nil {
+			t.Fatalf("round %d: could not create invite: %s", round, err.Error())
+		}
+
+		var successCount int
+		var successLock sync.Mutex
+		var jobs []func()
+		for _, relative := range relatives {
+			relative := relative
+			jobs = append(jobs, func() {
+				status, _ := testPost(router, "/bind", StudentRelativeBindInfo{RelativeWXID: relative.RelativeWXID, BindingCode: invite.InviteCode})
+				if status == http.StatusOK {
+					successLock.Lock()
+					successCount++
+					successLock.Unlock()
+				}
+			})
+		}
+		testParallel(t, jobs, testRaceTimeout)
+		if successCount != 1 {
+			t.Errorf("round %d: %d successful redeems of one invite", round, successCount)
+		}
+
+		references, err := findStudentRelativeRef(context.Background(), student.PID, primitive.NilObjectID)
+		if err != nil {
+			t.Fatalf("round %d: could not find references: %s", round, err.Error())
+		}
+		if len(references) != 1 || references[0].IsMain {
+			t.Errorf("round %d: got %d references, want one secondary relative", round, len(references))
+		}
+		redeemed, err := findRelativeInviteByCode(context.Background(), invite.InviteCode)
+		if err != nil || redeemed == nil || redeemed.Status != RelativeInviteStatusRedeemed {
+			t.Errorf("round %d: invite not kept as redeemed", round)
+		} else if len(references) == 1 && redeemed.RedeemerPID != references[0].RelativePID {
+			t.Errorf("round %d: invite redeemer %s is not bound relative %s", round, redeemed.RedeemerPID.Hex(), references[0].RelativePID.Hex())
+		}
+	}
+}
+
+// guessing codes with a new (unknown) wechat id per attempt is still limited per client IP and for all clients
+func TestBindingAttemptEnumeration(t *testing.T) {
+	testDBSetup(t)
+	router := testRouter(map[string]gin.HandlerFunc{
+		"/bind": studentBindingRelativeHandler,
+	})
+	run := primitive.NewObjectID()
+	wxidPrefix := "test_enum_wxid_" + run.Hex()
+	bind := func(clientIP string, attempt int) int {
+		body, _ := json.Marshal(StudentRelativeBindInfo{RelativeWXID: fmt.Sprintf("%s_%d", wxidPrefix, attempt), BindingCode: fmt.Sprintf("%06d", attempt)})
+		request := httptest.NewRequest(http.MethodPost, "/bind", bytes.NewReader(body))
+		request.RemoteAddr = clientIP + ":40000"
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	t.Cleanup(func() {
+		dbPool.Collection(DBCollectionBindingAttempt).DeleteMany(context.Background(), bson.D{{"relative_wxid", bson.D{{"$regex", "^" + wxidPrefix}}}})
+	})
+	defer func(perIP int, total int) {
+		serverConfig.BindingMaxAttemptsPerIP = perIP
+		serverConfig.BindingMaxAttemptsTotal = total
+	}(serverConfig.BindingMaxAttemptsPerIP, serverConfig.BindingMaxAttemptsTotal)
+
+	// one client IP, wechat id and code differ on every attempt
+	serverConfig.BindingMaxAttemptsPerIP = testAttemptLimit
+	clientIP := fmt.Sprintf("10.%d.%d.1", run[10], run[11])
+	for attempt := 0; attempt < testAttemptLimit+3; attempt++ {
+		var want = http.StatusConflict
+		if attempt >= testAttemptLimit {
+			want = http.StatusTooManyRequests
+		}
+		if status := bind(clientIP, attempt); status != want {
+			t.Errorf("attempt %d from one IP: got status %d, want %d", attempt, status, want)
+		}
+	}
+
+	// every attempt from another client IP
+	serverConfig.BindingMaxAttemptsPerIP = 1 << 20
+	failedCount, err := countBindingAttempt(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("could not count binding attempts: %s", err.Error())
+	}
+	serverConfig.BindingMaxAttemptsTotal = failedCount + testAttemptLimit
+	for attempt := 0; attempt < testAttemptLimit+3; attempt++ {
+		var want = http.StatusConflict
+		if attempt >= testAttemptLimit {
+			want = http.StatusTooManyRequests
+		}
+		if status := bind(fmt.Sprintf("10.%d.%d.%d", run[10], run[11], 10+attempt), 100+attempt); status != want {
+			t.Errorf("attempt %d from rotating IPs: got status %d, want %d", attempt, status, want)
+		}
+	}
+}
+
+// student data is served to bound relatives only (callers without relative_wxid need a token, none in test router)
+func TestStudentAccessCheck(t *testing.T) {
+	testDBSetup(t)
+	student, relatives := testStudentRelatives(t, 2)
+	router := testRouter(map[string]gin.HandlerFunc{
+		"/balance":  creditBalanceHandler,
+		"/progress": studentProgressHandler,
+		"/media":    studentMediaQueryHandler,
+	})
+	var reference = StudentRelativeRef{StudentPID: student.PID, RelativePID: relatives[0].PID, Relationship: "Mother", Permission: RelativePermissionView}
+	if _, err := createStudentRelativeRef(context.Background(), &reference); err != nil {
+		t.Fatalf("could not bind relative: %s", err.Error())
+	}
+
+	var cases = []struct {
+		name         string
+		relativeWXID string
+		want         int
+	}{
+		{"bound relative", relatives[0].RelativeWXID, http.StatusOK},
+		{"unbound relative", relatives[1].RelativeWXID, http.StatusForbidden},
+		{"unknown relative", "test_unknown_wxid_" + student.PID.Hex(), http.StatusForbidden},
+		{"no relative nor token", "", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		var requests = map[string]interface{}{
+			"/balance":  LessonCreditReq{StudentPID: student.PID, RelativeWXID: c.relativeWXID},
+			"/progress": StudentProgressReq{StudentPID: student.PID, RelativeWXID: c.relativeWXID},
+			"/media":    StudentMediaQueryReq{StudentPID: student.PID, EndTS: time.Now().Unix(), RelativeWXID: c.relativeWXID},
+		}
+		for apiURL, request := range requests {
+			if status, _ := testPost(router, apiURL, request); status != c.want {
+				t.Errorf("%s %s: got status %d, want %d", c.name, apiURL, status, c.want)
+			}
+		}
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
+	"time"
 )
 
 func teacherLoginHandler(ctx *gin.Context) {
@@ -26,15 +28,301 @@ func teacherLoginHandler(ctx *gin.Context) {
 
 	// find teacher by login information (teacher uid and password)
 	var teacherFound *Teacher
-	teacherFound, err = findTeacherByUID(teacher.TeacherUID)
+	teacherFound, err = findTeacherByUID(ctx.Request.Context(), teacher.TeacherUID)
 	if err != nil {
 		response.Status = http.StatusConflict
 		response.Message = err.Error()
 	} else if teacherFound.TeacherKey != teacher.TeacherKey {
 		response.Status = http.StatusConflict
 		response.Message = fmt.Sprintf("[%s] - teacher key not matched (UID=%s)", serverErrorMessages[seResourceNotMatched], teacher.TeacherUID)
+	} else if authToken, tokenExpire, tokenErr := teacherTokenIssue(teacherFound); tokenErr != nil {
+		response.Status = http.StatusConflict
+		response.Message = tokenErr.Error()
 	} else {
-		response.Payload = teacherFound
+		response.Payload = TeacherLoginResp{Teacher: teacherFound, AuthToken: authToken, TokenExpire: tokenExpire}
+	}
+	return
+}
+
+// create class session and course records for all enrolled students in one request
+func teacherSessionCreateHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var sessionReq ClassSessionCreateReq
+	var err error
+	if err = json.Unmarshal(params.Data, &sessionReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	var sessionDetail *ClassSessionDetail
+	sessionDetail, err = createClassSession(ctx.Request.Context(), &sessionReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = sessionDetail
+	return
+}
+
+// mark students of a class session present/absent/makeup
+func teacherSessionAttendanceHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var attendanceReq ClassSessionAttendanceReq
+	var err error
+	if err = json.Unmarshal(params.Data, &attendanceReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	var updateCnt int
+	updateCnt, err = updateClassSessionAttendance(ctx.Request.Context(), &attendanceReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = updateCnt
+	return
+}
+
+// get class session with its course records and session media
+func teacherSessionDetailHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var attendanceReq ClassSessionAttendanceReq
+	var err error
+	if err = json.Unmarshal(params.Data, &attendanceReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+	if attendanceReq.SessionPID.IsZero() {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - Please specified class session PID", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+
+	var sessionDetail ClassSessionDetail
+	sessions, err := findClassSession(ctx.Request.Context(), attendanceReq.SessionPID, primitive.NilObjectID)
+	if err != nil || len(sessions) == 0 {
+		response.Status = http.StatusConflict
+		response.Message = fmt.Sprintf("[%s] - No class session found with PID %s", serverErrorMessages[seResourceNotFound], attendanceReq.SessionPID.Hex())
+		return
+	}
+	sessionDetail.Session = sessions[0]
+	sessionDetail.Records, err = findCourseRecordBySessionPID(ctx.Request.Context(), sessionDetail.Session.PID)
+	if err == nil {
+		sessionDetail.Media, err = findCloudMediaBySessionPID(ctx.Request.Context(), []primitive.ObjectID{sessionDetail.Session.PID})
+	}
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = &sessionDetail
+	return
+}
+
+// approve or reject a pending leave request (logged in teacher of the course only, super-admin decides for teacher_pid)
+func teacherLeaveDecideHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var leaveReq LeaveRequestReq
+	var err error
+	if err = json.Unmarshal(params.Data, &leaveReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	// deciding teacher is the one of the auth token, a different teacher_pid is refused
+	scope := tenantScopeFromContext(ctx.Request.Context())
+	if scope == nil || (!scope.SuperAdmin && scope.TeacherPID.IsZero()) {
+		response.Status = http.StatusForbidden
+		response.Message = fmt.Sprintf("[%s] - Leave requests are decided by a logged in teacher (%s header)", serverErrorMessages[seInputParamNotValid],
+			ginHeaderAuthorization)
+		return
+	}
+	if !scope.SuperAdmin {
+		if !leaveReq.TeacherPID.IsZero() && leaveReq.TeacherPID != scope.TeacherPID {
+			response.Status = http.StatusForbidden
+			response.Message = fmt.Sprintf("[%s] - Teacher (PID %s) may not decide for teacher (PID %s)", serverErrorMessages[seResourceNotMatched],
+				scope.TeacherPID.Hex(), leaveReq.TeacherPID.Hex())
+			return
+		}
+		leaveReq.TeacherPID = scope.TeacherPID
+	}
+
+	var leaveRequest *LeaveRequest
+	leaveRequest, err = decideLeaveRequest(ctx.Request.Context(), &leaveReq)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = leaveRequest
+	return
+}
+
+// one day of a teacher: schedule occurrences, held class sessions and leave requests of taught/assisted courses
+func teacherDailyHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var dailyReq TeacherDailyReq
+	var err error
+	if err = json.Unmarshal(params.Data, &dailyReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+	if dailyReq.TeacherPID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specify teacher_pid", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+	if dailyReq.Date == "" {
+		dailyReq.Date = time.Now().Format(scheduleDateLayout)
+	}
+	day, err := time.ParseInLocation(scheduleDateLayout, dailyReq.Date, time.Local)
+	if err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Date must be YYYY-MM-DD (\"%s\")", serverErrorMessages[seInputSchemaNotValid], dailyReq.Date)
+		return
+	}
+	var nextDay = day.AddDate(0, 0, 1)
+
+	var dailyView = TeacherDailyView{
+		Date:          dailyReq.Date,
+		Occurrences:   []*ScheduleOccurrence{},
+		Sessions:      []*ClassSession{},
+		LeaveRequests: []*LeaveRequest{},
+	}
+	courses, err := findCourseByStaffPID(ctx.Request.Context(), dailyReq.TeacherPID)
+	if err == nil && len(courses) > 0 {
+		var coursePIDs = []primitive.ObjectID{}
+		for i := range courses {
+			coursePIDs = append(coursePIDs, courses[i].PID)
+		}
+		dailyView.Occurrences, err = courseScheduleUpcoming(ctx.Request.Context(), courses, day, nextDay)
+		if err == nil {
+			dailyView.Occurrences = scheduleOwnerOccurrences(dailyView.Occurrences, ScheduleOwnerTeacher, dailyReq.TeacherPID)
+			dailyView.Sessions, err = findClassSessionInRange(ctx.Request.Context(), coursePIDs, day.Unix(), nextDay.Unix())
+		}
+		if err == nil {
+			dailyView.LeaveRequests, err = findLeaveRequestInRange(ctx.Request.Context(), coursePIDs, "", day.Unix(), nextDay.Unix())
+		}
+	}
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = dailyView
+	return
+}
+
+// near-duplicate media groups of a course record or class session (exact duplicates of earlier media and similar images)
+func teacherMediaDuplicatesHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var duplicateReq CloudMediaDuplicateReq
+	var err error
+	if err = json.Unmarshal(params.Data, &duplicateReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+
+	var cloudMediaSlice []*CloudMedia
+	switch {
+	case !duplicateReq.CourseRecordPID.IsZero():
+		cloudMediaSlice, err = findCloudMediaByRecordPID(ctx.Request.Context(), duplicateReq.CourseRecordPID)
+	case !duplicateReq.SessionPID.IsZero():
+		cloudMediaSlice, err = findCloudMediaBySessionPID(ctx.Request.Context(), []primitive.ObjectID{duplicateReq.SessionPID})
+	default:
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specify course_record_pid or session_pid", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
+	}
+	response.Payload = cloudMediaDuplicateGroups(cloudMediaSlice)
+	return
+}
+
+// collapse near-duplicate media into one kept media (collapsed media is hidden from relatives)
+func teacherMediaCollapseHandler(ctx *gin.Context) {
+	params := ginContextRequestParameter(ctx)
+	response := GinResponse{
+		Status: http.StatusOK,
+	}
+	defer func() {
+		ginContextProcessResponse(ctx, &response)
+	}()
+
+	var collapseReq CloudMediaCollapseReq
+	var err error
+	if err = json.Unmarshal(params.Data, &collapseReq); err != nil {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - %s", serverErrorMessages[seInputJSONNotValid], err.Error())
+		return
+	}
+	if collapseReq.KeepPID.IsZero() {
+		response.Status = http.StatusBadRequest
+		response.Message = fmt.Sprintf("[%s] - Please specify keep_pid", serverErrorMessages[seInputJSONNotValid])
+		return
+	}
+
+	collapsed, err := collapseCloudMedia(ctx.Request.Context(), collapseReq.KeepPID, collapseReq.CollapsePIDs)
+	if err != nil {
+		response.Status = http.StatusConflict
+		response.Message = err.Error()
+		return
 	}
+	response.Payload = collapsed
 	return
 }